@@ -1,277 +1,513 @@
 package chat
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
-	"net"
-	"os"
+	"math/rand/v2"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 )
 
-// Temporary variables, should be in some sort of config package
+var quiet atomic.Bool // Chat messages aren't printed to stdout, changed from other goroutines (like the console)
+
+const DefaultServer = "irc.chat.twitch.tv:6697"                  // Twitch IRC server address (TLS)
+const DefaultPlaintextServer = "irc.chat.twitch.tv:6667"         // Twitch IRC server address (plaintext)
+const DefaultWebSocketServer = "wss://irc-ws.chat.twitch.tv:443" // Twitch IRC server address (WebSocket)
+const reconnectMinDelay = time.Second                            // Delay before first reconnect attempt
+const reconnectMaxDelay = time.Minute * 2                        // Maximum delay between reconnect attempts
+const pingInterval = time.Minute                                 // Send PING when nothing was received for that long
+const pongTimeout = time.Second * 15                             // Reconnect when nothing was received for that long after sending PING
+const pingCheckInterval = time.Second * 5                        // How often the connection is checked
+const messageMaxReceiveLength = 65536                            // Maximum length of received message, tags can take up to 8192 bytes
+const messageSendMaxLength = 500                                 // Maximum number of characters (not bytes) in one message, Twitch limit
+var messageEnd = []byte("\r\n")                                  // Byte array describing chat message end
+var errReconnectRequested = errors.New("server requested reconnect")
+
+// Returns true if chat messages are printed to stdout (default).
+func PrintChatMessages() bool {
+	return !quiet.Load()
+}
+
+// Turns printing of chat messages to stdout on or off, safe to call while chat bots are running.
+func SetPrintChatMessages(print bool) {
+	quiet.Store(!print)
+}
+
+// Chat bot configuration.
+type Config struct {
+	Pass     func() string // Returns OAuth token, without "oauth:" prefix. Called on every connection, so reconnects use refreshed token
+	Nick     string        // Chat bot nick
+	Server   string        // IRC server address, DefaultServer (or DefaultPlaintextServer when Plaintext is set) if empty. Addresses starting with "ws://" or "wss://" use WebSocket connection
+	Channels []string      // Channels to join after connecting
+
+	TLSConfig *tls.Config // TLS configuration used when connecting (also for "wss://" addresses), default configuration if nil
+	Plaintext bool        // Connect without TLS? The OAuth token is sent in clear text! Not used for WebSocket connections
 
-var PASS string = "" // OAuth token
-var NICK string = "AbevBot"                        // Chat bot nick
-var CHANNEL_NAME string = "AbevBot"                // Channel name
+	Dial func(ctx context.Context) (Transport, error) // Custom connection function used instead of connecting to Server, like replaying chat log
+
+	Clock func() time.Time // Returns current time, time.Now if nil. Used by command cooldowns and periodic messages
+
+	EmoteProviders []EmoteProvider // Third-party emote sets used to find emotes in chat messages, besides Twitch emotes
+
+	WhisperAPI WhisperAPI // Twitch API used to send whispers, sending whispers is disabled if nil
+	UserID     string     // Chat bot user ID, required for sending whispers
+}
 
-var PrintChatMessages = true // Should chat messages be printed to stdout?
+// Chat bot client.
+// It connects to the IRC server, joins configured channels and processes received chat messages.
+type Client struct {
+	config              Config
+	channels            []string // Joined channels, lower case without '#'
+	channelsMutex       sync.Mutex
+	sendQueue           *messageQueue // Queue of chat messages to send to chat
+	whispers            *whisperQueue // Queue of whispers to send through Twitch API
+	isStarted           atomic.Bool   // Is the chat bot started?
+	isConnected         atomic.Bool   // Is the chat bot connected?
+	isAuthenticated     atomic.Bool   // Did the server accept the login (welcome message received)?
+	lastMessageReceived atomic.Int64  // Time of last received message, in Unix nanoseconds
+	reconnects          atomic.Int64  // Amount of reconnects
+	reconnect           chan struct{} // Signaled when the server asks to reconnect
+
+	runMutex sync.Mutex
+	cancel   context.CancelFunc // Stops the chat bot started with Start
+	done     chan struct{}      // Closed when the chat bot started with Start stops
+
+	commands      map[string]*Command // Registered commands, key is lower case command name or alias
+	commandsMutex sync.Mutex
+
+	eventHandlers       map[int]EventHandler // Subscribed event handlers, key is subscription ID
+	eventHandlersNextID int                  // ID of next subscription
+	eventHandlersMutex  sync.Mutex
+
+	periodic      map[string]*periodicState // Periodic messages, key is channel name
+	live          map[string]bool           // Is the channel live? Key is channel name
+	periodicMutex sync.Mutex
+}
 
-const messageSendCooldown = time.Millisecond * 200 // Minimum 200ms between messages sent
-const messageSendMaxLength = 460                   // Maximum number of characters in one message. 500 characters Twitch limit, -40 characters as a buffer
-var messageStart = []byte("@badge")                // Byte array describing chat message start
-var messageEnd = []byte("\r\n")                    // Byte array describing chat message end
-var sendQueue messageQueue                         // Queue of chat messages to send to chat
-var isStarted bool                                 // Is the chat bot started?
-var chatMessagesSinceLastPeriodicMessage uint16    // Amount of chat messages since last periodic message
+// Creates new chat bot client with provided configuration.
+func NewClient(config Config) *Client {
+	if len(config.Server) == 0 {
+		if config.Plaintext {
+			config.Server = DefaultPlaintextServer
+		} else {
+			config.Server = DefaultServer
+		}
+	}
+	var c = &Client{
+		config:        config,
+		sendQueue:     newMessageQueue(),
+		whispers:      newWhisperQueue(),
+		reconnect:     make(chan struct{}, 1),
+		commands:      make(map[string]*Command),
+		eventHandlers: make(map[int]EventHandler),
+		periodic:      make(map[string]*periodicState),
+		live:          make(map[string]bool),
+	}
+	for _, channel := range config.Channels {
+		channel = normalizeChannel(channel)
+		if len(channel) > 0 && !slices.Contains(c.channels, channel) {
+			c.channels = append(c.channels, channel)
+		}
+	}
+	return c
+}
 
-// Starts the chat bot.
-func Start() {
-	if isStarted {
+// Starts the chat bot in the background. It runs until Stop is called.
+func (c *Client) Start() {
+	c.runMutex.Lock()
+	defer c.runMutex.Unlock()
+	if c.cancel != nil {
 		return
 	}
-	isStarted = true
 
-	slog.Info("Chat bot starting")
-	go update()
+	var ctx, cancel = context.WithCancel(context.Background())
+	var done = make(chan struct{})
+	c.cancel = cancel
+	c.done = done
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
 }
 
-// Main update.
-func update() {
-	var sleepErrorDur = time.Second * 5
-	var receiveBuffer []byte = make([]byte, 16384) // Max IRC message is 4096 bytes? let's allocate 4 times that, 2 times max message length wasn't enaugh for really fast chats
-	var remainingData []byte = make([]byte, 16384)
-	var remainingDataLen int
-	var zeroBytesReceivedCounter uint8
-	var header, body, msg string
-	var messageMetadata messageMetadata
-	var lastMessageSent time.Time = time.Now()
+// Stops the chat bot started with Start. Waits until the connection is closed.
+func (c *Client) Stop() {
+	c.runMutex.Lock()
+	defer c.runMutex.Unlock()
+	if c.cancel == nil {
+		return
+	}
+
+	c.cancel()
+	<-c.done
+	c.cancel = nil
+	c.done = nil
+}
+
+// Runs the chat bot until the context is canceled.
+// It connects to the server, processes received messages and sends queued messages, reconnecting on errors.
+func (c *Client) Run(ctx context.Context) {
+	var delay = reconnectMinDelay
+	var attempt int
+
+	c.isStarted.Store(true)
+	defer c.isStarted.Store(false)
+	slog.Info("Chat bot starting")
+	go c.runPeriodicMessages(ctx)
+	go c.runWhispers(ctx)
 
 	for {
 		// Try to connect
-		slog.Info("Chat bot connecting...")
-		var conn, err = net.Dial("tcp", "irc.chat.twitch.tv:6667")
-		if err != nil {
+		attempt++
+		slog.Info("Chat bot connecting...", "Attempt", attempt)
+		c.emitEvent(&ConnectionEvent{State: ConnectionConnecting, Attempt: attempt})
+		var conn, err = c.dial(ctx)
+		if err == nil {
+			slog.Info("Chat bot connected!")
+			err = c.handleConnection(ctx, conn)
+		}
+		if c.isAuthenticated.Swap(false) {
+			// Connection was working, start counting from the beginning
+			delay = reconnectMinDelay
+			attempt = 0
+		}
+		if err != nil && !errors.Is(err, errReconnectRequested) {
 			slog.Error("Chat bot error.", "Err", err)
-			time.Sleep(sleepErrorDur)
-			continue
 		}
+		c.emitEvent(&ConnectionEvent{State: ConnectionDisconnected, Attempt: attempt, Err: err})
 
-		// Connected! Send authentication data
-		slog.Info("Chat bot connected!")
-		{
-			var builder strings.Builder
-			builder.WriteString(fmt.Sprintf("PASS oauth:%s\r\n", PASS))
-			builder.WriteString(fmt.Sprintf("NICK %s\r\n", NICK))
-			builder.WriteString(fmt.Sprintf("JOIN #%s,#%s\r\n", strings.ToLower(CHANNEL_NAME), strings.ToLower(CHANNEL_NAME)))
-			builder.WriteString("CAP REQ :twitch.tv/commands twitch.tv/tags\r\n")
-			_, err = conn.Write([]byte(builder.String()))
-			if err != nil {
-				slog.Error("Chat bot error.", "Err", err)
-				continue
-			}
-			zeroBytesReceivedCounter = 0
+		if ctx.Err() != nil {
+			slog.Info("Chat bot stopped")
+			return
 		}
+		c.reconnects.Add(1)
 
-		// Update loop
-		for {
-			// Receive messages
-			conn.SetReadDeadline(time.Now().Add(time.Millisecond * 10)) // This timeout slows down entire loop, so no additional sleep is necessary
-			var n, err = conn.Read(receiveBuffer)
-			if err != nil {
-				if errors.Is(err, os.ErrDeadlineExceeded) {
-					// Read deadline exceeded, nothing to do
-				} else {
-					slog.Error("Chat bot error.", "Err", err)
-					break
-				}
-			} else if n == 0 {
-				zeroBytesReceivedCounter++
-				if zeroBytesReceivedCounter > 5 {
-					slog.Warn("Chat bot received 0 bytes multiple times, reconnecting!")
-					break
-				}
-			} else {
-				// Check if received data starts with message start
-				zeroBytesReceivedCounter = 0
-				var newMessage = true
-				for i, v := range messageStart {
-					if receiveBuffer[i] != v {
-						newMessage = false
-						break
-					}
-				}
-
-				// Look through received data and look for message end
-				var start, end, endIdx int
-				var endFound = false
-				for i := 0; i < n; i++ {
-					if receiveBuffer[i] == messageEnd[endIdx] {
-						endIdx++
-						if endIdx >= len(messageEnd) {
-							endFound = true
-						}
-					} else {
-						endIdx = 0
-					}
-
-					if endFound {
-						i++
-						endFound = false
-						endIdx = 0
-						end = i
-						if end-start <= 2 {
-							// Just an empty "\r\n", skip
-						} else if newMessage {
-							// Is there left over data? Just try to parse it?
-							if remainingDataLen > 0 {
-								header, body, msg, messageMetadata = parseMessage(remainingData[:remainingDataLen])
-								processMessage(header, body, msg, messageMetadata)
-								remainingDataLen = 0
-							}
-
-							// Parse new message
-							header, body, msg, messageMetadata = parseMessage(receiveBuffer[start:end])
-							processMessage(header, body, msg, messageMetadata)
-						} else {
-							// Append start of a message to left over data and parse it
-							for k := 0; k < end; k++ {
-								remainingData[remainingDataLen+k] = receiveBuffer[k]
-							}
-							header, body, msg, messageMetadata = parseMessage(remainingData[:(remainingDataLen + end)])
-							processMessage(header, body, msg, messageMetadata)
-							remainingDataLen = 0
-						}
-
-						newMessage = true // After parsing at least 1 message, parse the rest like new messages
-						start = end
-					}
-				}
-
-				if end < n {
-					// Data is missing message end
-					remainingDataLen = n - end
-					for i := 0; i < remainingDataLen; i++ {
-						remainingData[i] = receiveBuffer[end+i]
-					}
-				}
-			}
+		// Server asked to reconnect, do it right away. Otherwise wait with exponential backoff
+		var wait time.Duration
+		if !errors.Is(err, errReconnectRequested) {
+			wait = delay/2 + rand.N(delay/2+1) // Random jitter, so multiple bots don't reconnect at once
+			delay = min(delay*2, reconnectMaxDelay)
+		}
+		slog.Info("Chat bot reconnecting", "Delay", wait)
+		select {
+		case <-ctx.Done():
+			slog.Info("Chat bot stopped")
+			return
+		case <-time.After(wait):
+		}
+	}
+}
 
-			// Send messages
-			if sendQueue.PendingMessages && time.Since(lastMessageSent) > messageSendCooldown {
-				var msg, err = sendQueue.pop()
-				if err != nil {
-					slog.Error("Chat bot error, when sending a message.", "Err", err)
-				} else {
-					conn.Write([]byte(msg))
-					lastMessageSent = time.Now()
-				}
-			}
+// Authenticates the connection and runs reader, writer and keepalive goroutines until connection error,
+// reconnect request or context cancellation.
+func (c *Client) handleConnection(ctx context.Context, conn Transport) error {
+	defer conn.Close()
+
+	// Send authentication data
+	{
+		var pass string
+		if c.config.Pass != nil {
+			pass = c.config.Pass()
+		}
+		var builder strings.Builder
+		builder.WriteString(fmt.Sprintf("PASS oauth:%s\r\n", pass))
+		builder.WriteString(fmt.Sprintf("NICK %s\r\n", strings.ToLower(c.config.Nick)))
+		builder.WriteString("CAP REQ :twitch.tv/commands twitch.tv/tags\r\n")
+		var channels = c.Channels()
+		if len(channels) > 0 {
+			builder.WriteString(fmt.Sprintf("JOIN #%s\r\n", strings.Join(channels, ",#")))
+		}
+		var _, err = conn.Write([]byte(builder.String()))
+		if err != nil {
+			return err
+		}
+	}
+	c.sendQueue.clearHigh()
+	select {
+	case <-c.reconnect:
+		// Reconnect request from previous connection
+	default:
+	}
+	c.lastMessageReceived.Store(time.Now().UnixNano())
+	c.isConnected.Store(true)
+	defer c.isConnected.Store(false)
+
+	var connCtx, cancel = context.WithCancel(ctx)
+	var errs = make(chan error, 3)
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		errs <- c.readMessages(conn)
+	}()
+	go func() {
+		defer wg.Done()
+		errs <- c.writeMessages(connCtx, conn)
+	}()
+	go func() {
+		defer wg.Done()
+		errs <- c.keepAlive(connCtx)
+	}()
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errs:
+	case <-c.reconnect:
+		err = errReconnectRequested
+	}
+
+	// Closing the connection unblocks the reader
+	cancel()
+	conn.Close()
+	wg.Wait()
+	return err
+}
+
+// Sends PING when nothing was received for some time. Returns error when the server doesn't respond.
+func (c *Client) keepAlive(ctx context.Context) error {
+	var ticker = time.NewTicker(pingCheckInterval)
+	defer ticker.Stop()
+	var pingSent bool
 
-			// Periodic messages
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
 		}
 
-		conn.Close()
-		time.Sleep(sleepErrorDur)
+		var idle = time.Since(time.Unix(0, c.lastMessageReceived.Load()))
+		if idle < pingInterval {
+			pingSent = false
+		} else if idle >= pingInterval+pongTimeout {
+			return fmt.Errorf("connection timed out, nothing received for %s", idle.Round(time.Second))
+		} else if !pingSent {
+			c.sendQueue.pushHigh("PING :tmi.twitch.tv\r\n")
+			pingSent = true
+		}
 	}
 }
 
-// Parses chat message, returning header, body, whole message and metadata parts.
-func parseMessage(data []byte) (header, body, msg string, metadata messageMetadata) {
-	msg = string(data)
-	var temp, temp2, temp3 int
+// Returns current time from configured clock.
+func (c *Client) now() time.Time {
+	if c.config.Clock != nil {
+		return c.config.Clock()
+	}
+	return time.Now()
+}
 
-	if strings.HasPrefix(msg, "PING") {
-		header = msg
-		return
+// Requests reconnecting to the server.
+func (c *Client) requestReconnect() {
+	select {
+	case c.reconnect <- struct{}{}:
+	default:
+		// Reconnect is already requested
 	}
+}
 
-	// Find header <-> body "separator"
-	temp = strings.Index(msg, "tmi.twitch.tv")
-	if temp < 0 {
-		slog.Warn("Chat message not parsed correctly.\n", "Msg", msg)
-		return
+// Returns amount of reconnects since the chat bot was created.
+func (c *Client) Reconnects() int64 {
+	return c.reconnects.Load()
+}
+
+// Returns true if the chat bot is connected and the server accepted the login.
+func (c *Client) IsConnected() bool {
+	return c.isConnected.Load() && c.isAuthenticated.Load()
+}
+
+// Returns time when the last message was received from the server, zero time if nothing was received yet.
+func (c *Client) LastMessageReceived() time.Time {
+	var t = c.lastMessageReceived.Load()
+	if t == 0 {
+		return time.Time{}
 	}
+	return time.Unix(0, t)
+}
 
-	// Get message header
-	header = msg[:temp]
-	temp += 14 // 14 == "tmi.twitch.tv ".len()
-
-	// Get message type
-	temp2 = strings.Index(msg[temp:], " ")
-	if temp2 < 0 {
-		temp2 = len(msg) - temp
-	}
-	metadata.MessageType = msg[temp:(temp + temp2)]
-	temp2 += 1 + temp
-
-	// Get message body
-	temp = strings.Index(msg[temp2:], ":")
-	if temp > 0 {
-		body = msg[(temp + 1 + temp2):]
-	}
-	body = strings.TrimSuffix(body, "\r\n")
-	body = strings.TrimSuffix(body, "\r")
-	body = strings.TrimSuffix(body, "\n")
-
-	// Get header data
-	temp = 0  // start
-	temp2 = 0 // end
-	temp3 = 0 // '=' index
-	for i, v := range header {
-		if v == ';' || v == ' ' {
-			temp2 = i
-		} else if v == '=' {
-			temp3 = i + 1
+// Reads received messages line by line, parsing and processing them. Returns when the connection is closed.
+func (c *Client) readMessages(conn Transport) error {
+	var scanner = bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 16384), messageMaxReceiveLength)
+	scanner.Split(scanCompleteLines)
+	for scanner.Scan() {
+		var data = scanner.Bytes()
+		if len(bytes.TrimSpace(data)) == 0 {
+			continue // Just an empty "\r\n", skip
 		}
+		c.lastMessageReceived.Store(time.Now().UnixNano())
+		var msg, messageMetadata = parseMessage(data)
+		c.processMessage(msg, messageMetadata)
+	}
 
-		if temp2 > temp {
-			var s = header[temp3:temp2]
-			switch header[temp:(temp3 - 1)] {
-			case "id":
-				metadata.MessageID = s
-			case "badges":
-				if strings.HasPrefix(s, "broadcaster") {
-					metadata.Badge = "STR"
-				} else if strings.HasPrefix(s, "moderator") {
-					metadata.Badge = "MOD"
-				} else if strings.HasPrefix(s, "subscriber") {
-					metadata.Badge = "SUB"
-				} else if strings.HasPrefix(s, "vip") {
-					metadata.Badge = "VIP"
-				}
-			case "display-name":
-				metadata.UserName = s
-			case "user-id":
-				var num, err = strconv.ParseInt(s, 10, 64)
-				if err == nil {
-					metadata.UserID = num
-				}
-			case "custom-reward-id":
-				metadata.CustomRewardID = s
-			case "bits":
-				metadata.Bits = s
-			case "@msg-id":
-				fallthrough
-			case "msg-id":
-				metadata.MsgID = s
-			case "msg-param-recipient-display-name":
-				metadata.Receipent = s
+	var err = scanner.Err()
+	if err == nil {
+		err = io.EOF
+	}
+	return err
+}
+
+// Split function for bufio.Scanner returning lines without line endings.
+// Unlike bufio.ScanLines, incomplete line at the end of data (connection closed in the middle of a message) is dropped.
+func scanCompleteLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, bytes.TrimSuffix(data[:i], []byte{'\r'}), nil
+	}
+	if atEOF {
+		return len(data), nil, nil
+	}
+	return 0, nil, nil
+}
+
+// Sends queued messages, respecting the rate limits. Returns on write error or context cancellation.
+func (c *Client) writeMessages(ctx context.Context, conn Transport) error {
+	for {
+		var msg, ok, wait = c.sendQueue.pop(time.Now())
+		if ok {
+			var _, err = conn.Write([]byte(msg.line))
+			if err != nil {
+				c.sendQueue.requeue(msg)
+				return err
 			}
-			temp = temp2 + 1
-			temp3 = temp
+			continue
+		}
+
+		// Wait for new messages or until rate limit allows to send next message
+		var timeout <-chan time.Time
+		if wait > 0 {
+			timeout = time.After(wait)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.sendQueue.notify:
+		case <-timeout:
+		}
+	}
+}
+
+// Returns list of joined channels.
+func (c *Client) Channels() []string {
+	c.channelsMutex.Lock()
+	defer c.channelsMutex.Unlock()
+	return slices.Clone(c.channels)
+}
+
+// Joins the channel. The channel is joined again after reconnecting.
+func (c *Client) Join(channel string) {
+	channel = normalizeChannel(channel)
+	if len(channel) == 0 {
+		return
+	}
+
+	c.channelsMutex.Lock()
+	if slices.Contains(c.channels, channel) {
+		c.channelsMutex.Unlock()
+		return
+	}
+	c.channels = append(c.channels, channel)
+	c.channelsMutex.Unlock()
+
+	if c.isConnected.Load() {
+		c.sendQueue.pushHigh(fmt.Sprintf("JOIN #%s\r\n", channel))
+	}
+}
+
+// Leaves the channel.
+func (c *Client) Part(channel string) {
+	channel = normalizeChannel(channel)
+
+	c.channelsMutex.Lock()
+	var idx = slices.Index(c.channels, channel)
+	if idx < 0 {
+		c.channelsMutex.Unlock()
+		return
+	}
+	c.channels = slices.Delete(c.channels, idx, idx+1)
+	c.channelsMutex.Unlock()
+
+	if c.isConnected.Load() {
+		c.sendQueue.pushHigh(fmt.Sprintf("PART #%s\r\n", channel))
+	}
+}
+
+// Converts channel name to lower case and removes leading '#'.
+func normalizeChannel(channel string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(channel), "#"))
+}
+
+// Parses chat message, returning parsed IRC message and metadata parts.
+func parseMessage(data []byte) (msg Message, metadata MessageMetadata) {
+	var err error
+	msg, err = ParseMessage(string(data))
+	if err != nil {
+		slog.Warn("Chat message not parsed correctly.", "Msg", msg.Raw, "Err", err)
+	}
+
+	metadata.MessageType = msg.Command
+	metadata.Channel = msg.Channel()
+	metadata.Tags = msg.Tags
+	metadata.MessageID = msg.Tags["id"]
+	if len(metadata.MessageID) == 0 {
+		metadata.MessageID = msg.Tags["message-id"] // Whispers
+	}
+	metadata.UserName = msg.Tags["display-name"]
+	metadata.CustomRewardID = msg.Tags["custom-reward-id"]
+	metadata.Bits = msg.Tags["bits"]
+	metadata.MsgID = msg.Tags["msg-id"]
+	metadata.Receipent = msg.Tags["msg-param-recipient-display-name"]
+	if num, err := strconv.ParseInt(msg.Tags["user-id"], 10, 64); err == nil {
+		metadata.UserID = num
+	}
+
+	// Badge of the chatter with the highest permission level
+	for _, badge := range msg.Tags.Badges() {
+		var b string
+		switch badge.Name {
+		case "broadcaster":
+			b = "STR"
+		case "moderator":
+			b = "MOD"
+		case "vip":
+			b = "VIP"
+		case "subscriber", "founder":
+			b = "SUB"
+		default:
+			continue
+		}
+		if PermissionFromBadge(b) > PermissionFromBadge(metadata.Badge) {
+			metadata.Badge = b
 		}
 	}
 	return
 }
 
 // Processes the parsed chat message.
-func processMessage(header, body, msg string, metadata messageMetadata) {
-	if strings.HasPrefix(header, "PING") {
-		sendQueue.push("PONG :tmi.twitch.tv\r\n")
+func (c *Client) processMessage(msg Message, metadata MessageMetadata) {
+	var body = msg.Trailing
+	if (msg.Command == "PRIVMSG" || msg.Command == "USERNOTICE") && len(body) > 0 {
+		metadata.Fragments = ParseFragments(body, msg.Tags, metadata.Channel, c.config.EmoteProviders...)
+	}
+	c.emitEvent(&MessageEvent{
+		Channel:  metadata.Channel,
+		Time:     c.now(),
+		Message:  msg,
+		Metadata: metadata,
+	})
+
+	if msg.Command == "PING" {
+		c.sendQueue.pushHigh(fmt.Sprintf("PONG :%s\r\n", body))
 		return
 	}
 
@@ -282,202 +518,285 @@ func processMessage(header, body, msg string, metadata messageMetadata) {
 				"ChatterName", metadata.UserName,
 				"RewardID", metadata.CustomRewardID,
 				"Message", body)
+			c.emitEvent(&RewardRedeemEvent{
+				Channel:   metadata.Channel,
+				UserID:    metadata.UserID,
+				UserName:  metadata.UserName,
+				RewardID:  metadata.CustomRewardID,
+				Message:   body,
+				MessageID: metadata.MessageID,
+			})
 		} else if len(metadata.Bits) > 0 {
 			slog.Info("Chatter cheered with bits!",
 				"ChatterName", metadata.UserName,
 				"Bits", metadata.Bits,
 				"Message", body)
+			c.emitEvent(&CheerEvent{
+				Channel:   metadata.Channel,
+				UserID:    metadata.UserID,
+				UserName:  metadata.UserName,
+				Bits:      metadata.Tags.Int("bits"),
+				Message:   body,
+				MessageID: metadata.MessageID,
+			})
 		} else {
-			chatMessagesSinceLastPeriodicMessage++
-			if PrintChatMessages {
+			c.countPeriodicChatMessage(metadata.Channel)
+			if PrintChatMessages() {
 				fmt.Printf("%3s %20s: %s\n", metadata.Badge, metadata.UserName, body)
 			}
-			checkForChatCommands(body, metadata)
+			c.checkForChatCommands(body, metadata)
 		}
 
 	case "USERNOTICE":
 		switch metadata.MsgID {
-		case "sub":
-			slog.Info("Subscription", "ChatterName", metadata.UserName, "Message", body)
-		case "resub":
-			slog.Info("Resubscription", "ChatterName", metadata.UserName, "Message", body)
+		case "sub", "resub", "primepaidupgrade", "giftpaidupgrade", "communitypayforward":
+			switch metadata.MsgID {
+			case "sub":
+				slog.Info("Subscription", "ChatterName", metadata.UserName, "Message", body)
+			case "resub":
+				slog.Info("Resubscription", "ChatterName", metadata.UserName, "Message", body)
+			case "primepaidupgrade":
+				slog.Info("Subscription prime upgrade", "ChatterName", metadata.UserName, "Message", body)
+			case "giftpaidupgrade":
+				slog.Info("Subscription gift upgrade", "ChatterName", metadata.UserName, "Message", body)
+			case "communitypayforward":
+				slog.Info("Subscription gifted is payed forward", "ChatterName", metadata.UserName, "Message", body)
+			}
+			c.emitEvent(&SubEvent{
+				Channel:  metadata.Channel,
+				MsgID:    metadata.MsgID,
+				UserID:   metadata.UserID,
+				UserName: metadata.UserName,
+				Tier:     metadata.Tags["msg-param-sub-plan"],
+				Months:   metadata.Tags.Int("msg-param-cumulative-months"),
+				Streak:   metadata.Tags.Int("msg-param-streak-months"),
+				Message:  body,
+			})
 		case "subgift":
 			slog.Info("Subscription gift", "ChatterName", metadata.UserName, "Receipent", metadata.Receipent, "Message", body)
+			c.emitEvent(&GiftSubEvent{
+				Channel:   metadata.Channel,
+				MsgID:     metadata.MsgID,
+				UserID:    metadata.UserID,
+				UserName:  metadata.UserName,
+				Recipient: metadata.Receipent,
+				Tier:      metadata.Tags["msg-param-sub-plan"],
+				Count:     1,
+				Message:   body,
+			})
 		case "submysterygift":
 			slog.Info("Subscription gift to random chatters", "ChatterName", metadata.UserName, "Message", body)
-		case "primepaidupgrade":
-			slog.Info("Subscription prime upgrade", "ChatterName", metadata.UserName, "Message", body)
-		case "giftpaidupgrade":
-			slog.Info("Subscription gift upgrade", "ChatterName", metadata.UserName, "Message", body)
-		case "communitypayforward":
-			slog.Info("Subscription gifted is payed forward", "ChatterName", metadata.UserName, "Message", body)
+			c.emitEvent(&GiftSubEvent{
+				Channel:  metadata.Channel,
+				MsgID:    metadata.MsgID,
+				UserID:   metadata.UserID,
+				UserName: metadata.UserName,
+				Tier:     metadata.Tags["msg-param-sub-plan"],
+				Count:    metadata.Tags.Int("msg-param-mass-gift-count"),
+				Message:  body,
+			})
 		case "announcement":
 			slog.Info("Announcement", "ChatterName", metadata.UserName, "Message", body)
+			c.emitEvent(&AnnouncementEvent{
+				Channel:  metadata.Channel,
+				UserID:   metadata.UserID,
+				UserName: metadata.UserName,
+				Color:    metadata.Tags["msg-param-color"],
+				Message:  body,
+			})
 		case "raid":
 			slog.Info("Raid", "ChatterName", metadata.UserName, "Message", body)
+			c.emitEvent(&RaidEvent{
+				Channel:  metadata.Channel,
+				UserID:   metadata.UserID,
+				UserName: metadata.UserName,
+				Viewers:  metadata.Tags.Int("msg-param-viewerCount"),
+			})
 		case "viewermilestone":
 			slog.Info("Chatter reached viewer milestone", "ChatterName", metadata.UserName, "Message", body)
+			c.emitEvent(&ViewerMilestoneEvent{
+				Channel:  metadata.Channel,
+				UserID:   metadata.UserID,
+				UserName: metadata.UserName,
+				Category: metadata.Tags["msg-param-category"],
+				Value:    metadata.Tags.Int("msg-param-value"),
+				Message:  body,
+			})
 		default:
 			// Message type not recognized - print the whole message
-			fmt.Print(msg)
+			fmt.Println(msg.Raw)
+		}
+
+	case "WHISPER":
+		if PrintChatMessages() {
+			fmt.Printf("%3s %20s: %s (whisper)\n", "", metadata.UserName, body)
 		}
+		c.emitEvent(&WhisperEvent{
+			UserID:    metadata.UserID,
+			UserName:  metadata.UserName,
+			Login:     msg.Prefix.Nick,
+			Message:   body,
+			MessageID: metadata.MessageID,
+			ThreadID:  metadata.Tags["thread-id"],
+		})
+		c.checkForChatCommands(body, metadata)
 
 	case "CLEARCHAT":
-		if strings.HasPrefix(header, "@ban-duration") {
-			slog.Info("Chatter got banned", "ChatterName", body)
+		if len(metadata.Tags["ban-duration"]) > 0 {
+			slog.Info("Chatter got timed out", "ChatterName", body, "Duration", metadata.Tags["ban-duration"])
+			c.emitEvent(&BanEvent{
+				Channel:  metadata.Channel,
+				UserID:   int64(metadata.Tags.Int("target-user-id")),
+				UserName: body,
+				Duration: time.Second * time.Duration(metadata.Tags.Int("ban-duration")),
+			})
 		} else if len(body) > 0 {
-			slog.Info("Chat messages got cleared", "ChatterName", body)
+			slog.Info("Chatter got banned", "ChatterName", body)
+			c.emitEvent(&BanEvent{
+				Channel:  metadata.Channel,
+				UserID:   int64(metadata.Tags.Int("target-user-id")),
+				UserName: body,
+			})
 		} else {
 			slog.Info("Chat got cleared")
+			c.emitEvent(&ClearChatEvent{Channel: metadata.Channel})
 		}
 
 	case "CLEARMSG":
-		if strings.HasPrefix(header, "@login=") {
-			var idx = strings.Index(header, ";")
-			if idx < 0 {
-				idx = len(header)
-			}
-			slog.Info("Chatter got perma banned", "ChatterName", header[7:idx])
-		} else {
-			slog.Info("Someones messages got cleared")
-		}
+		slog.Info("Chatter message got deleted", "ChatterName", metadata.Tags["login"], "Message", body)
+		c.emitEvent(&MessageDeletedEvent{
+			Channel:   metadata.Channel,
+			UserName:  metadata.Tags["login"],
+			MessageID: metadata.Tags["target-msg-id"],
+			Message:   body,
+		})
 
 	case "NOTICE":
+		var event = RoomModeEvent{Channel: metadata.Channel, MsgID: metadata.MsgID}
 		switch metadata.MsgID {
 		case "emote_only_on":
 			slog.Info("This room is now in emote-only mode.")
+			event.Mode, event.Enabled = RoomModeEmoteOnly, true
 		case "emote_only_off":
 			slog.Info("This room is no longer in emote-only mode.")
+			event.Mode, event.Enabled = RoomModeEmoteOnly, false
 		case "subs_on":
 			slog.Info("This room is now in subscribers-only mode.")
+			event.Mode, event.Enabled = RoomModeSubsOnly, true
 		case "subs_off":
 			slog.Info("This room is no longer in subscribers-only mode.")
+			event.Mode, event.Enabled = RoomModeSubsOnly, false
 		case "followers_on":
 			fallthrough
 		case "followers_on_zero":
 			slog.Info("This room is now in followers-only mode.")
+			event.Mode, event.Enabled = RoomModeFollowersOnly, true
 		case "followers_off":
 			slog.Info("This room is no longer in followers-only mode.")
+			event.Mode, event.Enabled = RoomModeFollowersOnly, false
 		case "msg_followersonly":
 			slog.Info("This room is in 10 minutes followers-only mode.")
+			event.Mode, event.Enabled = RoomModeFollowersOnly, true
 		case "slow_on":
 			slog.Info("This room is now in slow mode.")
+			event.Mode, event.Enabled = RoomModeSlow, true
 		case "slow_off":
 			slog.Info("This room is no longer in slow mode.")
+			event.Mode, event.Enabled = RoomModeSlow, false
 		default:
 			// Message type not recognized - print the whole message
-			fmt.Print(msg)
+			fmt.Println(msg.Raw)
+			return
 		}
+		c.emitEvent(&event)
 
 	case "ROOMSTATE":
 		// Room state changed - do nothing? This message is always send with another one?
 
+	case "001":
+		// Welcome message, login was accepted
+		c.isAuthenticated.Store(true)
+		c.emitEvent(&ConnectionEvent{State: ConnectionConnected})
+
+	case "RECONNECT":
+		slog.Warn("Chat bot server requested reconnect")
+		c.requestReconnect()
+
+	case "PONG":
+		// Response to keepalive PING, nothing to do
+
 	case "USERSTATE":
-		if PrintChatMessages {
+		// Bot's badges in the channel, moderators and the broadcaster have higher rate limits
+		c.sendQueue.setElevated(metadata.Channel, PermissionFromBadge(metadata.Badge) >= PermissionModerator)
+		if PrintChatMessages() {
 			fmt.Printf("BOT %20s: %s (bot's message)\n", metadata.UserName, body)
 		}
 
 	default:
 		// Not recognized message
-		fmt.Print(msg)
+		fmt.Println(msg.Raw)
 	}
 }
 
-// Checks chat message for commands.
-func checkForChatCommands(msg string, metadata messageMetadata) {
-	// if strings.HasPrefix(msg, "!time") {
-	// 	SendMessageResponse(time.Now().String(), metadata.MessageID)
-	// }
+// Sends text message to the channel.
+func (c *Client) SendMessage(channel, msg string) {
+	c.SendMessageResponse(channel, msg, "")
 }
 
-// Sends text message to chat.
-func SendMessage(msg string) {
-	SendMessageResponse(msg, "")
-}
-
-// Sends text message response to chat.
-func SendMessageResponse(msg, msgID string) {
-	if !isStarted || len(msg) == 0 {
+// Sends text message response to the channel.
+// Long messages are split into multiple parts, new lines are replaced with spaces.
+func (c *Client) SendMessageResponse(channel, msg, msgID string) {
+	channel = normalizeChannel(channel)
+	if !c.isStarted.Load() || len(channel) == 0 || strings.ContainsFunc(channel, unicode.IsSpace) {
+		return
+	}
+	var parts = SplitMessage(msg, messageSendMaxLength, MessageContinuationPrefix)
+	if len(parts) == 0 {
 		return
 	}
-	var sb strings.Builder
-	var start, end int
-
-	sendQueue.mutex.Lock()
-
-	for {
-		// Find message end or place to split the message
-		end = len(msg)
-		if (end - start) > messageSendMaxLength {
-			end = strings.LastIndex(msg[:(start+messageSendMaxLength)], " ")
-			if end == -1 {
-				end = messageSendMaxLength
-			}
-		}
 
-		// Create the message
+	var sb strings.Builder
+	var messages = make([]queuedMessage, 0, len(parts))
+	for _, part := range parts {
 		sb.Reset()
 		if len(msgID) > 0 {
 			sb.WriteString("@reply-parent-msg-id=")
-			sb.WriteString(msgID)
+			sb.WriteString(escapeTagValue(msgID))
 			sb.WriteString(" ")
 		}
 		sb.WriteString("PRIVMSG #")
-		sb.WriteString(strings.ToLower(CHANNEL_NAME))
+		sb.WriteString(channel)
 		sb.WriteString(" :")
-		sb.WriteString(msg[start:end])
+		sb.WriteString(part)
 		sb.WriteString("\r\n")
-		sendQueue.Queue = append(sendQueue.Queue, sb.String())
-
-		start = end
-		if end >= len(msg) {
-			break
-		}
+		messages = append(messages, queuedMessage{
+			channel: channel,
+			line:    sb.String(),
+		})
 	}
 
-	sendQueue.PendingMessages = true
-	sendQueue.mutex.Unlock()
-}
-
-// Chat message metadata
-type messageMetadata struct {
-	UserID         int64  // Chatter ID
-	UserName       string // Name of the chatter
-	Badge          string // Badge of the chatter
-	MessageType    string // Type of the chat message
-	MessageID      string // Message ID
-	CustomRewardID string // Custom reward ID that created the chat message
-	Bits           string // Amount of bits
-	MsgID          string // Type of special chat message (like "sub", "emote_only_on")
-	Receipent      string // Receipent of action from a chat message (like receipent of sub gift)
-}
-
-// Queue of chat messages to send to chat.
-type messageQueue struct {
-	PendingMessages bool
-	mutex           sync.Mutex
-	Queue           []string
+	if !c.sendQueue.push(channel, msg, messages, time.Now()) {
+		slog.Warn("Chat message dropped, the same message was sent recently", "Channel", channel, "Message", msg)
+	}
 }
 
-// Add text message to send queue.
-func (q *messageQueue) push(msg string) {
-	q.mutex.Lock()
-	q.Queue = append(sendQueue.Queue, msg)
-	q.PendingMessages = true
-	q.mutex.Unlock()
+// Returns statistics of the send queue.
+func (c *Client) QueueStats() QueueStats {
+	return c.sendQueue.stats()
 }
 
-// Take first message from the queue.
-func (q *messageQueue) pop() (msg string, err error) {
-	q.mutex.Lock()
-	var count = len(q.Queue)
-	if count == 0 {
-		err = errors.New("queue is empty")
-		return
-	}
-	msg = q.Queue[0]
-	q.Queue = q.Queue[1:]
-	q.PendingMessages = count > 1
-	q.mutex.Unlock()
-	return
+// Chat message metadata
+type MessageMetadata struct {
+	UserID         int64      // Chatter ID
+	UserName       string     // Name of the chatter
+	Badge          string     // Badge of the chatter
+	MessageType    string     // Type of the chat message
+	MessageID      string     // Message ID
+	CustomRewardID string     // Custom reward ID that created the chat message
+	Bits           string     // Amount of bits
+	MsgID          string     // Type of special chat message (like "sub", "emote_only_on")
+	Receipent      string     // Receipent of action from a chat message (like receipent of sub gift)
+	Channel        string     // Channel name that the message was sent to
+	Tags           Tags       // All of the chat message tags
+	Fragments      []Fragment // Chat message text split into plain text and emotes
 }
@@ -0,0 +1,187 @@
+package chat
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// Transport reading from provided reader, writes are discarded.
+type readerTransport struct {
+	io.Reader
+}
+
+func (t readerTransport) Write(b []byte) (int, error) { return len(b), nil }
+func (t readerTransport) Close() error                { return nil }
+
+// Reads the data with readMessages, returns messages queued in response (PONG to PING, "!echo" command) and the returned error.
+func readAll(r io.Reader) ([]string, error) {
+	var c = NewClient(Config{})
+	c.RegisterCommand(Command{Name: "echo", Handler: func(ctx *CommandContext) {
+		c.sendQueue.pushHigh("ECHO " + strings.Join(ctx.Args, " ") + "\r\n")
+	}})
+	var err = c.readMessages(readerTransport{r})
+	return highPriority(c), err
+}
+
+// Returns lines waiting in high priority lane of the send queue.
+func highPriority(c *Client) []string {
+	var lines []string
+	for _, msg := range c.sendQueue.high {
+		lines = append(lines, msg.line)
+	}
+	return lines
+}
+
+func TestJoinPart(t *testing.T) {
+	var c = NewClient(Config{Channels: []string{"#Channel", "channel", " ", "Other"}})
+	if !slices.Equal(c.Channels(), []string{"channel", "other"}) {
+		t.Fatalf("configured channels %q", c.Channels())
+	}
+
+	// Channels are joined and left right away only when connected
+	c.Join("#New")
+	c.Part("OTHER")
+	if lines := highPriority(c); len(lines) != 0 {
+		t.Errorf("messages %q queued while disconnected", lines)
+	}
+	c.isConnected.Store(true)
+	c.Join("#Third")
+	c.Join("third")
+	c.Join("#")
+	c.Part("#New")
+	c.Part("unknown")
+	if lines := highPriority(c); !slices.Equal(lines, []string{"JOIN #third\r\n", "PART #new\r\n"}) {
+		t.Errorf("queued messages %q", lines)
+	}
+	if !slices.Equal(c.Channels(), []string{"channel", "third"}) {
+		t.Errorf("joined channels %q", c.Channels())
+	}
+}
+
+func TestDial(t *testing.T) {
+	if c := NewClient(Config{}); c.config.Server != DefaultServer {
+		t.Errorf("default server %q", c.config.Server)
+	}
+	if c := NewClient(Config{Plaintext: true}); c.config.Server != DefaultPlaintextServer {
+		t.Errorf("default plaintext server %q", c.config.Server)
+	}
+
+	var server = httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	var roots = x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	var tests = []struct {
+		config Config
+		ok     bool
+	}{
+		{Config{TLSConfig: &tls.Config{RootCAs: roots}}, true},
+		{Config{}, false}, // Self-signed certificate isn't trusted by default
+		{Config{Plaintext: true}, true},
+	}
+	for i, test := range tests {
+		test.config.Server = server.Listener.Addr().String()
+		var conn, err = NewClient(test.config).dial(context.Background())
+		if err == nil {
+			if tlsConn, ok := conn.(*tls.Conn); ok {
+				err = tlsConn.Handshake()
+			}
+			conn.Close()
+		}
+		if (err == nil) != test.ok {
+			t.Errorf("config %d: dial returned %v", i, err)
+		}
+	}
+}
+
+func TestReconnectRequest(t *testing.T) {
+	var c = NewClient(Config{Nick: "Bot"})
+	var states []ConnectionState
+	c.Subscribe(func(event Event) {
+		if e, ok := event.(*ConnectionEvent); ok {
+			states = append(states, e.State)
+		}
+	})
+	c.sendQueue.pushHigh("PONG :old\r\n") // Response for previous connection
+
+	var client, server = net.Pipe()
+	go io.Copy(io.Discard, server)
+	go server.Write([]byte(":tmi.twitch.tv 001 bot :Welcome, GLHF!\r\n:tmi.twitch.tv RECONNECT\r\n"))
+
+	var err = c.handleConnection(context.Background(), client)
+	if !errors.Is(err, errReconnectRequested) {
+		t.Errorf("connection closed with error %v, expected reconnect request", err)
+	}
+	if !c.isAuthenticated.Load() || c.isConnected.Load() {
+		t.Errorf("authenticated %v, connected %v after reconnect request", c.isAuthenticated.Load(), c.isConnected.Load())
+	}
+	if !slices.Equal(states, []ConnectionState{ConnectionConnected}) {
+		t.Errorf("connection events %v, expected Connected", states)
+	}
+	if lines := highPriority(c); len(lines) != 0 {
+		t.Errorf("messages %q of previous connection weren't dropped", lines)
+	}
+}
+
+func TestReadMessages(t *testing.T) {
+	var data = "PING :tmi.twitch.tv\r\n\r\n" +
+		"@id=1 :a!a@a.tmi.twitch.tv PRIVMSG #channel :!echo first\n" +
+		":a!a@a.tmi.twitch.tv PRIVMSG #channel :!echo second\r\n" +
+		"@id=3 :a!a@a.tmi.twitch.tv PRIVMSG #channel :!echo cut in the mid"
+	var expected = []string{
+		"PONG :tmi.twitch.tv\r\n",
+		"ECHO first\r\n",
+		"ECHO second\r\n",
+	}
+
+	for name, r := range map[string]io.Reader{
+		"whole":    strings.NewReader(data),
+		"one byte": iotest.OneByteReader(strings.NewReader(data)),
+		"halves":   iotest.HalfReader(strings.NewReader(data)),
+	} {
+		var received, err = readAll(r)
+		if !errors.Is(err, io.EOF) {
+			t.Errorf("%s: error %v, expected EOF", name, err)
+		}
+		if !slices.Equal(received, expected) {
+			t.Errorf("%s: received %q, expected %q", name, received, expected)
+		}
+	}
+}
+
+func BenchmarkReadMessages(b *testing.B) {
+	var lines = []string{
+		`@badge-info=subscriber/8;badges=subscriber/6;color=#FF0000;display-name=ronni;emotes=25:0-4;id=db25007f-7a18-43eb-9379-80131e44d633;mod=0;room-id=12345678;subscriber=1;tmi-sent-ts=1507246572675;user-id=87654321;user-type= :ronni!ronni@ronni.tmi.twitch.tv PRIVMSG #dallas :Kappa hello chat, how is it going?`,
+		`@emote-only=0;followers-only=-1;r9k=0;room-id=12345678;slow=0;subs-only=0 :tmi.twitch.tv ROOMSTATE #dallas`,
+		`PING :tmi.twitch.tv`,
+	}
+	var sb strings.Builder
+	for sb.Len() < 1<<20 {
+		for _, line := range lines {
+			sb.WriteString(line)
+			sb.WriteString("\r\n")
+		}
+	}
+	var data = sb.String()
+
+	var print = PrintChatMessages()
+	SetPrintChatMessages(false)
+	defer SetPrintChatMessages(print)
+	var c = NewClient(Config{})
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.readMessages(readerTransport{iotest.HalfReader(strings.NewReader(data))})
+		c.sendQueue.clearHigh() // PONG responses
+	}
+}
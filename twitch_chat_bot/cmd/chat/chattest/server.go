@@ -0,0 +1,648 @@
+package chattest
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"twitch_chat_bot/cmd/chat"
+)
+
+// Fake Twitch IRC (TMI) server for integration tests.
+// The server listens on local TCP port and speaks the login handshake like Twitch does:
+// PASS and NICK are answered with 001-004 and MOTD lines, CAP REQ with CAP ACK,
+// JOIN with JOIN, NAMES list, USERSTATE and ROOMSTATE, PING with PONG.
+// Tests inject scripted messages (PRIVMSG, USERNOTICE, WHISPER, CLEARCHAT, RECONNECT) and check recorded lines sent by the bot.
+// With Config.TLS the server uses TLS with self-signed certificate, like Twitch on port 6697.
+// Writes can be split into small chunks to exercise reassembly of messages split between reads:
+//
+//	var server = chattest.NewServer(chattest.Config{ChunkSize: 7})
+//	defer server.Close()
+//	var client = chat.NewClient(server.ClientConfig("bot", "channel"))
+//	client.Start()
+//	defer client.Stop()
+//	server.WaitJoined(ctx, "channel")
+//	server.PrivMsg("channel", "viewer", "!time", nil)
+//	var line, err = server.WaitFor(ctx, "PRIVMSG #channel")
+
+const Host = "tmi.twitch.tv" // Host name used as prefix of server messages
+
+var ErrClosed = errors.New("server is closed")
+
+// Server configuration.
+type Config struct {
+	Pass       string        // Expected OAuth token (without "oauth:" prefix), any token is accepted if empty
+	ChunkSize  int           // Maximum amount of bytes sent in one write, lines are split into multiple writes. 0 disables splitting
+	ChunkDelay time.Duration // Delay between split writes, so the client receives them in separate reads
+	TLS        bool          // Use TLS with self-signed certificate, clients have to trust Certificate
+}
+
+// Fake Twitch IRC server.
+type Server struct {
+	config   Config
+	listener net.Listener
+	cert     *x509.Certificate // Self-signed certificate of TLS server, nil without TLS
+	mutex    sync.Mutex
+	conns    []*conn
+	received []string      // Lines received from all of the connections
+	changed  chan struct{} // Closed and replaced when a line is received or a connection changes
+	accepted int           // Amount of accepted connections
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// Connection of the chat bot.
+type conn struct {
+	net.Conn
+	nick       string
+	authorized bool
+	channels   []string
+	writeMutex sync.Mutex
+}
+
+// Creates fake server listening on random local port.
+func NewServer(config Config) *Server {
+	var listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("chattest: failed to listen on a port: %v", err))
+	}
+	var s = &Server{
+		config:   config,
+		listener: listener,
+		changed:  make(chan struct{}),
+	}
+	if config.TLS {
+		var cert, err = newCertificate()
+		if err != nil {
+			listener.Close()
+			panic(fmt.Sprintf("chattest: failed to create certificate: %v", err))
+		}
+		s.cert = cert.Leaf
+		s.listener = tls.NewListener(listener, &tls.Config{Certificates: []tls.Certificate{cert}})
+	}
+	s.wg.Add(1)
+	go s.accept()
+	return s
+}
+
+// Returns the server address.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Returns self-signed certificate of TLS server, nil if the server doesn't use TLS.
+func (s *Server) Certificate() *x509.Certificate {
+	return s.cert
+}
+
+// Returns TLS configuration trusting the server certificate, nil if the server doesn't use TLS.
+func (s *Server) TLSConfig() *tls.Config {
+	if s.cert == nil {
+		return nil
+	}
+	var pool = x509.NewCertPool()
+	pool.AddCert(s.cert)
+	return &tls.Config{RootCAs: pool}
+}
+
+// Connects to the server, can be used as chat.Config.Dial function.
+func (s *Server) Dial(ctx context.Context) (chat.Transport, error) {
+	if s.cert != nil {
+		var dialer = tls.Dialer{Config: s.TLSConfig()}
+		return dialer.DialContext(ctx, "tcp", s.Addr())
+	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", s.Addr())
+}
+
+// Returns chat bot configuration connecting to the server.
+// TLS server is connected to by the chat bot itself, through Server address and TLSConfig trusting the certificate.
+func (s *Server) ClientConfig(nick string, channels ...string) chat.Config {
+	var config = chat.Config{
+		Pass:     func() string { return s.config.Pass },
+		Nick:     nick,
+		Channels: channels,
+	}
+	if s.cert != nil {
+		config.Server = s.Addr()
+		config.TLSConfig = s.TLSConfig()
+	} else {
+		config.Dial = s.Dial
+	}
+	return config
+}
+
+// Stops the server and closes all of the connections.
+func (s *Server) Close() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.closed = true
+	var err = s.listener.Close()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.notify()
+	s.mutex.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// Accepts new connections until the server is closed.
+func (s *Server) accept() {
+	defer s.wg.Done()
+	for {
+		var nc, err = s.listener.Accept()
+		if err != nil {
+			return
+		}
+		var c = &conn{Conn: nc}
+		s.mutex.Lock()
+		if s.closed {
+			s.mutex.Unlock()
+			nc.Close()
+			return
+		}
+		s.conns = append(s.conns, c)
+		s.accepted++
+		s.notify()
+		s.mutex.Unlock()
+
+		s.wg.Add(1)
+		go s.serve(c)
+	}
+}
+
+// Reads lines sent by the chat bot and responds to them until the connection is closed.
+func (s *Server) serve(c *conn) {
+	defer s.wg.Done()
+	defer func() {
+		c.Close()
+		s.mutex.Lock()
+		s.conns = slices.DeleteFunc(s.conns, func(other *conn) bool { return other == c })
+		s.notify()
+		s.mutex.Unlock()
+	}()
+
+	var scanner = bufio.NewScanner(c)
+	for scanner.Scan() {
+		var line = strings.TrimRight(scanner.Text(), "\r")
+		if len(line) == 0 {
+			continue
+		}
+		s.mutex.Lock()
+		s.received = append(s.received, line)
+		s.notify()
+		s.mutex.Unlock()
+
+		if !s.handle(c, line) {
+			return
+		}
+	}
+}
+
+// Responds to the line sent by the chat bot. Returns false if the connection should be closed.
+func (s *Server) handle(c *conn, line string) bool {
+	var msg, err = chat.ParseMessage(line)
+	if err != nil {
+		return true
+	}
+
+	switch msg.Command {
+	case "PASS":
+		var pass = strings.TrimPrefix(param(msg, 0), "oauth:")
+		if len(s.config.Pass) > 0 && pass != s.config.Pass {
+			s.write(c, fmt.Sprintf(":%s NOTICE * :Login authentication failed", Host))
+			return false
+		}
+		c.authorized = true
+	case "NICK":
+		if !c.authorized && len(s.config.Pass) > 0 {
+			s.write(c, fmt.Sprintf(":%s NOTICE * :Improperly formatted auth", Host))
+			return false
+		}
+		c.nick = strings.ToLower(param(msg, 0))
+		s.write(c,
+			fmt.Sprintf(":%s 001 %s :Welcome, GLHF!", Host, c.nick),
+			fmt.Sprintf(":%s 002 %s :Your host is %s", Host, c.nick, Host),
+			fmt.Sprintf(":%s 003 %s :This server is rather new", Host, c.nick),
+			fmt.Sprintf(":%s 004 %s :-", Host, c.nick),
+			fmt.Sprintf(":%s 375 %s :-", Host, c.nick),
+			fmt.Sprintf(":%s 372 %s :You are in a maze of twisty passages, all alike.", Host, c.nick),
+			fmt.Sprintf(":%s 376 %s :>", Host, c.nick),
+		)
+	case "CAP":
+		if param(msg, 0) == "REQ" {
+			s.write(c, fmt.Sprintf(":%s CAP * ACK :%s", Host, msg.Trailing))
+		}
+	case "JOIN":
+		for _, channel := range strings.Split(param(msg, 0), ",") {
+			channel = strings.ToLower(strings.TrimPrefix(channel, "#"))
+			if len(channel) == 0 {
+				continue
+			}
+			s.mutex.Lock()
+			if !slices.Contains(c.channels, channel) {
+				c.channels = append(c.channels, channel)
+			}
+			s.notify()
+			s.mutex.Unlock()
+			s.write(c,
+				fmt.Sprintf(":%s!%s@%s.%s JOIN #%s", c.nick, c.nick, c.nick, Host, channel),
+				fmt.Sprintf(":%s.%s 353 %s = #%s :%s", c.nick, Host, c.nick, channel, c.nick),
+				fmt.Sprintf(":%s.%s 366 %s #%s :End of /NAMES list", c.nick, Host, c.nick, channel),
+				fmt.Sprintf("@badge-info=;badges=;color=;display-name=%s;emote-sets=0;mod=0;subscriber=0;user-type= :%s USERSTATE #%s", c.nick, Host, channel),
+				fmt.Sprintf("@emote-only=0;followers-only=-1;r9k=0;room-id=%d;slow=0;subs-only=0 :%s ROOMSTATE #%s", channelID(channel), Host, channel),
+			)
+		}
+	case "PART":
+		for _, channel := range strings.Split(param(msg, 0), ",") {
+			channel = strings.ToLower(strings.TrimPrefix(channel, "#"))
+			s.mutex.Lock()
+			c.channels = slices.DeleteFunc(c.channels, func(ch string) bool { return ch == channel })
+			s.notify()
+			s.mutex.Unlock()
+			s.write(c, fmt.Sprintf(":%s!%s@%s.%s PART #%s", c.nick, c.nick, c.nick, Host, channel))
+		}
+	case "PING":
+		s.write(c, fmt.Sprintf(":%s PONG %s :%s", Host, Host, msg.Trailing))
+	}
+	return true
+}
+
+// Writes lines to the connection, splitting them into chunks if configured.
+func (s *Server) write(c *conn, lines ...string) error {
+	var data []byte
+	for _, line := range lines {
+		data = append(data, line...)
+		data = append(data, "\r\n"...)
+	}
+	return s.writeRaw(c, data)
+}
+
+// Writes raw data to the connection, splitting it into chunks if configured.
+func (s *Server) writeRaw(c *conn, data []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	var size = s.config.ChunkSize
+	if size <= 0 {
+		size = len(data)
+	}
+	for len(data) > 0 {
+		var n = min(size, len(data))
+		var _, err = c.Write(data[:n])
+		if err != nil {
+			return err
+		}
+		data = data[n:]
+		if len(data) > 0 && s.config.ChunkDelay > 0 {
+			time.Sleep(s.config.ChunkDelay)
+		}
+	}
+	return nil
+}
+
+// Sends lines to all of the connected chat bots. Lines shouldn't end with "\r\n".
+func (s *Server) Send(lines ...string) error {
+	var data []byte
+	for _, line := range lines {
+		data = append(data, line...)
+		data = append(data, "\r\n"...)
+	}
+	return s.SendRaw(data)
+}
+
+// Sends raw data to all of the connected chat bots, it can contain partial lines.
+func (s *Server) SendRaw(data []byte) error {
+	s.mutex.Lock()
+	var conns = slices.Clone(s.conns)
+	s.mutex.Unlock()
+	if len(conns) == 0 {
+		return errors.New("no chat bot is connected")
+	}
+
+	var errs []error
+	for _, c := range conns {
+		errs = append(errs, s.writeRaw(c, data))
+	}
+	return errors.Join(errs...)
+}
+
+// Sends raw data to all of the connected chat bots, split into chunks of provided sizes.
+// Chunks are sent with a delay, so each of them is received in a separate read.
+// Remaining data after the last chunk is sent at once.
+func (s *Server) SendSplit(data []byte, sizes ...int) error {
+	for _, size := range sizes {
+		if len(data) == 0 {
+			break
+		}
+		var n = min(size, len(data))
+		if err := s.SendRaw(data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+		time.Sleep(max(s.config.ChunkDelay, time.Millisecond*10))
+	}
+	if len(data) > 0 {
+		return s.SendRaw(data)
+	}
+	return nil
+}
+
+// Sends chat message of the chatter. Tags are added to default chat message tags, overwriting them.
+func (s *Server) PrivMsg(channel, user, text string, tags chat.Tags) error {
+	channel = strings.ToLower(strings.TrimPrefix(channel, "#"))
+	var login = strings.ToLower(user)
+	var all = chat.Tags{
+		"badge-info":   "",
+		"badges":       "",
+		"color":        "",
+		"display-name": user,
+		"emotes":       "",
+		"first-msg":    "0",
+		"id":           newMessageID(),
+		"mod":          "0",
+		"room-id":      fmt.Sprint(channelID(channel)),
+		"subscriber":   "0",
+		"tmi-sent-ts":  fmt.Sprint(time.Now().UnixMilli()),
+		"turbo":        "0",
+		"user-id":      fmt.Sprint(channelID(login)),
+		"user-type":    "",
+	}
+	for k, v := range tags {
+		all[k] = v
+	}
+	return s.Send(fmt.Sprintf("@%s :%s!%s@%s.%s PRIVMSG #%s :%s", formatTags(all), login, login, login, Host, channel, text))
+}
+
+// Sends user notice (subscription, raid, announcement, etc.) identified by msg-id.
+// Tags are added to default tags, overwriting them. Text is optional message attached by the chatter.
+func (s *Server) UserNotice(channel, user, msgID, text string, tags chat.Tags) error {
+	channel = strings.ToLower(strings.TrimPrefix(channel, "#"))
+	var all = chat.Tags{
+		"badge-info":   "",
+		"badges":       "",
+		"color":        "",
+		"display-name": user,
+		"id":           newMessageID(),
+		"login":        strings.ToLower(user),
+		"msg-id":       msgID,
+		"room-id":      fmt.Sprint(channelID(channel)),
+		"system-msg":   "",
+		"tmi-sent-ts":  fmt.Sprint(time.Now().UnixMilli()),
+		"user-id":      fmt.Sprint(channelID(strings.ToLower(user))),
+	}
+	for k, v := range tags {
+		all[k] = v
+	}
+	var line = fmt.Sprintf("@%s :%s USERNOTICE #%s", formatTags(all), Host, channel)
+	if len(text) > 0 {
+		line += " :" + text
+	}
+	return s.Send(line)
+}
+
+// Sends whisper from the chatter to the chat bot with provided nick.
+func (s *Server) Whisper(user, to, text string, tags chat.Tags) error {
+	var login = strings.ToLower(user)
+	to = strings.ToLower(to)
+	var all = chat.Tags{
+		"badges":       "",
+		"color":        "",
+		"display-name": user,
+		"emotes":       "",
+		"message-id":   fmt.Sprint(channelID(text)),
+		"thread-id":    fmt.Sprintf("%d_%d", channelID(login), channelID(to)),
+		"turbo":        "0",
+		"user-id":      fmt.Sprint(channelID(login)),
+		"user-type":    "",
+	}
+	for k, v := range tags {
+		all[k] = v
+	}
+	return s.Send(fmt.Sprintf("@%s :%s!%s@%s.%s WHISPER %s :%s", formatTags(all), login, login, login, Host, to, text))
+}
+
+// Clears chat messages of the chatter. Empty user clears the whole chat.
+// Duration 0 means permanent ban, otherwise the chatter is timed out.
+func (s *Server) ClearChat(channel, user string, duration time.Duration) error {
+	channel = strings.ToLower(strings.TrimPrefix(channel, "#"))
+	var tags = chat.Tags{
+		"room-id":     fmt.Sprint(channelID(channel)),
+		"tmi-sent-ts": fmt.Sprint(time.Now().UnixMilli()),
+	}
+	if len(user) == 0 {
+		return s.Send(fmt.Sprintf("@%s :%s CLEARCHAT #%s", formatTags(tags), Host, channel))
+	}
+	user = strings.ToLower(user)
+	tags["target-user-id"] = fmt.Sprint(channelID(user))
+	if duration > 0 {
+		tags["ban-duration"] = fmt.Sprint(int(duration.Seconds()))
+	}
+	return s.Send(fmt.Sprintf("@%s :%s CLEARCHAT #%s :%s", formatTags(tags), Host, channel, user))
+}
+
+// Asks connected chat bots to reconnect.
+func (s *Server) Reconnect() error {
+	return s.Send(fmt.Sprintf(":%s RECONNECT", Host))
+}
+
+// Closes connections of all of the chat bots, without sending anything.
+func (s *Server) Disconnect() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+}
+
+// Returns all of the lines received from the chat bots, without "\r\n".
+func (s *Server) Received() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return slices.Clone(s.received)
+}
+
+// Returns lines received from the chat bots with provided command (like "PRIVMSG").
+func (s *Server) ReceivedCommand(command string) []chat.Message {
+	var messages []chat.Message
+	for _, line := range s.Received() {
+		var msg, err = chat.ParseMessage(line)
+		if err == nil && msg.Command == command {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+// Removes all of the recorded lines.
+func (s *Server) ClearReceived() {
+	s.mutex.Lock()
+	s.received = nil
+	s.mutex.Unlock()
+}
+
+// Returns amount of accepted connections.
+func (s *Server) Accepted() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.accepted
+}
+
+// Waits until a line containing provided text is received and returns it.
+// Lines received before the call are checked too.
+func (s *Server) WaitFor(ctx context.Context, text string) (string, error) {
+	var line string
+	var err = s.wait(ctx, func() bool {
+		for _, l := range s.received {
+			if strings.Contains(l, text) {
+				line = l
+				return true
+			}
+		}
+		return false
+	})
+	return line, err
+}
+
+// Waits until a chat bot is connected and joined the channel.
+func (s *Server) WaitJoined(ctx context.Context, channel string) error {
+	channel = strings.ToLower(strings.TrimPrefix(channel, "#"))
+	return s.wait(ctx, func() bool {
+		for _, c := range s.conns {
+			if slices.Contains(c.channels, channel) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Waits until provided amount of connections was accepted.
+func (s *Server) WaitAccepted(ctx context.Context, count int) error {
+	return s.wait(ctx, func() bool { return s.accepted >= count })
+}
+
+// Waits until the condition is true. The condition is checked with locked mutex.
+func (s *Server) wait(ctx context.Context, condition func() bool) error {
+	for {
+		s.mutex.Lock()
+		if condition() {
+			s.mutex.Unlock()
+			return nil
+		}
+		if s.closed {
+			s.mutex.Unlock()
+			return ErrClosed
+		}
+		var changed = s.changed
+		s.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Wakes up waiting goroutines. Should be called with locked mutex.
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// Returns the message parameter, empty if the message doesn't have it.
+func param(msg chat.Message, i int) string {
+	if i < len(msg.Params) {
+		return msg.Params[i]
+	}
+	return ""
+}
+
+// Formats tags in IRCv3 format, escaping the values.
+func formatTags(tags chat.Tags) string {
+	var keys = make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	var escaper = strings.NewReplacer(`\`, `\\`, ";", `\:`, " ", `\s`, "\r", `\r`, "\n", `\n`)
+	var builder strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			builder.WriteByte(';')
+		}
+		builder.WriteString(k)
+		builder.WriteByte('=')
+		builder.WriteString(escaper.Replace(tags[k]))
+	}
+	return builder.String()
+}
+
+// Creates self-signed certificate for local address, valid for a day.
+func newCertificate() (tls.Certificate, error) {
+	var key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	var template = &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"chattest"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour * 24),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		DNSNames:              []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+var messageCounter struct {
+	sync.Mutex
+	n int
+}
+
+// Returns new unique message ID.
+func newMessageID() string {
+	messageCounter.Lock()
+	defer messageCounter.Unlock()
+	messageCounter.n++
+	return fmt.Sprintf("00000000-0000-0000-0000-%012d", messageCounter.n)
+}
+
+// Returns stable fake ID of the channel or user name.
+func channelID(name string) int64 {
+	var id int64 = 1000
+	for _, r := range name {
+		id = (id*31 + int64(r)) % 1_000_000_000
+	}
+	return id
+}
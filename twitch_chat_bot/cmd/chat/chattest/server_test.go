@@ -0,0 +1,252 @@
+package chattest
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"twitch_chat_bot/cmd/chat"
+)
+
+// Starts the server and chat bot connected to it, waiting until the bot joins the channel.
+func startClient(t *testing.T, config Config, setup func(c *chat.Client)) (*Server, *chat.Client, chan chat.Event) {
+	t.Helper()
+	var server = NewServer(config)
+	t.Cleanup(func() { server.Close() })
+	var client = chat.NewClient(server.ClientConfig("Bot", "#Channel"))
+	var events = make(chan chat.Event, 1000)
+	client.Subscribe(func(event chat.Event) { events <- event })
+	if setup != nil {
+		setup(client)
+	}
+	client.Start()
+	t.Cleanup(client.Stop)
+
+	var ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := server.WaitJoined(ctx, "channel"); err != nil {
+		t.Fatal(err)
+	}
+	return server, client, events
+}
+
+// Waits for the event of type T, skipping other events.
+func waitEvent[T chat.Event](t *testing.T, events chan chat.Event) T {
+	t.Helper()
+	var timeout = time.After(time.Second * 5)
+	for {
+		select {
+		case event := <-events:
+			if e, ok := event.(T); ok {
+				return e
+			}
+		case <-timeout:
+			var zero T
+			t.Fatalf("%T event wasn't received", zero)
+			return zero
+		}
+	}
+}
+
+// Waits for the line sent by the chat bot.
+func waitFor(t *testing.T, server *Server, text string) string {
+	t.Helper()
+	var ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	var line, err = server.WaitFor(ctx, text)
+	if err != nil {
+		t.Fatalf("line containing %q wasn't received: %v", text, err)
+	}
+	return line
+}
+
+func TestHandshake(t *testing.T) {
+	// Server replies are split into small writes
+	var server, client, events = startClient(t, Config{Pass: "token", ChunkSize: 7, ChunkDelay: time.Millisecond}, nil)
+	var e = waitEvent[*chat.ConnectionEvent](t, events)
+	for e.State != chat.ConnectionConnected {
+		e = waitEvent[*chat.ConnectionEvent](t, events)
+	}
+
+	var received = server.Received()
+	if len(received) < 4 || received[0] != "PASS oauth:token" || received[1] != "NICK bot" {
+		t.Fatalf("received lines %q", received)
+	}
+	if !strings.HasPrefix(received[2], "CAP REQ :") || !slices.Contains(received, "JOIN #channel") {
+		t.Errorf("received lines %q, expected capabilities request and join", received)
+	}
+	if !client.IsConnected() || !slices.Equal(client.Channels(), []string{"channel"}) {
+		t.Errorf("client connected %v to channels %q", client.IsConnected(), client.Channels())
+	}
+}
+
+func TestCommandReply(t *testing.T) {
+	var server, _, _ = startClient(t, Config{ChunkSize: 5}, func(c *chat.Client) {
+		c.RegisterCommand(chat.Command{Name: "hello", Handler: func(ctx *chat.CommandContext) {
+			ctx.Reply("Hi " + ctx.Metadata.UserName)
+		}})
+	})
+	server.PrivMsg("channel", "Viewer", "!hello", nil)
+	if line := waitFor(t, server, "PRIVMSG #channel"); !strings.HasSuffix(line, ":Hi Viewer") {
+		t.Errorf("reply %q", line)
+	}
+	if messages := server.ReceivedCommand("PRIVMSG"); len(messages) != 1 || messages[0].Params[0] != "#channel" {
+		t.Errorf("sent messages %+v", messages)
+	}
+}
+
+func TestLineReassembly(t *testing.T) {
+	var server, _, events = startClient(t, Config{}, nil)
+
+	// Split in the middle of tags, between "\r" and "\n", and with multiple lines in one read
+	var data = []byte("@badges=moderator/1;display-name=Mod;user-id=5 :mod!mod@mod.tmi.twitch.tv PRIVMSG #channel :first message\r\n" +
+		":viewer!viewer@viewer.tmi.twitch.tv PRIVMSG #channel :second\r\n" +
+		"PING :tmi.twitch.tv\r\n" +
+		":viewer!viewer@viewer.tmi.twitch.tv PRIVMSG #channel :third\r\n")
+	if err := server.SendSplit(data, 10, 94, 1, 70, 30); err != nil {
+		t.Fatal(err)
+	}
+
+	var texts []string
+	for len(texts) < 3 {
+		var e = waitEvent[*chat.MessageEvent](t, events)
+		if e.Message.Command != "PRIVMSG" {
+			continue
+		}
+		texts = append(texts, e.Message.Trailing)
+		if len(texts) == 1 && (e.Metadata.UserName != "Mod" || e.Metadata.UserID != 5 || e.Message.Tags["badges"] != "moderator/1") {
+			t.Errorf("first message reassembled with metadata %+v and tags %v", e.Metadata, e.Message.Tags)
+		}
+	}
+	if !slices.Equal(texts, []string{"first message", "second", "third"}) {
+		t.Errorf("received messages %q", texts)
+	}
+	waitFor(t, server, "PONG :tmi.twitch.tv")
+}
+
+func TestScriptedEvents(t *testing.T) {
+	var server, _, events = startClient(t, Config{ChunkSize: 16}, nil)
+
+	server.UserNotice("channel", "Subscriber", "resub", "still here", chat.Tags{"msg-param-cumulative-months": "7", "msg-param-sub-plan": "1000"})
+	if e := waitEvent[*chat.SubEvent](t, events); e.UserName != "Subscriber" || e.Months != 7 || e.Message != "still here" {
+		t.Errorf("unexpected sub event %+v", e)
+	}
+	server.ClearChat("channel", "Spammer", time.Minute*10)
+	if e := waitEvent[*chat.BanEvent](t, events); e.Channel != "channel" || e.Duration != time.Minute*10 {
+		t.Errorf("unexpected ban event %+v", e)
+	}
+	server.ClearChat("channel", "", 0)
+	waitEvent[*chat.ClearChatEvent](t, events)
+	server.Whisper("Viewer", "bot", "psst", nil)
+	if e := waitEvent[*chat.WhisperEvent](t, events); e.UserName != "Viewer" || e.Message != "psst" {
+		t.Errorf("unexpected whisper event %+v", e)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	var server, client, _ = startClient(t, Config{}, nil)
+	var ctx, cancel = context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	// Requested reconnect and closed connection are both followed by login and joining the channels
+	for i, reconnect := range []func(){func() { server.Reconnect() }, server.Disconnect} {
+		server.ClearReceived()
+		reconnect()
+		if err := server.WaitAccepted(ctx, i+2); err != nil {
+			t.Fatal(err)
+		}
+		waitFor(t, server, "JOIN #channel")
+		if err := server.WaitJoined(ctx, "channel"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if client.Reconnects() != 2 {
+		t.Errorf("%d reconnects, expected 2", client.Reconnects())
+	}
+}
+
+func TestRejectedToken(t *testing.T) {
+	var server = NewServer(Config{Pass: "token"})
+	defer server.Close()
+	var config = server.ClientConfig("bot", "channel")
+	config.Pass = func() string { return "wrong" }
+	var client = chat.NewClient(config)
+	client.Start()
+	defer client.Stop()
+
+	// Connection is closed after the login fails, the channel isn't joined
+	waitFor(t, server, "PASS oauth:wrong")
+	var ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+	if err := server.WaitJoined(ctx, "channel"); err == nil {
+		t.Error("chat bot with rejected token joined the channel")
+	}
+}
+
+func TestJoinPart(t *testing.T) {
+	var server, client, _ = startClient(t, Config{}, nil)
+	var ctx, cancel = context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	// Channels joined and left at runtime are sent right away
+	client.Join("#Other")
+	client.Join("other")
+	waitFor(t, server, "JOIN #other")
+	if err := server.WaitJoined(ctx, "other"); err != nil {
+		t.Fatal(err)
+	}
+	client.Part("#Channel")
+	waitFor(t, server, "PART #channel")
+	if !slices.Equal(client.Channels(), []string{"other"}) {
+		t.Errorf("joined channels %q", client.Channels())
+	}
+	if joins := server.ReceivedCommand("JOIN"); len(joins) != 2 {
+		t.Errorf("channels joined %d times, expected twice", len(joins))
+	}
+
+	// Only the current channels are joined again after reconnect
+	server.ClearReceived()
+	server.Disconnect()
+	if err := server.WaitAccepted(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if line := waitFor(t, server, "JOIN"); line != "JOIN #other" {
+		t.Errorf("joined %q after reconnect", line)
+	}
+}
+
+func TestTLS(t *testing.T) {
+	var server = NewServer(Config{TLS: true, Pass: "token"})
+	defer server.Close()
+	var ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	// Chat bot connects by itself, trusting the self-signed certificate through Config.TLSConfig
+	var config = server.ClientConfig("bot", "channel")
+	if config.Dial != nil || config.Plaintext || config.TLSConfig == nil || !config.TLSConfig.RootCAs.Equal(server.TLSConfig().RootCAs) {
+		t.Fatalf("unexpected TLS client configuration %+v", config)
+	}
+	var client = chat.NewClient(config)
+	client.Start()
+	defer client.Stop()
+	if err := server.WaitJoined(ctx, "channel"); err != nil {
+		t.Fatal(err)
+	}
+	if received := server.Received(); received[0] != "PASS oauth:token" {
+		t.Errorf("received lines %q", received)
+	}
+	client.Stop()
+
+	// Certificate isn't trusted by default
+	server.ClearReceived()
+	config.TLSConfig = nil
+	client = chat.NewClient(config)
+	client.Start()
+	defer client.Stop()
+	var waitCtx, waitCancel = context.WithTimeout(ctx, time.Millisecond*300)
+	defer waitCancel()
+	if _, err := server.WaitFor(waitCtx, "PASS"); err == nil {
+		t.Error("chat bot sent the token to server with untrusted certificate")
+	}
+}
@@ -0,0 +1,217 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Chat commands.
+// Commands are registered on the client with RegisterCommand and are checked on every chat message.
+// Chat message starting with CommandPrefix followed by command name (or one of it's aliases) runs the command handler.
+// Each command can have global cooldown, per chatter cooldown and required permission level.
+// Moderators and the broadcaster are not affected by cooldowns.
+// Commands marked with Whisper can also be used in whispers to the chat bot, they are answered with a whisper.
+
+var CommandPrefix = "!" // Prefix that chat message has to start with to be recognized as a command
+
+// Permission level of the chatter.
+type Permission uint8
+
+const (
+	PermissionEveryone Permission = iota
+	PermissionSubscriber
+	PermissionVIP
+	PermissionModerator
+	PermissionBroadcaster
+)
+
+// Converts permission level to it's string representation.
+func (p Permission) ToString() string {
+	switch p {
+	case PermissionEveryone:
+		return "Everyone"
+	case PermissionSubscriber:
+		return "Subscriber"
+	case PermissionVIP:
+		return "VIP"
+	case PermissionModerator:
+		return "Moderator"
+	case PermissionBroadcaster:
+		return "Broadcaster"
+	default:
+		return ""
+	}
+}
+
+// Returns permission level of the chatter based on the badge (STR/MOD/VIP/SUB).
+func PermissionFromBadge(badge string) Permission {
+	switch badge {
+	case "STR":
+		return PermissionBroadcaster
+	case "MOD":
+		return PermissionModerator
+	case "VIP":
+		return PermissionVIP
+	case "SUB":
+		return PermissionSubscriber
+	default:
+		return PermissionEveryone
+	}
+}
+
+// Chat command handler.
+type CommandHandler func(ctx *CommandContext)
+
+// Chat command.
+type Command struct {
+	Name         string         // Command name, without the prefix
+	Aliases      []string       // Other names that can be used to run the command
+	Permission   Permission     // Minimum permission level required to use the command
+	Cooldown     time.Duration  // Minimum time between command uses
+	UserCooldown time.Duration  // Minimum time between command uses by the same chatter
+	Handler      CommandHandler // Function called when the command is used
+	Whisper      bool           // Can the command be used in whispers? Whispers don't have channel badges, so only commands for everyone can be used
+
+	lastUsed   time.Time           // Last time the command was used
+	lastUsedBy map[int64]time.Time // Last time the command was used by the chatter, key is chatter ID
+}
+
+// Data passed to command handler.
+type CommandContext struct {
+	Client   *Client         // Client that received the command
+	Command  *Command        // The command that is being run
+	Name     string          // Name that was used to run the command (command name or one of it's aliases)
+	Args     []string        // Arguments provided after the command name
+	Message  string          // Whole chat message
+	Metadata MessageMetadata // Chat message metadata
+}
+
+// Sends response to the chat message that used the command. Commands used in whispers are answered with a whisper.
+func (ctx *CommandContext) Reply(msg string) {
+	if ctx.IsWhisper() {
+		if err := ctx.Client.SendWhisper(ctx.Metadata.UserID, msg); err != nil {
+			slog.Warn("Error replying to command with whisper", "Command", ctx.Command.Name, "Err", err)
+		}
+		return
+	}
+	ctx.Client.SendMessageResponse(ctx.Metadata.Channel, msg, ctx.Metadata.MessageID)
+}
+
+// Returns true if the command was used in a whisper.
+func (ctx *CommandContext) IsWhisper() bool {
+	return ctx.Metadata.MessageType == "WHISPER"
+}
+
+// Registers new chat command.
+func (c *Client) RegisterCommand(cmd Command) error {
+	var name = strings.ToLower(strings.TrimPrefix(cmd.Name, CommandPrefix))
+	if len(name) == 0 {
+		return errors.New("command name is empty")
+	}
+	if cmd.Handler == nil {
+		return fmt.Errorf("command %s has no handler", name)
+	}
+
+	var names = []string{name}
+	for _, alias := range cmd.Aliases {
+		alias = strings.ToLower(strings.TrimPrefix(alias, CommandPrefix))
+		if len(alias) > 0 {
+			names = append(names, alias)
+		}
+	}
+
+	c.commandsMutex.Lock()
+	defer c.commandsMutex.Unlock()
+
+	for _, n := range names {
+		if _, ok := c.commands[n]; ok {
+			return fmt.Errorf("command %s is already registered", n)
+		}
+	}
+
+	var command = cmd
+	command.Name = name
+	command.Aliases = names[1:]
+	command.lastUsedBy = make(map[int64]time.Time)
+	for _, n := range names {
+		c.commands[n] = &command
+	}
+	return nil
+}
+
+// Removes registered chat command (with all of it's aliases).
+func (c *Client) UnregisterCommand(name string) {
+	name = strings.ToLower(strings.TrimPrefix(name, CommandPrefix))
+
+	c.commandsMutex.Lock()
+	defer c.commandsMutex.Unlock()
+
+	var cmd, ok = c.commands[name]
+	if !ok {
+		return
+	}
+	delete(c.commands, cmd.Name)
+	for _, alias := range cmd.Aliases {
+		delete(c.commands, alias)
+	}
+}
+
+// Checks chat message for commands.
+func (c *Client) checkForChatCommands(msg string, metadata MessageMetadata) {
+	if !strings.HasPrefix(msg, CommandPrefix) {
+		return
+	}
+	var args = strings.Fields(msg[len(CommandPrefix):])
+	if len(args) == 0 {
+		return
+	}
+	var name = strings.ToLower(args[0])
+
+	c.commandsMutex.Lock()
+	var cmd, ok = c.commands[name]
+	var whisper = metadata.MessageType == "WHISPER"
+	if !ok || (whisper && !cmd.Whisper) {
+		c.commandsMutex.Unlock()
+		return
+	}
+
+	// Check permissions and cooldowns
+	var permission = PermissionFromBadge(metadata.Badge)
+	if permission < cmd.Permission {
+		c.commandsMutex.Unlock()
+		return
+	}
+	var now = c.now()
+	if permission < PermissionModerator {
+		if now.Sub(cmd.lastUsed) < cmd.Cooldown {
+			c.commandsMutex.Unlock()
+			return
+		}
+		if now.Sub(cmd.lastUsedBy[metadata.UserID]) < cmd.UserCooldown {
+			c.commandsMutex.Unlock()
+			return
+		}
+	}
+	cmd.lastUsed = now
+	cmd.lastUsedBy[metadata.UserID] = now
+	c.commandsMutex.Unlock()
+
+	c.emitEvent(&CommandEvent{
+		Channel:  metadata.Channel,
+		Command:  cmd.Name,
+		UserID:   metadata.UserID,
+		UserName: metadata.UserName,
+		Whisper:  whisper,
+	})
+	cmd.Handler(&CommandContext{
+		Client:   c,
+		Command:  cmd,
+		Name:     name,
+		Args:     args[1:],
+		Message:  msg,
+		Metadata: metadata,
+	})
+}
@@ -0,0 +1,245 @@
+package chat
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Parses raw IRC message and processes it the same way as the reader goroutine.
+func receive(c *Client, line string) {
+	c.processMessage(parseMessage([]byte(line)))
+}
+
+// Returns raw PRIVMSG line of the chatter with provided badges (like "moderator/1").
+func privmsg(user, badges, text string) string {
+	return fmt.Sprintf("@badge-info=;badges=%s;color=;display-name=%s;emotes=;id=%s-msg;mod=0;room-id=1;subscriber=0;user-id=%d :%s!%s@%s.tmi.twitch.tv PRIVMSG #channel :%s",
+		badges, user, strings.ToLower(user), userID(user), strings.ToLower(user), strings.ToLower(user), strings.ToLower(user), text)
+}
+
+// Returns stable fake user ID of the chatter.
+func userID(user string) int64 {
+	var id int64 = 100
+	for _, r := range strings.ToLower(user) {
+		id = id*31 + int64(r)
+	}
+	return id % 1_000_000
+}
+
+// Fake clock that only moves when advanced.
+type fakeClock struct {
+	t time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (f *fakeClock) Now() time.Time              { return f.t }
+func (f *fakeClock) Advance(d time.Duration)     { f.t = f.t.Add(d) }
+func (f *fakeClock) Config(config Config) Config { config.Clock = f.Now; return config }
+
+// Registers command recording every use, returns pointer to recorded contexts.
+func registerRecorder(t *testing.T, c *Client, cmd Command) *[]CommandContext {
+	t.Helper()
+	var calls []CommandContext
+	cmd.Handler = func(ctx *CommandContext) {
+		calls = append(calls, *ctx)
+	}
+	if err := c.RegisterCommand(cmd); err != nil {
+		t.Fatalf("RegisterCommand(%s) failed: %v", cmd.Name, err)
+	}
+	return &calls
+}
+
+func TestCommandRouting(t *testing.T) {
+	var c = NewClient(Config{})
+	var calls = registerRecorder(t, c, Command{Name: "!Hello", Aliases: []string{"hi", "!hey"}})
+
+	var tests = []struct {
+		line string
+		name string   // Expected name used to run the command, empty if the command shouldn't run
+		args []string // Expected arguments
+	}{
+		{privmsg("Viewer", "", "!hello"), "hello", []string{}},
+		{privmsg("Viewer", "", "!HELLO   there  friend"), "hello", []string{"there", "friend"}},
+		{privmsg("Viewer", "", "!hi"), "hi", []string{}},
+		{privmsg("Viewer", "", "!hey you"), "hey", []string{"you"}},
+		{privmsg("Viewer", "", "hello"), "", nil},
+		{privmsg("Viewer", "", "say !hello"), "", nil},
+		{privmsg("Viewer", "", "!hellothere"), "", nil},
+		{privmsg("Viewer", "", "!"), "", nil},
+		{privmsg("Viewer", "", "!unknown"), "", nil},
+	}
+	for _, test := range tests {
+		*calls = nil
+		receive(c, test.line)
+		if len(test.name) == 0 {
+			if len(*calls) != 0 {
+				t.Errorf("%q: command ran, but it shouldn't", test.line)
+			}
+			continue
+		}
+		if len(*calls) != 1 {
+			t.Errorf("%q: command ran %d times, expected once", test.line, len(*calls))
+			continue
+		}
+		var ctx = (*calls)[0]
+		if ctx.Name != test.name || ctx.Command.Name != "hello" {
+			t.Errorf("%q: name %q (command %q), expected %q (command \"hello\")", test.line, ctx.Name, ctx.Command.Name, test.name)
+		}
+		if !slices.Equal(ctx.Args, test.args) {
+			t.Errorf("%q: args %q, expected %q", test.line, ctx.Args, test.args)
+		}
+		if ctx.Metadata.UserName != "Viewer" || ctx.Metadata.UserID != userID("Viewer") || ctx.Metadata.MessageID != "viewer-msg" || ctx.Metadata.Channel != "channel" {
+			t.Errorf("%q: unexpected metadata %+v", test.line, ctx.Metadata)
+		}
+	}
+}
+
+func TestCommandPermissions(t *testing.T) {
+	var tests = []struct {
+		permission Permission
+		badges     string
+		run        bool
+	}{
+		{PermissionEveryone, "", true},
+		{PermissionSubscriber, "", false},
+		{PermissionSubscriber, "subscriber/12", true},
+		{PermissionSubscriber, "founder/0", true},
+		{PermissionVIP, "subscriber/12", false},
+		{PermissionVIP, "vip/1", true},
+		{PermissionModerator, "vip/1,subscriber/3", false},
+		{PermissionModerator, "moderator/1", true},
+		{PermissionModerator, "subscriber/3,moderator/1", true},
+		{PermissionBroadcaster, "moderator/1", false},
+		{PermissionBroadcaster, "broadcaster/1", true},
+	}
+	for _, test := range tests {
+		var c = NewClient(Config{})
+		var calls = registerRecorder(t, c, Command{Name: "cmd", Permission: test.permission})
+		receive(c, privmsg("Chatter", test.badges, "!cmd"))
+		if run := len(*calls) == 1; run != test.run {
+			t.Errorf("permission %s, badges %q: command ran %v, expected %v", test.permission.ToString(), test.badges, run, test.run)
+		}
+	}
+}
+
+func TestCommandCooldowns(t *testing.T) {
+	var clock = newFakeClock()
+	var c = NewClient(clock.Config(Config{}))
+	var calls = registerRecorder(t, c, Command{Name: "cmd", Cooldown: time.Second * 10, UserCooldown: time.Second * 30})
+
+	var steps = []struct {
+		advance time.Duration // Time passed before the message
+		user    string
+		badges  string
+		run     bool
+	}{
+		{0, "Alice", "", true},
+		{time.Second * 5, "Bob", "", false},                   // Global cooldown
+		{time.Second * 5, "Bob", "", true},                    // Global cooldown passed
+		{time.Second * 10, "Alice", "", false},                // Alice's cooldown, 20s after her last use
+		{0, "Mod", "moderator/1", true},                       // Moderators skip cooldowns
+		{0, "Mod", "moderator/1", true},                       // Even right after their own use
+		{time.Second * 5, "Carol", "", false},                 // Moderator's use restarted global cooldown
+		{time.Second * 5, "Alice", "", true},                  // 30s after Alice's last use
+		{time.Second * 10, "Streamer", "broadcaster/1", true}, // The broadcaster skips cooldowns
+	}
+	for i, step := range steps {
+		clock.Advance(step.advance)
+		var before = len(*calls)
+		receive(c, privmsg(step.user, step.badges, "!cmd"))
+		if run := len(*calls) > before; run != step.run {
+			t.Errorf("step %d (%s): command ran %v, expected %v", i, step.user, run, step.run)
+		}
+	}
+}
+
+func TestRegisterCommand(t *testing.T) {
+	var c = NewClient(Config{})
+	var handler = func(ctx *CommandContext) {}
+
+	if err := c.RegisterCommand(Command{Name: "!", Handler: handler}); err == nil {
+		t.Error("command with empty name registered")
+	}
+	if err := c.RegisterCommand(Command{Name: "nohandler"}); err == nil {
+		t.Error("command without handler registered")
+	}
+	if err := c.RegisterCommand(Command{Name: "first", Aliases: []string{"one"}, Handler: handler}); err != nil {
+		t.Fatalf("RegisterCommand failed: %v", err)
+	}
+	if err := c.RegisterCommand(Command{Name: "FIRST", Handler: handler}); err == nil {
+		t.Error("command with the same name registered")
+	}
+	if err := c.RegisterCommand(Command{Name: "second", Aliases: []string{"one"}, Handler: handler}); err == nil {
+		t.Error("command with used alias registered")
+	}
+	if _, ok := c.commands["second"]; ok {
+		t.Error("command with used alias partially registered")
+	}
+}
+
+func TestUnregisterCommand(t *testing.T) {
+	var c = NewClient(Config{})
+	var calls = registerRecorder(t, c, Command{Name: "cmd", Aliases: []string{"alias"}})
+
+	c.UnregisterCommand("!ALIAS")
+	receive(c, privmsg("Viewer", "", "!cmd"))
+	receive(c, privmsg("Viewer", "", "!alias"))
+	if len(*calls) != 0 {
+		t.Errorf("unregistered command ran %d times", len(*calls))
+	}
+	// The name can be used again
+	registerRecorder(t, c, Command{Name: "alias"})
+}
+
+func TestCommandWhispers(t *testing.T) {
+	var c = NewClient(Config{})
+	var chatOnly = registerRecorder(t, c, Command{Name: "chat"})
+	var whisper = registerRecorder(t, c, Command{Name: "whisper", Whisper: true})
+	var line = "@badges=;color=;display-name=Viewer;emotes=;message-id=7;thread-id=1_2;turbo=0;user-id=42;user-type= :viewer!viewer@viewer.tmi.twitch.tv WHISPER bot :"
+
+	receive(c, line+"!chat")
+	receive(c, line+"!whisper arg")
+	if len(*chatOnly) != 0 {
+		t.Error("command not allowed in whispers ran from a whisper")
+	}
+	if len(*whisper) != 1 {
+		t.Fatalf("whisper command ran %d times, expected once", len(*whisper))
+	}
+	var ctx = (*whisper)[0]
+	if !ctx.IsWhisper() || ctx.Metadata.UserID != 42 || !slices.Equal(ctx.Args, []string{"arg"}) {
+		t.Errorf("unexpected whisper command context: whisper %v, user %d, args %q", ctx.IsWhisper(), ctx.Metadata.UserID, ctx.Args)
+	}
+}
+
+func TestCommandEventAndReply(t *testing.T) {
+	var c = NewClient(Config{})
+	c.isStarted.Store(true) // Messages are queued only while the chat bot is running
+	var events []*CommandEvent
+	c.Subscribe(func(event Event) {
+		if e, ok := event.(*CommandEvent); ok {
+			events = append(events, e)
+		}
+	})
+	if err := c.RegisterCommand(Command{Name: "ping", Aliases: []string{"p"}, Handler: func(ctx *CommandContext) {
+		ctx.Reply("pong")
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	receive(c, privmsg("Viewer", "", "!p"))
+	if len(events) != 1 || events[0].Command != "ping" || events[0].UserName != "Viewer" || events[0].Channel != "channel" || events[0].Whisper {
+		t.Errorf("unexpected command events %+v", events)
+	}
+	var msg, ok, _ = c.sendQueue.pop(time.Now())
+	if !ok {
+		t.Fatal("reply wasn't queued")
+	}
+	if msg.line != "@reply-parent-msg-id=viewer-msg PRIVMSG #channel :pong\r\n" {
+		t.Errorf("reply %q", msg.line)
+	}
+}
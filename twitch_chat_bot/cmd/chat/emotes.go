@@ -0,0 +1,295 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Chat message emotes.
+// Chat message text is split into fragments of plain text and emotes, so overlays can render emote images.
+// Twitch emotes are read from "emotes" tag (positions are in runes, not bytes).
+// Third-party emotes (BetterTTV, FrankerFaceZ, 7TV) are words of the text matching emote names from emote providers.
+// Emote sets can be loaded from JSON files downloaded from the emote services:
+//
+//	var set, err = chat.LoadEmoteSetFile("bttv.json", chat.EmoteSourceBTTV, "")
+//	var client = chat.NewClient(chat.Config{EmoteProviders: []chat.EmoteProvider{set}})
+
+// Type of message fragment.
+type FragmentType int
+
+const (
+	FragmentText  FragmentType = iota // Plain text
+	FragmentEmote                     // Emote
+)
+
+// Converts fragment type to it's string representation.
+func (t FragmentType) ToString() string {
+	switch t {
+	case FragmentText:
+		return "Text"
+	case FragmentEmote:
+		return "Emote"
+	default:
+		return ""
+	}
+}
+
+// Source of the emote.
+type EmoteSource int
+
+const (
+	EmoteSourceTwitch EmoteSource = iota // Twitch emote from "emotes" tag
+	EmoteSourceBTTV                      // BetterTTV emote
+	EmoteSourceFFZ                       // FrankerFaceZ emote
+	EmoteSource7TV                       // 7TV emote
+)
+
+// Converts emote source to it's string representation.
+func (s EmoteSource) ToString() string {
+	switch s {
+	case EmoteSourceTwitch:
+		return "Twitch"
+	case EmoteSourceBTTV:
+		return "BTTV"
+	case EmoteSourceFFZ:
+		return "FFZ"
+	case EmoteSource7TV:
+		return "7TV"
+	default:
+		return ""
+	}
+}
+
+// Returns URL of the emote image with provided ID.
+func (s EmoteSource) URL(id string) string {
+	switch s {
+	case EmoteSourceTwitch:
+		return fmt.Sprintf("https://static-cdn.jtvnw.net/emoticons/v2/%s/default/dark/1.0", id)
+	case EmoteSourceBTTV:
+		return fmt.Sprintf("https://cdn.betterttv.net/emote/%s/1x", id)
+	case EmoteSourceFFZ:
+		return fmt.Sprintf("https://cdn.frankerfacez.com/emote/%s/1", id)
+	case EmoteSource7TV:
+		return fmt.Sprintf("https://cdn.7tv.app/emote/%s/1x.webp", id)
+	default:
+		return ""
+	}
+}
+
+// Chat emote.
+type Emote struct {
+	ID     string      // Emote ID
+	Name   string      // Emote name, the text that is replaced with the emote
+	Source EmoteSource // Emote service
+	URL    string      // URL of the emote image
+}
+
+// Part of chat message, plain text or an emote.
+type Fragment struct {
+	Type  FragmentType // Fragment type
+	Text  string       // Fragment text, emote name in case of emote
+	Emote *Emote       // Emote, nil for plain text
+}
+
+// Provider of third-party emotes.
+type EmoteProvider interface {
+	Emote(channel, name string) (Emote, bool) // Returns emote with provided name available in the channel
+}
+
+// Splits chat message text into plain text and emote fragments.
+// Twitch emotes are read from emote positions in the tags, remaining text is matched word by word against the emote providers.
+func ParseFragments(text string, tags Tags, channel string, providers ...EmoteProvider) []Fragment {
+	var runes = []rune(text)
+	var fragments []Fragment
+	var pos int
+	for _, e := range tags.Emotes() {
+		if e.Start < pos || e.End >= len(runes) {
+			continue // Overlapping or out of text range
+		}
+		if e.Start > pos {
+			fragments = appendText(fragments, string(runes[pos:e.Start]), channel, providers)
+		}
+		var name = string(runes[e.Start : e.End+1])
+		fragments = append(fragments, Fragment{
+			Type:  FragmentEmote,
+			Text:  name,
+			Emote: &Emote{ID: e.ID, Name: name, Source: EmoteSourceTwitch, URL: EmoteSourceTwitch.URL(e.ID)},
+		})
+		pos = e.End + 1
+	}
+	if pos < len(runes) {
+		fragments = appendText(fragments, string(runes[pos:]), channel, providers)
+	}
+	return fragments
+}
+
+// Appends text to the fragments, replacing words matching third-party emotes with emote fragments.
+func appendText(fragments []Fragment, text string, channel string, providers []EmoteProvider) []Fragment {
+	var plain strings.Builder
+	var flush = func() {
+		if plain.Len() == 0 {
+			return
+		}
+		if len(fragments) > 0 && fragments[len(fragments)-1].Type == FragmentText {
+			fragments[len(fragments)-1].Text += plain.String()
+		} else {
+			fragments = append(fragments, Fragment{Type: FragmentText, Text: plain.String()})
+		}
+		plain.Reset()
+	}
+
+	for len(text) > 0 {
+		// Whitespace is always plain text
+		var idx = strings.IndexFunc(text, func(r rune) bool { return !unicode.IsSpace(r) })
+		if idx != 0 {
+			if idx < 0 {
+				idx = len(text)
+			}
+			plain.WriteString(text[:idx])
+			text = text[idx:]
+			continue
+		}
+
+		idx = strings.IndexFunc(text, unicode.IsSpace)
+		if idx < 0 {
+			idx = len(text)
+		}
+		var word = text[:idx]
+		text = text[idx:]
+		if emote, ok := findEmote(channel, word, providers); ok {
+			flush()
+			fragments = append(fragments, Fragment{Type: FragmentEmote, Text: word, Emote: &emote})
+		} else {
+			plain.WriteString(word)
+		}
+	}
+	flush()
+	return fragments
+}
+
+// Returns emote from the first provider that has it.
+func findEmote(channel, name string, providers []EmoteProvider) (Emote, bool) {
+	for _, p := range providers {
+		if emote, ok := p.Emote(channel, name); ok {
+			return emote, true
+		}
+	}
+	return Emote{}, false
+}
+
+// Set of third-party emotes, global or available in one channel.
+type EmoteSet struct {
+	Channel string // Channel name that the emotes are available in, empty for global emotes
+	emotes  map[string]Emote
+	mutex   sync.RWMutex
+}
+
+// Creates emote set with provided emotes. Empty channel makes the emotes available in all of the channels.
+func NewEmoteSet(channel string, emotes ...Emote) *EmoteSet {
+	var set = &EmoteSet{Channel: normalizeChannel(channel), emotes: make(map[string]Emote)}
+	set.Add(emotes...)
+	return set
+}
+
+// Adds emotes to the set, replacing emotes with the same names.
+func (s *EmoteSet) Add(emotes ...Emote) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, e := range emotes {
+		if len(e.URL) == 0 {
+			e.URL = e.Source.URL(e.ID)
+		}
+		s.emotes[e.Name] = e
+	}
+}
+
+// Returns amount of emotes in the set.
+func (s *EmoteSet) Len() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.emotes)
+}
+
+// Returns emote with provided name (case sensitive) if the set is available in the channel.
+func (s *EmoteSet) Emote(channel, name string) (Emote, bool) {
+	if len(s.Channel) > 0 && s.Channel != normalizeChannel(channel) {
+		return Emote{}, false
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var e, ok = s.emotes[name]
+	return e, ok
+}
+
+// Emote in JSON lists of emote services. Emote name is "code" for BetterTTV and "name" for FrankerFaceZ and 7TV.
+type jsonEmote struct {
+	ID   json.RawMessage `json:"id"` // String or number
+	Code string          `json:"code"`
+	Name string          `json:"name"`
+}
+
+// JSON emote lists of emote services, depending on the endpoint emotes are in different fields.
+type jsonEmoteList struct {
+	Emotes        []jsonEmote `json:"emotes"`        // 7TV emote set
+	ChannelEmotes []jsonEmote `json:"channelEmotes"` // BetterTTV user
+	SharedEmotes  []jsonEmote `json:"sharedEmotes"`  // BetterTTV user
+	Sets          map[string]struct {
+		Emoticons []jsonEmote `json:"emoticons"`
+	} `json:"sets"` // FrankerFaceZ room or global set
+}
+
+// Parses JSON emote list of emote service and returns it as an emote set.
+// Supported formats are plain array of emotes (BetterTTV global emotes), BetterTTV user (channelEmotes and sharedEmotes),
+// FrankerFaceZ sets (sets.*.emoticons) and 7TV emote set (emotes).
+func ParseEmoteSet(r io.Reader, source EmoteSource, channel string) (*EmoteSet, error) {
+	var data, err = io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var emotes []jsonEmote
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "[") {
+		err = json.Unmarshal(data, &emotes)
+	} else {
+		var list jsonEmoteList
+		err = json.Unmarshal(data, &list)
+		emotes = append(emotes, list.Emotes...)
+		emotes = append(emotes, list.ChannelEmotes...)
+		emotes = append(emotes, list.SharedEmotes...)
+		for _, set := range list.Sets {
+			emotes = append(emotes, set.Emoticons...)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s emote set failed: %w", source.ToString(), err)
+	}
+
+	var set = NewEmoteSet(channel)
+	for _, e := range emotes {
+		var id = strings.Trim(string(e.ID), `"`)
+		var name = e.Code
+		if len(name) == 0 {
+			name = e.Name
+		}
+		if len(id) == 0 || len(name) == 0 {
+			continue
+		}
+		set.Add(Emote{ID: id, Name: name, Source: source})
+	}
+	return set, nil
+}
+
+// Loads emote set from JSON file, see ParseEmoteSet.
+func LoadEmoteSetFile(path string, source EmoteSource, channel string) (*EmoteSet, error) {
+	var file, err = os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseEmoteSet(file, source, channel)
+}
@@ -0,0 +1,130 @@
+package chat
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Returns fragments in compact form: plain text in quotes, emotes as "source:id:name".
+func formatFragments(fragments []Fragment) []string {
+	var result []string
+	for _, f := range fragments {
+		if f.Type == FragmentText {
+			result = append(result, fmt.Sprintf("%q", f.Text))
+		} else {
+			result = append(result, fmt.Sprintf("%s:%s:%s", f.Emote.Source.ToString(), f.Emote.ID, f.Text))
+		}
+	}
+	return result
+}
+
+// Loads emote set from testdata, failing the test on error.
+func loadEmoteSet(t *testing.T, file string, source EmoteSource, channel string) *EmoteSet {
+	t.Helper()
+	var set, err = LoadEmoteSetFile(filepath.Join("testdata", file), source, channel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return set
+}
+
+func TestLoadEmoteSetFile(t *testing.T) {
+	var tests = []struct {
+		file   string
+		source EmoteSource
+		emotes map[string]string // Name to ID
+	}{
+		{"bttv_global.json", EmoteSourceBTTV, map[string]string{":tf:": "54fa8f1401e468494b85b537", "DatSauce": "54fa903b01e468494b85b53f", "FeelsGoodMan": "55028923f3e4c3cc78c1ec9b"}},
+		{"bttv_user.json", EmoteSourceBTTV, map[string]string{"catJAM": "5f1d7ee265fe924464ef6e2a", "pepeD": "5e76d338d6581c3724c0f0b2"}},
+		{"ffz_room.json", EmoteSourceFFZ, map[string]string{"LilZ": "28138", "ZreknarF": "27081"}},
+		{"7tv_set.json", EmoteSource7TV, map[string]string{"peepoHappy": "60ae958e229664e8667aea38", "Clap": "603cac391cd55c0014d989be"}},
+	}
+	for _, test := range tests {
+		var set = loadEmoteSet(t, test.file, test.source, "")
+		if set.Len() != len(test.emotes) {
+			t.Errorf("%s: %d emotes, expected %d", test.file, set.Len(), len(test.emotes))
+		}
+		for name, id := range test.emotes {
+			var e, ok = set.Emote("channel", name)
+			if !ok || e.ID != id || e.Name != name || e.Source != test.source || e.URL != test.source.URL(id) {
+				t.Errorf("%s: emote %q is %+v", test.file, name, e)
+			}
+		}
+	}
+
+	if _, err := LoadEmoteSetFile(filepath.Join("testdata", "invalid.json"), EmoteSource7TV, ""); err == nil || !strings.Contains(err.Error(), "7TV") {
+		t.Errorf("invalid file returned %v", err)
+	}
+	if _, err := LoadEmoteSetFile(filepath.Join("testdata", "missing.json"), EmoteSourceBTTV, ""); err == nil {
+		t.Error("missing file didn't return an error")
+	}
+}
+
+func TestEmoteSetChannel(t *testing.T) {
+	var set = loadEmoteSet(t, "ffz_room.json", EmoteSourceFFZ, "#Channel")
+	if _, ok := set.Emote("channel", "LilZ"); !ok {
+		t.Error("channel emote isn't available in the channel")
+	}
+	if _, ok := set.Emote("other", "LilZ"); ok {
+		t.Error("channel emote is available in other channel")
+	}
+	if _, ok := set.Emote("channel", "lilz"); ok {
+		t.Error("emote name matched case insensitively")
+	}
+}
+
+func TestParseFragments(t *testing.T) {
+	var providers = []EmoteProvider{
+		loadEmoteSet(t, "bttv_global.json", EmoteSourceBTTV, ""),
+		loadEmoteSet(t, "7tv_set.json", EmoteSource7TV, "channel"),
+		NewEmoteSet("", Emote{ID: "override", Name: "Clap", Source: EmoteSourceFFZ}),
+	}
+	var tests = []struct {
+		text      string
+		emotes    string // Value of "emotes" tag
+		channel   string
+		fragments []string
+	}{
+		{"hello world", "", "channel", []string{`"hello world"`}},
+		{"Kappa", "25:0-4", "channel", []string{"Twitch:25:Kappa"}},
+		{"Kappa Keepo Kappa", "25:0-4,12-16/1902:6-10", "channel", []string{"Twitch:25:Kappa", `" "`, "Twitch:1902:Keepo", `" "`, "Twitch:25:Kappa"}},
+
+		// Positions are in runes, text before the emote contains multi-byte characters
+		{"héllo 👋 Kappa!", "25:8-12", "channel", []string{`"héllo 👋 "`, "Twitch:25:Kappa", `"!"`}},
+		{"ääää Kappa", "25:5-9", "channel", []string{`"ääää "`, "Twitch:25:Kappa"}},
+
+		// Overlapping and out of range positions are ignored
+		{"Kappa", "25:0-4/1902:2-3", "channel", []string{"Twitch:25:Kappa"}},
+		{"short", "25:3-10", "channel", []string{`"short"`}},
+
+		// Third-party emotes are whole words, the first provider wins
+		{"nice  DatSauce peepoHappy Clap", "", "channel", []string{`"nice  "`, "BTTV:54fa903b01e468494b85b53f:DatSauce", `" "`, "7TV:60ae958e229664e8667aea38:peepoHappy", `" "`, "7TV:603cac391cd55c0014d989be:Clap"}},
+		{"DatSauces :tf:", "", "channel", []string{`"DatSauces "`, "BTTV:54fa8f1401e468494b85b537::tf:"}},
+		{"peepoHappy Clap", "", "other", []string{`"peepoHappy "`, "FFZ:override:Clap"}},
+		{"Kappa FeelsGoodMan ", "25:0-4", "channel", []string{"Twitch:25:Kappa", `" "`, "BTTV:55028923f3e4c3cc78c1ec9b:FeelsGoodMan", `" "`}},
+	}
+	for _, test := range tests {
+		var fragments = formatFragments(ParseFragments(test.text, Tags{"emotes": test.emotes}, test.channel, providers...))
+		if !slices.Equal(fragments, test.fragments) {
+			t.Errorf("ParseFragments(%q, %q, %q) returned %s, expected %s", test.text, test.emotes, test.channel, fragments, test.fragments)
+		}
+	}
+}
+
+func TestMessageFragments(t *testing.T) {
+	var c = NewClient(Config{EmoteProviders: []EmoteProvider{loadEmoteSet(t, "bttv_user.json", EmoteSourceBTTV, "channel")}})
+	var fragments []Fragment
+	c.Subscribe(func(event Event) {
+		if e, ok := event.(*MessageEvent); ok {
+			fragments = e.Metadata.Fragments
+		}
+	})
+	receive(c, strings.Replace(privmsg("Viewer", "", "😀 Kappa catJAM"), "emotes=", "emotes=25:2-6", 1))
+	var expected = []string{`"😀 "`, "Twitch:25:Kappa", `" "`, "BTTV:5f1d7ee265fe924464ef6e2a:catJAM"}
+	if result := formatFragments(fragments); !slices.Equal(result, expected) {
+		t.Errorf("message fragments %s, expected %s", result, expected)
+	}
+}
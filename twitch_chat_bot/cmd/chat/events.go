@@ -0,0 +1,255 @@
+package chat
+
+import "time"
+
+// Chat events.
+// Events are created from special chat messages (subscriptions, raids, bans, room mode changes, etc.).
+// Other packages can react to them by subscribing an event handler on the client with Subscribe.
+// Handlers are called from the chat bot goroutine, long running work should be moved to a separate goroutine.
+// Received event can be checked with a type switch:
+//
+//	client.Subscribe(func(event chat.Event) {
+//		switch e := event.(type) {
+//		case *chat.RaidEvent:
+//			fmt.Println(e.UserName, "raided with", e.Viewers, "viewers")
+//		}
+//	})
+
+// Chat event.
+type Event interface {
+	EventName() string // Name of the event, mostly the same as msg-id tag of the chat message
+}
+
+// Function called when chat event occurs.
+type EventHandler func(event Event)
+
+// Chatter subscribed, resubscribed or upgraded the subscription.
+type SubEvent struct {
+	Channel  string // Channel name
+	MsgID    string // "sub", "resub", "primepaidupgrade", "giftpaidupgrade" or "communitypayforward"
+	UserID   int64  // Chatter ID
+	UserName string // Name of the chatter
+	Tier     string // Subscription plan: "Prime", "1000", "2000" or "3000"
+	Months   int    // Cumulative amount of months
+	Streak   int    // Amount of consecutive months, 0 if the chatter doesn't share it
+	Message  string // Message attached to the subscription
+}
+
+// Chatter gifted subscription to another chatter or random chatters.
+type GiftSubEvent struct {
+	Channel   string // Channel name
+	MsgID     string // "subgift" or "submysterygift"
+	UserID    int64  // Gifter ID
+	UserName  string // Name of the gifter
+	Recipient string // Name of the chatter that received the gift, empty when gifted to random chatters
+	Tier      string // Subscription plan: "1000", "2000" or "3000"
+	Count     int    // Amount of gifted subscriptions
+	Message   string // Message attached to the gift
+}
+
+// Channel got raided.
+type RaidEvent struct {
+	Channel  string // Channel name
+	UserID   int64  // Raider ID
+	UserName string // Name of the raider
+	Viewers  int    // Amount of viewers that came with the raid
+}
+
+// Chatter cheered with bits.
+type CheerEvent struct {
+	Channel   string // Channel name
+	UserID    int64  // Chatter ID
+	UserName  string // Name of the chatter
+	Bits      int    // Amount of bits
+	Message   string // Chat message with the cheer
+	MessageID string // Chat message ID
+}
+
+// Chatter redeemed custom reward that requires text input.
+type RewardRedeemEvent struct {
+	Channel   string // Channel name
+	UserID    int64  // Chatter ID
+	UserName  string // Name of the chatter
+	RewardID  string // Custom reward ID
+	Message   string // Text provided with the redemption
+	MessageID string // Chat message ID
+}
+
+// Moderator or the broadcaster sent an announcement.
+type AnnouncementEvent struct {
+	Channel  string // Channel name
+	UserID   int64  // Chatter ID
+	UserName string // Name of the chatter
+	Color    string // Announcement color: "PRIMARY", "BLUE", "GREEN", "ORANGE" or "PURPLE"
+	Message  string // Announcement text
+}
+
+// Chatter reached viewer milestone (like watch streak).
+type ViewerMilestoneEvent struct {
+	Channel  string // Channel name
+	UserID   int64  // Chatter ID
+	UserName string // Name of the chatter
+	Category string // Milestone category, like "watch-streak"
+	Value    int    // Milestone value
+	Message  string // Message attached to the milestone
+}
+
+// Chatter got banned or timed out.
+type BanEvent struct {
+	Channel  string        // Channel name
+	UserID   int64         // Banned chatter ID
+	UserName string        // Name of the banned chatter
+	Duration time.Duration // Timeout duration, 0 for permanent ban
+}
+
+// All chat messages got cleared.
+type ClearChatEvent struct {
+	Channel string // Channel name
+}
+
+// Single chat message got deleted.
+type MessageDeletedEvent struct {
+	Channel   string // Channel name
+	UserName  string // Name of the chatter that sent the message
+	MessageID string // Deleted message ID
+	Message   string // Deleted message text
+}
+
+// Chatter sent a whisper (private message) to the chat bot.
+type WhisperEvent struct {
+	UserID    int64  // Chatter ID
+	UserName  string // Name of the chatter
+	Login     string // Login of the chatter
+	Message   string // Whisper text
+	MessageID string // Whisper ID
+	ThreadID  string // Whisper thread ID
+}
+
+// Room mode.
+type RoomMode uint8
+
+const (
+	RoomModeEmoteOnly RoomMode = iota
+	RoomModeSubsOnly
+	RoomModeFollowersOnly
+	RoomModeSlow
+)
+
+// Converts room mode to it's string representation.
+func (m RoomMode) ToString() string {
+	switch m {
+	case RoomModeEmoteOnly:
+		return "EmoteOnly"
+	case RoomModeSubsOnly:
+		return "SubsOnly"
+	case RoomModeFollowersOnly:
+		return "FollowersOnly"
+	case RoomModeSlow:
+		return "Slow"
+	default:
+		return ""
+	}
+}
+
+// Room mode got changed.
+type RoomModeEvent struct {
+	Channel string   // Channel name
+	MsgID   string   // msg-id tag of the notice, like "slow_on"
+	Mode    RoomMode // Mode that got changed
+	Enabled bool     // Is the mode turned on?
+}
+
+// Message received from the server, emitted for every message before it's processed.
+type MessageEvent struct {
+	Channel  string          // Channel name, empty if the message isn't related to a channel
+	Time     time.Time       // Time when the message was received
+	Message  Message         // Parsed IRC message
+	Metadata MessageMetadata // Chat message metadata
+}
+
+// Chatter used a chat command, emitted before the command handler is called.
+type CommandEvent struct {
+	Channel  string // Channel name, empty if the command was used in a whisper
+	Command  string // Command name (not the alias that was used)
+	UserID   int64  // Chatter ID
+	UserName string // Name of the chatter
+	Whisper  bool   // Was the command used in a whisper?
+}
+
+// State of the connection to the IRC server.
+type ConnectionState uint8
+
+const (
+	ConnectionConnecting   ConnectionState = iota // Connecting to the server
+	ConnectionConnected                           // Connected and logged in, channels are being joined
+	ConnectionDisconnected                        // Connection was closed, the chat bot reconnects unless it was stopped
+)
+
+// Converts connection state to it's string representation.
+func (s ConnectionState) ToString() string {
+	switch s {
+	case ConnectionConnecting:
+		return "Connecting"
+	case ConnectionConnected:
+		return "Connected"
+	case ConnectionDisconnected:
+		return "Disconnected"
+	default:
+		return ""
+	}
+}
+
+// State of the connection to the IRC server changed.
+type ConnectionEvent struct {
+	State   ConnectionState // New connection state
+	Attempt int             // Connection attempt since last working connection
+	Err     error           // Error that closed the connection, only for ConnectionDisconnected
+}
+
+func (e *SubEvent) EventName() string             { return e.MsgID }
+func (e *GiftSubEvent) EventName() string         { return e.MsgID }
+func (e *RaidEvent) EventName() string            { return "raid" }
+func (e *CheerEvent) EventName() string           { return "cheer" }
+func (e *RewardRedeemEvent) EventName() string    { return "reward" }
+func (e *AnnouncementEvent) EventName() string    { return "announcement" }
+func (e *ViewerMilestoneEvent) EventName() string { return "viewermilestone" }
+func (e *BanEvent) EventName() string             { return "ban" }
+func (e *ClearChatEvent) EventName() string       { return "clearchat" }
+func (e *MessageDeletedEvent) EventName() string  { return "clearmsg" }
+func (e *RoomModeEvent) EventName() string        { return e.MsgID }
+func (e *ConnectionEvent) EventName() string      { return "connection" }
+func (e *MessageEvent) EventName() string         { return "message" }
+func (e *CommandEvent) EventName() string         { return "command" }
+func (e *WhisperEvent) EventName() string         { return "whisper" }
+
+// Subscribes event handler to chat events. Returns subscription ID that can be used to unsubscribe.
+func (c *Client) Subscribe(handler EventHandler) int {
+	c.eventHandlersMutex.Lock()
+	defer c.eventHandlersMutex.Unlock()
+
+	var id = c.eventHandlersNextID
+	c.eventHandlersNextID++
+	c.eventHandlers[id] = handler
+	return id
+}
+
+// Unsubscribes event handler with provided subscription ID.
+func (c *Client) Unsubscribe(id int) {
+	c.eventHandlersMutex.Lock()
+	delete(c.eventHandlers, id)
+	c.eventHandlersMutex.Unlock()
+}
+
+// Calls every subscribed event handler with provided event.
+func (c *Client) emitEvent(event Event) {
+	c.eventHandlersMutex.Lock()
+	var handlers = make([]EventHandler, 0, len(c.eventHandlers))
+	for _, handler := range c.eventHandlers {
+		handlers = append(handlers, handler)
+	}
+	c.eventHandlersMutex.Unlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
@@ -0,0 +1,177 @@
+package chat
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Processes raw IRC message, returns emitted events besides MessageEvent.
+func receiveEvents(line string) []Event {
+	var c = NewClient(Config{})
+	var events []Event
+	c.Subscribe(func(event Event) {
+		if _, ok := event.(*MessageEvent); !ok {
+			events = append(events, event)
+		}
+	})
+	receive(c, line)
+	return events
+}
+
+func TestEvents(t *testing.T) {
+	// Recorded messages, based on examples from Twitch IRC documentation
+	var tests = []struct {
+		name  string
+		line  string
+		event Event // Expected event, nil if no event should be emitted
+	}{
+		{
+			"sub",
+			`@badge-info=subscriber/0;badges=subscriber/0,premium/1;color=;display-name=NewSub;emotes=;flags=;id=5e3ee8a9-23b5-4b34-b4a5-9e4ec4a4d7bb;login=newsub;mod=0;msg-id=sub;msg-param-cumulative-months=1;msg-param-months=0;msg-param-multimonth-duration=1;msg-param-multimonth-tenure=0;msg-param-should-share-streak=0;msg-param-sub-plan-name=Channel\sSubscription;msg-param-sub-plan=1000;msg-param-was-gifted=false;room-id=12345678;subscriber=1;system-msg=NewSub\ssubscribed\sat\sTier\s1.;tmi-sent-ts=1700000000000;user-id=11112222;user-type= :tmi.twitch.tv USERNOTICE #dallas`,
+			&SubEvent{Channel: "dallas", MsgID: "sub", UserID: 11112222, UserName: "NewSub", Tier: "1000", Months: 1},
+		},
+		{
+			"resub",
+			`@badge-info=subscriber/8;badges=subscriber/6,glitchcon2020/1;color=#FF0000;display-name=ronni;emotes=;id=db25007f-7a18-43eb-9379-80131e44d633;login=ronni;mod=0;msg-id=resub;msg-param-cumulative-months=6;msg-param-streak-months=2;msg-param-should-share-streak=1;msg-param-sub-plan=Prime;msg-param-sub-plan-name=Prime;room-id=12345678;subscriber=1;system-msg=ronni\shas\ssubscribed\sfor\s6\smonths!;tmi-sent-ts=1507246572675;user-id=87654321;user-type= :tmi.twitch.tv USERNOTICE #dallas :Great stream -- keep it up!`,
+			&SubEvent{Channel: "dallas", MsgID: "resub", UserID: 87654321, UserName: "ronni", Tier: "Prime", Months: 6, Streak: 2, Message: "Great stream -- keep it up!"},
+		},
+		{
+			"giftpaidupgrade",
+			`@badge-info=;badges=;color=;display-name=Upgrader;emotes=;id=1;login=upgrader;mod=0;msg-id=giftpaidupgrade;msg-param-sender-login=gifter;msg-param-sender-name=Gifter;room-id=12345678;subscriber=1;system-msg=Upgrader\sis\scontinuing\sthe\sGift\sSub;tmi-sent-ts=1700000000000;user-id=33334444;user-type= :tmi.twitch.tv USERNOTICE #dallas`,
+			&SubEvent{Channel: "dallas", MsgID: "giftpaidupgrade", UserID: 33334444, UserName: "Upgrader"},
+		},
+		{
+			"subgift",
+			`@badge-info=;badges=staff/1,premium/1;color=#0000FF;display-name=TWW2;emotes=;id=e9176cd8-5e22-4684-ad40-ce53c2561c5e;login=tww2;mod=0;msg-id=subgift;msg-param-months=1;msg-param-recipient-display-name=Mr_Woodchuck;msg-param-recipient-id=55554444;msg-param-recipient-name=mr_woodchuck;msg-param-sub-plan-name=House\sof\sNyoro~n;msg-param-sub-plan=1000;room-id=19571752;subscriber=0;system-msg=TWW2\sgifted\sa\sTier\s1\ssub\sto\sMr_Woodchuck!;tmi-sent-ts=1521159445153;user-id=87654321;user-type=staff :tmi.twitch.tv USERNOTICE #forstycup`,
+			&GiftSubEvent{Channel: "forstycup", MsgID: "subgift", UserID: 87654321, UserName: "TWW2", Recipient: "Mr_Woodchuck", Tier: "1000", Count: 1},
+		},
+		{
+			"submysterygift",
+			`@badge-info=;badges=;color=;display-name=Generous;emotes=;id=2;login=generous;mod=0;msg-id=submysterygift;msg-param-mass-gift-count=5;msg-param-origin-id=abc;msg-param-sender-count=25;msg-param-sub-plan=2000;room-id=12345678;subscriber=0;system-msg=Generous\sis\sgifting\s5\sTier\s2\sSubs!;tmi-sent-ts=1700000000000;user-id=55556666;user-type= :tmi.twitch.tv USERNOTICE #dallas`,
+			&GiftSubEvent{Channel: "dallas", MsgID: "submysterygift", UserID: 55556666, UserName: "Generous", Tier: "2000", Count: 5},
+		},
+		{
+			"raid",
+			`@badge-info=;badges=turbo/1;color=#9ACD32;display-name=TestChannel;emotes=;id=3d830f12-795c-447d-af3c-ea05e40fbddb;login=testchannel;mod=0;msg-id=raid;msg-param-displayName=TestChannel;msg-param-login=testchannel;msg-param-viewerCount=15;room-id=33332222;subscriber=0;system-msg=15\sraiders\sfrom\sTestChannel\shave\sjoined\n!;tmi-sent-ts=1507246572675;turbo=1;user-id=123456;user-type= :tmi.twitch.tv USERNOTICE #othertestchannel`,
+			&RaidEvent{Channel: "othertestchannel", UserID: 123456, UserName: "TestChannel", Viewers: 15},
+		},
+		{
+			"announcement",
+			`@badge-info=;badges=moderator/1;color=;display-name=ModName;emotes=;flags=;id=7;login=modname;mod=1;msg-id=announcement;msg-param-color=PURPLE;room-id=12345678;subscriber=0;system-msg=;tmi-sent-ts=1700000000000;user-id=77778888;user-type=mod :tmi.twitch.tv USERNOTICE #dallas :Stream starts soon!`,
+			&AnnouncementEvent{Channel: "dallas", UserID: 77778888, UserName: "ModName", Color: "PURPLE", Message: "Stream starts soon!"},
+		},
+		{
+			"viewermilestone",
+			`@badge-info=;badges=;color=;display-name=Loyal;emotes=;id=8;login=loyal;mod=0;msg-id=viewermilestone;msg-param-category=watch-streak;msg-param-copoReward=350;msg-param-id=x;msg-param-value=5;room-id=12345678;subscriber=0;system-msg=Loyal\swatched\s5\sconsecutive\sstreams;tmi-sent-ts=1700000000000;user-id=99990000;user-type= :tmi.twitch.tv USERNOTICE #dallas :Hello!`,
+			&ViewerMilestoneEvent{Channel: "dallas", UserID: 99990000, UserName: "Loyal", Category: "watch-streak", Value: 5, Message: "Hello!"},
+		},
+		{
+			"unknown usernotice",
+			`@badge-info=;badges=;display-name=Someone;id=9;login=someone;msg-id=bitsbadgetier;room-id=12345678;user-id=1 :tmi.twitch.tv USERNOTICE #dallas`,
+			nil,
+		},
+		{
+			"cheer",
+			`@badge-info=;badges=bits/100;bits=100;color=;display-name=Cheerer;emotes=;id=10;mod=0;room-id=12345678;subscriber=0;tmi-sent-ts=1700000000000;user-id=12121212;user-type= :cheerer!cheerer@cheerer.tmi.twitch.tv PRIVMSG #dallas :cheer100 Nice play!`,
+			&CheerEvent{Channel: "dallas", UserID: 12121212, UserName: "Cheerer", Bits: 100, Message: "cheer100 Nice play!", MessageID: "10"},
+		},
+		{
+			"reward",
+			`@badge-info=;badges=;color=;custom-reward-id=27c8e506-a0a4-4919-b0e1-3c5f9b7d2b1c;display-name=Redeemer;emotes=;id=11;mod=0;room-id=12345678;subscriber=0;tmi-sent-ts=1700000000000;user-id=34343434;user-type= :redeemer!redeemer@redeemer.tmi.twitch.tv PRIVMSG #dallas :Play some music`,
+			&RewardRedeemEvent{Channel: "dallas", UserID: 34343434, UserName: "Redeemer", RewardID: "27c8e506-a0a4-4919-b0e1-3c5f9b7d2b1c", Message: "Play some music", MessageID: "11"},
+		},
+		{
+			"timeout",
+			`@ban-duration=350;room-id=12345678;target-user-id=87654321;tmi-sent-ts=1642719320727 :tmi.twitch.tv CLEARCHAT #dallas :ronni`,
+			&BanEvent{Channel: "dallas", UserID: 87654321, UserName: "ronni", Duration: time.Second * 350},
+		},
+		{
+			"ban",
+			`@room-id=12345678;target-user-id=87654321;tmi-sent-ts=1642715756806 :tmi.twitch.tv CLEARCHAT #dallas :ronni`,
+			&BanEvent{Channel: "dallas", UserID: 87654321, UserName: "ronni"},
+		},
+		{
+			"clear chat",
+			`@room-id=12345678;tmi-sent-ts=1642715695392 :tmi.twitch.tv CLEARCHAT #dallas`,
+			&ClearChatEvent{Channel: "dallas"},
+		},
+		{
+			"clear message",
+			`@login=ronni;room-id=;target-msg-id=abc-123-def;tmi-sent-ts=1642720582342 :tmi.twitch.tv CLEARMSG #dallas :HeyGuys`,
+			&MessageDeletedEvent{Channel: "dallas", UserName: "ronni", MessageID: "abc-123-def", Message: "HeyGuys"},
+		},
+		{
+			"slow mode",
+			`@msg-id=slow_on :tmi.twitch.tv NOTICE #dallas :This room is now in slow mode. You may send messages every 10 seconds.`,
+			&RoomModeEvent{Channel: "dallas", MsgID: "slow_on", Mode: RoomModeSlow, Enabled: true},
+		},
+		{
+			"followers only off",
+			`@msg-id=followers_off :tmi.twitch.tv NOTICE #dallas :This room is no longer in followers-only mode.`,
+			&RoomModeEvent{Channel: "dallas", MsgID: "followers_off", Mode: RoomModeFollowersOnly, Enabled: false},
+		},
+		{
+			"unknown notice",
+			`@msg-id=msg_channel_suspended :tmi.twitch.tv NOTICE #dallas :This channel does not exist or has been suspended.`,
+			nil,
+		},
+		{
+			"whisper",
+			`@badges=;color=;display-name=Viewer;emotes=;message-id=7;thread-id=1_2;turbo=0;user-id=42;user-type= :viewer!viewer@viewer.tmi.twitch.tv WHISPER bot :hi there`,
+			&WhisperEvent{UserID: 42, UserName: "Viewer", Login: "viewer", Message: "hi there", MessageID: "7", ThreadID: "1_2"},
+		},
+		{
+			"welcome",
+			`:tmi.twitch.tv 001 bot :Welcome, GLHF!`,
+			&ConnectionEvent{State: ConnectionConnected},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var events = receiveEvents(test.line)
+			if test.event == nil {
+				if len(events) != 0 {
+					t.Fatalf("expected no events, got %#v", events)
+				}
+				return
+			}
+			if len(events) != 1 {
+				t.Fatalf("expected 1 event, got %d: %#v", len(events), events)
+			}
+			if !reflect.DeepEqual(events[0], test.event) {
+				t.Errorf("got %#v\nexpected %#v", events[0], test.event)
+			}
+			if events[0].EventName() != test.event.EventName() {
+				t.Errorf("event name %q, expected %q", events[0].EventName(), test.event.EventName())
+			}
+		})
+	}
+}
+
+func TestMessageEvent(t *testing.T) {
+	var c = NewClient(newFakeClock().Config(Config{}))
+	var events []*MessageEvent
+	var id = c.Subscribe(func(event Event) {
+		if e, ok := event.(*MessageEvent); ok {
+			events = append(events, e)
+		}
+	})
+
+	receive(c, privmsg("Viewer", "vip/1", "hello"))
+	receive(c, "PING :tmi.twitch.tv")
+	c.Unsubscribe(id)
+	receive(c, privmsg("Viewer", "", "not received"))
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 message events, got %d", len(events))
+	}
+	var e = events[0]
+	if e.Channel != "channel" || e.Message.Command != "PRIVMSG" || e.Message.Trailing != "hello" || e.Metadata.Badge != "VIP" || e.Time != newFakeClock().Now() {
+		t.Errorf("unexpected message event %+v", e)
+	}
+	if events[1].Message.Command != "PING" || events[1].Channel != "" {
+		t.Errorf("unexpected PING message event %+v", events[1])
+	}
+}
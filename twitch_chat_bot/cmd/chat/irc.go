@@ -0,0 +1,295 @@
+package chat
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// IRC message parser.
+// Messages are parsed according to IRCv3 message format:
+// [@tags SPACE] [:prefix SPACE] command [params] [:trailing]
+// Tag values are unescaped as described in IRCv3 message tags specification.
+// Twitch specific tags (badges, emotes, reply-parent, etc.) can be read with typed accessors of Tags.
+
+// Parsed IRC message.
+type Message struct {
+	Raw      string   // Whole message, without line ending
+	Tags     Tags     // Message tags, empty map if the message doesn't have tags
+	Prefix   Prefix   // Message source
+	Command  string   // Message command, like "PRIVMSG", "PING" or numeric reply like "001"
+	Params   []string // Message parameters, without the trailing one
+	Trailing string   // Trailing parameter, chat message text in case of PRIVMSG
+}
+
+// Source of the IRC message.
+type Prefix struct {
+	Nick string // Nick or server name
+	User string
+	Host string
+}
+
+// IRC message tags.
+type Tags map[string]string
+
+// Chat badge.
+type Badge struct {
+	Name    string // Badge name, like "subscriber"
+	Version string // Badge version, like "12"
+}
+
+// Position of emote in chat message text.
+type EmoteRange struct {
+	ID    string // Emote ID
+	Start int    // Index of first character of the emote, in runes
+	End   int    // Index of last character of the emote, in runes
+}
+
+// Chat message that the message is replying to.
+type ReplyParent struct {
+	MessageID   string // Parent message ID
+	UserID      int64  // Parent message sender ID
+	UserLogin   string // Parent message sender login
+	DisplayName string // Parent message sender name
+	Body        string // Parent message text
+}
+
+// Parses IRC message.
+func ParseMessage(line string) (msg Message, err error) {
+	line = strings.TrimRight(line, "\r\n")
+	msg.Raw = line
+	msg.Tags = make(Tags)
+
+	// Tags
+	if strings.HasPrefix(line, "@") {
+		var idx = strings.IndexByte(line, ' ')
+		if idx < 0 {
+			return msg, errors.New("message contains only tags")
+		}
+		parseTags(line[1:idx], msg.Tags)
+		line = strings.TrimLeft(line[idx:], " ")
+	}
+
+	// Prefix
+	if strings.HasPrefix(line, ":") {
+		var idx = strings.IndexByte(line, ' ')
+		if idx < 0 {
+			return msg, errors.New("message contains only prefix")
+		}
+		msg.Prefix = parsePrefix(line[1:idx])
+		line = strings.TrimLeft(line[idx:], " ")
+	}
+
+	// Command
+	var idx = strings.IndexByte(line, ' ')
+	if idx < 0 {
+		idx = len(line)
+	}
+	msg.Command = line[:idx]
+	if len(msg.Command) == 0 {
+		return msg, errors.New("message is missing command")
+	}
+	line = line[idx:]
+
+	// Params
+	for {
+		line = strings.TrimLeft(line, " ")
+		if len(line) == 0 {
+			break
+		}
+		if line[0] == ':' {
+			msg.Trailing = line[1:]
+			break
+		}
+		idx = strings.IndexByte(line, ' ')
+		if idx < 0 {
+			idx = len(line)
+		}
+		msg.Params = append(msg.Params, line[:idx])
+		line = line[idx:]
+	}
+
+	return msg, nil
+}
+
+// Parses message tags (without leading '@') into provided map.
+func parseTags(s string, tags Tags) {
+	for _, tag := range strings.Split(s, ";") {
+		if len(tag) == 0 {
+			continue
+		}
+		var key, value, _ = strings.Cut(tag, "=")
+		if len(key) == 0 {
+			continue
+		}
+		tags[key] = unescapeTagValue(value)
+	}
+}
+
+// Unescapes message tag value.
+func unescapeTagValue(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+
+	var sb strings.Builder
+	sb.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			sb.WriteByte(s[i])
+			continue
+		}
+		i++
+		if i >= len(s) {
+			break // Lone backslash at the end is dropped
+		}
+		switch s[i] {
+		case ':':
+			sb.WriteByte(';')
+		case 's':
+			sb.WriteByte(' ')
+		case '\\':
+			sb.WriteByte('\\')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'n':
+			sb.WriteByte('\n')
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String()
+}
+
+// Escapes message tag value.
+func escapeTagValue(s string) string {
+	var replacer = strings.NewReplacer("\\", "\\\\", ";", "\\:", " ", "\\s", "\r", "\\r", "\n", "\\n")
+	return replacer.Replace(s)
+}
+
+// Parses message prefix (without leading ':').
+func parsePrefix(s string) (prefix Prefix) {
+	var idx = strings.IndexByte(s, '@')
+	if idx >= 0 {
+		prefix.Host = s[(idx + 1):]
+		s = s[:idx]
+	}
+	idx = strings.IndexByte(s, '!')
+	if idx >= 0 {
+		prefix.User = s[(idx + 1):]
+		s = s[:idx]
+	}
+	prefix.Nick = s
+	return
+}
+
+// Returns channel name (without '#') that the message was sent to, empty if the message isn't related to a channel.
+func (m *Message) Channel() string {
+	if len(m.Params) == 0 || !strings.HasPrefix(m.Params[0], "#") {
+		return ""
+	}
+	return m.Params[0][1:]
+}
+
+// Returns integer value of the tag, 0 if the tag is missing or is not a number.
+func (t Tags) Int(tag string) int {
+	var num, err = strconv.Atoi(t[tag])
+	if err != nil {
+		return 0
+	}
+	return num
+}
+
+// Returns true if the tag value is "1".
+func (t Tags) Bool(tag string) bool {
+	return t[tag] == "1"
+}
+
+// Returns chatter badges.
+func (t Tags) Badges() []Badge {
+	return parseBadges(t["badges"])
+}
+
+// Returns additional badge information, like exact amount of subscribed months.
+func (t Tags) BadgeInfo() []Badge {
+	return parseBadges(t["badge-info"])
+}
+
+// Returns version of the badge with provided name and true, or empty string and false if the chatter doesn't have the badge.
+func (t Tags) Badge(name string) (string, bool) {
+	for _, badge := range t.Badges() {
+		if badge.Name == name {
+			return badge.Version, true
+		}
+	}
+	return "", false
+}
+
+// Returns emote positions in the chat message, sorted by position.
+func (t Tags) Emotes() []EmoteRange {
+	var emotes []EmoteRange
+	for _, emote := range strings.Split(t["emotes"], "/") {
+		var id, ranges, ok = strings.Cut(emote, ":")
+		if !ok || len(id) == 0 {
+			continue
+		}
+		for _, r := range strings.Split(ranges, ",") {
+			var startStr, endStr, ok = strings.Cut(r, "-")
+			if !ok {
+				continue
+			}
+			var start, err1 = strconv.Atoi(startStr)
+			var end, err2 = strconv.Atoi(endStr)
+			if err1 != nil || err2 != nil || start < 0 || end < start {
+				continue
+			}
+			emotes = append(emotes, EmoteRange{ID: id, Start: start, End: end})
+		}
+	}
+	slices.SortFunc(emotes, func(a, b EmoteRange) int { return a.Start - b.Start })
+	return emotes
+}
+
+// Returns chatter name color in hex format (like "#1E90FF"), empty if the chatter didn't set the color.
+func (t Tags) Color() string {
+	return t["color"]
+}
+
+// Returns true if this is the first message of the chatter in the channel.
+func (t Tags) FirstMessage() bool {
+	return t.Bool("first-msg")
+}
+
+// Returns true if the chatter is a returning chatter.
+func (t Tags) ReturningChatter() bool {
+	return t.Bool("returning-chatter")
+}
+
+// Returns chat message that the message is replying to and true, or false if the message isn't a reply.
+func (t Tags) ReplyParent() (parent ReplyParent, ok bool) {
+	parent.MessageID, ok = t["reply-parent-msg-id"]
+	if !ok {
+		return
+	}
+	parent.UserID, _ = strconv.ParseInt(t["reply-parent-user-id"], 10, 64)
+	parent.UserLogin = t["reply-parent-user-login"]
+	parent.DisplayName = t["reply-parent-display-name"]
+	parent.Body = t["reply-parent-msg-body"]
+	return
+}
+
+// Parses badges tag value, like "broadcaster/1,subscriber/12".
+func parseBadges(s string) []Badge {
+	if len(s) == 0 {
+		return nil
+	}
+	var badges []Badge
+	for _, b := range strings.Split(s, ",") {
+		var name, version, _ = strings.Cut(b, "/")
+		if len(name) > 0 {
+			badges = append(badges, Badge{Name: name, Version: version})
+		}
+	}
+	return badges
+}
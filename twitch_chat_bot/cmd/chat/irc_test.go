@@ -0,0 +1,221 @@
+package chat
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMessage(t *testing.T) {
+	var tests = []struct {
+		line string
+		msg  Message // Expected message, Raw is filled in by the test
+		err  bool
+	}{
+		{
+			line: "PING :tmi.twitch.tv",
+			msg:  Message{Tags: Tags{}, Command: "PING", Trailing: "tmi.twitch.tv"},
+		},
+		{
+			line: ":tmi.twitch.tv 001 bot :Welcome, GLHF!\r\n",
+			msg:  Message{Tags: Tags{}, Prefix: Prefix{Nick: "tmi.twitch.tv"}, Command: "001", Params: []string{"bot"}, Trailing: "Welcome, GLHF!"},
+		},
+		{
+			line: "@badges=broadcaster/1;display-name=Ronni;emote-only=1;room-id=1 :ronni!ronni@ronni.tmi.twitch.tv PRIVMSG #ronni :Kappa Keepo",
+			msg: Message{
+				Tags:     Tags{"badges": "broadcaster/1", "display-name": "Ronni", "emote-only": "1", "room-id": "1"},
+				Prefix:   Prefix{Nick: "ronni", User: "ronni", Host: "ronni.tmi.twitch.tv"},
+				Command:  "PRIVMSG",
+				Params:   []string{"#ronni"},
+				Trailing: "Kappa Keepo",
+			},
+		},
+		{
+			line: `@system-msg=15\sraiders\sfrom\sTest\n!;empty=;flag;=novalue;semi=a\:b;back=c\\d;lone=e\ :tmi.twitch.tv USERNOTICE #test`,
+			msg: Message{
+				Tags:    Tags{"system-msg": "15 raiders from Test\n!", "empty": "", "flag": "", "semi": "a;b", "back": `c\d`, "lone": "e"},
+				Prefix:  Prefix{Nick: "tmi.twitch.tv"},
+				Command: "USERNOTICE",
+				Params:  []string{"#test"},
+			},
+		},
+		{
+			line: ":bot.tmi.twitch.tv 353 bot = #channel :bot other",
+			msg:  Message{Tags: Tags{}, Prefix: Prefix{Nick: "bot.tmi.twitch.tv"}, Command: "353", Params: []string{"bot", "=", "#channel"}, Trailing: "bot other"},
+		},
+		{
+			line: "@a=b   :nick   JOIN    #channel   ",
+			msg:  Message{Tags: Tags{"a": "b"}, Prefix: Prefix{Nick: "nick"}, Command: "JOIN", Params: []string{"#channel"}},
+		},
+		{
+			line: "PRIVMSG #channel ::starts with colon",
+			msg:  Message{Tags: Tags{}, Command: "PRIVMSG", Params: []string{"#channel"}, Trailing: ":starts with colon"},
+		},
+		{
+			line: "PRIVMSG #channel :",
+			msg:  Message{Tags: Tags{}, Command: "PRIVMSG", Params: []string{"#channel"}},
+		},
+		{line: "@only=tags", err: true},
+		{line: ":only.prefix", err: true},
+		{line: "@a=b :prefix ", err: true},
+		{line: "", err: true},
+	}
+
+	for _, test := range tests {
+		var msg, err = ParseMessage(test.line)
+		if (err != nil) != test.err {
+			t.Errorf("%q: error %v, expected error %v", test.line, err, test.err)
+			continue
+		}
+		if test.err {
+			continue
+		}
+		test.msg.Raw = strings.TrimRight(test.line, "\r\n")
+		if !reflect.DeepEqual(msg, test.msg) {
+			t.Errorf("%q:\ngot      %#v\nexpected %#v", test.line, msg, test.msg)
+		}
+	}
+}
+
+func TestMessageChannel(t *testing.T) {
+	var tests = map[string]string{
+		"PRIVMSG #channel :hi":            "channel",
+		"WHISPER bot :hi":                 "",
+		"PING :tmi.twitch.tv":             "",
+		":tmi.twitch.tv CLEARCHAT #other": "other",
+	}
+	for line, channel := range tests {
+		var msg, _ = ParseMessage(line)
+		if msg.Channel() != channel {
+			t.Errorf("%q: channel %q, expected %q", line, msg.Channel(), channel)
+		}
+	}
+}
+
+func TestTagValueEscaping(t *testing.T) {
+	var tests = []struct {
+		value   string
+		escaped string
+	}{
+		{"", ""},
+		{"plain", "plain"},
+		{"two words", `two\swords`},
+		{"a;b", `a\:b`},
+		{`back\slash`, `back\\slash`},
+		{"line\r\nbreak", `line\r\nbreak`},
+		{`\s is not a space`, `\\s\sis\snot\sa\sspace`},
+		{"zażółć ; gęślą", `zażółć\s\:\sgęślą`},
+	}
+	for _, test := range tests {
+		if escaped := escapeTagValue(test.value); escaped != test.escaped {
+			t.Errorf("escapeTagValue(%q) = %q, expected %q", test.value, escaped, test.escaped)
+		}
+		if value := unescapeTagValue(test.escaped); value != test.value {
+			t.Errorf("unescapeTagValue(%q) = %q, expected %q", test.escaped, value, test.value)
+		}
+	}
+
+	// Invalid escapes are tolerated
+	var invalid = map[string]string{
+		`a\`:    "a",
+		`\x\y`:  "xy",
+		`\\\`:   `\`,
+		`end\\`: `end\`,
+	}
+	for escaped, value := range invalid {
+		if v := unescapeTagValue(escaped); v != value {
+			t.Errorf("unescapeTagValue(%q) = %q, expected %q", escaped, v, value)
+		}
+	}
+}
+
+func TestTagsRoundTrip(t *testing.T) {
+	var tags = Tags{
+		"display-name":          "Some One",
+		"reply-parent-msg-body": `hi; how\are you?` + "\r\n",
+		"empty":                 "",
+	}
+	var parts []string
+	for key, value := range tags {
+		parts = append(parts, key+"="+escapeTagValue(value))
+	}
+	var msg, err = ParseMessage("@" + strings.Join(parts, ";") + " PRIVMSG #channel :text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(msg.Tags, tags) {
+		t.Errorf("tags %q, expected %q", msg.Tags, tags)
+	}
+}
+
+func FuzzTagValueRoundTrip(f *testing.F) {
+	for _, s := range []string{"", "plain", "two words", `a;b\c`, "\r\n", `\s`, "zażółć"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, value string) {
+		var escaped = escapeTagValue(value)
+		if strings.ContainsAny(escaped, " ;\r\n") {
+			t.Errorf("escapeTagValue(%q) = %q contains characters that should be escaped", value, escaped)
+		}
+		if got := unescapeTagValue(escaped); got != value {
+			t.Errorf("round trip of %q: escaped %q, unescaped %q", value, escaped, got)
+		}
+	})
+}
+
+func FuzzParseMessage(f *testing.F) {
+	for _, line := range []string{
+		"PING :tmi.twitch.tv",
+		":tmi.twitch.tv 001 bot :Welcome, GLHF!",
+		"@badges=broadcaster/1;display-name=Ronni :ronni!ronni@ronni.tmi.twitch.tv PRIVMSG #ronni :Kappa Keepo",
+		`@system-msg=a\sb\:c\\d\n;flag;=x :tmi.twitch.tv USERNOTICE #test`,
+		"@a=b   :nick   JOIN    #channel   ",
+		"@only=tags",
+		":prefix",
+		"",
+	} {
+		f.Add(line)
+	}
+	f.Fuzz(func(t *testing.T, line string) {
+		var msg, err = ParseMessage(line)
+		if msg.Raw != strings.TrimRight(line, "\r\n") {
+			t.Errorf("Raw %q doesn't match the line %q", msg.Raw, line)
+		}
+		if msg.Tags == nil {
+			t.Error("Tags are nil")
+		}
+		if err != nil {
+			return
+		}
+		if len(msg.Command) == 0 || strings.Contains(msg.Command, " ") {
+			t.Errorf("invalid command %q", msg.Command)
+		}
+		for _, param := range msg.Params {
+			if len(param) == 0 || strings.Contains(param, " ") || param[0] == ':' {
+				t.Errorf("invalid param %q", param)
+			}
+		}
+		for key, value := range msg.Tags {
+			if len(key) == 0 {
+				t.Errorf("empty tag key with value %q", value)
+			}
+			if got := unescapeTagValue(escapeTagValue(value)); got != value {
+				t.Errorf("tag %s value %q doesn't survive escaping round trip, got %q", key, value, got)
+			}
+		}
+		// Accessors shouldn't panic on any parsed message
+		msg.Channel()
+		msg.Tags.Badges()
+		msg.Tags.Emotes()
+		msg.Tags.ReplyParent()
+	})
+}
+
+func BenchmarkParseMessage(b *testing.B) {
+	var line = `@badge-info=subscriber/8;badges=subscriber/6,glitchcon2020/1;client-nonce=e5d5e5a4;color=#FF0000;display-name=ronni;emotes=25:0-4,12-16/1902:6-10;first-msg=0;flags=;id=db25007f-7a18-43eb-9379-80131e44d633;mod=0;reply-parent-msg-body=How\sare\syou?;returning-chatter=0;room-id=12345678;subscriber=1;tmi-sent-ts=1507246572675;turbo=0;user-id=87654321;user-type= :ronni!ronni@ronni.tmi.twitch.tv PRIVMSG #dallas :Kappa Keepo Kappa`
+	b.ReportAllocs()
+	b.SetBytes(int64(len(line)))
+	for i := 0; i < b.N; i++ {
+		ParseMessage(line)
+	}
+}
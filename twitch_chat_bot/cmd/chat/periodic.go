@@ -0,0 +1,138 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+// Periodic messages.
+// Every channel can have a list of messages that are posted on an interval.
+// The message is posted only when enough chat messages were received since the last one,
+// so the bot doesn't spam an empty chat. Messages are rotated in order or picked at random.
+// Messages with OnlyWhenLive set are posted only in channels marked as live with SetChannelLive.
+// Live status isn't known from IRC chat, the caller has to set it (for example from EventSub stream.online / stream.offline).
+// Time is taken from Config.Clock, so the scheduler can be driven by a fake clock.
+
+const periodicMessagesCheckInterval = time.Second // How often periodic messages are checked
+
+// Periodic messages configuration for a channel.
+type PeriodicMessages struct {
+	Channel         string        // Channel name
+	Messages        []string      // Messages to post
+	Interval        time.Duration // Minimum time between periodic messages
+	MinChatMessages int           // Minimum amount of chat messages since last periodic message
+	Random          bool          // Pick random message instead of rotating them in order?
+	OnlyWhenLive    bool          // Post messages only when the channel is marked as live with SetChannelLive?
+}
+
+// State of periodic messages of a channel.
+type periodicState struct {
+	config       PeriodicMessages
+	last         int       // Index of last posted message
+	lastSent     time.Time // Time when last periodic message was posted
+	chatMessages int       // Amount of chat messages since last periodic message
+}
+
+// Adds periodic messages to the channel, replacing previous ones.
+func (c *Client) AddPeriodicMessages(config PeriodicMessages) error {
+	config.Channel = normalizeChannel(config.Channel)
+	if len(config.Channel) == 0 {
+		return errors.New("channel name is empty")
+	}
+	if len(config.Messages) == 0 {
+		return errors.New("no messages provided")
+	}
+	if config.Interval <= 0 {
+		return errors.New("interval has to be greater than 0")
+	}
+
+	config.Messages = slices.Clone(config.Messages)
+
+	c.periodicMutex.Lock()
+	defer c.periodicMutex.Unlock()
+	c.periodic[config.Channel] = &periodicState{
+		config:   config,
+		last:     -1,
+		lastSent: c.now(),
+	}
+	return nil
+}
+
+// Removes periodic messages of the channel.
+func (c *Client) RemovePeriodicMessages(channel string) {
+	c.periodicMutex.Lock()
+	delete(c.periodic, normalizeChannel(channel))
+	c.periodicMutex.Unlock()
+}
+
+// Marks the channel as live or offline. Periodic messages with OnlyWhenLive set are posted only in live channels.
+func (c *Client) SetChannelLive(channel string, live bool) {
+	c.periodicMutex.Lock()
+	c.live[normalizeChannel(channel)] = live
+	c.periodicMutex.Unlock()
+}
+
+// Counts chat message received in the channel.
+func (c *Client) countPeriodicChatMessage(channel string) {
+	c.periodicMutex.Lock()
+	if state, ok := c.periodic[channel]; ok {
+		state.chatMessages++
+	}
+	c.periodicMutex.Unlock()
+}
+
+// Checks periodic messages on an interval until the context is canceled.
+func (c *Client) runPeriodicMessages(ctx context.Context) {
+	var ticker = time.NewTicker(periodicMessagesCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if c.isConnected.Load() {
+				c.UpdatePeriodicMessages()
+			}
+		}
+	}
+}
+
+// Posts periodic messages that are due. It's called automatically while the chat bot is running.
+func (c *Client) UpdatePeriodicMessages() {
+	var now = c.now()
+	var toSend = make(map[string]string)
+
+	c.periodicMutex.Lock()
+	for channel, state := range c.periodic {
+		if state.config.OnlyWhenLive && !c.live[channel] {
+			continue
+		}
+		if now.Sub(state.lastSent) < state.config.Interval || state.chatMessages < state.config.MinChatMessages {
+			continue
+		}
+
+		var count = len(state.config.Messages)
+		var idx int
+		if state.config.Random {
+			// Random message, but not the same as the last one
+			idx = rand.IntN(count)
+			if count > 1 && idx == state.last {
+				idx = (idx + 1) % count
+			}
+		} else {
+			idx = (state.last + 1) % count
+		}
+		toSend[channel] = state.config.Messages[idx]
+		state.last = idx
+		state.lastSent = now
+		state.chatMessages = 0
+	}
+	c.periodicMutex.Unlock()
+
+	for channel, msg := range toSend {
+		c.SendMessage(channel, msg)
+	}
+}
@@ -0,0 +1,198 @@
+package chat
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns texts of chat messages waiting in the send queue, removing them from the queue.
+// Duplicate detection uses real time, so it's reset to allow posting the same message again.
+func sentMessages(c *Client) []string {
+	c.sendQueue.mutex.Lock()
+	clear(c.sendQueue.recent)
+	c.sendQueue.mutex.Unlock()
+
+	var texts []string
+	for {
+		var msg, ok, _ = c.sendQueue.pop(time.Now())
+		if !ok {
+			return texts
+		}
+		var m, _ = ParseMessage(strings.TrimSuffix(msg.line, "\r\n"))
+		texts = append(texts, msg.channel+": "+m.Trailing)
+	}
+}
+
+// Creates running client with periodic messages driven by the fake clock.
+func newPeriodicClient(t *testing.T, clock *fakeClock, configs ...PeriodicMessages) *Client {
+	t.Helper()
+	var c = NewClient(clock.Config(Config{}))
+	c.isStarted.Store(true) // Messages are queued only while the chat bot is running
+	for _, config := range configs {
+		if err := c.AddPeriodicMessages(config); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+func TestPeriodicMessagesInterval(t *testing.T) {
+	var clock = newFakeClock()
+	var c = newPeriodicClient(t, clock, PeriodicMessages{
+		Channel:  "#Channel",
+		Messages: []string{"first", "second", "third"},
+		Interval: time.Minute * 10,
+	})
+
+	var steps = []struct {
+		advance time.Duration
+		sent    []string
+	}{
+		{0, nil},
+		{time.Minute*10 - time.Second, nil},
+		{time.Second, []string{"channel: first"}},
+		{time.Minute * 5, nil},
+		{time.Minute * 5, []string{"channel: second"}},
+		{time.Minute * 30, []string{"channel: third"}}, // Missed intervals don't pile up
+		{0, nil},
+		{time.Minute * 10, []string{"channel: first"}},
+	}
+	for i, step := range steps {
+		clock.Advance(step.advance)
+		c.UpdatePeriodicMessages()
+		if sent := sentMessages(c); !slices.Equal(sent, step.sent) {
+			t.Errorf("step %d: sent %q, expected %q", i, sent, step.sent)
+		}
+	}
+}
+
+func TestPeriodicMessagesMinChatMessages(t *testing.T) {
+	var clock = newFakeClock()
+	var c = newPeriodicClient(t, clock, PeriodicMessages{
+		Channel:         "channel",
+		Messages:        []string{"first", "second"},
+		Interval:        time.Minute,
+		MinChatMessages: 2,
+	})
+
+	clock.Advance(time.Hour)
+	c.UpdatePeriodicMessages()
+	if sent := sentMessages(c); len(sent) != 0 {
+		t.Fatalf("sent %q to empty chat", sent)
+	}
+
+	// Only chat messages in the channel are counted
+	receive(c, privmsg("Viewer", "", "hello"))
+	receive(c, "@id=1;user-id=5 :other!other@other.tmi.twitch.tv PRIVMSG #other :hi")
+	c.UpdatePeriodicMessages()
+	if sent := sentMessages(c); len(sent) != 0 {
+		t.Fatalf("sent %q after one chat message", sent)
+	}
+	receive(c, privmsg("Viewer", "", "still here"))
+	c.UpdatePeriodicMessages()
+	if sent := sentMessages(c); !slices.Equal(sent, []string{"channel: first"}) {
+		t.Fatalf("sent %q, expected the first message", sent)
+	}
+
+	// Counter is reset after posting
+	receive(c, privmsg("Viewer", "", "one"))
+	clock.Advance(time.Minute)
+	c.UpdatePeriodicMessages()
+	if sent := sentMessages(c); len(sent) != 0 {
+		t.Fatalf("sent %q, but the counter wasn't reset", sent)
+	}
+}
+
+func TestPeriodicMessagesLive(t *testing.T) {
+	var clock = newFakeClock()
+	var c = newPeriodicClient(t, clock,
+		PeriodicMessages{Channel: "live", Messages: []string{"live message"}, Interval: time.Minute, OnlyWhenLive: true},
+		PeriodicMessages{Channel: "always", Messages: []string{"always message"}, Interval: time.Minute},
+	)
+
+	clock.Advance(time.Minute)
+	c.UpdatePeriodicMessages()
+	if sent := sentMessages(c); !slices.Equal(sent, []string{"always: always message"}) {
+		t.Errorf("offline: sent %q", sent)
+	}
+
+	c.SetChannelLive("#LIVE", true)
+	c.UpdatePeriodicMessages()
+	if sent := sentMessages(c); !slices.Equal(sent, []string{"live: live message"}) {
+		t.Errorf("live: sent %q", sent)
+	}
+
+	c.SetChannelLive("live", false)
+	clock.Advance(time.Minute)
+	c.UpdatePeriodicMessages()
+	if sent := sentMessages(c); !slices.Equal(sent, []string{"always: always message"}) {
+		t.Errorf("offline again: sent %q", sent)
+	}
+}
+
+func TestPeriodicMessagesRandom(t *testing.T) {
+	var clock = newFakeClock()
+	var c = newPeriodicClient(t, clock, PeriodicMessages{
+		Channel:  "channel",
+		Messages: []string{"a", "b"},
+		Interval: time.Minute,
+		Random:   true,
+	})
+
+	// The same message is never posted twice in a row
+	var last string
+	for i := 0; i < 10; i++ {
+		clock.Advance(time.Minute)
+		c.UpdatePeriodicMessages()
+		var sent = sentMessages(c)
+		if len(sent) != 1 {
+			t.Fatalf("tick %d: sent %q, expected one message", i, sent)
+		}
+		if sent[0] == last {
+			t.Fatalf("tick %d: %q posted twice in a row", i, last)
+		}
+		last = sent[0]
+	}
+}
+
+func TestPeriodicMessagesChanges(t *testing.T) {
+	var clock = newFakeClock()
+	var c = newPeriodicClient(t, clock, PeriodicMessages{Channel: "channel", Messages: []string{"old"}, Interval: time.Minute})
+
+	// Replacing messages restarts the interval
+	clock.Advance(time.Second * 30)
+	c.AddPeriodicMessages(PeriodicMessages{Channel: "channel", Messages: []string{"new"}, Interval: time.Minute})
+	clock.Advance(time.Second * 30)
+	c.UpdatePeriodicMessages()
+	if sent := sentMessages(c); len(sent) != 0 {
+		t.Errorf("sent %q before the interval of replaced messages", sent)
+	}
+	clock.Advance(time.Second * 30)
+	c.UpdatePeriodicMessages()
+	if sent := sentMessages(c); !slices.Equal(sent, []string{"channel: new"}) {
+		t.Errorf("sent %q, expected replaced message", sent)
+	}
+
+	c.RemovePeriodicMessages("#Channel")
+	clock.Advance(time.Hour)
+	c.UpdatePeriodicMessages()
+	if sent := sentMessages(c); len(sent) != 0 {
+		t.Errorf("sent %q after removing periodic messages", sent)
+	}
+}
+
+func TestAddPeriodicMessagesErrors(t *testing.T) {
+	var c = NewClient(Config{})
+	for _, config := range []PeriodicMessages{
+		{Channel: "#", Messages: []string{"a"}, Interval: time.Minute},
+		{Channel: "channel", Interval: time.Minute},
+		{Channel: "channel", Messages: []string{"a"}},
+		{Channel: "channel", Messages: []string{"a"}, Interval: -time.Minute},
+	} {
+		if err := c.AddPeriodicMessages(config); err == nil {
+			t.Errorf("AddPeriodicMessages(%+v) didn't fail", config)
+		}
+	}
+}
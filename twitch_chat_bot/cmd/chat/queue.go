@@ -0,0 +1,242 @@
+package chat
+
+import (
+	"sync"
+	"time"
+)
+
+// Queue of messages to send.
+// Messages are sent through two lanes:
+// - high priority lane (PONG, JOIN, PART) that isn't rate limited and is always sent first,
+// - chat messages lane that is rate limited per channel with a token bucket.
+// Twitch allows 20 messages per 30 seconds for regular chatters and 100 messages per 30 seconds
+// if the bot is the broadcaster or a moderator in the channel (based on received USERSTATE).
+// VIPs don't get the higher limit, a VIP bot using it would get globally rate limited.
+// The same message sent to the same channel within 30 seconds is dropped, Twitch would reject it anyway.
+// Duplicates are checked for the whole message, parts of a long message are either all sent or all dropped.
+// Chat messages are kept in the queue when the connection is lost and are sent after reconnecting,
+// high priority messages are related to the lost connection and are dropped.
+
+const rateLimitPeriod = time.Second * 30        // Period of chat messages rate limit
+const rateLimitRegular = 20                     // Messages per period for regular chatters
+const rateLimitElevated = 100                   // Messages per period for the broadcaster and moderators
+const duplicateMessagePeriod = time.Second * 30 // Time in which the same message can't be sent again
+
+// Chat message waiting in the queue.
+type queuedMessage struct {
+	channel string // Channel the message is sent to, empty for high priority messages
+	line    string // Whole IRC message
+}
+
+// Statistics of the send queue.
+type QueueStats struct {
+	HighPriority int    // Amount of messages waiting in high priority lane
+	Pending      int    // Amount of chat messages waiting to be sent
+	Sent         uint64 // Amount of sent messages (both lanes)
+	Duplicates   uint64 // Amount of chat messages dropped as duplicates
+}
+
+// Queue of chat messages to send to chat.
+type messageQueue struct {
+	mutex      sync.Mutex
+	high       []queuedMessage         // High priority messages
+	messages   []queuedMessage         // Chat messages
+	buckets    map[string]*tokenBucket // Rate limit of the channel, key is channel name
+	elevated   map[string]bool         // Is the bot elevated (broadcaster or moderator) in the channel?
+	recent     map[string]time.Time    // Time when the message was queued, key is channel and whole message text
+	sent       uint64
+	duplicates uint64
+	notify     chan struct{} // Signaled when new messages are added to the queue
+}
+
+// Creates new message queue.
+func newMessageQueue() *messageQueue {
+	return &messageQueue{
+		buckets:  make(map[string]*tokenBucket),
+		elevated: make(map[string]bool),
+		recent:   make(map[string]time.Time),
+		notify:   make(chan struct{}, 1),
+	}
+}
+
+// Add message to high priority lane.
+func (q *messageQueue) pushHigh(line string) {
+	q.mutex.Lock()
+	q.high = append(q.high, queuedMessage{line: line})
+	q.mutex.Unlock()
+	q.signal()
+}
+
+// Add chat message split into parts to the queue. Returns false if the message was dropped as a duplicate.
+func (q *messageQueue) push(channel, text string, parts []queuedMessage, now time.Time) bool {
+	q.mutex.Lock()
+	for key, t := range q.recent {
+		if now.Sub(t) >= duplicateMessagePeriod {
+			delete(q.recent, key)
+		}
+	}
+	var key = channel + " " + text
+	if _, found := q.recent[key]; found {
+		q.duplicates++
+		q.mutex.Unlock()
+		return false
+	}
+	q.recent[key] = now
+	q.messages = append(q.messages, parts...)
+	q.mutex.Unlock()
+
+	q.signal()
+	return true
+}
+
+// Notifies the writer that there are pending messages.
+func (q *messageQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+		// Writer is already notified
+	}
+}
+
+// Take next message that can be sent and true. If there is no such message, returns false
+// and time after which next message can be sent (or 0 if the queue is empty).
+func (q *messageQueue) pop(now time.Time) (msg queuedMessage, ok bool, wait time.Duration) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if len(q.high) > 0 {
+		msg = q.high[0]
+		q.high = q.high[1:]
+		q.sent++
+		return msg, true, 0
+	}
+
+	// Only the first message of every channel is checked, so messages are sent in order
+	var checked = make(map[string]bool)
+	for i, msg := range q.messages {
+		if checked[msg.channel] {
+			continue
+		}
+		checked[msg.channel] = true
+
+		var w = q.bucket(msg.channel).take(now)
+		if w == 0 {
+			q.messages = append(q.messages[:i], q.messages[(i+1):]...)
+			q.sent++
+			return msg, true, 0
+		}
+		if wait == 0 || w < wait {
+			wait = w
+		}
+	}
+	return msg, false, wait
+}
+
+// Puts back chat message that couldn't be sent, so it's sent first after reconnecting.
+func (q *messageQueue) requeue(msg queuedMessage) {
+	if len(msg.channel) == 0 {
+		return // High priority messages are not sent again
+	}
+	q.mutex.Lock()
+	q.messages = append([]queuedMessage{msg}, q.messages...)
+	q.sent--
+	q.mutex.Unlock()
+}
+
+// Removes high priority messages, they are related to previous connection.
+func (q *messageQueue) clearHigh() {
+	q.mutex.Lock()
+	q.high = q.high[:0]
+	q.mutex.Unlock()
+}
+
+// Sets if the bot is elevated (broadcaster or moderator) in the channel, changing it's rate limit.
+func (q *messageQueue) setElevated(channel string, elevated bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.elevated[channel] == elevated {
+		return
+	}
+	q.elevated[channel] = elevated
+	if b, ok := q.buckets[channel]; ok {
+		b.setLimit(q.limit(channel), rateLimitPeriod)
+	}
+	q.signal()
+}
+
+// Returns rate limit bucket of the channel. Should be called with locked mutex.
+func (q *messageQueue) bucket(channel string) *tokenBucket {
+	var b, ok = q.buckets[channel]
+	if !ok {
+		b = newTokenBucket(q.limit(channel), rateLimitPeriod)
+		q.buckets[channel] = b
+	}
+	return b
+}
+
+// Returns amount of messages per rate limit period for the channel. Should be called with locked mutex.
+func (q *messageQueue) limit(channel string) int {
+	if q.elevated[channel] {
+		return rateLimitElevated
+	}
+	return rateLimitRegular
+}
+
+// Returns statistics of the queue.
+func (q *messageQueue) stats() QueueStats {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return QueueStats{
+		HighPriority: len(q.high),
+		Pending:      len(q.messages),
+		Sent:         q.sent,
+		Duplicates:   q.duplicates,
+	}
+}
+
+// Token bucket rate limiter.
+type tokenBucket struct {
+	capacity float64   // Maximum amount of tokens
+	tokens   float64   // Available tokens
+	rate     float64   // Tokens added per second
+	last     time.Time // Last time tokens were added
+}
+
+// Creates new full token bucket allowing count of actions per period.
+func newTokenBucket(count int, period time.Duration) *tokenBucket {
+	var b = &tokenBucket{}
+	b.setLimit(count, period)
+	b.tokens = b.capacity
+	return b
+}
+
+// Changes amount of actions allowed per period.
+func (b *tokenBucket) setLimit(count int, period time.Duration) {
+	b.capacity = float64(count)
+	b.rate = float64(count) / period.Seconds()
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+}
+
+// Takes a token if available and returns 0, otherwise returns time after which the token will be available.
+func (b *tokenBucket) take(now time.Time) time.Duration {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	var wait = time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	if wait <= 0 {
+		wait = time.Millisecond
+	}
+	return wait
+}
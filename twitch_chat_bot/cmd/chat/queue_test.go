@@ -0,0 +1,145 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestElevatedRateLimit(t *testing.T) {
+	var tests = []struct {
+		badges   string
+		elevated bool
+	}{
+		{"", false},
+		{"subscriber/12", false},
+		{"vip/1", false},
+		{"moderator/1", true},
+		{"broadcaster/1", true},
+	}
+	for _, test := range tests {
+		var c = NewClient(Config{})
+		receive(c, "@badge-info=;badges="+test.badges+";color=;display-name=Bot;emote-sets=0;mod=0;subscriber=0;user-type= :tmi.twitch.tv USERSTATE #channel")
+		if c.sendQueue.elevated["channel"] != test.elevated {
+			t.Errorf("badges %q: elevated %v, expected %v", test.badges, c.sendQueue.elevated["channel"], test.elevated)
+		}
+		var expected = rateLimitRegular
+		if test.elevated {
+			expected = rateLimitElevated
+		}
+		if limit := c.sendQueue.limit("channel"); limit != expected {
+			t.Errorf("badges %q: rate limit %d, expected %d", test.badges, limit, expected)
+		}
+	}
+}
+
+func TestMessageQueueDuplicates(t *testing.T) {
+	var c = NewClient(Config{})
+	c.isStarted.Store(true) // Messages are queued only while the chat bot is running
+
+	// Long messages starting with the same part are different messages, all of their parts are queued
+	var start = strings.Repeat("word ", messageSendMaxLength/5)
+	c.SendMessage("channel", start+"first")
+	c.SendMessage("channel", start+"second")
+	c.SendMessage("other", start+"first")
+	if stats := c.QueueStats(); stats.Pending != 6 || stats.Duplicates != 0 {
+		t.Errorf("%d messages queued, %d duplicates", stats.Pending, stats.Duplicates)
+	}
+	// Repeated message is dropped as a whole
+	c.SendMessage("#Channel", start+"first")
+	if stats := c.QueueStats(); stats.Pending != 6 || stats.Duplicates != 1 {
+		t.Errorf("%d messages queued, %d duplicates", stats.Pending, stats.Duplicates)
+	}
+
+	var q = newMessageQueue()
+	var now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var parts = []queuedMessage{{channel: "channel", line: "PRIVMSG #channel :hi\r\n"}}
+	if !q.push("channel", "hi", parts, now) || q.push("channel", "hi", parts, now.Add(duplicateMessagePeriod-time.Second)) {
+		t.Error("message repeated within the period wasn't dropped")
+	}
+	if !q.push("channel", "hi", parts, now.Add(duplicateMessagePeriod)) {
+		t.Error("message repeated after the period was dropped")
+	}
+}
+
+func TestMessageQueuePriority(t *testing.T) {
+	var q = newMessageQueue()
+	var now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < rateLimitRegular+1; i++ {
+		var text = fmt.Sprint(i)
+		q.push("channel", text, []queuedMessage{{channel: "channel", line: text}}, now)
+	}
+	q.pushHigh("PONG")
+
+	// High priority message is sent first
+	if msg, ok, _ := q.pop(now); !ok || msg.line != "PONG" {
+		t.Fatalf("first sent message %q, expected PONG", msg.line)
+	}
+	for i := 0; i < rateLimitRegular; i++ {
+		if msg, ok, _ := q.pop(now); !ok || msg.line != fmt.Sprint(i) {
+			t.Fatalf("sent message %q, expected %d", msg.line, i)
+		}
+	}
+
+	// Chat messages over the rate limit wait, high priority messages don't
+	if _, ok, wait := q.pop(now); ok || wait <= 0 {
+		t.Errorf("message over the rate limit sent %v, wait %s", ok, wait)
+	}
+	q.pushHigh("JOIN #other")
+	if msg, ok, _ := q.pop(now); !ok || msg.line != "JOIN #other" {
+		t.Errorf("high priority message %q over the rate limit wasn't sent", msg.line)
+	}
+
+	// After reconnect, requeued chat message is sent first and high priority messages are dropped
+	q.pushHigh("PONG")
+	q.clearHigh()
+	q.requeue(queuedMessage{channel: "channel", line: "lost"}) // Not counted as sent anymore
+	if msg, ok, _ := q.pop(now.Add(rateLimitPeriod)); !ok || msg.line != "lost" {
+		t.Errorf("first message after reconnect %q, expected requeued message", msg.line)
+	}
+	if stats := q.stats(); stats.HighPriority != 0 || stats.Pending != 1 || stats.Sent != rateLimitRegular+2 {
+		t.Errorf("unexpected queue stats %+v", stats)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	var b = newTokenBucket(rateLimitRegular, rateLimitPeriod)
+	var now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < rateLimitRegular; i++ {
+		if wait := b.take(now); wait != 0 {
+			t.Fatalf("take %d of full bucket returned wait %s", i, wait)
+		}
+	}
+
+	// Empty bucket refills one token per 1.5 seconds (20 per 30 seconds)
+	var interval = rateLimitPeriod / rateLimitRegular
+	if wait := b.take(now); wait != interval {
+		t.Errorf("empty bucket returned wait %s, expected %s", wait, interval)
+	}
+	if wait := b.take(now.Add(interval / 3)); wait != interval*2/3 {
+		t.Errorf("partially refilled bucket returned wait %s, expected %s", wait, interval*2/3)
+	}
+	now = now.Add(interval)
+	if wait := b.take(now); wait != 0 {
+		t.Errorf("refilled token wasn't available, wait %s", wait)
+	}
+
+	// Bucket doesn't refill over its capacity
+	now = now.Add(time.Hour)
+	b.take(now)
+	if b.tokens != rateLimitRegular-1 {
+		t.Errorf("%.1f tokens left after refill, expected %d", b.tokens, rateLimitRegular-1)
+	}
+
+	// Lowered limit caps the available tokens, raised limit refills faster
+	b.setLimit(5, rateLimitPeriod)
+	if b.tokens != 5 {
+		t.Errorf("%.1f tokens after lowering the limit to 5", b.tokens)
+	}
+	b.setLimit(rateLimitElevated, rateLimitPeriod)
+	b.tokens = 0
+	if wait := b.take(now); wait != rateLimitPeriod/rateLimitElevated {
+		t.Errorf("elevated bucket returned wait %s", wait)
+	}
+}
@@ -0,0 +1,132 @@
+package chat
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Chat message splitting.
+// Twitch limits chat messages to 500 characters, longer messages are split into multiple parts.
+// Message length is counted in characters (runes), not bytes.
+// Messages are split at spaces when possible, otherwise between characters.
+// Characters that are displayed as one (emoji with modifiers, letters with combining marks, flags)
+// are never split, they are kept together as one grapheme cluster.
+// New line characters are replaced with spaces, otherwise they could be used to inject IRC commands.
+
+var MessageContinuationPrefix = "" // Prefix added to every part of split message except the first one, like "(cont.) "
+
+// Replaces new line and other control characters with spaces and trims the message.
+func SanitizeMessage(msg string) string {
+	if !strings.ContainsFunc(msg, unicode.IsControl) {
+		return strings.TrimSpace(msg)
+	}
+	msg = strings.ReplaceAll(msg, "\r\n", " ")
+	msg = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, msg)
+	return strings.TrimSpace(msg)
+}
+
+// Splits the message into parts of at most maxLength characters.
+// Continuation prefix is added to every part except the first one and counts into the part length.
+func SplitMessage(msg string, maxLength int, continuationPrefix string) []string {
+	msg = SanitizeMessage(msg)
+	if len(msg) == 0 {
+		return nil
+	}
+	if utf8.RuneCountInString(msg) <= maxLength {
+		return []string{msg}
+	}
+
+	var parts []string
+	var prefix string
+	var limit = maxLength
+	for len(msg) > 0 {
+		var end, length, lastSpace int
+		lastSpace = -1
+		for end < len(msg) {
+			var size, count = nextGraphemeCluster(msg[end:])
+			if length+count > limit {
+				break
+			}
+			if msg[end] == ' ' {
+				lastSpace = end
+			}
+			end += size
+			length += count
+		}
+
+		if end >= len(msg) {
+			// Rest of the message fits
+		} else if msg[end] == ' ' {
+			// Split exactly at a space
+		} else if lastSpace > 0 {
+			end = lastSpace
+		} else if end == 0 {
+			// Limit is smaller than a single grapheme cluster, take it anyway
+			end, _ = nextGraphemeCluster(msg)
+		}
+
+		var part = strings.TrimRight(msg[:end], " ")
+		if len(part) > 0 {
+			parts = append(parts, prefix+part)
+		}
+		msg = strings.TrimLeft(msg[end:], " ")
+
+		// Next parts start with continuation prefix
+		if len(prefix) == 0 && len(continuationPrefix) > 0 {
+			prefix = continuationPrefix
+			limit = max(maxLength-utf8.RuneCountInString(prefix), 1)
+		}
+	}
+	return parts
+}
+
+// Returns size in bytes and length in characters of the first grapheme cluster in the string.
+// It's a simplified version of Unicode text segmentation rules, it handles combining marks,
+// variation selectors, emoji modifiers, zero width joiner sequences, regional indicator pairs (flags) and tag sequences.
+func nextGraphemeCluster(s string) (size, count int) {
+	var r, n = utf8.DecodeRuneInString(s)
+	size, count = n, 1
+
+	var regionalIndicators = 0
+	if isRegionalIndicator(r) {
+		regionalIndicators = 1
+	}
+	var joined = false
+	for size < len(s) {
+		var next, n = utf8.DecodeRuneInString(s[size:])
+		switch {
+		case joined:
+			// Character after zero width joiner is part of the cluster
+			joined = false
+		case next == '\u200d':
+			joined = true
+		case isRegionalIndicator(next) && regionalIndicators == 1:
+			regionalIndicators = 2
+		case isGraphemeExtend(next):
+		default:
+			return
+		}
+		size += n
+		count++
+	}
+	return
+}
+
+// Returns true if the character extends previous character (it's displayed together with it).
+func isGraphemeExtend(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc) ||
+		(r >= 0xFE00 && r <= 0xFE0F) || // Variation selectors
+		(r >= 0x1F3FB && r <= 0x1F3FF) || // Emoji skin tone modifiers
+		(r >= 0xE0020 && r <= 0xE007F) // Tag characters (subdivision flags)
+}
+
+// Returns true if the character is a regional indicator, two of them create a flag.
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
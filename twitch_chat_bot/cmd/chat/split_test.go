@@ -0,0 +1,102 @@
+package chat
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizeMessage(t *testing.T) {
+	var tests = []struct {
+		msg       string
+		sanitized string
+	}{
+		{"hello", "hello"},
+		{"  padded \t", "padded"},
+		{"line1\r\nline2", "line1 line2"},
+		{"a\nb\rc\td", "a b c d"},
+		{"hi\r\nPRIVMSG #other :injected", "hi PRIVMSG #other :injected"},
+		{"\x00text\x7f", "text"},
+		{"next\u0085line", "next line"},
+		{"zażółć\ngęślą", "zażółć gęślą"},
+		{"\r\n\r\n", ""},
+	}
+	for _, test := range tests {
+		if sanitized := SanitizeMessage(test.msg); sanitized != test.sanitized {
+			t.Errorf("SanitizeMessage(%q) = %q, expected %q", test.msg, sanitized, test.sanitized)
+		}
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	var tests = []struct {
+		name      string
+		msg       string
+		maxLength int
+		prefix    string
+		parts     []string
+	}{
+		{"empty", "", 10, "", nil},
+		{"only new lines", "\r\n \n", 10, "", nil},
+		{"fits", "short", 10, "", []string{"short"}},
+		{"exact length", "0123456789", 10, "", []string{"0123456789"}},
+		{"split at space on the limit", "hello world foo", 11, "", []string{"hello world", "foo"}},
+		{"split at last space", "hello world foo", 8, "", []string{"hello", "world", "foo"}},
+		{"multiple spaces", "a    b", 3, "", []string{"a", "b"}},
+		{"no spaces", "abcdefghij", 4, "", []string{"abcd", "efgh", "ij"}},
+		{"new lines", "aaa\nbbb\r\nccc", 3, "", []string{"aaa", "bbb", "ccc"}},
+		{"multibyte runes", "żółćżółć", 4, "", []string{"żółć", "żółć"}},
+		{"multibyte runes with spaces", "zażółć gęślą jaźń", 12, "", []string{"zażółć gęślą", "jaźń"}},
+		{"cjk", "日本語のテキスト", 3, "", []string{"日本語", "のテキ", "スト"}},
+		{"combining marks", "ééé", 3, "", []string{"é", "é", "é"}},
+		{"flags", "🇵🇱🇵🇱🇵🇱", 3, "", []string{"🇵🇱", "🇵🇱", "🇵🇱"}},
+		{"skin tones", "👍🏽👍🏽", 3, "", []string{"👍🏽", "👍🏽"}},
+		{"zero width joiner", "a👨‍👩‍👧", 3, "", []string{"a", "👨‍👩‍👧"}},
+		{"variation selector", "☺️☺️", 2, "", []string{"☺️", "☺️"}},
+		{"subdivision flag", "🏴\U000e0067\U000e0062\U000e0065\U000e006e\U000e0067\U000e007f x", 7, "", []string{"🏴\U000e0067\U000e0062\U000e0065\U000e006e\U000e0067\U000e007f", "x"}},
+		{"continuation prefix", "one two three four", 9, "(c) ", []string{"one two", "(c) three", "(c) four"}},
+		{"continuation prefix not added to single part", "one two", 9, "(c) ", []string{"one two"}},
+		{"continuation prefix with multibyte runes", "żółć żółć żółć", 9, "… ", []string{"żółć żółć", "… żółć"}},
+		{"continuation prefix longer than the limit", "abcdef", 3, "(continued) ", []string{"abc", "(continued) d", "(continued) e", "(continued) f"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var parts = SplitMessage(test.msg, test.maxLength, test.prefix)
+			if !slices.Equal(parts, test.parts) {
+				t.Fatalf("SplitMessage(%q, %d, %q) = %q, expected %q", test.msg, test.maxLength, test.prefix, parts, test.parts)
+			}
+			for _, part := range parts {
+				if !utf8.ValidString(part) {
+					t.Errorf("part %q is not valid UTF-8", part)
+				}
+				if strings.ContainsAny(part, "\r\n") {
+					t.Errorf("part %q contains new line", part)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitMessageLimit(t *testing.T) {
+	var msg = strings.Repeat("Kappa żółć 👍🏽 ", 100)
+	for _, prefix := range []string{"", "(cont.) "} {
+		var parts = SplitMessage(msg, messageSendMaxLength, prefix)
+		if len(parts) < 2 {
+			t.Fatalf("prefix %q: message wasn't split", prefix)
+		}
+		var joined []string
+		for i, part := range parts {
+			if n := utf8.RuneCountInString(part); n > messageSendMaxLength {
+				t.Errorf("prefix %q: part %d has %d characters", prefix, i, n)
+			}
+			if i > 0 && !strings.HasPrefix(part, prefix) {
+				t.Errorf("prefix %q: part %d %q doesn't start with the prefix", prefix, i, part)
+			}
+			joined = append(joined, strings.TrimPrefix(part, prefix))
+		}
+		if strings.Join(joined, " ") != strings.TrimSpace(msg) {
+			t.Errorf("prefix %q: parts don't add up to the message", prefix)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// Transports used to exchange IRC messages with the server.
+// Raw TCP connection (with or without TLS) is used by default.
+// When server address starts with "ws://" or "wss://" WebSocket connection is used instead,
+// each WebSocket frame contains one IRC message.
+
+// Connection to the IRC server.
+type Transport interface {
+	Read(b []byte) (n int, err error)  // Reads received data, blocks until data is received or the connection is closed
+	Write(b []byte) (n int, err error) // Sends IRC messages, each ending with "\r\n"
+	Close() error                      // Closes the connection, unblocking pending reads
+}
+
+// Connects to the IRC server using transport selected by the server address.
+func (c *Client) dial(ctx context.Context) (Transport, error) {
+	if c.config.Dial != nil {
+		return c.config.Dial(ctx)
+	}
+	var server = c.config.Server
+	if strings.HasPrefix(server, "ws://") || strings.HasPrefix(server, "wss://") {
+		return dialWebSocket(ctx, server, c.config.TLSConfig)
+	}
+	if c.config.Plaintext {
+		slog.Warn("Chat bot connecting without TLS!")
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "tcp", server)
+	}
+	var dialer = tls.Dialer{Config: c.config.TLSConfig}
+	return dialer.DialContext(ctx, "tcp", server)
+}
+
+// WebSocket connection to the IRC server.
+type wsTransport struct {
+	ws         *websocket.Conn
+	pending    []byte // Part of received frame that wasn't read yet
+	writeMutex sync.Mutex
+}
+
+// Connects to the IRC server with WebSocket connection.
+func dialWebSocket(ctx context.Context, url string, tlsConfig *tls.Config) (*wsTransport, error) {
+	var dialer = *websocket.DefaultDialer
+	dialer.TLSClientConfig = tlsConfig
+	var ws, _, err = dialer.DialContext(ctx, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &wsTransport{ws: ws}, nil
+}
+
+func (t *wsTransport) Read(b []byte) (int, error) {
+	for len(t.pending) == 0 {
+		var _, data, err = t.ws.ReadMessage()
+		if err != nil {
+			return 0, err
+		}
+		if !bytes.HasSuffix(data, messageEnd) {
+			data = append(data, messageEnd...)
+		}
+		t.pending = data
+	}
+
+	var n = copy(b, t.pending)
+	t.pending = t.pending[n:]
+	return n, nil
+}
+
+func (t *wsTransport) Write(b []byte) (int, error) {
+	t.writeMutex.Lock()
+	defer t.writeMutex.Unlock()
+
+	for _, line := range bytes.SplitAfter(b, messageEnd) {
+		if len(line) == 0 {
+			continue
+		}
+		var err = t.ws.WriteMessage(websocket.TextMessage, line)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (t *wsTransport) Close() error {
+	return t.ws.Close()
+}
@@ -0,0 +1,203 @@
+package chat
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Local WebSocket stand-in of Twitch IRC server.
+type wsServer struct {
+	server   *httptest.Server
+	mutex    sync.Mutex
+	frames   []string             // Received frames
+	conns    chan *websocket.Conn // Accepted connections
+	received chan string          // Signaled with every received frame
+}
+
+// Starts WebSocket server, with TLS if secure is set. The handler can answer received frames.
+func newWSServer(t *testing.T, secure bool, handler func(ws *websocket.Conn, frame string)) *wsServer {
+	t.Helper()
+	var s = &wsServer{conns: make(chan *websocket.Conn, 10), received: make(chan string, 100)}
+	var upgrader = websocket.Upgrader{Subprotocols: []string{"irc"}}
+	var h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ws, err = upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		s.conns <- ws
+		defer ws.Close()
+		for {
+			var _, data, err = ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			s.mutex.Lock()
+			s.frames = append(s.frames, string(data))
+			s.mutex.Unlock()
+			s.received <- string(data)
+			if handler != nil {
+				handler(ws, string(data))
+			}
+		}
+	})
+	if secure {
+		s.server = httptest.NewTLSServer(h)
+	} else {
+		s.server = httptest.NewServer(h)
+	}
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// Returns WebSocket address of the server.
+func (s *wsServer) url() string {
+	return "ws" + strings.TrimPrefix(s.server.URL, "http")
+}
+
+// Returns TLS configuration trusting the server certificate.
+func (s *wsServer) tlsConfig() *tls.Config {
+	var pool = x509.NewCertPool()
+	pool.AddCert(s.server.Certificate())
+	return &tls.Config{RootCAs: pool}
+}
+
+// Waits for received frame containing the text.
+func (s *wsServer) waitFor(t *testing.T, text string) {
+	t.Helper()
+	var timeout = time.After(time.Second * 5)
+	for {
+		select {
+		case frame := <-s.received:
+			if strings.Contains(frame, text) {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for frame containing %q", text)
+		}
+	}
+}
+
+func TestWebSocketTransport(t *testing.T) {
+	var s = newWSServer(t, false, nil)
+	var ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	var conn, err = dialWebSocket(ctx, s.url(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var ws = <-s.conns
+
+	// Every IRC message is sent in a separate frame
+	if n, err := conn.Write([]byte("PASS oauth:token\r\nNICK bot\r\n")); err != nil || n != 28 {
+		t.Fatalf("Write returned %d, %v", n, err)
+	}
+	s.waitFor(t, "NICK")
+	s.mutex.Lock()
+	var frames = s.frames
+	s.mutex.Unlock()
+	if len(frames) != 2 || frames[0] != "PASS oauth:token\r\n" || frames[1] != "NICK bot\r\n" {
+		t.Errorf("received frames %q", frames)
+	}
+
+	// Received frames are returned as lines, even when the frame is missing line ending or is read in parts
+	ws.WriteMessage(websocket.TextMessage, []byte(":tmi.twitch.tv 001 bot :Welcome, GLHF!\r\n"))
+	ws.WriteMessage(websocket.TextMessage, []byte("PING :tmi.twitch.tv"))
+	var expected = ":tmi.twitch.tv 001 bot :Welcome, GLHF!\r\nPING :tmi.twitch.tv\r\n"
+	var received []byte
+	var buf = make([]byte, 7)
+	for len(received) < len(expected) {
+		var n, err = conn.Read(buf)
+		if err != nil {
+			t.Fatalf("Read failed after %q: %v", received, err)
+		}
+		received = append(received, buf[:n]...)
+	}
+	if string(received) != expected {
+		t.Errorf("read %q, expected %q", received, expected)
+	}
+
+	// Closed connection unblocks reads
+	ws.Close()
+	if _, err := conn.Read(buf); err == nil {
+		t.Error("Read didn't fail after the server closed the connection")
+	}
+}
+
+func TestWebSocketTransportTLS(t *testing.T) {
+	var s = newWSServer(t, true, nil)
+	var ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if _, err := dialWebSocket(ctx, s.url(), nil); err == nil {
+		t.Error("connected to server with untrusted certificate")
+	}
+	var conn, err = dialWebSocket(ctx, s.url(), s.tlsConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("PING :test\r\n"))
+	s.waitFor(t, "PING :test")
+}
+
+func TestClientWebSocket(t *testing.T) {
+	var s = newWSServer(t, true, func(ws *websocket.Conn, frame string) {
+		switch {
+		case strings.HasPrefix(frame, "NICK"):
+			ws.WriteMessage(websocket.TextMessage, []byte(":tmi.twitch.tv 001 bot :Welcome, GLHF!\r\n"))
+		case strings.HasPrefix(frame, "JOIN"):
+			ws.WriteMessage(websocket.TextMessage, []byte(":bot!bot@bot.tmi.twitch.tv JOIN #channel\r\n"))
+			ws.WriteMessage(websocket.TextMessage, []byte(privmsg("Viewer", "", "!hello")))
+		}
+	})
+
+	// Token is read on every connection, like after it was refreshed
+	var tokens atomic.Int32
+	var pass = func() string { return fmt.Sprintf("token%d", tokens.Add(1)) }
+	var config = Config{Pass: pass, Nick: "Bot", Channels: []string{"#Channel"}, Server: s.url(), TLSConfig: s.tlsConfig()}
+	var c = NewClient(config)
+	var connected = make(chan struct{}, 1)
+	c.Subscribe(func(event Event) {
+		if e, ok := event.(*ConnectionEvent); ok && e.State == ConnectionConnected {
+			select {
+			case connected <- struct{}{}:
+			default:
+			}
+		}
+	})
+	c.RegisterCommand(Command{Name: "hello", Handler: func(ctx *CommandContext) {
+		ctx.Reply("Hi " + ctx.Metadata.UserName)
+	}})
+	c.Start()
+	defer c.Stop()
+
+	s.waitFor(t, "PASS oauth:token1")
+	s.waitFor(t, "JOIN #channel")
+	select {
+	case <-connected:
+	case <-time.After(time.Second * 5):
+		t.Fatal("client didn't connect")
+	}
+	s.waitFor(t, "PRIVMSG #channel :Hi Viewer")
+	if !c.IsConnected() {
+		t.Error("IsConnected returned false")
+	}
+
+	// Client reconnects when the server closes the connection
+	var ws = <-s.conns
+	ws.Close()
+	s.waitFor(t, "PASS oauth:token2")
+}
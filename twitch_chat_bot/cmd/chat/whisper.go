@@ -0,0 +1,159 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Whispers (private messages).
+// Received WHISPER messages are emitted as WhisperEvent and checked for commands that can be used in whispers (Command.Whisper).
+// Whispers are sent through Twitch API (IRC whispers are deprecated), so Config.WhisperAPI and Config.UserID have to be set.
+// Sent whispers have their own rate limits: 3 per second, 100 per minute and at most 40 different recipients per day.
+
+const whisperSendMaxLength = 500               // Maximum number of characters in one whisper (the limit for new recipients)
+const whisperRateLimitSecond = 3               // Whispers per second
+const whisperRateLimitMinute = 100             // Whispers per minute
+const whisperMaxRecipients = 40                // Maximum amount of different recipients per day
+const whisperRecipientsPeriod = time.Hour * 24 // Period of recipients limit
+const whisperSendTimeout = time.Second * 10    // Timeout of Twitch API request
+
+var ErrWhispersDisabled = errors.New("whispers are not configured")
+var ErrWhisperRecipientLimit = errors.New("whisper recipients limit reached")
+
+// Twitch API used to send whispers, implemented by helix.Client.
+type WhisperAPI interface {
+	SendWhisper(ctx context.Context, fromUserID, toUserID, message string) error
+}
+
+// Whisper waiting in the queue.
+type queuedWhisper struct {
+	toUserID string
+	text     string
+}
+
+// Queue of whispers to send.
+type whisperQueue struct {
+	mutex      sync.Mutex
+	whispers   []queuedWhisper
+	second     *tokenBucket         // Whispers per second limit
+	minute     *tokenBucket         // Whispers per minute limit
+	recipients map[string]time.Time // Time of first whisper sent to the recipient in current period, key is user ID
+	notify     chan struct{}        // Signaled when new whispers are added to the queue
+}
+
+// Creates new whisper queue.
+func newWhisperQueue() *whisperQueue {
+	return &whisperQueue{
+		second:     newTokenBucket(whisperRateLimitSecond, time.Second),
+		minute:     newTokenBucket(whisperRateLimitMinute, time.Minute),
+		recipients: make(map[string]time.Time),
+		notify:     make(chan struct{}, 1),
+	}
+}
+
+// Adds whispers to the recipient to the queue. Returns error if too many recipients got whispers today.
+func (q *whisperQueue) push(toUserID string, parts []string, now time.Time) error {
+	q.mutex.Lock()
+	for id, t := range q.recipients {
+		if now.Sub(t) >= whisperRecipientsPeriod {
+			delete(q.recipients, id)
+		}
+	}
+	if _, ok := q.recipients[toUserID]; !ok {
+		if len(q.recipients) >= whisperMaxRecipients {
+			q.mutex.Unlock()
+			return ErrWhisperRecipientLimit
+		}
+		q.recipients[toUserID] = now
+	}
+	for _, part := range parts {
+		q.whispers = append(q.whispers, queuedWhisper{toUserID: toUserID, text: part})
+	}
+	q.mutex.Unlock()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Take next whisper and true if rate limits allow sending it. Otherwise returns false
+// and time after which next whisper can be sent (or 0 if the queue is empty).
+func (q *whisperQueue) pop(now time.Time) (w queuedWhisper, ok bool, wait time.Duration) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if len(q.whispers) == 0 {
+		return w, false, 0
+	}
+	if wait = q.minute.take(now); wait > 0 {
+		return w, false, wait
+	}
+	if wait = q.second.take(now); wait > 0 {
+		q.minute.tokens = min(q.minute.tokens+1, q.minute.capacity) // Give back the token, the whisper wasn't sent
+		return w, false, wait
+	}
+	w = q.whispers[0]
+	q.whispers = q.whispers[1:]
+	return w, true, 0
+}
+
+// Returns amount of whispers waiting to be sent.
+func (q *whisperQueue) pending() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.whispers)
+}
+
+// Sends whisper to the chatter. Long messages are split into multiple whispers.
+// Requires Config.WhisperAPI and Config.UserID, whispers are sent while the chat bot is running.
+func (c *Client) SendWhisper(toUserID int64, msg string) error {
+	if c.config.WhisperAPI == nil || len(c.config.UserID) == 0 {
+		return ErrWhispersDisabled
+	}
+	var parts = SplitMessage(msg, whisperSendMaxLength, MessageContinuationPrefix)
+	if len(parts) == 0 {
+		return nil
+	}
+	return c.whispers.push(strconv.FormatInt(toUserID, 10), parts, time.Now())
+}
+
+// Returns amount of whispers waiting to be sent.
+func (c *Client) PendingWhispers() int {
+	return c.whispers.pending()
+}
+
+// Sends queued whispers through Twitch API, respecting the rate limits, until the context is canceled.
+func (c *Client) runWhispers(ctx context.Context) {
+	if c.config.WhisperAPI == nil {
+		return
+	}
+	for {
+		var w, ok, wait = c.whispers.pop(time.Now())
+		if ok {
+			var sendCtx, cancel = context.WithTimeout(ctx, whisperSendTimeout)
+			var err = c.config.WhisperAPI.SendWhisper(sendCtx, c.config.UserID, w.toUserID, w.text)
+			cancel()
+			if err != nil {
+				slog.Error("Error sending whisper", "UserID", w.toUserID, "Err", err)
+			}
+			continue
+		}
+
+		var timeout <-chan time.Time
+		if wait > 0 {
+			timeout = time.After(wait)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.whispers.notify:
+		case <-timeout:
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestWhisperQueueRateLimit(t *testing.T) {
+	var q = newWhisperQueue()
+	var now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	if err := q.push("1", []string{"a", "b", "c", "d", "e"}, now); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < whisperRateLimitSecond; i++ {
+		if w, ok, _ := q.pop(now); !ok || w.toUserID != "1" {
+			t.Fatalf("whisper %d wasn't sent", i)
+		}
+	}
+
+	// Whispers over the per second limit wait, without using up the per minute limit
+	for i := 0; i < 10; i++ {
+		if _, ok, wait := q.pop(now); ok || wait <= 0 || wait > time.Second {
+			t.Fatalf("pop over the limit returned %v, wait %s", ok, wait)
+		}
+	}
+	if q.minute.tokens != whisperRateLimitMinute-whisperRateLimitSecond {
+		t.Errorf("%.1f whispers per minute left, expected %d", q.minute.tokens, whisperRateLimitMinute-whisperRateLimitSecond)
+	}
+
+	// Refilled per minute limit stays at its capacity after tokens are given back
+	now = now.Add(time.Hour)
+	q.second.tokens = 0
+	q.second.last = now
+	if _, ok, _ := q.pop(now); ok || q.minute.tokens != q.minute.capacity {
+		t.Errorf("sent %v, %.1f tokens in bucket of %.0f", ok, q.minute.tokens, q.minute.capacity)
+	}
+	if _, ok, _ := q.pop(now.Add(time.Second)); !ok || q.pending() != 1 {
+		t.Errorf("whisper wasn't sent after a second, %d whispers left", q.pending())
+	}
+}
+
+func TestWhisperQueueRecipients(t *testing.T) {
+	var q = newWhisperQueue()
+	var now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < whisperMaxRecipients; i++ {
+		if err := q.push(fmt.Sprint(i), []string{"hi"}, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.push("new", []string{"hi"}, now); !errors.Is(err, ErrWhisperRecipientLimit) {
+		t.Errorf("whisper to new recipient over the limit returned %v", err)
+	}
+	if err := q.push("0", []string{"again"}, now.Add(time.Hour)); err != nil {
+		t.Errorf("whisper to known recipient returned %v", err)
+	}
+	if err := q.push("new", []string{"hi"}, now.Add(whisperRecipientsPeriod)); err != nil {
+		t.Errorf("whisper to new recipient in next period returned %v", err)
+	}
+}
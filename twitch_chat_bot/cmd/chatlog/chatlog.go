@@ -0,0 +1,300 @@
+package chatlog
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+	"twitch_chat_bot/cmd/chat"
+	"unicode"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Chat log stored in SQLite database.
+// Received chat messages and events are stored as raw IRC messages together with parsed data.
+// Stored messages can be searched with full-text search and replayed through the chat client.
+// On Windows SQLite requires GCC to build: https://github.com/mattn/go-sqlite3?tab=readme-ov-file#windows
+
+// Commands of IRC messages that are stored, other ones (PING, JOIN, numeric replies, etc.) are skipped.
+var storedCommands = []string{"PRIVMSG", "USERNOTICE", "CLEARCHAT", "CLEARMSG", "NOTICE", "ROOMSTATE", "USERSTATE", "WHISPER"}
+
+// Chat log.
+type Log struct {
+	db    *sql.DB
+	mutex sync.Mutex
+}
+
+// Stored chat message.
+type Entry struct {
+	ID       int64     // Entry ID
+	Time     time.Time // Time when the message was received
+	Channel  string    // Channel name
+	Command  string    // IRC command, like "PRIVMSG"
+	MsgID    string    // msg-id tag, like "sub" or "raid"
+	UserID   int64     // Chatter ID
+	UserName string    // Name of the chatter
+	Text     string    // Chat message text
+	Raw      string    // Whole IRC message
+}
+
+// Opens chat log database. If the database file is not found, new file is created.
+func Open(path string) (*Log, error) {
+	var db, err = sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Table creation, full-text search table is synchronized with the messages table
+	_, err = db.Exec(`
+CREATE TABLE IF NOT EXISTS messages (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	time INTEGER NOT NULL,
+	channel TEXT NOT NULL,
+	command TEXT NOT NULL,
+	msg_id TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	user_name TEXT NOT NULL,
+	text TEXT NOT NULL,
+	raw TEXT NOT NULL);
+CREATE INDEX IF NOT EXISTS messages_channel_time ON messages (channel, time);
+CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts4(content="messages", user_name, text);
+CREATE TRIGGER IF NOT EXISTS messages_fts_insert AFTER INSERT ON messages BEGIN
+	INSERT INTO messages_fts (docid, user_name, text) VALUES (new.id, new.user_name, new.text);
+END;
+CREATE TRIGGER IF NOT EXISTS messages_fts_delete BEFORE DELETE ON messages BEGIN
+	DELETE FROM messages_fts WHERE docid = old.id;
+END;`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Log{db: db}, nil
+}
+
+// Closes the database.
+func (l *Log) Close() error {
+	return l.db.Close()
+}
+
+// Starts storing messages received by the client. Returns subscription ID that can be used to unsubscribe.
+func (l *Log) Attach(client *chat.Client) int {
+	return client.Subscribe(func(event chat.Event) {
+		var e, ok = event.(*chat.MessageEvent)
+		if !ok {
+			return
+		}
+		var err = l.Store(e.Time, e.Message, e.Metadata)
+		if err != nil {
+			slog.Error("Chat log error, when storing a message.", "Err", err)
+		}
+	})
+}
+
+// Stores the message. Messages that are not chat messages or events are skipped.
+func (l *Log) Store(t time.Time, msg chat.Message, metadata chat.MessageMetadata) error {
+	var stored = false
+	for _, command := range storedCommands {
+		if msg.Command == command {
+			stored = true
+			break
+		}
+	}
+	if !stored {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	var _, err = l.db.Exec("INSERT INTO messages (time, channel, command, msg_id, user_id, user_name, text, raw) VALUES (?, ?, ?, ?, ?, ?, ?, ?);",
+		t.UnixMilli(), metadata.Channel, msg.Command, metadata.MsgID, metadata.UserID, metadata.UserName, msg.Trailing, msg.Raw)
+	return err
+}
+
+// Returns stored messages of the channel (or all channels if empty) received in provided time range, ordered by time.
+// Zero time means no limit.
+func (l *Log) Entries(channel string, since, until time.Time) ([]Entry, error) {
+	var query strings.Builder
+	var args []any
+	query.WriteString("SELECT id, time, channel, command, msg_id, user_id, user_name, text, raw FROM messages WHERE 1=1")
+	if len(channel) > 0 {
+		query.WriteString(" AND channel = ?")
+		args = append(args, strings.ToLower(strings.TrimPrefix(channel, "#")))
+	}
+	if !since.IsZero() {
+		query.WriteString(" AND time >= ?")
+		args = append(args, since.UnixMilli())
+	}
+	if !until.IsZero() {
+		query.WriteString(" AND time <= ?")
+		args = append(args, until.UnixMilli())
+	}
+	query.WriteString(" ORDER BY time, id;")
+	return l.query(query.String(), args...)
+}
+
+// Searches stored messages using full-text search query (like "hello" or "user_name:abev"),
+// returns at most limit newest matching messages. User input should be converted with SearchQuery.
+func (l *Log) Search(text string, limit int) ([]Entry, error) {
+	if len(strings.TrimSpace(text)) == 0 {
+		return nil, errors.New("search query is empty")
+	}
+	return l.query(`SELECT m.id, m.time, m.channel, m.command, m.msg_id, m.user_id, m.user_name, m.text, m.raw
+FROM messages_fts f JOIN messages m ON m.id = f.docid
+WHERE messages_fts MATCH ? ORDER BY m.time DESC LIMIT ?;`, text, limit)
+}
+
+// Converts user input to full-text search query matching all of its words literally,
+// so operators (OR, NOT, NEAR), column filters, prefixes and quotes in the input are not interpreted.
+// Words are split on punctuation like the full-text search tokenizer does, every word is quoted.
+func SearchQuery(text string) string {
+	var terms []string
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsNumber(r) }) {
+		terms = append(terms, `"`+word+`"`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// Runs the query returning stored messages.
+func (l *Log) query(query string, args ...any) ([]Entry, error) {
+	var rows, err = l.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var e Entry
+		var t int64
+		err = rows.Scan(&e.ID, &t, &e.Channel, &e.Command, &e.MsgID, &e.UserID, &e.UserName, &e.Text, &e.Raw)
+		if err != nil {
+			return nil, err
+		}
+		e.Time = time.UnixMilli(t)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Replay of stored messages.
+// It's a chat.Transport that returns stored messages as if they were received from the server,
+// so they go through the same parse and process pipeline. Messages sent by the chat bot are printed to stdout.
+// Every connection starts with the same welcome messages Twitch sends after login, so the client is connected.
+type Replay struct {
+	entries []Entry
+	speed   float64       // Replay speed multiplier, 0 replays without delays
+	pending []byte        // Part of the message that wasn't read yet
+	last    time.Time     // Time of previously replayed message
+	closed  chan struct{} // Closed when the connection to the replay is closed
+	done    chan struct{} // Closed when all messages were replayed
+	mutex   sync.Mutex
+}
+
+// Welcome messages sent before replayed messages, like after logging in to Twitch.
+var replayWelcome = []string{
+	":tmi.twitch.tv 001 replay :Welcome, GLHF!",
+	":tmi.twitch.tv 002 replay :Your host is tmi.twitch.tv",
+	":tmi.twitch.tv 003 replay :This server is rather new",
+	":tmi.twitch.tv 004 replay :-",
+	":tmi.twitch.tv 375 replay :-",
+	":tmi.twitch.tv 372 replay :You are in a maze of twisty passages, all alike.",
+	":tmi.twitch.tv 376 replay :>",
+}
+
+// Creates new replay of provided messages. Speed of 1 replays at original speed, 10 replays 10 times faster
+// and 0 replays without any delays.
+func NewReplay(entries []Entry, speed float64) *Replay {
+	return &Replay{
+		entries: entries,
+		speed:   speed,
+		closed:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Connects to the replay, can be used as chat.Config.Dial function.
+// After reconnecting the replay sends welcome messages again and continues from the last replayed message.
+func (r *Replay) Dial(ctx context.Context) (chat.Transport, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	select {
+	case <-r.closed:
+		r.closed = make(chan struct{})
+	default:
+	}
+	r.pending = []byte(strings.Join(replayWelcome, "\r\n") + "\r\n")
+	return r, nil
+}
+
+// Returns channel that is closed after all messages were replayed.
+func (r *Replay) Done() <-chan struct{} {
+	return r.done
+}
+
+func (r *Replay) Read(b []byte) (int, error) {
+	for len(r.pending) == 0 {
+		var closed = r.closedChannel()
+		if len(r.entries) == 0 {
+			select {
+			case <-r.done:
+			default:
+				close(r.done)
+			}
+			<-closed
+			return 0, io.EOF
+		}
+
+		// Wait the same time that passed between original messages
+		var entry = r.entries[0]
+		if r.speed > 0 && !r.last.IsZero() {
+			var wait = time.Duration(float64(entry.Time.Sub(r.last)) / r.speed)
+			select {
+			case <-closed:
+				return 0, io.EOF
+			case <-time.After(wait):
+			}
+		}
+		r.last = entry.Time
+		r.entries = r.entries[1:]
+		r.pending = []byte(entry.Raw + "\r\n")
+	}
+
+	var n = copy(b, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *Replay) Write(b []byte) (int, error) {
+	for _, line := range strings.SplitAfter(string(b), "\r\n") {
+		var msg, err = chat.ParseMessage(line)
+		if err != nil || msg.Command != "PRIVMSG" {
+			continue // Skip login, JOIN, PONG and other messages
+		}
+		slog.Info("Replay, chat bot sent a message", "Channel", msg.Channel(), "Message", msg.Trailing)
+	}
+	return len(b), nil
+}
+
+func (r *Replay) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	select {
+	case <-r.closed:
+	default:
+		close(r.closed)
+	}
+	return nil
+}
+
+// Returns channel that is closed when current connection to the replay is closed.
+func (r *Replay) closedChannel() <-chan struct{} {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.closed
+}
@@ -0,0 +1,186 @@
+package chatlog
+
+import (
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+	"twitch_chat_bot/cmd/chat"
+)
+
+func TestReplay(t *testing.T) {
+	var start = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var entries = []Entry{
+		{Time: start, Raw: "@id=1;user-id=1 :a!a@a.tmi.twitch.tv PRIVMSG #channel :first"},
+		{Time: start.Add(time.Second), Raw: "@id=2;user-id=2 :b!b@b.tmi.twitch.tv PRIVMSG #channel :second"},
+	}
+	var r = NewReplay(entries, 0)
+	var c = chat.NewClient(chat.Config{Nick: "bot", Channels: []string{"channel"}, Dial: r.Dial})
+
+	var mutex sync.Mutex
+	var connected bool
+	var received []string
+	c.Subscribe(func(event chat.Event) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch e := event.(type) {
+		case *chat.ConnectionEvent:
+			if e.State == chat.ConnectionConnected {
+				connected = true
+			}
+		case *chat.MessageEvent:
+			if e.Message.Command == "PRIVMSG" {
+				if !connected {
+					t.Errorf("message %q replayed before the welcome message", e.Message.Trailing)
+				}
+				received = append(received, e.Message.Trailing)
+			}
+		}
+	})
+
+	var print = chat.PrintChatMessages()
+	chat.SetPrintChatMessages(false)
+	defer chat.SetPrintChatMessages(print)
+	c.Start()
+	defer c.Stop()
+	select {
+	case <-r.Done():
+	case <-time.After(time.Second * 5):
+		t.Fatal("replay didn't finish")
+	}
+
+	if !c.IsConnected() {
+		t.Error("client isn't connected to the replay")
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if !connected {
+		t.Error("ConnectionEvent wasn't emitted")
+	}
+	if !slices.Equal(received, []string{"first", "second"}) {
+		t.Errorf("replayed %q", received)
+	}
+}
+
+// Opens chat log in temporary directory and stores provided IRC messages, one second apart.
+func openTestLog(t *testing.T, start time.Time, lines ...string) *Log {
+	t.Helper()
+	var l, err = Open(filepath.Join(t.TempDir(), "chat.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	for i, line := range lines {
+		var msg, err = chat.ParseMessage(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var metadata = chat.MessageMetadata{Channel: msg.Channel(), UserID: int64(msg.Tags.Int("user-id")), UserName: msg.Tags["display-name"], MsgID: msg.Tags["msg-id"]}
+		if err = l.Store(start.Add(time.Second*time.Duration(i)), msg, metadata); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return l
+}
+
+// Returns texts of the entries.
+func entryTexts(entries []Entry) []string {
+	var texts []string
+	for _, e := range entries {
+		texts = append(texts, e.Text)
+	}
+	return texts
+}
+
+func TestStore(t *testing.T) {
+	var start = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var l = openTestLog(t, start,
+		"@display-name=Viewer;user-id=5 :viewer!viewer@viewer.tmi.twitch.tv PRIVMSG #channel :hello",
+		"PING :tmi.twitch.tv",
+		":bot!bot@bot.tmi.twitch.tv JOIN #channel",
+		"@msg-id=raid;display-name=Raider;user-id=6 :tmi.twitch.tv USERNOTICE #other :raid message",
+		"@display-name=Viewer;user-id=5 :viewer!viewer@viewer.tmi.twitch.tv PRIVMSG #channel :bye",
+	)
+
+	// Only chat messages and events are stored
+	var entries, err = l.Entries("", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("%d entries stored, expected 3", len(entries))
+	}
+	var e = entries[1]
+	if !e.Time.Equal(start.Add(time.Second*3)) || e.Channel != "other" || e.Command != "USERNOTICE" || e.MsgID != "raid" ||
+		e.UserID != 6 || e.UserName != "Raider" || e.Text != "raid message" || e.Raw[0] != '@' {
+		t.Errorf("unexpected entry %+v", e)
+	}
+
+	// Entries are filtered by channel and time range
+	var tests = []struct {
+		channel      string
+		since, until time.Time
+		texts        []string
+	}{
+		{"#Channel", time.Time{}, time.Time{}, []string{"hello", "bye"}},
+		{"", start.Add(time.Second), time.Time{}, []string{"raid message", "bye"}},
+		{"", time.Time{}, start.Add(time.Second * 3), []string{"hello", "raid message"}},
+		{"channel", start.Add(time.Second * 5), time.Time{}, nil},
+	}
+	for _, test := range tests {
+		var entries, err = l.Entries(test.channel, test.since, test.until)
+		if texts := entryTexts(entries); err != nil || !slices.Equal(texts, test.texts) {
+			t.Errorf("entries of %q from %s to %s are %q, %v, expected %q", test.channel, test.since, test.until, texts, err, test.texts)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	var start = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var l = openTestLog(t, start,
+		"@display-name=Abev;user-id=1 :abev!abev@abev.tmi.twitch.tv PRIVMSG #channel :Hello chat",
+		"@display-name=Viewer;user-id=2 :viewer!viewer@viewer.tmi.twitch.tv PRIVMSG #channel :hello abev, hellooo",
+		"@display-name=Viewer;user-id=2 :viewer!viewer@viewer.tmi.twitch.tv PRIVMSG #channel :what is OR in sql",
+		`@display-name=Quoter;user-id=3 :quoter!quoter@quoter.tmi.twitch.tv PRIVMSG #channel :he said "chat hello"`,
+	)
+
+	var tests = []struct {
+		query string
+		texts []string // Newest first
+	}{
+		{"hello", []string{`he said "chat hello"`, "hello abev, hellooo", "Hello chat"}},
+		{"user_name:abev", []string{"Hello chat"}},
+		{"abev", []string{"hello abev, hellooo", "Hello chat"}},
+		{"hell*", []string{`he said "chat hello"`, "hello abev, hellooo", "Hello chat"}},
+		{`"hello chat"`, []string{"Hello chat"}},
+		{"hello NOT abev", []string{`he said "chat hello"`}},
+		{"sql OR quoter", []string{`he said "chat hello"`, "what is OR in sql"}},
+
+		// Escaped user input matches the words literally
+		{SearchQuery("user_name:abev"), nil},
+		{SearchQuery("hell*"), nil},
+		{SearchQuery("OR sql"), []string{"what is OR in sql"}},
+		{SearchQuery(`chat" OR "what`), nil},
+		{SearchQuery("hello NOT abev"), nil},
+		{SearchQuery(`  "HELLO"  chat `), []string{`he said "chat hello"`, "Hello chat"}},
+	}
+	for _, test := range tests {
+		var entries, err = l.Search(test.query, 10)
+		if texts := entryTexts(entries); err != nil || !slices.Equal(texts, test.texts) {
+			t.Errorf("search %q returned %q, %v, expected %q", test.query, texts, err, test.texts)
+		}
+	}
+
+	if entries, err := l.Search("hello", 1); err != nil || len(entries) != 1 || entries[0].UserName != "Quoter" {
+		t.Errorf("limited search returned %+v, %v", entries, err)
+	}
+	for _, query := range []string{"", "  ", SearchQuery(`""`)} {
+		if _, err := l.Search(query, 10); err == nil {
+			t.Errorf("empty search %q didn't fail", query)
+		}
+	}
+	if _, err := l.Search(`"unterminated`, 10); err == nil {
+		t.Error("malformed query didn't fail")
+	}
+}
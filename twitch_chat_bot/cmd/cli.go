@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+	"twitch_chat_bot/cmd/chat"
+	"twitch_chat_bot/cmd/chatlog"
+)
+
+// Chat bot subcommands, besides "run".
+
+const authTimeout = time.Minute * 5  // Time given to the user to authorize the app in the browser
+const sayTimeout = time.Second * 30  // Time after which "say" subcommand gives up
+const replayFlushDelay = time.Second // Time given to the bot to send responses to the last replayed messages
+
+// Requests Twitch access token with OAuth authorization code flow and saves it in the configuration file.
+func auth(args []string) error {
+	var flags = flag.NewFlagSet("auth", flag.ContinueOnError)
+	var configPath = flags.String("config", defaultConfigPath, "Configuration file")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	var config, err = loadConfig(*configPath, true)
+	if err != nil {
+		return err
+	}
+	if len(config.ClientID) == 0 || len(config.ClientSecret) == 0 {
+		return fmt.Errorf("client_id and client_secret have to be set in %s", config.path)
+	}
+
+	var ctx, stop = signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, authTimeout)
+	defer cancel()
+
+	var app = config.app()
+	token, err := app.Authorize(ctx)
+	if err != nil {
+		return fmt.Errorf("authorization failed: %w", err)
+	}
+	validation, err := app.Validate(ctx, token.AccessToken)
+	if err != nil {
+		return fmt.Errorf("validating new access token failed: %w", err)
+	}
+
+	config.Token = token
+	if err = config.save(); err != nil {
+		return err
+	}
+	fmt.Printf("Access token of %s saved in %s.\n", validation.Login, config.path)
+	if !strings.EqualFold(validation.Login, config.Nick) {
+		slog.Warn("Access token belongs to different user than the chat bot nick", "Login", validation.Login, "Nick", config.Nick)
+	}
+	return nil
+}
+
+// Connects to Twitch chat, sends one chat message to the channel and exits.
+func say(args []string) error {
+	var flags = flag.NewFlagSet("say", flag.ContinueOnError)
+	var configPath = flags.String("config", defaultConfigPath, "Configuration file")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: say [flags] <channel> <text>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return errors.New("channel and text are required")
+	}
+	var channel, text = flags.Arg(0), strings.Join(flags.Args()[1:], " ")
+
+	var config, err = loadConfig(*configPath, false)
+	if err != nil {
+		return err
+	}
+	if len(config.Token.AccessToken) == 0 {
+		return errors.New("access token is missing, use \"auth\" subcommand first")
+	}
+
+	var ctx, stop = signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, sayTimeout)
+	defer cancel()
+
+	// Chat connection uses the stored token, so the expired one is refreshed and saved first
+	if config.Token.Expired(time.Now()) {
+		token, err := config.app().Refresh(ctx, config.Token.RefreshToken)
+		if err != nil {
+			return fmt.Errorf("refreshing expired access token failed: %w", err)
+		}
+		if err = config.setToken(token); err != nil {
+			return err
+		}
+	}
+
+	chat.SetPrintChatMessages(false)
+	var connected = make(chan struct{}, 1)
+	var client = chat.NewClient(chat.Config{
+		Pass:     config.accessToken,
+		Nick:     config.Nick,
+		Channels: []string{channel},
+	})
+	client.Subscribe(func(event chat.Event) {
+		if e, ok := event.(*chat.ConnectionEvent); ok && e.State == chat.ConnectionConnected {
+			select {
+			case connected <- struct{}{}:
+			default:
+			}
+		}
+	})
+	client.Start()
+	defer client.Stop()
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("connecting to chat failed: %w", ctx.Err())
+	case <-connected:
+	}
+	client.SendMessage(channel, text)
+
+	// Wait until the message leaves the queue
+	var ticker = time.NewTicker(time.Millisecond * 100)
+	defer ticker.Stop()
+	for {
+		var stats = client.QueueStats()
+		if stats.Pending == 0 && stats.HighPriority == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("sending the message failed: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+	time.Sleep(time.Millisecond * 500) // Let the connection flush
+	return nil
+}
+
+// Replays messages stored in the chat log database file instead of connecting to Twitch.
+func replay(args []string) error {
+	var flags = flag.NewFlagSet("replay", flag.ContinueOnError)
+	var configPath = flags.String("config", defaultConfigPath, "Configuration file, nick and channels are used")
+	var channel = flags.String("channel", "", "Replay only messages of the channel")
+	var speed = flags.Float64("speed", 1, "Replay speed multiplier, 0 replays without delays")
+	var overlayAddress = flags.String("overlay", "", "Address of chat overlay HTTP server, overlay address from the configuration if empty")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: replay [flags] <log>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errors.New("chat log database file is required")
+	}
+
+	var config, err = loadConfig(*configPath, false)
+	if errors.Is(err, os.ErrNotExist) {
+		config, err = defaultConfig(), nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(*overlayAddress) == 0 {
+		*overlayAddress = config.Overlay
+	}
+
+	log, err := chatlog.Open(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("opening the chat log failed: %w", err)
+	}
+	defer log.Close()
+
+	entries, err := log.Entries(*channel, time.Time{}, time.Time{})
+	if err != nil {
+		return fmt.Errorf("reading the chat log failed: %w", err)
+	}
+	slog.Info("Replaying chat log", "Messages", len(entries), "Speed", *speed)
+
+	var ctx, stop = signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var r = chatlog.NewReplay(entries, *speed)
+	var client = newClient(chat.Config{
+		Nick:     config.Nick,
+		Channels: config.Channels,
+		Dial:     r.Dial,
+	}, nil, "")
+	if len(*overlayAddress) > 0 {
+		var server = startOverlay(*overlayAddress, client)
+		defer server.Close()
+	}
+	client.Start()
+	select {
+	case <-r.Done():
+		time.Sleep(replayFlushDelay) // Let the bot send responses to the last messages
+		slog.Info("Replay finished")
+	case <-ctx.Done():
+		slog.Info("Replay stopped")
+	}
+	client.Stop()
+	return nil
+}
+
+// Configuration file subcommands.
+func configCommand(args []string) error {
+	if len(args) == 0 || args[0] != "validate" {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: config validate [flags]")
+		return errors.New("unknown config subcommand")
+	}
+
+	var flags = flag.NewFlagSet("config validate", flag.ContinueOnError)
+	var configPath = flags.String("config", defaultConfigPath, "Configuration file")
+	var online = flags.Bool("online", false, "Also validate the access token with Twitch")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	var config, err = loadConfig(*configPath, false)
+	if err != nil {
+		return err
+	}
+	if err = config.validate(); err != nil {
+		fmt.Printf("Configuration %s is invalid:\n%v\n", config.path, err)
+		return errors.New("invalid configuration")
+	}
+
+	if len(config.Token.AccessToken) == 0 {
+		fmt.Println("Access token is missing, the chat bot can't log in. Use \"auth\" subcommand.")
+	} else if config.Token.Expired(time.Now()) {
+		fmt.Println("Access token is expired, it will be refreshed when the chat bot starts.")
+	}
+	if *online && len(config.Token.AccessToken) > 0 {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+		var validation, err = config.app().Validate(ctx, config.Token.AccessToken)
+		if err != nil {
+			return fmt.Errorf("access token validation failed: %w", err)
+		}
+		fmt.Printf("Access token of %s is valid for %s, scopes: %s\n",
+			validation.Login, time.Duration(validation.ExpiresIn)*time.Second, strings.Join(validation.Scopes, ", "))
+	}
+	fmt.Printf("Configuration %s is valid.\n", config.path)
+	return nil
+}
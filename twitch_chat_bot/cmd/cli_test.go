@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"twitch_chat_bot/cmd/chat"
+	"twitch_chat_bot/cmd/chatlog"
+)
+
+// Saves configuration file in temporary directory, returns it's path.
+func writeTestConfig(t *testing.T, change func(c *botConfig)) string {
+	t.Helper()
+	var config = defaultConfig()
+	config.path = filepath.Join(t.TempDir(), "config.json")
+	config.Metrics, config.Overlay = "", ""
+	if change != nil {
+		change(config)
+	}
+	if err := config.save(); err != nil {
+		t.Fatal(err)
+	}
+	return config.path
+}
+
+func TestArguments(t *testing.T) {
+	var tests = []struct {
+		command func(args []string) error
+		args    []string
+		err     string
+	}{
+		{say, []string{"channel"}, "channel and text are required"},
+		{say, []string{"-unknown"}, "flag provided but not defined"},
+		{replay, nil, "chat log database file is required"},
+		{configCommand, nil, "unknown config subcommand"},
+		{configCommand, []string{"check"}, "unknown config subcommand"},
+		{configCommand, []string{"validate", "-unknown"}, "flag provided but not defined"},
+	}
+	for _, test := range tests {
+		if err := test.command(test.args); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("arguments %q returned %v, expected %q", test.args, err, test.err)
+		}
+	}
+}
+
+func TestAuthConfig(t *testing.T) {
+	// New configuration file has to be filled in first
+	var path = filepath.Join(t.TempDir(), "config.json")
+	if err := auth([]string{"-config", path}); !errors.Is(err, errConfigCreated) {
+		t.Errorf("auth without configuration file returned %v", err)
+	}
+	if err := auth([]string{"-config", path}); err == nil || !strings.Contains(err.Error(), "client_id and client_secret have to be set") {
+		t.Errorf("auth without Twitch app returned %v", err)
+	}
+	if err := say([]string{"-config", path, "channel", "hello"}); err == nil || !strings.Contains(err.Error(), "access token is missing") {
+		t.Errorf("say without access token returned %v", err)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	var tests = []struct {
+		change func(c *botConfig)
+		err    string
+	}{
+		{nil, ""},
+		{func(c *botConfig) { c.Token.AccessToken = "token" }, "invalid configuration"},
+		{func(c *botConfig) { c.Channels = nil }, "invalid configuration"},
+	}
+	for i, test := range tests {
+		var path = writeTestConfig(t, test.change)
+		var err = configCommand([]string{"validate", "-config", path})
+		if (err == nil) != (len(test.err) == 0) || (err != nil && !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("config %d: validation returned %v, expected %q", i, err, test.err)
+		}
+	}
+	if err := configCommand([]string{"validate", "-config", filepath.Join(t.TempDir(), "missing.json")}); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("validating missing file returned %v", err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var print = chat.PrintChatMessages()
+	chat.SetPrintChatMessages(false)
+	defer chat.SetPrintChatMessages(print)
+
+	var path = filepath.Join(t.TempDir(), "chat.db")
+	var log, err = chatlog.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg, _ = chat.ParseMessage("@user-id=5 :viewer!viewer@viewer.tmi.twitch.tv PRIVMSG #abevbot :hello")
+	if err = log.Store(time.Now(), msg, chat.MessageMetadata{Channel: "abevbot", UserID: 5, UserName: "viewer"}); err != nil {
+		t.Fatal(err)
+	}
+	log.Close()
+
+	// Replay without configuration file uses the defaults
+	var config = filepath.Join(t.TempDir(), "missing.json")
+	if err = replay([]string{"-config", config, "-speed", "0", path}); err != nil {
+		t.Error(err)
+	}
+	if err = replay([]string{"-config", config, filepath.Join(t.TempDir(), "missing", "chat.db")}); err == nil {
+		t.Error("replay of missing chat log didn't fail")
+	}
+}
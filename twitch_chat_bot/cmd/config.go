@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"twitch_chat_bot/cmd/games"
+	"twitch_chat_bot/cmd/moderation"
+	"twitch_chat_bot/cmd/oauth"
+)
+
+// Chat bot configuration file (JSON).
+// If the file doesn't exist, it's created with default values. Twitch access token is saved in the file
+// by "auth" subcommand and after the token gets refreshed. The file should be kept private.
+
+const defaultConfigPath = "config.json"      // Path to the configuration file
+const tokenRefreshTimeout = time.Second * 10 // Timeout of access token refresh request
+
+// Returned by loadConfig when it created new configuration file, the bot can't run until it's filled in.
+var errConfigCreated = errors.New("configuration file created")
+
+// Chat bot configuration.
+type botConfig struct {
+	Nick         string            `json:"nick"`          // Chat bot nick
+	Channels     []string          `json:"channels"`      // Channels to join, the first one is the main channel (EventSub, periodic messages)
+	ClientID     string            `json:"client_id"`     // Twitch API bots client ID
+	ClientSecret string            `json:"client_secret"` // Twitch API bots client password
+	RedirectURI  string            `json:"redirect_uri"`  // Twitch API bots redirect Uri, used by "auth" subcommand
+	Token        oauth.Token       `json:"token"`         // Twitch access token
+	ChatLog      string            `json:"chat_log"`      // Chat log database file, empty disables the chat log
+	Users        string            `json:"users"`         // Chatters and loyalty points database file
+	Games        string            `json:"games"`         // Polls, giveaways and trivia database file
+	Bots         []string          `json:"bots"`          // Logins of other bots in the channels, excluded from giveaways
+	Rewards      map[string]string `json:"rewards"`       // Channel points reward IDs by title, needed without Twitch API (chat redemptions contain only reward ID)
+	Trivia       []games.Question  `json:"trivia"`        // Trivia questions
+	Moderation   moderationConfig  `json:"moderation"`    // Moderation rules
+	Metrics      string            `json:"metrics"`       // Address of metrics and health HTTP endpoint, empty disables it
+	Overlay      string            `json:"overlay"`       // Address of chat overlay HTTP server, empty disables it
+
+	path   string             // Path of the configuration file
+	tokens *oauth.TokenSource // Refreshes the access token, nil if Twitch API isn't configured
+	mutex  sync.Mutex         // Guards the token and saving the file
+}
+
+// Returns configuration with default values.
+func defaultConfig() *botConfig {
+	return &botConfig{
+		Nick:        "AbevBot",
+		Channels:    []string{"AbevBot"},
+		RedirectURI: "http://localhost:3000",
+		ChatLog:     "chat.db",
+		Users:       "users.db",
+		Games:       "games.db",
+		Bots:        []string{"Nightbot", "StreamElements"},
+		Trivia: []games.Question{
+			{Question: "What is the capital of France?", Answers: []string{"Paris"}},
+			{Question: "How many legs does a spider have?", Answers: []string{"8", "eight"}},
+		},
+		Moderation: moderationConfig{
+			DryRun:  true,
+			Links:   linkRule{ruleAction: ruleAction{Action: "delete"}, Allowed: []string{"twitch.tv", "youtube.com", "youtu.be"}},
+			Caps:    capsRule{ruleAction: ruleAction{Action: "delete"}, MinLength: 15, MaxRatio: 0.8},
+			Emotes:  emoteRule{ruleAction: ruleAction{Action: "timeout", Timeout: 60}, MaxEmotes: 15},
+			Repeats: repeatRule{ruleAction: ruleAction{Action: "timeout", Timeout: 300}, MaxRepeats: 3, Period: 60},
+		},
+		Metrics: "localhost:9090",
+		Overlay: "localhost:8080",
+	}
+}
+
+// Moderation configuration. Every rule has an action, rules without action are disabled.
+type moderationConfig struct {
+	DryRun  bool       `json:"dry_run"` // Only log moderation actions, don't perform them
+	Links   linkRule   `json:"links"`   // Links to domains that are not allowed
+	Caps    capsRule   `json:"caps"`    // Messages with too many capital letters
+	Emotes  emoteRule  `json:"emotes"`  // Messages with too many emotes
+	Repeats repeatRule `json:"repeats"` // The same message sent repeatedly
+	Phrases phraseRule `json:"phrases"` // Banned phrases and regular expressions
+}
+
+// Action of moderation rule.
+type ruleAction struct {
+	Action  string `json:"action"`  // "delete", "timeout" or "ban", empty disables the rule
+	Timeout int    `json:"timeout"` // Timeout duration in seconds
+}
+
+type linkRule struct {
+	ruleAction
+	Allowed []string `json:"allowed"` // Allowed domains, their subdomains are also allowed
+}
+
+type capsRule struct {
+	ruleAction
+	MinLength int     `json:"min_length"` // Minimum amount of letters in checked messages
+	MaxRatio  float64 `json:"max_ratio"`  // Maximum ratio of capital letters, like 0.8
+}
+
+type emoteRule struct {
+	ruleAction
+	MaxEmotes int `json:"max_emotes"` // Maximum amount of emotes in the message
+}
+
+type repeatRule struct {
+	ruleAction
+	MaxRepeats int `json:"max_repeats"` // Maximum amount of the same message within the period
+	Period     int `json:"period"`      // Period in seconds
+}
+
+type phraseRule struct {
+	ruleAction
+	Phrases  []string `json:"phrases"`  // Banned phrases, case insensitive
+	Patterns []string `json:"patterns"` // Banned regular expressions
+}
+
+// Returns moderation action and true, or false if the rule is disabled.
+func (a ruleAction) action() (moderation.Action, bool, error) {
+	switch strings.ToLower(a.Action) {
+	case "":
+		return moderation.Action{}, false, nil
+	case "delete":
+		return moderation.Action{Type: moderation.ActionDelete}, true, nil
+	case "timeout":
+		if a.Timeout <= 0 {
+			return moderation.Action{}, false, errors.New("timeout duration has to be positive")
+		}
+		return moderation.Action{Type: moderation.ActionTimeout, Duration: time.Second * time.Duration(a.Timeout)}, true, nil
+	case "ban":
+		return moderation.Action{Type: moderation.ActionBan}, true, nil
+	default:
+		return moderation.Action{}, false, fmt.Errorf("unknown action %q", a.Action)
+	}
+}
+
+// Returns enabled moderation rules.
+func (c *moderationConfig) rules() ([]moderation.Rule, error) {
+	var rules []moderation.Rule
+	var errs []error
+	var add = func(name string, a ruleAction, filter func() (moderation.Filter, error)) {
+		var action, enabled, err = a.action()
+		if err == nil && enabled {
+			var f moderation.Filter
+			if f, err = filter(); err == nil {
+				rules = append(rules, moderation.Rule{Name: name, Filter: f, Action: action})
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("moderation rule %s: %w", name, err))
+		}
+	}
+
+	add("Links", c.Links.ruleAction, func() (moderation.Filter, error) {
+		return &moderation.LinkFilter{Allowed: c.Links.Allowed}, nil
+	})
+	add("Caps", c.Caps.ruleAction, func() (moderation.Filter, error) {
+		if c.Caps.MaxRatio <= 0 || c.Caps.MaxRatio > 1 {
+			return nil, fmt.Errorf("max_ratio %v has to be between 0 and 1", c.Caps.MaxRatio)
+		}
+		return &moderation.CapsFilter{MinLength: c.Caps.MinLength, MaxRatio: c.Caps.MaxRatio}, nil
+	})
+	add("Emote spam", c.Emotes.ruleAction, func() (moderation.Filter, error) {
+		if c.Emotes.MaxEmotes <= 0 {
+			return nil, errors.New("max_emotes has to be positive")
+		}
+		return &moderation.EmoteSpamFilter{MaxEmotes: c.Emotes.MaxEmotes}, nil
+	})
+	add("Repeated messages", c.Repeats.ruleAction, func() (moderation.Filter, error) {
+		if c.Repeats.MaxRepeats <= 0 || c.Repeats.Period <= 0 {
+			return nil, errors.New("max_repeats and period have to be positive")
+		}
+		return moderation.NewRepeatFilter(c.Repeats.MaxRepeats, time.Second*time.Duration(c.Repeats.Period)), nil
+	})
+	add("Banned phrases", c.Phrases.ruleAction, func() (moderation.Filter, error) {
+		var filter = &moderation.PhraseFilter{Phrases: c.Phrases.Phrases}
+		for _, pattern := range c.Phrases.Patterns {
+			var re, err = regexp.Compile(pattern)
+			if err != nil {
+				return nil, err
+			}
+			filter.Patterns = append(filter.Patterns, re)
+		}
+		return filter, nil
+	})
+	return rules, errors.Join(errs...)
+}
+
+// Loads configuration file. If the file doesn't exist and create is set, new file with default values is created
+// and errConfigCreated is returned.
+func loadConfig(path string, create bool) (*botConfig, error) {
+	var config = defaultConfig()
+	config.path = path
+
+	var data, err = os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && create {
+		if err = config.save(); err != nil {
+			return nil, err
+		}
+		fmt.Printf("Created configuration file %s. Fill in nick, channels, client_id and client_secret, "+
+			"then get the access token with \"auth\" subcommand.\n", path)
+		return nil, errConfigCreated
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("parsing configuration file %s failed: %w", path, err)
+	}
+	return config, nil
+}
+
+// Saves configuration file.
+func (c *botConfig) save() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var data, err = json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, append(data, '\n'), 0600)
+}
+
+// Returns access token used to connect to chat. Expired token is refreshed when Twitch API is configured.
+func (c *botConfig) accessToken() string {
+	c.mutex.Lock()
+	var tokens, token = c.tokens, c.Token.AccessToken
+	c.mutex.Unlock()
+	if tokens == nil {
+		return token
+	}
+
+	var ctx, cancel = context.WithTimeout(context.Background(), tokenRefreshTimeout)
+	defer cancel()
+	var refreshed, err = tokens.Token(ctx)
+	if err != nil {
+		slog.Error("Twitch access token refresh failed, using the current token", "Err", err)
+		return token
+	}
+	return refreshed
+}
+
+// Replaces the access token and saves the configuration file.
+func (c *botConfig) setToken(token oauth.Token) error {
+	c.mutex.Lock()
+	c.Token = token
+	c.mutex.Unlock()
+	return c.save()
+}
+
+// Returns Twitch app configuration.
+func (c *botConfig) app() oauth.Config {
+	return oauth.Config{
+		ClientID:     c.ClientID,
+		ClientSecret: c.ClientSecret,
+		RedirectURI:  c.RedirectURI,
+	}
+}
+
+// Returns the main channel, empty if no channels are configured.
+func (c *botConfig) mainChannel() string {
+	if len(c.Channels) == 0 {
+		return ""
+	}
+	return c.Channels[0]
+}
+
+// Checks configuration values, returns all of the found problems.
+func (c *botConfig) validate() error {
+	var errs []error
+	if len(c.Nick) == 0 {
+		errs = append(errs, errors.New("nick is empty"))
+	}
+	if len(c.Channels) == 0 {
+		errs = append(errs, errors.New("no channels configured"))
+	}
+	for _, channel := range c.Channels {
+		if len(strings.TrimPrefix(channel, "#")) == 0 || strings.ContainsAny(channel, " \t,") {
+			errs = append(errs, fmt.Errorf("invalid channel name %q", channel))
+		}
+	}
+	if len(c.ClientID) > 0 && len(c.ClientSecret) == 0 {
+		errs = append(errs, errors.New("client_id is set, but client_secret is empty"))
+	}
+	if len(c.Token.AccessToken) > 0 && len(c.ClientID) == 0 {
+		errs = append(errs, errors.New("token is set, but client_id is empty"))
+	}
+	if redirect, err := url.Parse(c.RedirectURI); err != nil || len(redirect.Host) == 0 {
+		errs = append(errs, fmt.Errorf("invalid redirect_uri %q", c.RedirectURI))
+	}
+	if len(c.Users) == 0 {
+		errs = append(errs, errors.New("users database file is empty"))
+	}
+	if len(c.Games) == 0 {
+		errs = append(errs, errors.New("games database file is empty"))
+	}
+	for title, id := range c.Rewards {
+		if len(id) == 0 {
+			errs = append(errs, fmt.Errorf("reward %q has empty ID", title))
+		}
+	}
+	for i, q := range c.Trivia {
+		if len(q.Question) == 0 || len(q.Answers) == 0 {
+			errs = append(errs, fmt.Errorf("trivia question %d needs question and answers", i+1))
+		}
+	}
+	if _, err := c.Moderation.rules(); err != nil {
+		errs = append(errs, err)
+	}
+	for name, address := range map[string]string{"metrics": c.Metrics, "overlay": c.Overlay} {
+		if len(address) == 0 {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s address %q: %w", name, address, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"twitch_chat_bot/cmd/games"
+	"twitch_chat_bot/cmd/moderation"
+	"twitch_chat_bot/cmd/oauth"
+)
+
+func TestLoadConfig(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "config.json")
+
+	// Missing file is created only when requested, the bot stops until it's filled in
+	if _, err := loadConfig(path, false); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("loading missing file returned %v", err)
+	}
+	if config, err := loadConfig(path, true); config != nil || !errors.Is(err, errConfigCreated) {
+		t.Fatalf("creating the file returned %v, %v", config, err)
+	}
+	var config, err = loadConfig(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.path != path || config.Nick != "AbevBot" || !config.Moderation.DryRun || config.validate() != nil {
+		t.Errorf("created configuration %+v, validation %v", config, config.validate())
+	}
+
+	// Edited values are loaded, values missing in the file keep the defaults
+	if err = os.WriteFile(path, []byte(`{"nick": "Other", "token": {"access_token": "access"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if config, err = loadConfig(path, true); err != nil || config.Nick != "Other" || config.Token.AccessToken != "access" || config.Users != "users.db" {
+		t.Errorf("loaded configuration %+v, %v", config, err)
+	}
+	if err = os.WriteFile(path, []byte(`{"nick": `), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = loadConfig(path, true); err == nil || !strings.Contains(err.Error(), "parsing configuration file") {
+		t.Errorf("loading malformed file returned %v", err)
+	}
+}
+
+func TestSetToken(t *testing.T) {
+	var config = defaultConfig()
+	config.path = filepath.Join(t.TempDir(), "config.json")
+	var token = oauth.Token{AccessToken: "access", RefreshToken: "refresh", Expires: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), Scopes: []string{"chat:read"}}
+	if err := config.setToken(token); err != nil {
+		t.Fatal(err)
+	}
+	if config.accessToken() != "access" {
+		t.Errorf("access token %q", config.accessToken())
+	}
+	var loaded, err = loadConfig(config.path, false)
+	if err != nil || loaded.Token.RefreshToken != "refresh" || !loaded.Token.Expires.Equal(token.Expires) || len(loaded.Token.Scopes) != 1 {
+		t.Errorf("saved token %+v, %v", loaded.Token, err)
+	}
+	if info, err := os.Stat(config.path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("configuration file mode %v, %v", info.Mode(), err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var tests = []struct {
+		change func(c *botConfig)
+		err    string
+	}{
+		{func(c *botConfig) {}, ""},
+		{func(c *botConfig) { c.ClientID, c.ClientSecret, c.Token.AccessToken = "id", "secret", "token" }, ""},
+		{func(c *botConfig) { c.Nick = "" }, "nick is empty"},
+		{func(c *botConfig) { c.Channels = nil }, "no channels"},
+		{func(c *botConfig) { c.Channels = []string{"#", "two words"} }, `invalid channel name "two words"`},
+		{func(c *botConfig) { c.ClientID = "id" }, "client_secret is empty"},
+		{func(c *botConfig) { c.Token.AccessToken = "token" }, "client_id is empty"},
+		{func(c *botConfig) { c.RedirectURI = "localhost" }, "invalid redirect_uri"},
+		{func(c *botConfig) { c.Users, c.Games = "", "" }, "games database file is empty"},
+		{func(c *botConfig) { c.Rewards = map[string]string{"Hydrate": ""} }, `reward "Hydrate" has empty ID`},
+		{func(c *botConfig) { c.Trivia = append(c.Trivia, games.Question{Question: "?"}) }, "trivia question 3"},
+		{func(c *botConfig) { c.Moderation.Links.Action = "kick" }, `unknown action "kick"`},
+		{func(c *botConfig) { c.Overlay = "8080" }, `invalid overlay address "8080"`},
+		{func(c *botConfig) { c.Metrics, c.Overlay = "", "" }, ""},
+	}
+	for i, test := range tests {
+		var config = defaultConfig()
+		test.change(config)
+		var err = config.validate()
+		if (err == nil) != (len(test.err) == 0) || (err != nil && !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("config %d: validation returned %v, expected %q", i, err, test.err)
+		}
+	}
+}
+
+func TestModerationRules(t *testing.T) {
+	// Default rules only log the actions
+	var config = defaultConfig().Moderation
+	var rules, err = config.rules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, rule := range rules {
+		names = append(names, rule.Name)
+	}
+	if !config.DryRun || strings.Join(names, ", ") != "Links, Caps, Emote spam, Repeated messages" {
+		t.Errorf("default rules %q, dry-run %v", names, config.DryRun)
+	}
+	if rules[3].Action != (moderation.Action{Type: moderation.ActionTimeout, Duration: time.Minute * 5}) {
+		t.Errorf("repeated messages action %+v", rules[3].Action)
+	}
+
+	var tests = []struct {
+		config moderationConfig
+		rules  int
+		err    string
+	}{
+		{moderationConfig{}, 0, ""},
+		{moderationConfig{Phrases: phraseRule{ruleAction: ruleAction{Action: "Ban"}, Phrases: []string{"scam"}, Patterns: []string{`free \w+`}}}, 1, ""},
+		{moderationConfig{Phrases: phraseRule{ruleAction: ruleAction{Action: "ban"}, Patterns: []string{`(`}}}, 0, "Banned phrases"},
+		{moderationConfig{Links: linkRule{ruleAction: ruleAction{Action: "kick"}}}, 0, `unknown action "kick"`},
+		{moderationConfig{Emotes: emoteRule{ruleAction: ruleAction{Action: "timeout"}, MaxEmotes: 5}}, 0, "timeout duration"},
+		{moderationConfig{Caps: capsRule{ruleAction: ruleAction{Action: "delete"}, MaxRatio: 1.5}}, 0, "max_ratio"},
+		{moderationConfig{Repeats: repeatRule{ruleAction: ruleAction{Action: "delete"}, MaxRepeats: 3}}, 0, "period"},
+	}
+	for i, test := range tests {
+		var rules, err = test.config.rules()
+		if (err == nil) != (len(test.err) == 0) || (err != nil && !strings.Contains(err.Error(), test.err)) || len(rules) != test.rules {
+			t.Errorf("config %d: %d rules, error %v, expected %d rules, error %q", i, len(rules), err, test.rules, test.err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"twitch_chat_bot/cmd/chat"
+)
+
+// Interactive console.
+// While the bot is running, the operator can type commands into the console:
+// send chat messages, join / part channels, toggle printing chat messages and check the send queue.
+
+// Console command.
+type consoleCommand struct {
+	usage   string                          // Command arguments
+	help    string                          // Command description
+	minArgs int                             // Minimum amount of arguments
+	handler func(c *console, args []string) // Function called when the command is used
+}
+
+// Interactive console of running chat bot.
+type console struct {
+	client *chat.Client
+	out    io.Writer
+	quit   func() // Stops the chat bot
+}
+
+var consoleCommands map[string]consoleCommand
+
+func init() {
+	consoleCommands = map[string]consoleCommand{
+		"help": {help: "Shows available commands", handler: func(c *console, args []string) {
+			c.printHelp()
+		}},
+		"say": {usage: "<channel> <text>", help: "Sends chat message to the channel", minArgs: 2, handler: func(c *console, args []string) {
+			c.client.SendMessage(args[0], strings.Join(args[1:], " "))
+		}},
+		"join": {usage: "<channel>", help: "Joins the channel", minArgs: 1, handler: func(c *console, args []string) {
+			c.client.Join(args[0])
+		}},
+		"part": {usage: "<channel>", help: "Leaves the channel", minArgs: 1, handler: func(c *console, args []string) {
+			c.client.Part(args[0])
+		}},
+		"channels": {help: "Lists joined channels", handler: func(c *console, args []string) {
+			fmt.Fprintln(c.out, strings.Join(c.client.Channels(), ", "))
+		}},
+		"print": {usage: "[on|off]", help: "Toggles printing of chat messages", handler: func(c *console, args []string) {
+			switch {
+			case len(args) > 0 && (args[0] == "on" || args[0] == "off"):
+				chat.SetPrintChatMessages(args[0] == "on")
+			case len(args) > 0:
+				fmt.Fprintln(c.out, "Usage: print [on|off]")
+				return
+			default:
+				chat.SetPrintChatMessages(!chat.PrintChatMessages())
+			}
+			fmt.Fprintln(c.out, "Printing chat messages:", chat.PrintChatMessages())
+		}},
+		"queue": {help: "Shows send queue state", handler: func(c *console, args []string) {
+			var stats = c.client.QueueStats()
+			fmt.Fprintf(c.out, "Pending: %d, high priority: %d, sent: %d, duplicates: %d, whispers: %d\n",
+				stats.Pending, stats.HighPriority, stats.Sent, stats.Duplicates, c.client.PendingWhispers())
+		}},
+		"status": {help: "Shows connection state", handler: func(c *console, args []string) {
+			var last = "never"
+			if t := c.client.LastMessageReceived(); !t.IsZero() {
+				last = t.Format("15:04:05")
+			}
+			fmt.Fprintf(c.out, "Connected: %v, last message received: %s, reconnects: %d\n",
+				c.client.IsConnected(), last, c.client.Reconnects())
+		}},
+		"quit": {help: "Stops the chat bot", handler: func(c *console, args []string) {
+			c.quit()
+		}},
+	}
+}
+
+// Reads console commands line by line until the input is closed.
+func runConsole(client *chat.Client, in io.Reader, out io.Writer, quit func()) {
+	var c = &console{client: client, out: out, quit: quit}
+	var scanner = bufio.NewScanner(in)
+	for scanner.Scan() {
+		c.execute(scanner.Text())
+	}
+}
+
+// Parses and runs console command.
+func (c *console) execute(line string) {
+	var args = strings.Fields(line)
+	if len(args) == 0 {
+		return
+	}
+	var name = strings.ToLower(args[0])
+	if name == "exit" {
+		name = "quit"
+	}
+	var cmd, ok = consoleCommands[name]
+	if !ok {
+		fmt.Fprintf(c.out, "Unknown command %q, type \"help\" to list available commands\n", args[0])
+		return
+	}
+	if len(args)-1 < cmd.minArgs {
+		fmt.Fprintf(c.out, "Usage: %s %s\n", name, cmd.usage)
+		return
+	}
+	cmd.handler(c, args[1:])
+}
+
+// Prints available console commands.
+func (c *console) printHelp() {
+	for _, name := range []string{"say", "join", "part", "channels", "print", "queue", "status", "quit", "help"} {
+		var cmd = consoleCommands[name]
+		fmt.Fprintf(c.out, "  %-28s %s\n", strings.TrimSpace(name+" "+cmd.usage), cmd.help)
+	}
+}
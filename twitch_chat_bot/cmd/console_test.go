@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"twitch_chat_bot/cmd/chat"
+)
+
+func TestConsole(t *testing.T) {
+	var print = chat.PrintChatMessages()
+	defer chat.SetPrintChatMessages(print)
+	chat.SetPrintChatMessages(true)
+
+	var out strings.Builder
+	var quit = 0
+	var c = &console{client: chat.NewClient(chat.Config{Nick: "bot", Channels: []string{"channel"}}), out: &out, quit: func() { quit++ }}
+	var tests = []struct {
+		line   string
+		output string
+	}{
+		{"", ""},
+		{"  ", ""},
+		{"unknown", "Unknown command \"unknown\", type \"help\" to list available commands\n"},
+		{"say channel", "Usage: say <channel> <text>\n"},
+		{"join", "Usage: join <channel>\n"},
+		{"join #Other", ""},
+		{"JOIN other", ""},
+		{"channels", "channel, other\n"},
+		{"part channel", ""},
+		{"channels", "other\n"},
+		{"print off", "Printing chat messages: false\n"},
+		{"print", "Printing chat messages: true\n"},
+		{"print yes", "Usage: print [on|off]\n"},
+		{"print on", "Printing chat messages: true\n"},
+		{"queue", "Pending: 0, high priority: 0, sent: 0, duplicates: 0, whispers: 0\n"},
+		{"status", "Connected: false, last message received: never, reconnects: 0\n"},
+	}
+	for _, test := range tests {
+		out.Reset()
+		c.execute(test.line)
+		if out.String() != test.output {
+			t.Errorf("%q printed %q, expected %q", test.line, out.String(), test.output)
+		}
+	}
+	if !chat.PrintChatMessages() {
+		t.Error("printing of chat messages isn't enabled")
+	}
+
+	// Help lists every command
+	out.Reset()
+	c.execute("help")
+	for name, cmd := range consoleCommands {
+		if !strings.Contains(out.String(), strings.TrimSpace(name+" "+cmd.usage)) || !strings.Contains(out.String(), cmd.help) {
+			t.Errorf("help doesn't describe %q:\n%s", name, out.String())
+		}
+	}
+
+	c.execute("quit")
+	c.execute("exit")
+	if quit != 2 {
+		t.Errorf("quit called %d times, expected 2", quit)
+	}
+}
+
+func TestRunConsole(t *testing.T) {
+	var out strings.Builder
+	var quit = false
+	var client = chat.NewClient(chat.Config{Nick: "bot", Channels: []string{"channel"}})
+	runConsole(client, strings.NewReader("join other\r\n\nchannels\nquit\n"), &out, func() { quit = true })
+	if out.String() != "channel, other\n" || !quit {
+		t.Errorf("console printed %q, quit %v", out.String(), quit)
+	}
+}
@@ -0,0 +1,135 @@
+package eventsub
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// EventSub events delivered to subscribed handlers.
+
+// Event received from EventSub.
+type Event interface {
+	EventName() string // Returns subscription type of the event, like "channel.follow"
+}
+
+// Function called for every received event.
+type EventHandler func(event Event)
+
+// Channel points custom reward.
+type Reward struct {
+	ID     string `json:"id"`
+	Title  string `json:"title"`
+	Prompt string `json:"prompt"`
+	Cost   int    `json:"cost"`
+}
+
+// Viewer redeemed channel points custom reward.
+type RedemptionEvent struct {
+	ID                   string    `json:"id"`
+	BroadcasterUserID    string    `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string    `json:"broadcaster_user_login"`
+	UserID               string    `json:"user_id"`
+	UserLogin            string    `json:"user_login"`
+	UserName             string    `json:"user_name"`
+	UserInput            string    `json:"user_input"`
+	Status               string    `json:"status"` // "unfulfilled", "fulfilled" or "canceled"
+	Reward               Reward    `json:"reward"`
+	RedeemedAt           time.Time `json:"redeemed_at"`
+}
+
+// Viewer followed the channel.
+type FollowEvent struct {
+	BroadcasterUserID    string    `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string    `json:"broadcaster_user_login"`
+	UserID               string    `json:"user_id"`
+	UserLogin            string    `json:"user_login"`
+	UserName             string    `json:"user_name"`
+	FollowedAt           time.Time `json:"followed_at"`
+}
+
+// Phase of hype train.
+type HypeTrainPhase uint8
+
+const (
+	HypeTrainBegin HypeTrainPhase = iota
+	HypeTrainProgress
+	HypeTrainEnd
+)
+
+// Converts hype train phase to it's string representation.
+func (p HypeTrainPhase) ToString() string {
+	switch p {
+	case HypeTrainBegin:
+		return "Begin"
+	case HypeTrainProgress:
+		return "Progress"
+	case HypeTrainEnd:
+		return "End"
+	default:
+		return ""
+	}
+}
+
+// Hype train began, progressed or ended.
+type HypeTrainEvent struct {
+	Phase                HypeTrainPhase `json:"-"`
+	ID                   string         `json:"id"`
+	BroadcasterUserID    string         `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string         `json:"broadcaster_user_login"`
+	Level                int            `json:"level"`
+	Total                int            `json:"total"`    // Total points contributed
+	Progress             int            `json:"progress"` // Points contributed to current level
+	Goal                 int            `json:"goal"`     // Points needed to reach next level
+	StartedAt            time.Time      `json:"started_at"`
+	ExpiresAt            time.Time      `json:"expires_at"`       // Begin and progress only
+	EndedAt              time.Time      `json:"ended_at"`         // End only
+	CooldownEndsAt       time.Time      `json:"cooldown_ends_at"` // End only
+}
+
+// Stream went online or offline.
+type StreamEvent struct {
+	Online               bool      `json:"-"`
+	ID                   string    `json:"id"` // Online only
+	BroadcasterUserID    string    `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string    `json:"broadcaster_user_login"`
+	BroadcasterUserName  string    `json:"broadcaster_user_name"`
+	Type                 string    `json:"type"`       // Online only, "live", "playlist", "watch_party", "premiere" or "rerun"
+	StartedAt            time.Time `json:"started_at"` // Online only
+}
+
+// Notification of subscription type that doesn't have it's own event.
+type NotificationEvent struct {
+	Type    string          // Subscription type
+	Version string          // Subscription version
+	Event   json.RawMessage // Event data
+}
+
+// Subscription was revoked by Twitch (user revoked the authorization, user was removed, etc.).
+type RevocationEvent struct {
+	SubscriptionID string
+	Type           string // Subscription type
+	Status         string // Reason, like "authorization_revoked"
+}
+
+func (e *RedemptionEvent) EventName() string   { return TypeRedemption }
+func (e *FollowEvent) EventName() string       { return TypeFollow }
+func (e *NotificationEvent) EventName() string { return e.Type }
+func (e *RevocationEvent) EventName() string   { return "revocation" }
+
+func (e *StreamEvent) EventName() string {
+	if e.Online {
+		return TypeStreamOnline
+	}
+	return TypeStreamOffline
+}
+
+func (e *HypeTrainEvent) EventName() string {
+	switch e.Phase {
+	case HypeTrainBegin:
+		return TypeHypeTrainBegin
+	case HypeTrainProgress:
+		return TypeHypeTrainProgress
+	default:
+		return TypeHypeTrainEnd
+	}
+}
@@ -0,0 +1,419 @@
+package eventsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+	"twitch_chat_bot/cmd/helix"
+
+	"github.com/gorilla/websocket"
+)
+
+// EventSub WebSocket client.
+// It receives events that are not visible in IRC chat (channel points redemptions, follows, hype trains,
+// stream going online and offline).
+// After connecting the server sends welcome message with session ID, that is used to create subscriptions
+// through Twitch API. Subscriptions have to be created within 10 seconds after the welcome message.
+// The server sends keepalive messages when there are no notifications, if nothing is received
+// for keepalive timeout the connection is considered lost and the client reconnects with new session.
+// When the server asks to reconnect, the client connects to provided url and closes the old connection
+// after receiving the welcome message, subscriptions are kept in that case.
+// The same notification can be delivered more than once, duplicates are dropped by message ID.
+
+const DefaultURL = "wss://eventsub.wss.twitch.tv/ws" // Twitch EventSub WebSocket server
+
+const welcomeTimeout = time.Second * 10         // Maximum time to wait for welcome message
+const keepaliveMargin = time.Second * 5         // Added to keepalive timeout to account for delays
+const reconnectMinDelay = time.Second           // Delay before first reconnect attempt
+const reconnectMaxDelay = time.Minute * 2       // Maximum delay between reconnect attempts
+const duplicateMessagePeriod = time.Minute * 10 // How long received message IDs are remembered
+const subscribeTimeout = time.Second * 10       // Timeout of subscription requests
+
+// Subscription types.
+const (
+	TypeRedemption        = "channel.channel_points_custom_reward_redemption.add"
+	TypeFollow            = "channel.follow"
+	TypeHypeTrainBegin    = "channel.hype_train.begin"
+	TypeHypeTrainProgress = "channel.hype_train.progress"
+	TypeHypeTrainEnd      = "channel.hype_train.end"
+	TypeStreamOnline      = "stream.online"
+	TypeStreamOffline     = "stream.offline"
+)
+
+// Creates EventSub subscriptions, implemented by *helix.Client.
+type SubscriptionAPI interface {
+	CreateEventSubSubscription(ctx context.Context, request helix.EventSubRequest) (helix.EventSubSubscription, error)
+}
+
+// EventSub subscription.
+type Subscription struct {
+	Type      string
+	Version   string
+	Condition map[string]string
+}
+
+// Subscription to channel points redemptions. Requires channel:read:redemptions scope.
+func RedemptionSubscription(broadcasterID string) Subscription {
+	return Subscription{TypeRedemption, "1", map[string]string{"broadcaster_user_id": broadcasterID}}
+}
+
+// Subscription to follows. Requires moderator:read:followers scope.
+func FollowSubscription(broadcasterID, moderatorID string) Subscription {
+	return Subscription{TypeFollow, "2", map[string]string{"broadcaster_user_id": broadcasterID, "moderator_user_id": moderatorID}}
+}
+
+// Subscriptions to hype train begin, progress and end. Requires channel:read:hype_train scope.
+func HypeTrainSubscriptions(broadcasterID string) []Subscription {
+	var condition = map[string]string{"broadcaster_user_id": broadcasterID}
+	return []Subscription{
+		{TypeHypeTrainBegin, "1", condition},
+		{TypeHypeTrainProgress, "1", condition},
+		{TypeHypeTrainEnd, "1", condition},
+	}
+}
+
+// Subscriptions to stream going online and offline. Doesn't require any scope.
+func StreamSubscriptions(broadcasterID string) []Subscription {
+	var condition = map[string]string{"broadcaster_user_id": broadcasterID}
+	return []Subscription{
+		{TypeStreamOnline, "1", condition},
+		{TypeStreamOffline, "1", condition},
+	}
+}
+
+// EventSub client configuration.
+type Config struct {
+	URL           string          // EventSub server address, DefaultURL if empty
+	API           SubscriptionAPI // Creates subscriptions
+	Subscriptions []Subscription  // Subscriptions created after connecting
+}
+
+// EventSub client.
+type Client struct {
+	config              Config
+	received            map[string]time.Time // Time when message was received, key is message ID
+	sessionID           atomic.Pointer[string]
+	runMutex            sync.Mutex
+	cancel              context.CancelFunc
+	done                chan struct{}
+	eventHandlers       map[int]EventHandler
+	eventHandlersNextID int
+	eventHandlersMutex  sync.Mutex
+}
+
+// Message received from EventSub server.
+type message struct {
+	Metadata struct {
+		MessageID           string    `json:"message_id"`
+		MessageType         string    `json:"message_type"`
+		MessageTimestamp    time.Time `json:"message_timestamp"`
+		SubscriptionType    string    `json:"subscription_type"`
+		SubscriptionVersion string    `json:"subscription_version"`
+	} `json:"metadata"`
+	Payload struct {
+		Session *struct {
+			ID                      string `json:"id"`
+			Status                  string `json:"status"`
+			KeepaliveTimeoutSeconds int    `json:"keepalive_timeout_seconds"`
+			ReconnectURL            string `json:"reconnect_url"`
+		} `json:"session"`
+		Subscription *helix.EventSubSubscription `json:"subscription"`
+		Event        json.RawMessage             `json:"event"`
+	} `json:"payload"`
+}
+
+// Creates new EventSub client.
+func NewClient(config Config) *Client {
+	if len(config.URL) == 0 {
+		config.URL = DefaultURL
+	}
+	return &Client{
+		config:        config,
+		received:      make(map[string]time.Time),
+		eventHandlers: make(map[int]EventHandler),
+	}
+}
+
+// Starts the client in the background. It runs until Stop is called.
+func (c *Client) Start() {
+	c.runMutex.Lock()
+	defer c.runMutex.Unlock()
+	if c.cancel != nil {
+		return
+	}
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	var done = make(chan struct{})
+	c.cancel = cancel
+	c.done = done
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+}
+
+// Stops the client started with Start. Waits until the connection is closed.
+func (c *Client) Stop() {
+	c.runMutex.Lock()
+	defer c.runMutex.Unlock()
+	if c.cancel == nil {
+		return
+	}
+
+	c.cancel()
+	<-c.done
+	c.cancel = nil
+	c.done = nil
+}
+
+// Returns ID of current session, empty if not connected.
+func (c *Client) SessionID() string {
+	var id = c.sessionID.Load()
+	if id == nil {
+		return ""
+	}
+	return *id
+}
+
+// Runs the client until the context is canceled, reconnecting on errors.
+func (c *Client) Run(ctx context.Context) {
+	var delay = reconnectMinDelay
+	for {
+		slog.Info("EventSub connecting...")
+		var welcomed, err = c.handleConnection(ctx)
+		c.sessionID.Store(nil)
+		if ctx.Err() != nil {
+			slog.Info("EventSub stopped")
+			return
+		}
+		slog.Error("EventSub error.", "Err", err)
+		if welcomed {
+			delay = reconnectMinDelay // Connection was working, start counting from the beginning
+		}
+
+		var wait = delay/2 + rand.N(delay/2+1)
+		delay = min(delay*2, reconnectMaxDelay)
+		slog.Info("EventSub reconnecting", "Delay", wait)
+		select {
+		case <-ctx.Done():
+			slog.Info("EventSub stopped")
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Connects to the server and processes received messages until an error or context cancellation.
+// Returns true if welcome message was received.
+func (c *Client) handleConnection(ctx context.Context) (bool, error) {
+	var ws, _, err = websocket.DefaultDialer.DialContext(ctx, c.config.URL, nil)
+	if err != nil {
+		return false, err
+	}
+
+	// Current connection changes when the server asks to reconnect
+	var conn atomic.Pointer[websocket.Conn]
+	conn.Store(ws)
+	var stop = context.AfterFunc(ctx, func() { conn.Load().Close() })
+	defer stop()
+	defer func() { conn.Load().Close() }()
+
+	var welcomed = false
+	var keepalive = welcomeTimeout
+	for {
+		var ws = conn.Load()
+		ws.SetReadDeadline(time.Now().Add(keepalive))
+		var msg, err = readMessage(ws)
+		if err != nil {
+			return welcomed, err
+		}
+
+		switch msg.Metadata.MessageType {
+		case "session_welcome":
+			if msg.Payload.Session == nil {
+				return welcomed, errors.New("welcome message without session")
+			}
+			keepalive = time.Duration(msg.Payload.Session.KeepaliveTimeoutSeconds)*time.Second + keepaliveMargin
+			c.sessionID.Store(&msg.Payload.Session.ID)
+			if !welcomed {
+				welcomed = true
+				slog.Info("EventSub connected!", "Session", msg.Payload.Session.ID)
+				c.subscribe(ctx, msg.Payload.Session.ID)
+			}
+
+		case "session_keepalive":
+			// Read deadline is extended with every message
+
+		case "session_reconnect":
+			if msg.Payload.Session == nil || len(msg.Payload.Session.ReconnectURL) == 0 {
+				return welcomed, errors.New("reconnect message without reconnect url")
+			}
+			slog.Info("EventSub server requested reconnect")
+			newWS, newKeepalive, err := c.reconnect(ctx, msg.Payload.Session.ReconnectURL)
+			if err != nil {
+				return welcomed, fmt.Errorf("reconnect failed: %w", err)
+			}
+			conn.Store(newWS)
+			ws.Close()
+			keepalive = newKeepalive
+
+		case "notification":
+			if c.isDuplicate(msg.Metadata.MessageID, msg.Metadata.MessageTimestamp) {
+				continue
+			}
+			var event, err = parseEvent(msg.Metadata.SubscriptionType, msg.Metadata.SubscriptionVersion, msg.Payload.Event)
+			if err != nil {
+				slog.Error("EventSub error, when parsing notification.", "Type", msg.Metadata.SubscriptionType, "Err", err)
+				continue
+			}
+			c.emitEvent(event)
+
+		case "revocation":
+			if msg.Payload.Subscription == nil {
+				continue
+			}
+			slog.Warn("EventSub subscription revoked", "Type", msg.Payload.Subscription.Type, "Status", msg.Payload.Subscription.Status)
+			c.emitEvent(&RevocationEvent{
+				SubscriptionID: msg.Payload.Subscription.ID,
+				Type:           msg.Payload.Subscription.Type,
+				Status:         msg.Payload.Subscription.Status,
+			})
+
+		default:
+			slog.Warn("EventSub unknown message type", "Type", msg.Metadata.MessageType)
+		}
+	}
+}
+
+// Connects to reconnect url and waits for welcome message. Returns new connection and it's keepalive timeout.
+func (c *Client) reconnect(ctx context.Context, url string) (*websocket.Conn, time.Duration, error) {
+	var ws, _, err = websocket.DefaultDialer.DialContext(ctx, url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	ws.SetReadDeadline(time.Now().Add(welcomeTimeout))
+	msg, err := readMessage(ws)
+	if err == nil && (msg.Metadata.MessageType != "session_welcome" || msg.Payload.Session == nil) {
+		err = fmt.Errorf("expected welcome message, received %q", msg.Metadata.MessageType)
+	}
+	if err != nil {
+		ws.Close()
+		return nil, 0, err
+	}
+	c.sessionID.Store(&msg.Payload.Session.ID)
+	return ws, time.Duration(msg.Payload.Session.KeepaliveTimeoutSeconds)*time.Second + keepaliveMargin, nil
+}
+
+// Reads and decodes one message.
+func readMessage(ws *websocket.Conn) (message, error) {
+	var msg message
+	var _, data, err = ws.ReadMessage()
+	if err != nil {
+		return msg, err
+	}
+	err = json.Unmarshal(data, &msg)
+	return msg, err
+}
+
+// Creates configured subscriptions for the session.
+func (c *Client) subscribe(ctx context.Context, sessionID string) {
+	if c.config.API == nil {
+		slog.Warn("EventSub subscriptions API is not configured")
+		return
+	}
+	for _, sub := range c.config.Subscriptions {
+		var reqCtx, cancel = context.WithTimeout(ctx, subscribeTimeout)
+		var _, err = c.config.API.CreateEventSubSubscription(reqCtx, helix.EventSubRequest{
+			Type:      sub.Type,
+			Version:   sub.Version,
+			Condition: sub.Condition,
+			Transport: helix.EventSubTransport{Method: "websocket", SessionID: sessionID},
+		})
+		cancel()
+		if err != nil {
+			slog.Error("EventSub error, when creating subscription.", "Type", sub.Type, "Err", err)
+		}
+	}
+}
+
+// Returns true if the message was already received or it's too old (it could be a replay).
+// Old message IDs are forgotten.
+func (c *Client) isDuplicate(id string, timestamp time.Time) bool {
+	var now = time.Now()
+	for key, t := range c.received {
+		if now.Sub(t) > duplicateMessagePeriod {
+			delete(c.received, key)
+		}
+	}
+	if !timestamp.IsZero() && now.Sub(timestamp) > duplicateMessagePeriod {
+		return true
+	}
+	if _, found := c.received[id]; found {
+		return true
+	}
+	c.received[id] = now
+	return false
+}
+
+// Decodes notification event of provided subscription type.
+func parseEvent(subscriptionType, version string, data json.RawMessage) (Event, error) {
+	var event Event
+	switch subscriptionType {
+	case TypeRedemption:
+		event = &RedemptionEvent{}
+	case TypeFollow:
+		event = &FollowEvent{}
+	case TypeHypeTrainBegin:
+		event = &HypeTrainEvent{Phase: HypeTrainBegin}
+	case TypeHypeTrainProgress:
+		event = &HypeTrainEvent{Phase: HypeTrainProgress}
+	case TypeHypeTrainEnd:
+		event = &HypeTrainEvent{Phase: HypeTrainEnd}
+	case TypeStreamOnline:
+		event = &StreamEvent{Online: true}
+	case TypeStreamOffline:
+		event = &StreamEvent{Online: false}
+	default:
+		return &NotificationEvent{Type: subscriptionType, Version: version, Event: data}, nil
+	}
+	var err = json.Unmarshal(data, event)
+	return event, err
+}
+
+// Subscribes event handler to EventSub events. Returns subscription ID that can be used to unsubscribe.
+func (c *Client) Subscribe(handler EventHandler) int {
+	c.eventHandlersMutex.Lock()
+	defer c.eventHandlersMutex.Unlock()
+
+	var id = c.eventHandlersNextID
+	c.eventHandlersNextID++
+	c.eventHandlers[id] = handler
+	return id
+}
+
+// Unsubscribes event handler with provided subscription ID.
+func (c *Client) Unsubscribe(id int) {
+	c.eventHandlersMutex.Lock()
+	delete(c.eventHandlers, id)
+	c.eventHandlersMutex.Unlock()
+}
+
+// Calls every subscribed event handler with provided event.
+func (c *Client) emitEvent(event Event) {
+	c.eventHandlersMutex.Lock()
+	var handlers = make([]EventHandler, 0, len(c.eventHandlers))
+	for _, handler := range c.eventHandlers {
+		handlers = append(handlers, handler)
+	}
+	c.eventHandlersMutex.Unlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
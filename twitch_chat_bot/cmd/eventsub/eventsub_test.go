@@ -0,0 +1,221 @@
+package eventsub
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"twitch_chat_bot/cmd/helix"
+
+	"github.com/gorilla/websocket"
+)
+
+// Subscriptions API recording created subscriptions.
+type fakeAPI struct {
+	mutex    sync.Mutex
+	requests []helix.EventSubRequest
+	created  chan struct{} // Signaled with every created subscription
+}
+
+func (a *fakeAPI) CreateEventSubSubscription(ctx context.Context, request helix.EventSubRequest) (helix.EventSubSubscription, error) {
+	a.mutex.Lock()
+	a.requests = append(a.requests, request)
+	a.mutex.Unlock()
+	a.created <- struct{}{}
+	return helix.EventSubSubscription{ID: "sub-" + request.Type, Status: "enabled", Type: request.Type}, nil
+}
+
+// Local stand-in of EventSub server. Every accepted connection is passed to the test.
+type fakeServer struct {
+	server *httptest.Server
+	conns  chan *websocket.Conn
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+	var s = &fakeServer{conns: make(chan *websocket.Conn, 10)}
+	var upgrader = websocket.Upgrader{}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ws, err = upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		s.conns <- ws
+	}))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// Returns WebSocket address of the server path.
+func (s *fakeServer) url(path string) string {
+	return "ws" + strings.TrimPrefix(s.server.URL, "http") + path
+}
+
+// Waits for new connection to the server.
+func (s *fakeServer) accept(t *testing.T) *websocket.Conn {
+	t.Helper()
+	select {
+	case ws := <-s.conns:
+		t.Cleanup(func() { ws.Close() })
+		return ws
+	case <-time.After(time.Second * 5):
+		t.Fatal("client didn't connect")
+		return nil
+	}
+}
+
+// Sends EventSub message with provided metadata and payload.
+func send(t *testing.T, ws *websocket.Conn, id, messageType, subscriptionType string, timestamp time.Time, payload string) {
+	t.Helper()
+	var data = fmt.Sprintf(`{"metadata":{"message_id":%q,"message_type":%q,"message_timestamp":%q,"subscription_type":%q,"subscription_version":"1"},"payload":%s}`,
+		id, messageType, timestamp.Format(time.RFC3339Nano), subscriptionType, payload)
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(data)); err != nil {
+		t.Fatalf("sending %s message failed: %v", messageType, err)
+	}
+}
+
+func welcome(t *testing.T, ws *websocket.Conn, sessionID string) {
+	t.Helper()
+	send(t, ws, "welcome-"+sessionID, "session_welcome", "", time.Now(),
+		fmt.Sprintf(`{"session":{"id":%q,"status":"connected","keepalive_timeout_seconds":10,"reconnect_url":null}}`, sessionID))
+}
+
+// Waits for next event received by the client.
+func nextEvent(t *testing.T, events chan Event) Event {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(time.Second * 5):
+		t.Fatal("event wasn't received")
+		return nil
+	}
+}
+
+func TestClient(t *testing.T) {
+	var server = newFakeServer(t)
+	var api = &fakeAPI{created: make(chan struct{}, 10)}
+	var client = NewClient(Config{
+		URL:           server.url("/ws"),
+		API:           api,
+		Subscriptions: []Subscription{RedemptionSubscription("1"), FollowSubscription("1", "2")},
+	})
+	var events = make(chan Event, 10)
+	client.Subscribe(func(event Event) { events <- event })
+	client.Start()
+	defer client.Stop()
+
+	// Subscriptions are created for the session after the welcome message
+	var ws = server.accept(t)
+	welcome(t, ws, "session-1")
+	for i := 0; i < 2; i++ {
+		select {
+		case <-api.created:
+		case <-time.After(time.Second * 5):
+			t.Fatal("subscriptions weren't created")
+		}
+	}
+	api.mutex.Lock()
+	for _, request := range api.requests {
+		if request.Transport.Method != "websocket" || request.Transport.SessionID != "session-1" {
+			t.Errorf("subscription %s created with transport %+v", request.Type, request.Transport)
+		}
+	}
+	if api.requests[0].Type != TypeRedemption || api.requests[1].Condition["moderator_user_id"] != "2" {
+		t.Errorf("unexpected subscriptions %+v", api.requests)
+	}
+	api.mutex.Unlock()
+	if client.SessionID() != "session-1" {
+		t.Errorf("session ID %q", client.SessionID())
+	}
+
+	// Keepalive isn't an event, notifications are delivered once
+	var redemption = `{"subscription":{"id":"sub-1","type":"channel.channel_points_custom_reward_redemption.add"},"event":{"id":"r1","user_login":"viewer","user_name":"Viewer","user_input":"hi","status":"unfulfilled","reward":{"id":"reward-1","title":"Hydrate","cost":100}}}`
+	send(t, ws, "keepalive-1", "session_keepalive", "", time.Now(), `{}`)
+	send(t, ws, "n1", "notification", TypeRedemption, time.Now(), redemption)
+	send(t, ws, "n1", "notification", TypeRedemption, time.Now(), redemption)
+	send(t, ws, "n-old", "notification", TypeRedemption, time.Now().Add(-time.Hour), redemption)
+	send(t, ws, "n2", "notification", "channel.raid", time.Now(), `{"event":{"viewers":10}}`)
+	if e, ok := nextEvent(t, events).(*RedemptionEvent); !ok || e.Reward.Title != "Hydrate" || e.UserName != "Viewer" || e.UserInput != "hi" {
+		t.Errorf("unexpected redemption event %+v", e)
+	}
+	if e, ok := nextEvent(t, events).(*NotificationEvent); !ok || e.Type != "channel.raid" || string(e.Event) != `{"viewers":10}` {
+		t.Errorf("expected raid notification, received %+v", e)
+	}
+
+	// Revoked subscription is reported
+	send(t, ws, "revocation-1", "revocation", TypeFollow, time.Now(),
+		`{"subscription":{"id":"sub-2","status":"authorization_revoked","type":"channel.follow"}}`)
+	if e, ok := nextEvent(t, events).(*RevocationEvent); !ok || e.SubscriptionID != "sub-2" || e.Status != "authorization_revoked" {
+		t.Errorf("unexpected revocation event %+v", e)
+	}
+
+	// After reconnect request the client moves to the new connection, subscriptions are kept
+	send(t, ws, "reconnect-1", "session_reconnect", "", time.Now(),
+		fmt.Sprintf(`{"session":{"id":"session-1","status":"reconnecting","keepalive_timeout_seconds":null,"reconnect_url":%q}}`, server.url("/reconnect")))
+	var newWS = server.accept(t)
+	welcome(t, newWS, "session-2")
+	ws.SetReadDeadline(time.Now().Add(time.Second * 5))
+	if _, _, err := ws.ReadMessage(); err == nil {
+		t.Error("old connection wasn't closed")
+	}
+	send(t, newWS, "n3", "notification", TypeFollow, time.Now(), `{"event":{"user_login":"follower","user_name":"Follower"}}`)
+	if e, ok := nextEvent(t, events).(*FollowEvent); !ok || e.UserName != "Follower" {
+		t.Errorf("unexpected follow event %+v", e)
+	}
+	if client.SessionID() != "session-2" {
+		t.Errorf("session ID %q after reconnect", client.SessionID())
+	}
+	if len(api.created) != 0 {
+		t.Error("subscriptions were created again after reconnect")
+	}
+}
+
+func TestClientReconnectsWithNewSession(t *testing.T) {
+	var server = newFakeServer(t)
+	var api = &fakeAPI{created: make(chan struct{}, 10)}
+	var client = NewClient(Config{URL: server.url("/ws"), API: api, Subscriptions: []Subscription{RedemptionSubscription("1")}})
+	client.Start()
+	defer client.Stop()
+
+	var ws = server.accept(t)
+	welcome(t, ws, "session-1")
+	<-api.created
+
+	// Lost connection is replaced with new session, that needs new subscriptions
+	ws.Close()
+	ws = server.accept(t)
+	welcome(t, ws, "session-2")
+	select {
+	case <-api.created:
+	case <-time.After(time.Second * 5):
+		t.Fatal("subscriptions weren't created for new session")
+	}
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	if api.requests[1].Transport.SessionID != "session-2" {
+		t.Errorf("subscription created for session %q", api.requests[1].Transport.SessionID)
+	}
+}
+
+func TestParseStreamEvent(t *testing.T) {
+	var tests = []struct {
+		subscriptionType string
+		data             string
+		online           bool
+	}{
+		{TypeStreamOnline, `{"id":"9001","broadcaster_user_id":"1","broadcaster_user_login":"channel","broadcaster_user_name":"Channel","type":"live","started_at":"2024-01-01T12:00:00Z"}`, true},
+		{TypeStreamOffline, `{"broadcaster_user_id":"1","broadcaster_user_login":"channel","broadcaster_user_name":"Channel"}`, false},
+	}
+	for _, test := range tests {
+		var event, err = parseEvent(test.subscriptionType, "1", []byte(test.data))
+		var e, ok = event.(*StreamEvent)
+		if err != nil || !ok || e.Online != test.online || e.BroadcasterUserLogin != "channel" || e.EventName() != test.subscriptionType {
+			t.Errorf("%s parsed as %+v, %v", test.subscriptionType, event, err)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package games
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+	"twitch_chat_bot/cmd/chat"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Chat mini-games: polls, giveaways and trivia.
+// Moderators start the games with chat commands, chatters take part by typing keywords in chat:
+// - !poll 2m Best game? | Minecraft | Terraria - chatters vote with option number or text until the time runs out,
+// - !giveaway start !join - chatters enter by typing the keyword, moderators draw winners with !giveaway draw,
+// - !trivia - asks a random question, the first chatter with correct answer gets a point.
+// Results are announced in chat. State of the games is stored in SQLite database after every change,
+// so it survives reconnects and restarts of the chat bot. Timed games that ended while the bot was offline
+// are finished when the manager is attached to the client.
+
+const defaultSubscriberWeight = 2             // Default amount of giveaway tickets of subscribers
+const defaultTriviaTimeout = time.Second * 30 // Default time to answer trivia question
+const triviaLeaderboardSize = 5               // Amount of chatters shown by trivia leaderboard
+
+const (
+	gamePoll     = "poll"
+	gameGiveaway = "giveaway"
+	gameTrivia   = "trivia"
+)
+
+var ErrGameRunning = errors.New("game is already running")
+var ErrNoGame = errors.New("game is not running")
+
+// Games configuration.
+type Config struct {
+	Bots             []string         // Logins of bots excluded from giveaways, should include the chat bot itself
+	SubscriberWeight int              // Amount of giveaway tickets of subscribers (regular chatters get 1), 0 means 2
+	Questions        []Question       // Trivia questions
+	TriviaTimeout    time.Duration    // Time to answer trivia question, 0 means 30 seconds
+	Clock            func() time.Time // Time source, time.Now if nil
+	Rand             *rand.Rand       // Random numbers source used to draw winners and questions, default source if nil
+}
+
+// Games manager.
+type Manager struct {
+	db        *sql.DB
+	config    Config
+	client    *chat.Client
+	mutex     sync.Mutex
+	polls     map[string]*Poll       // Running polls, key is channel name
+	giveaways map[string]*Giveaway   // Running giveaways, key is channel name
+	trivia    map[string]*Trivia     // Asked trivia questions, key is channel name
+	timers    map[string]*time.Timer // Timers ending timed games, key is channel name and game
+	restored  bool                   // Were timers of games loaded from the database started?
+}
+
+// Opens games database and loads state of running games. If the database file is not found, new file is created.
+func Open(path string, config Config) (*Manager, error) {
+	if config.SubscriberWeight <= 0 {
+		config.SubscriberWeight = defaultSubscriberWeight
+	}
+	if config.TriviaTimeout <= 0 {
+		config.TriviaTimeout = defaultTriviaTimeout
+	}
+	if config.Clock == nil {
+		config.Clock = time.Now
+	}
+	var bots []string
+	for _, bot := range config.Bots {
+		bots = append(bots, strings.ToLower(bot))
+	}
+	config.Bots = bots
+	var questions []Question
+	for _, q := range config.Questions {
+		if len(q.Question) > 0 && len(q.Answers) > 0 {
+			questions = append(questions, q)
+		}
+	}
+	config.Questions = questions
+
+	var db, err = sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec(`
+CREATE TABLE IF NOT EXISTS games (
+	channel TEXT NOT NULL,
+	game TEXT NOT NULL,
+	state TEXT NOT NULL,
+	PRIMARY KEY (channel, game));
+CREATE TABLE IF NOT EXISTS trivia_scores (
+	channel TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	user_name TEXT NOT NULL,
+	score INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (channel, user_id));`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	var m = &Manager{
+		db:        db,
+		config:    config,
+		polls:     make(map[string]*Poll),
+		giveaways: make(map[string]*Giveaway),
+		trivia:    make(map[string]*Trivia),
+		timers:    make(map[string]*time.Timer),
+	}
+	if err = m.load(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// Stops timers and closes the database.
+func (m *Manager) Close() error {
+	m.mutex.Lock()
+	for key, timer := range m.timers {
+		timer.Stop()
+		delete(m.timers, key)
+	}
+	m.mutex.Unlock()
+	return m.db.Close()
+}
+
+// Loads state of running games from the database.
+func (m *Manager) load() error {
+	var rows, err = m.db.Query("SELECT channel, game, state FROM games;")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var channel, game, state string
+		if err = rows.Scan(&channel, &game, &state); err != nil {
+			return err
+		}
+		switch game {
+		case gamePoll:
+			var p Poll
+			err = json.Unmarshal([]byte(state), &p)
+			m.polls[channel] = &p
+		case gameGiveaway:
+			var g Giveaway
+			err = json.Unmarshal([]byte(state), &g)
+			m.giveaways[channel] = &g
+		case gameTrivia:
+			var t Trivia
+			err = json.Unmarshal([]byte(state), &t)
+			m.trivia[channel] = &t
+		}
+		if err != nil {
+			slog.Error("Games error, when loading game state.", "Channel", channel, "Game", game, "Err", err)
+		}
+	}
+	return rows.Err()
+}
+
+// Stores state of the game, nil state removes it. Should be called with locked mutex.
+func (m *Manager) save(channel, game string, state any) {
+	var err error
+	if state == nil {
+		_, err = m.db.Exec("DELETE FROM games WHERE channel = ? AND game = ?;", channel, game)
+	} else {
+		var data []byte
+		data, err = json.Marshal(state)
+		if err == nil {
+			_, err = m.db.Exec("INSERT OR REPLACE INTO games (channel, game, state) VALUES (?, ?, ?);", channel, game, string(data))
+		}
+	}
+	if err != nil {
+		slog.Error("Games error, when saving game state.", "Channel", channel, "Game", game, "Err", err)
+	}
+}
+
+// Calls the function at provided time, replacing previous timer of the game. Should be called with locked mutex.
+func (m *Manager) schedule(channel, game string, at time.Time, f func()) {
+	var key = channel + "/" + game
+	if timer, ok := m.timers[key]; ok {
+		timer.Stop()
+	}
+	m.timers[key] = time.AfterFunc(at.Sub(m.config.Clock()), func() {
+		m.mutex.Lock()
+		delete(m.timers, key)
+		m.mutex.Unlock()
+		f()
+	})
+}
+
+// Stops timer of the game. Should be called with locked mutex.
+func (m *Manager) unschedule(channel, game string) {
+	var key = channel + "/" + game
+	if timer, ok := m.timers[key]; ok {
+		timer.Stop()
+		delete(m.timers, key)
+	}
+}
+
+// Sends chat message to the channel, if the manager is attached to a client.
+func (m *Manager) announce(channel, msg string) {
+	slog.Info("Games", "Channel", channel, "Message", msg)
+	if m.client != nil {
+		m.client.SendMessage(channel, msg)
+	}
+}
+
+// Returns random number in [0, n).
+func (m *Manager) randN(n int) int {
+	if m.config.Rand != nil {
+		return m.config.Rand.IntN(n)
+	}
+	return rand.IntN(n)
+}
+
+// Starts handling chat messages of the client (votes, giveaway entries, trivia answers) and announcing results.
+// Timers of games loaded from the database start when the client connects, so games that ended
+// while the bot was offline are finished and their results announced. Returns subscription ID that can be used to unsubscribe.
+func (m *Manager) Attach(client *chat.Client) int {
+	m.mutex.Lock()
+	m.client = client
+	m.mutex.Unlock()
+
+	return client.Subscribe(func(event chat.Event) {
+		if e, ok := event.(*chat.ConnectionEvent); ok && e.State == chat.ConnectionConnected {
+			m.restoreTimers()
+			return
+		}
+		var e, ok = event.(*chat.MessageEvent)
+		if !ok || e.Message.Command != "PRIVMSG" || e.Metadata.UserID == 0 {
+			return
+		}
+		var text = strings.TrimSpace(e.Message.Trailing)
+		if strings.HasPrefix(text, chat.CommandPrefix) && !m.IsGiveawayKeyword(e.Channel, text) {
+			return
+		}
+		m.vote(e.Channel, e.Metadata.UserID, text)
+		m.enter(e.Channel, e.Message.Prefix.Nick, e.Metadata, text)
+		m.answer(e.Channel, e.Metadata.UserID, e.Metadata.UserName, text)
+	})
+}
+
+// Starts timers of games loaded from the database, only once.
+func (m *Manager) restoreTimers() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.restored {
+		return
+	}
+	m.restored = true
+	for channel, p := range m.polls {
+		m.schedule(channel, gamePoll, p.Ends, func() { m.EndPoll(channel) })
+	}
+	for channel, t := range m.trivia {
+		m.schedule(channel, gameTrivia, t.Ends, func() { m.expireTrivia(channel) })
+	}
+}
+
+// Registers games chat commands: !poll, !giveaway and !trivia.
+// Starting and ending games requires moderator permission (moderators skip cooldowns), status can be checked by everyone.
+func (m *Manager) RegisterCommands(client *chat.Client) error {
+	return errors.Join(
+		client.RegisterCommand(chat.Command{
+			Name:         "poll",
+			UserCooldown: time.Second * 10,
+			Handler:      m.pollCommand,
+		}),
+		client.RegisterCommand(chat.Command{
+			Name:         "giveaway",
+			UserCooldown: time.Second * 10,
+			Handler:      m.giveawayCommand,
+		}),
+		client.RegisterCommand(chat.Command{
+			Name:         "trivia",
+			UserCooldown: time.Second * 10,
+			Handler:      m.triviaCommand,
+		}),
+	)
+}
+
+// Returns true if the chatter that used the command is a moderator or the broadcaster.
+func isModerator(ctx *chat.CommandContext) bool {
+	return chat.PermissionFromBadge(ctx.Metadata.Badge) >= chat.PermissionModerator
+}
@@ -0,0 +1,233 @@
+package games
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"twitch_chat_bot/cmd/chat"
+)
+
+// Giveaway entry.
+type GiveawayEntry struct {
+	UserName string `json:"user_name"` // Name of the chatter
+	Weight   int    `json:"weight"`    // Amount of tickets, subscribers get more
+}
+
+// Chat giveaway.
+type Giveaway struct {
+	Keyword   string                  `json:"keyword"`    // Chat message that enters the giveaway
+	Open      bool                    `json:"open"`       // Are new entries accepted?
+	Entries   map[int64]GiveawayEntry `json:"entries"`    // Giveaway entries, key is chatter ID
+	Winners   []string                `json:"winners"`    // Names of already drawn winners
+	WinnerIDs []int64                 `json:"winner_ids"` // IDs of already drawn winners, they can't enter again
+}
+
+// Returns true if the chat message matches giveaway keyword.
+func (g *Giveaway) matches(text string) bool {
+	return strings.EqualFold(strings.TrimSpace(text), g.Keyword)
+}
+
+// Starts new giveaway in the channel. Chatters enter by typing the keyword in chat.
+func (m *Manager) StartGiveaway(channel, keyword string) error {
+	keyword = strings.TrimSpace(keyword)
+	if len(keyword) == 0 {
+		return fmt.Errorf("giveaway keyword is empty")
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.giveaways[channel]; ok {
+		return ErrGameRunning
+	}
+	var g = &Giveaway{
+		Keyword: keyword,
+		Open:    true,
+		Entries: make(map[int64]GiveawayEntry),
+	}
+	m.giveaways[channel] = g
+	m.save(channel, gameGiveaway, g)
+	m.announce(channel, fmt.Sprintf("Giveaway started! Type %s in chat to enter. Subscribers get %dx more tickets.",
+		keyword, m.config.SubscriberWeight))
+	return nil
+}
+
+// Closes entries of the giveaway in the channel, winners can still be drawn.
+func (m *Manager) CloseGiveaway(channel string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var g, ok = m.giveaways[channel]
+	if !ok {
+		return ErrNoGame
+	}
+	g.Open = false
+	m.save(channel, gameGiveaway, g)
+	m.announce(channel, fmt.Sprintf("Giveaway entries are closed, %d chatters entered.", len(g.Entries)))
+	return nil
+}
+
+// Draws giveaway winner, subscribers have higher chance to win. The winner is removed from the entries,
+// so next draw picks another chatter. Returns name of the winner.
+func (m *Manager) DrawGiveaway(channel string) (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var g, ok = m.giveaways[channel]
+	if !ok {
+		return "", ErrNoGame
+	}
+	if len(g.Entries) == 0 {
+		return "", fmt.Errorf("nobody entered the giveaway")
+	}
+
+	// Sort the entries, so the draw depends only on the random number
+	var ids = make([]int64, 0, len(g.Entries))
+	var tickets = 0
+	for id, entry := range g.Entries {
+		ids = append(ids, id)
+		tickets += entry.Weight
+	}
+	slices.Sort(ids)
+	var ticket = m.randN(tickets)
+	var winnerID = ids[len(ids)-1]
+	for _, id := range ids {
+		if ticket < g.Entries[id].Weight {
+			winnerID = id
+			break
+		}
+		ticket -= g.Entries[id].Weight
+	}
+
+	var winner = g.Entries[winnerID].UserName
+	delete(g.Entries, winnerID)
+	g.Winners = append(g.Winners, winner)
+	g.WinnerIDs = append(g.WinnerIDs, winnerID)
+	m.save(channel, gameGiveaway, g)
+	m.announce(channel, fmt.Sprintf("Giveaway winner is @%s, congratulations!", winner))
+	return winner, nil
+}
+
+// Ends the giveaway in the channel.
+func (m *Manager) EndGiveaway(channel string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var g, ok = m.giveaways[channel]
+	if !ok {
+		return ErrNoGame
+	}
+	delete(m.giveaways, channel)
+	m.save(channel, gameGiveaway, nil)
+	if len(g.Winners) > 0 {
+		m.announce(channel, fmt.Sprintf("Giveaway ended, winners: %s.", strings.Join(g.Winners, ", ")))
+	} else {
+		m.announce(channel, "Giveaway ended without winners.")
+	}
+	return nil
+}
+
+// Returns copy of the giveaway in the channel.
+func (m *Manager) Giveaway(channel string) (Giveaway, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var g, ok = m.giveaways[channel]
+	if !ok {
+		return Giveaway{}, false
+	}
+	var giveaway = *g
+	giveaway.Entries = make(map[int64]GiveawayEntry, len(g.Entries))
+	for id, entry := range g.Entries {
+		giveaway.Entries[id] = entry
+	}
+	giveaway.Winners = slices.Clone(g.Winners)
+	giveaway.WinnerIDs = slices.Clone(g.WinnerIDs)
+	return giveaway, true
+}
+
+// Returns true if the chat message is keyword of running giveaway.
+func (m *Manager) IsGiveawayKeyword(channel, text string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var g, ok = m.giveaways[channel]
+	return ok && g.matches(text)
+}
+
+// Enters the chatter into the giveaway if the chat message matches the keyword.
+// The broadcaster, bots and already drawn winners can't enter, subscribers get more tickets. Bots are matched by login,
+// display names can differ from it (like localized names).
+func (m *Manager) enter(channel, login string, metadata chat.MessageMetadata, text string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var g, ok = m.giveaways[channel]
+	if !ok || !g.Open || !g.matches(text) {
+		return
+	}
+	if _, ok := g.Entries[metadata.UserID]; ok {
+		return
+	}
+	if metadata.Badge == "STR" || slices.Contains(m.config.Bots, strings.ToLower(login)) {
+		return
+	}
+	if slices.Contains(g.WinnerIDs, metadata.UserID) {
+		return
+	}
+
+	var weight = 1
+	if isSubscriber(metadata.Tags) {
+		weight = m.config.SubscriberWeight
+	}
+	g.Entries[metadata.UserID] = GiveawayEntry{UserName: metadata.UserName, Weight: weight}
+	m.save(channel, gameGiveaway, g)
+}
+
+// Returns true if the chatter is subscribed to the channel.
+func isSubscriber(tags chat.Tags) bool {
+	if tags.Bool("subscriber") {
+		return true
+	}
+	var _, sub = tags.Badge("subscriber")
+	var _, founder = tags.Badge("founder")
+	return sub || founder
+}
+
+// !giveaway start <keyword> - starts new giveaway (moderators).
+// !giveaway close - stops accepting entries (moderators).
+// !giveaway draw - draws a winner, can be used multiple times (moderators).
+// !giveaway end - ends the giveaway (moderators).
+// !giveaway - shows the running giveaway.
+func (m *Manager) giveawayCommand(ctx *chat.CommandContext) {
+	var channel = ctx.Metadata.Channel
+	if len(ctx.Args) == 0 {
+		var g, ok = m.Giveaway(channel)
+		switch {
+		case !ok:
+			ctx.Reply("There is no giveaway running.")
+		case g.Open:
+			ctx.Reply(fmt.Sprintf("Type %s in chat to enter the giveaway! Entries: %d.", g.Keyword, len(g.Entries)))
+		default:
+			ctx.Reply(fmt.Sprintf("Giveaway entries are closed. Entries: %d.", len(g.Entries)))
+		}
+		return
+	}
+	if !isModerator(ctx) {
+		return
+	}
+
+	var err error
+	switch strings.ToLower(ctx.Args[0]) {
+	case "start":
+		if len(ctx.Args) < 2 {
+			ctx.Reply("Usage: !giveaway start <keyword>")
+			return
+		}
+		err = m.StartGiveaway(channel, strings.Join(ctx.Args[1:], " "))
+	case "close":
+		err = m.CloseGiveaway(channel)
+	case "draw":
+		_, err = m.DrawGiveaway(channel)
+	case "end", "cancel":
+		err = m.EndGiveaway(channel)
+	default:
+		ctx.Reply("Usage: !giveaway [start <keyword>|close|draw|end]")
+		return
+	}
+	if err != nil {
+		ctx.Reply(fmt.Sprintf("Giveaway error: %s.", err))
+	}
+}
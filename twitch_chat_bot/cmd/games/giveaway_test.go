@@ -0,0 +1,197 @@
+package games
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"path/filepath"
+	"testing"
+	"time"
+	"twitch_chat_bot/cmd/chat"
+	"twitch_chat_bot/cmd/chat/chattest"
+)
+
+// Random source always returning the same number. Zero makes rand.Rand.IntN retry forever, small numbers pick 0.
+type constSource uint64
+
+func (s constSource) Uint64() uint64 { return uint64(s) }
+
+// Opens games manager with database in temporary directory.
+func openTestManager(t *testing.T, config Config) *Manager {
+	t.Helper()
+	var m, err = Open(filepath.Join(t.TempDir(), "games.db"), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+// Enters the chatter with provided amount of tickets into the giveaway.
+func addEntry(m *Manager, channel string, userID int64, name string, weight int) {
+	m.mutex.Lock()
+	m.giveaways[channel].Entries[userID] = GiveawayEntry{UserName: name, Weight: weight}
+	m.mutex.Unlock()
+}
+
+func TestGiveawayEntries(t *testing.T) {
+	var server = chattest.NewServer(chattest.Config{})
+	defer server.Close()
+	var client = chat.NewClient(server.ClientConfig("bot", "channel"))
+	var m = openTestManager(t, Config{Bots: []string{"Bot", "Nightbot"}, SubscriberWeight: 3})
+	m.Attach(client)
+	if err := m.StartGiveaway("channel", "!join"); err != nil {
+		t.Fatal(err)
+	}
+	client.Start()
+	defer client.Stop()
+	var ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := server.WaitJoined(ctx, "channel"); err != nil {
+		t.Fatal(err)
+	}
+
+	server.PrivMsg("channel", "Viewer", "!JOIN", nil)
+	server.PrivMsg("channel", "Viewer", "!join", nil)
+	server.PrivMsg("channel", "Subscriber", "!join", chat.Tags{"badges": "subscriber/12", "subscriber": "1"})
+	server.PrivMsg("channel", "Talker", "join", nil)
+	server.PrivMsg("channel", "Channel", "!join", chat.Tags{"badges": "broadcaster/1"})
+	// Bots are excluded by login, even with localized display name
+	server.PrivMsg("channel", "Nightbot", "!join", chat.Tags{"display-name": "ナイトボット"})
+	server.PrivMsg("channel", "Bot", "!join", nil)
+	server.PrivMsg("channel", "Last", "!join", nil)
+
+	// Chat messages are processed in order, the last chatter is entered after all of the others
+	var g Giveaway
+	for {
+		var ok bool
+		if g, ok = m.Giveaway("channel"); ok && len(g.Entries) >= 3 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("chatters weren't entered, entries %+v", g.Entries)
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+	var weights = make(map[string]int)
+	for _, entry := range g.Entries {
+		weights[entry.UserName] = entry.Weight
+	}
+	if len(weights) != 3 || weights["Viewer"] != 1 || weights["Subscriber"] != 3 || weights["Last"] != 1 {
+		t.Errorf("unexpected entries %v", weights)
+	}
+
+	// Closed giveaway doesn't accept entries
+	if err := m.CloseGiveaway("channel"); err != nil {
+		t.Fatal(err)
+	}
+	m.enter("channel", "late", chat.MessageMetadata{UserID: 99, UserName: "Late"}, "!join")
+	if g, _ = m.Giveaway("channel"); len(g.Entries) != 3 {
+		t.Errorf("closed giveaway has %d entries", len(g.Entries))
+	}
+}
+
+func TestDrawGiveawayWeights(t *testing.T) {
+	var tests = []struct {
+		source constSource
+		winner string
+	}{
+		{1 << 32, "A"},        // First ticket
+		{math.MaxUint64, "C"}, // Last ticket
+		{math.MaxUint64 / 2, "B"},
+	}
+	for _, test := range tests {
+		var m = openTestManager(t, Config{Rand: rand.New(test.source)})
+		m.StartGiveaway("channel", "!join")
+		addEntry(m, "channel", 3, "C", 1)
+		addEntry(m, "channel", 1, "A", 1)
+		addEntry(m, "channel", 2, "B", 5)
+
+		var winner, err = m.DrawGiveaway("channel")
+		if err != nil || winner != test.winner {
+			t.Errorf("source %d drew %q, %v, expected %q", test.source, winner, err, test.winner)
+		}
+		// Winner can't win again
+		var g, _ = m.Giveaway("channel")
+		for _, entry := range g.Entries {
+			if entry.UserName == winner {
+				t.Errorf("winner %q is still entered", winner)
+			}
+		}
+		if len(g.Winners) != 1 || g.Winners[0] != winner {
+			t.Errorf("winners %q", g.Winners)
+		}
+	}
+}
+
+func TestGiveawayWinners(t *testing.T) {
+	var m = openTestManager(t, Config{Rand: rand.New(constSource(1 << 32))})
+	m.StartGiveaway("channel", "!join")
+	m.enter("channel", "winner", chat.MessageMetadata{UserID: 1, UserName: "Winner"}, "!join")
+	if winner, err := m.DrawGiveaway("channel"); err != nil || winner != "Winner" {
+		t.Fatalf("drew %q, %v", winner, err)
+	}
+
+	// Winner is recognized by ID even after changing the name, other chatters with the same name can enter
+	m.enter("channel", "renamed", chat.MessageMetadata{UserID: 1, UserName: "Renamed"}, "!join")
+	m.enter("channel", "winner", chat.MessageMetadata{UserID: 2, UserName: "Winner"}, "!join")
+	var g, _ = m.Giveaway("channel")
+	if _, ok := g.Entries[1]; ok || len(g.Entries) != 1 || g.Entries[2].UserName != "Winner" {
+		t.Errorf("unexpected entries %+v", g.Entries)
+	}
+	if len(g.WinnerIDs) != 1 || g.WinnerIDs[0] != 1 {
+		t.Errorf("winner IDs %v", g.WinnerIDs)
+	}
+
+	// Winners are kept when the manager is restarted
+	var path = filepath.Join(t.TempDir(), "games.db")
+	var first, err = Open(path, Config{Rand: rand.New(constSource(1 << 32))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.StartGiveaway("channel", "!join")
+	first.enter("channel", "winner", chat.MessageMetadata{UserID: 1, UserName: "Winner"}, "!join")
+	first.DrawGiveaway("channel")
+	first.Close()
+	second, err := Open(path, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	second.enter("channel", "winner", chat.MessageMetadata{UserID: 1, UserName: "Winner"}, "!join")
+	if g, _ = second.Giveaway("channel"); len(g.Entries) != 0 {
+		t.Errorf("winner entered again after restart, entries %+v", g.Entries)
+	}
+}
+
+func TestDrawGiveawayDistribution(t *testing.T) {
+	var m = openTestManager(t, Config{Rand: rand.New(rand.NewPCG(1, 2))})
+	m.StartGiveaway("channel", "!join")
+
+	// Subscriber with 2 tickets wins twice as often as a regular chatter
+	const draws = 3000
+	var wins = make(map[string]int)
+	for i := 0; i < draws; i++ {
+		addEntry(m, "channel", 1, "Viewer", 1)
+		addEntry(m, "channel", 2, "Subscriber", 2)
+		var winner, err = m.DrawGiveaway("channel")
+		if err != nil {
+			t.Fatal(err)
+		}
+		wins[winner]++
+		m.mutex.Lock()
+		clear(m.giveaways["channel"].Entries)
+		m.mutex.Unlock()
+	}
+	if ratio := float64(wins["Subscriber"]) / draws; ratio < 0.62 || ratio > 0.71 {
+		t.Errorf("subscriber won %.1f%% of draws, expected 66.7%%", ratio*100)
+	}
+
+	if _, err := m.DrawGiveaway("channel"); err == nil {
+		t.Error("draw without entries didn't fail")
+	}
+	if _, err := m.DrawGiveaway("other"); err != ErrNoGame {
+		t.Errorf("draw without giveaway returned %v", err)
+	}
+}
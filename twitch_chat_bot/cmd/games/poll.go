@@ -0,0 +1,252 @@
+package games
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"twitch_chat_bot/cmd/chat"
+)
+
+const pollMinOptions = 2                // Minimum amount of poll options
+const pollMaxOptions = 10               // Maximum amount of poll options
+const pollDefaultDuration = time.Minute // Poll duration used when the command doesn't specify it
+const pollMaxDuration = time.Hour       // Maximum poll duration
+const pollOptionsSeparator = "|"        // Separates poll question and options in the command
+
+// Chat poll.
+type Poll struct {
+	Question string        `json:"question"` // Poll question
+	Options  []string      `json:"options"`  // Poll options
+	Votes    map[int64]int `json:"votes"`    // Index of voted option, key is chatter ID
+	Started  time.Time     `json:"started"`  // Time when the poll started
+	Ends     time.Time     `json:"ends"`     // Time when voting ends
+}
+
+// Poll option result.
+type PollResult struct {
+	Option string // Poll option
+	Votes  int    // Amount of votes
+}
+
+// Returns votes of every option, in the order of the options.
+func (p *Poll) Results() []PollResult {
+	var results = make([]PollResult, len(p.Options))
+	for i, option := range p.Options {
+		results[i].Option = option
+	}
+	for _, option := range p.Votes {
+		if option >= 0 && option < len(results) {
+			results[option].Votes++
+		}
+	}
+	return results
+}
+
+// Returns index of the option chosen by the chat message: option number or option text. Returns -1 if the message isn't a vote.
+func (p *Poll) option(text string) int {
+	if n, err := strconv.Atoi(text); err == nil {
+		if n >= 1 && n <= len(p.Options) {
+			return n - 1
+		}
+		return -1
+	}
+	for i, option := range p.Options {
+		if strings.EqualFold(option, text) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Formats poll options with their numbers.
+func (p *Poll) formatOptions() string {
+	var options = make([]string, len(p.Options))
+	for i, option := range p.Options {
+		options[i] = fmt.Sprintf("%d) %s", i+1, option)
+	}
+	return strings.Join(options, " ")
+}
+
+// Formats poll results with vote percentages and the winning options.
+func (p *Poll) formatResults() string {
+	var results = p.Results()
+	var total, best = 0, 0
+	for _, r := range results {
+		total += r.Votes
+		best = max(best, r.Votes)
+	}
+	var parts = make([]string, len(results))
+	var winners []string
+	for i, r := range results {
+		var percent = 0
+		if total > 0 {
+			percent = r.Votes * 100 / total
+		}
+		parts[i] = fmt.Sprintf("%s: %d (%d%%)", r.Option, r.Votes, percent)
+		if best > 0 && r.Votes == best {
+			winners = append(winners, r.Option)
+		}
+	}
+	var msg = fmt.Sprintf("%s %s.", p.Question, strings.Join(parts, ", "))
+	switch len(winners) {
+	case 0:
+		msg += " Nobody voted."
+	case 1:
+		msg += fmt.Sprintf(" Winner: %s!", winners[0])
+	default:
+		msg += fmt.Sprintf(" Tie: %s!", strings.Join(winners, ", "))
+	}
+	return msg
+}
+
+// Starts new poll in the channel. Chatters vote by typing option number or option text in chat.
+// Results are announced in chat when the poll ends.
+func (m *Manager) StartPoll(channel, question string, options []string, duration time.Duration) error {
+	if len(options) < pollMinOptions || len(options) > pollMaxOptions {
+		return fmt.Errorf("poll needs %d to %d options", pollMinOptions, pollMaxOptions)
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.polls[channel]; ok {
+		return ErrGameRunning
+	}
+	var now = m.config.Clock()
+	var p = &Poll{
+		Question: question,
+		Options:  options,
+		Votes:    make(map[int64]int),
+		Started:  now,
+		Ends:     now.Add(duration),
+	}
+	m.polls[channel] = p
+	m.save(channel, gamePoll, p)
+	m.schedule(channel, gamePoll, p.Ends, func() { m.EndPoll(channel) })
+	m.announce(channel, fmt.Sprintf("Poll: %s Vote by typing the number or the option in chat: %s Voting ends in %s.",
+		question, p.formatOptions(), duration))
+	return nil
+}
+
+// Ends the poll in the channel and announces the results.
+func (m *Manager) EndPoll(channel string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var p, ok = m.polls[channel]
+	if !ok {
+		return ErrNoGame
+	}
+	delete(m.polls, channel)
+	m.unschedule(channel, gamePoll)
+	m.save(channel, gamePoll, nil)
+	m.announce(channel, "Poll ended! "+p.formatResults())
+	return nil
+}
+
+// Cancels the poll in the channel without announcing the results.
+func (m *Manager) CancelPoll(channel string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.polls[channel]; !ok {
+		return ErrNoGame
+	}
+	delete(m.polls, channel)
+	m.unschedule(channel, gamePoll)
+	m.save(channel, gamePoll, nil)
+	m.announce(channel, "Poll canceled.")
+	return nil
+}
+
+// Returns copy of the running poll in the channel.
+func (m *Manager) Poll(channel string) (Poll, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var p, ok = m.polls[channel]
+	if !ok {
+		return Poll{}, false
+	}
+	var poll = *p
+	poll.Votes = make(map[int64]int, len(p.Votes))
+	for id, option := range p.Votes {
+		poll.Votes[id] = option
+	}
+	return poll, true
+}
+
+// Counts chat message as a vote in running poll. Chatters can change their vote, the last one counts.
+func (m *Manager) vote(channel string, userID int64, text string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var p, ok = m.polls[channel]
+	if !ok || !m.config.Clock().Before(p.Ends) {
+		return
+	}
+	var option = p.option(text)
+	if option < 0 {
+		return
+	}
+	if previous, ok := p.Votes[userID]; ok && previous == option {
+		return
+	}
+	p.Votes[userID] = option
+	m.save(channel, gamePoll, p)
+}
+
+// !poll [duration] <question> | <option> | <option>... - starts new poll (moderators).
+// !poll end / !poll cancel - ends the poll early with / without results (moderators).
+// !poll - shows the running poll.
+func (m *Manager) pollCommand(ctx *chat.CommandContext) {
+	var channel = ctx.Metadata.Channel
+	if len(ctx.Args) == 0 {
+		var p, ok = m.Poll(channel)
+		if !ok {
+			ctx.Reply("There is no poll running.")
+			return
+		}
+		var left = p.Ends.Sub(m.config.Clock()).Round(time.Second)
+		ctx.Reply(fmt.Sprintf("Poll: %s %s Votes: %d, ends in %s.", p.Question, p.formatOptions(), len(p.Votes), max(left, 0)))
+		return
+	}
+	if !isModerator(ctx) {
+		return
+	}
+
+	var err error
+	switch strings.ToLower(ctx.Args[0]) {
+	case "end", "stop":
+		err = m.EndPoll(channel)
+	case "cancel":
+		err = m.CancelPoll(channel)
+	default:
+		var args = ctx.Args
+		var duration = pollDefaultDuration
+		if d, ok := parseDuration(args[0]); ok {
+			duration = min(d, pollMaxDuration)
+			args = args[1:]
+		}
+		var parts = strings.Split(strings.Join(args, " "), pollOptionsSeparator)
+		var question = strings.TrimSpace(parts[0])
+		var options []string
+		for _, option := range parts[1:] {
+			if option = strings.TrimSpace(option); len(option) > 0 {
+				options = append(options, option)
+			}
+		}
+		if len(question) == 0 {
+			ctx.Reply("Usage: !poll [duration] <question> | <option> | <option>...")
+			return
+		}
+		err = m.StartPoll(channel, question, options, duration)
+	}
+	if err != nil {
+		ctx.Reply(fmt.Sprintf("Poll error: %s.", err))
+	}
+}
+
+// Parses duration in seconds ("90") or Go duration format ("1m30s"). Returns false if the value isn't positive duration.
+func parseDuration(s string) (time.Duration, bool) {
+	if seconds, err := strconv.Atoi(s); err == nil {
+		return time.Duration(seconds) * time.Second, seconds > 0
+	}
+	var d, err = time.ParseDuration(s)
+	return d, err == nil && d > 0
+}
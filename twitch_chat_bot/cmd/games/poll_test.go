@@ -0,0 +1,112 @@
+package games
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPollVotes(t *testing.T) {
+	var now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var m = openTestManager(t, Config{Clock: func() time.Time { return now }})
+	if err := m.StartPoll("channel", "Best pet?", []string{"Cat", "Dog", "Fish"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.StartPoll("channel", "Again?", []string{"Yes", "No"}, time.Minute); err != ErrGameRunning {
+		t.Errorf("second poll returned %v", err)
+	}
+
+	m.vote("channel", 1, "1")
+	m.vote("channel", 2, "dog")
+	m.vote("channel", 3, "FISH")
+	m.vote("channel", 4, "4")     // Not an option
+	m.vote("channel", 5, "a dog") // Not an option
+	m.vote("channel", 3, "2")     // Changed vote
+	m.vote("other", 6, "1")       // No poll in the channel
+	var p, _ = m.Poll("channel")
+	if len(p.Votes) != 3 || p.Votes[1] != 0 || p.Votes[2] != 1 || p.Votes[3] != 1 {
+		t.Errorf("unexpected votes %v", p.Votes)
+	}
+	var results = p.Results()
+	if len(results) != 3 || results[0] != (PollResult{"Cat", 1}) || results[1] != (PollResult{"Dog", 2}) || results[2] != (PollResult{"Fish", 0}) {
+		t.Errorf("unexpected results %+v", results)
+	}
+	if msg := p.formatResults(); msg != "Best pet? Cat: 1 (33%), Dog: 2 (66%), Fish: 0 (0%). Winner: Dog!" {
+		t.Errorf("results %q", msg)
+	}
+
+	// Votes after the end time don't count
+	now = now.Add(time.Minute)
+	m.vote("channel", 7, "3")
+	if p, _ = m.Poll("channel"); len(p.Votes) != 3 {
+		t.Errorf("vote after the end counted, votes %v", p.Votes)
+	}
+	if err := m.EndPoll("channel"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Poll("channel"); ok {
+		t.Error("poll is running after it ended")
+	}
+	if err := m.EndPoll("channel"); err != ErrNoGame {
+		t.Errorf("ending ended poll returned %v", err)
+	}
+}
+
+func TestPollResults(t *testing.T) {
+	var tests = []struct {
+		votes map[int64]int
+		msg   string
+	}{
+		{map[int64]int{}, "Question? A: 0 (0%), B: 0 (0%). Nobody voted."},
+		{map[int64]int{1: 0, 2: 1}, "Question? A: 1 (50%), B: 1 (50%). Tie: A, B!"},
+		{map[int64]int{1: 1, 2: 5}, "Question? A: 0 (0%), B: 1 (100%). Winner: B!"},
+	}
+	for _, test := range tests {
+		var p = Poll{Question: "Question?", Options: []string{"A", "B"}, Votes: test.votes}
+		if msg := p.formatResults(); msg != test.msg {
+			t.Errorf("votes %v formatted %q, expected %q", test.votes, msg, test.msg)
+		}
+	}
+}
+
+func TestPollEnds(t *testing.T) {
+	var m = openTestManager(t, Config{})
+	if err := m.StartPoll("channel", "Question?", []string{"A"}, time.Minute); err == nil {
+		t.Error("poll with one option started")
+	}
+	if err := m.StartPoll("channel", "Question?", []string{"A", "B"}, time.Millisecond*20); err != nil {
+		t.Fatal(err)
+	}
+	var timeout = time.After(time.Second * 5)
+	for {
+		if _, ok := m.Poll("channel"); !ok {
+			break
+		}
+		select {
+		case <-timeout:
+			t.Fatal("poll didn't end")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	var tests = []struct {
+		s        string
+		duration time.Duration
+		ok       bool
+	}{
+		{"90", time.Second * 90, true},
+		{"1m30s", time.Second * 90, true},
+		{"2h", time.Hour * 2, true},
+		{"0", 0, false},
+		{"-5", 0, false},
+		{"-1m", 0, false},
+		{"Question?", 0, false},
+		{"", 0, false},
+	}
+	for _, test := range tests {
+		if d, ok := parseDuration(test.s); ok != test.ok || (ok && d != test.duration) {
+			t.Errorf("%q parsed as %s, %v, expected %s, %v", test.s, d, ok, test.duration, test.ok)
+		}
+	}
+}
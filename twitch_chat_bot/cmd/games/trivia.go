@@ -0,0 +1,220 @@
+package games
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"twitch_chat_bot/cmd/chat"
+	"unicode"
+)
+
+// Trivia question.
+type Question struct {
+	Question string   `json:"question"` // Question text
+	Answers  []string `json:"answers"`  // Accepted answers, the first one is announced when nobody answers
+}
+
+// Trivia question asked in chat.
+type Trivia struct {
+	Question Question  `json:"question"` // Asked question
+	Ends     time.Time `json:"ends"`     // Time when answering ends
+}
+
+// Trivia score of a chatter.
+type TriviaScore struct {
+	UserID   int64  // Chatter ID
+	UserName string // Name of the chatter
+	Score    int    // Amount of correctly answered questions
+}
+
+// Returns true if the chat message is correct answer to the question.
+func (q *Question) correct(text string) bool {
+	var answer = normalizeAnswer(text)
+	for _, a := range q.Answers {
+		if normalizeAnswer(a) == answer {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalizes trivia answer: lower case, without punctuation and repeated spaces.
+func normalizeAnswer(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsPunct(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Asks random trivia question in the channel. The first chatter that types correct answer in chat gets a point.
+func (m *Manager) AskTrivia(channel string) error {
+	if len(m.config.Questions) == 0 {
+		return fmt.Errorf("no trivia questions configured")
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.trivia[channel]; ok {
+		return ErrGameRunning
+	}
+	var t = &Trivia{
+		Question: m.config.Questions[m.randN(len(m.config.Questions))],
+		Ends:     m.config.Clock().Add(m.config.TriviaTimeout),
+	}
+	m.trivia[channel] = t
+	m.save(channel, gameTrivia, t)
+	m.schedule(channel, gameTrivia, t.Ends, func() { m.expireTrivia(channel) })
+	m.announce(channel, fmt.Sprintf("Trivia: %s You have %s to answer!", t.Question.Question, m.config.TriviaTimeout))
+	return nil
+}
+
+// Ends the trivia question in the channel and announces the answer.
+func (m *Manager) StopTrivia(channel string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var t, ok = m.trivia[channel]
+	if !ok {
+		return ErrNoGame
+	}
+	m.endTrivia(channel)
+	m.announce(channel, fmt.Sprintf("Trivia stopped. The answer was: %s.", t.Question.Answers[0]))
+	return nil
+}
+
+// Ends the trivia question in the channel when nobody answered in time.
+func (m *Manager) expireTrivia(channel string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var t, ok = m.trivia[channel]
+	if !ok {
+		return
+	}
+	m.endTrivia(channel)
+	m.announce(channel, fmt.Sprintf("Nobody answered the trivia in time. The answer was: %s.", t.Question.Answers[0]))
+}
+
+// Removes the trivia question in the channel. Should be called with locked mutex.
+func (m *Manager) endTrivia(channel string) {
+	delete(m.trivia, channel)
+	m.unschedule(channel, gameTrivia)
+	m.save(channel, gameTrivia, nil)
+}
+
+// Checks if the chat message is correct answer to trivia question in the channel.
+func (m *Manager) answer(channel string, userID int64, userName, text string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var t, ok = m.trivia[channel]
+	if !ok || !m.config.Clock().Before(t.Ends) || !t.Question.correct(text) {
+		return
+	}
+	m.endTrivia(channel)
+
+	var score, err = m.addTriviaScore(channel, userID, userName)
+	if err != nil {
+		slog.Error("Games error, when updating trivia score.", "Channel", channel, "UserID", userID, "Err", err)
+	}
+	m.announce(channel, fmt.Sprintf("@%s answered correctly: %s! Score: %d.", userName, t.Question.Answers[0], score))
+}
+
+// Adds a point to the chatter, returns new score.
+func (m *Manager) addTriviaScore(channel string, userID int64, userName string) (int, error) {
+	var row = m.db.QueryRow(`
+INSERT INTO trivia_scores (channel, user_id, user_name, score) VALUES (?, ?, ?, 1)
+ON CONFLICT (channel, user_id) DO UPDATE SET user_name = excluded.user_name, score = score + 1
+RETURNING score;`, channel, userID, userName)
+	var score int
+	var err = row.Scan(&score)
+	return score, err
+}
+
+// Returns trivia score of the chatter.
+func (m *Manager) TriviaScore(channel string, userID int64) (int, error) {
+	var score int
+	var err = m.db.QueryRow("SELECT score FROM trivia_scores WHERE channel = ? AND user_id = ?;", channel, userID).Scan(&score)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return score, err
+}
+
+// Returns chatters with the highest trivia scores.
+func (m *Manager) TriviaLeaderboard(channel string, limit int) ([]TriviaScore, error) {
+	var rows, err = m.db.Query(`
+SELECT user_id, user_name, score FROM trivia_scores WHERE channel = ?
+ORDER BY score DESC, user_name LIMIT ?;`, channel, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var scores []TriviaScore
+	for rows.Next() {
+		var s TriviaScore
+		if err = rows.Scan(&s.UserID, &s.UserName, &s.Score); err != nil {
+			return nil, err
+		}
+		scores = append(scores, s)
+	}
+	return scores, rows.Err()
+}
+
+// !trivia - asks random trivia question (moderators).
+// !trivia stop - ends the question and shows the answer (moderators).
+// !trivia score - shows trivia score of the chatter.
+// !trivia top - shows chatters with the highest trivia scores.
+func (m *Manager) triviaCommand(ctx *chat.CommandContext) {
+	var channel = ctx.Metadata.Channel
+	var subcommand = ""
+	if len(ctx.Args) > 0 {
+		subcommand = strings.ToLower(ctx.Args[0])
+	}
+
+	switch subcommand {
+	case "score":
+		var score, err = m.TriviaScore(channel, ctx.Metadata.UserID)
+		if err != nil {
+			slog.Error("Games error, when reading trivia score.", "Channel", channel, "Err", err)
+			return
+		}
+		ctx.Reply(fmt.Sprintf("Your trivia score: %d.", score))
+		return
+	case "top":
+		var scores, err = m.TriviaLeaderboard(channel, triviaLeaderboardSize)
+		if err != nil {
+			slog.Error("Games error, when reading trivia leaderboard.", "Channel", channel, "Err", err)
+			return
+		}
+		if len(scores) == 0 {
+			ctx.Reply("Nobody answered trivia questions yet.")
+			return
+		}
+		var parts = make([]string, len(scores))
+		for i, s := range scores {
+			parts[i] = fmt.Sprintf("%d. %s (%d)", i+1, s.UserName, s.Score)
+		}
+		ctx.Reply("Trivia leaderboard: " + strings.Join(parts, ", "))
+		return
+	}
+	if !isModerator(ctx) {
+		return
+	}
+
+	var err error
+	switch subcommand {
+	case "":
+		err = m.AskTrivia(channel)
+	case "stop", "end":
+		err = m.StopTrivia(channel)
+	default:
+		ctx.Reply("Usage: !trivia [stop|score|top]")
+		return
+	}
+	if err != nil {
+		ctx.Reply(fmt.Sprintf("Trivia error: %s.", err))
+	}
+}
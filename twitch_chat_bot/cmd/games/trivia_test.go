@@ -0,0 +1,120 @@
+package games
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeAnswer(t *testing.T) {
+	var tests = []struct {
+		s, answer string
+	}{
+		{"Paris", "paris"},
+		{"  PARIS!!! ", "paris"},
+		{"New   York.", "new york"},
+		{"it's 8", "its 8"},
+		{"Ärger", "ärger"},
+		{"?!.", ""},
+	}
+	for _, test := range tests {
+		if answer := normalizeAnswer(test.s); answer != test.answer {
+			t.Errorf("%q normalized to %q, expected %q", test.s, answer, test.answer)
+		}
+	}
+}
+
+func TestTriviaAnswers(t *testing.T) {
+	var now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var m = openTestManager(t, Config{
+		Questions: []Question{{Question: "How many legs does a spider have?", Answers: []string{"8", "Eight"}}},
+		Clock:     func() time.Time { return now },
+	})
+	if err := m.AskTrivia("channel"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AskTrivia("channel"); err != ErrGameRunning {
+		t.Errorf("second question returned %v", err)
+	}
+
+	// The first correct answer wins, the question ends
+	m.answer("channel", 1, "Wrong", "six")
+	m.answer("channel", 2, "First", "eight!")
+	m.answer("channel", 3, "Second", "8")
+	for userID, expected := range map[int64]int{1: 0, 2: 1, 3: 0} {
+		if score, err := m.TriviaScore("channel", userID); err != nil || score != expected {
+			t.Errorf("score of %d is %d, %v, expected %d", userID, score, err, expected)
+		}
+	}
+	if err := m.StopTrivia("channel"); err != ErrNoGame {
+		t.Errorf("stopping answered question returned %v", err)
+	}
+
+	// Answers after the time runs out don't count
+	if err := m.AskTrivia("channel"); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(defaultTriviaTimeout)
+	m.answer("channel", 3, "Second", "8")
+	if score, _ := m.TriviaScore("channel", 3); score != 0 {
+		t.Errorf("late answer scored %d", score)
+	}
+	if err := m.StopTrivia("channel"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTriviaExpires(t *testing.T) {
+	var m = openTestManager(t, Config{
+		Questions:     []Question{{Question: "What is the capital of France?", Answers: []string{"Paris"}}},
+		TriviaTimeout: time.Millisecond * 20,
+	})
+	if err := m.AskTrivia("channel"); err != nil {
+		t.Fatal(err)
+	}
+	var timeout = time.After(time.Second * 5)
+	for {
+		m.mutex.Lock()
+		var _, ok = m.trivia["channel"]
+		m.mutex.Unlock()
+		if !ok {
+			break
+		}
+		select {
+		case <-timeout:
+			t.Fatal("trivia question didn't expire")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+	if err := m.AskTrivia("channel"); err != nil {
+		t.Errorf("asking after the question expired returned %v", err)
+	}
+
+	var empty = openTestManager(t, Config{Questions: []Question{{Question: "No answers?"}}})
+	if err := empty.AskTrivia("channel"); err == nil {
+		t.Error("trivia without valid questions started")
+	}
+}
+
+func TestTriviaLeaderboard(t *testing.T) {
+	var m = openTestManager(t, Config{})
+	for _, s := range []TriviaScore{{1, "Abev", 0}, {2, "Viewer", 0}, {1, "Abev", 0}, {3, "Bob", 0}, {2, "Viewer", 0}, {1, "Renamed", 0}} {
+		if _, err := m.addTriviaScore("channel", s.UserID, s.UserName); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if score, err := m.addTriviaScore("other", 1, "Abev"); err != nil || score != 1 {
+		t.Errorf("score in other channel %d, %v", score, err)
+	}
+
+	// Scores are ordered by score and name, the last name of the chatter is kept
+	var scores, err = m.TriviaLeaderboard("channel", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scores) != 2 || scores[0] != (TriviaScore{1, "Renamed", 3}) || scores[1] != (TriviaScore{2, "Viewer", 2}) {
+		t.Errorf("unexpected leaderboard %+v", scores)
+	}
+	if scores, err = m.TriviaLeaderboard("empty", 5); err != nil || len(scores) != 0 {
+		t.Errorf("empty leaderboard %+v, %v", scores, err)
+	}
+}
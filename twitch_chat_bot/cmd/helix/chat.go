@@ -0,0 +1,52 @@
+package helix
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Chat endpoints (announcements, shoutouts, whispers).
+
+// Announcement colors.
+const (
+	AnnouncementPrimary = "primary"
+	AnnouncementBlue    = "blue"
+	AnnouncementGreen   = "green"
+	AnnouncementOrange  = "orange"
+	AnnouncementPurple  = "purple"
+)
+
+// Sends announcement to broadcaster's chat. Empty color means primary color.
+// Requires moderator:manage:announcements scope.
+func (c *Client) SendAnnouncement(ctx context.Context, broadcasterID, moderatorID, message, color string) error {
+	var body = struct {
+		Message string `json:"message"`
+		Color   string `json:"color,omitempty"`
+	}{message, color}
+	return c.do(ctx, http.MethodPost, "/chat/announcements", url.Values{
+		"broadcaster_id": {broadcasterID},
+		"moderator_id":   {moderatorID},
+	}, body, nil)
+}
+
+// Sends shoutout from one broadcaster to another. Requires moderator:manage:shoutouts scope.
+func (c *Client) SendShoutout(ctx context.Context, fromBroadcasterID, toBroadcasterID, moderatorID string) error {
+	return c.do(ctx, http.MethodPost, "/chat/shoutouts", url.Values{
+		"from_broadcaster_id": {fromBroadcasterID},
+		"to_broadcaster_id":   {toBroadcasterID},
+		"moderator_id":        {moderatorID},
+	}, nil, nil)
+}
+
+// Sends whisper message. From user ID has to match the user that owns the access token.
+// Requires user:manage:whispers scope.
+func (c *Client) SendWhisper(ctx context.Context, fromUserID, toUserID, message string) error {
+	var body = struct {
+		Message string `json:"message"`
+	}{message}
+	return c.do(ctx, http.MethodPost, "/whispers", url.Values{
+		"from_user_id": {fromUserID},
+		"to_user_id":   {toUserID},
+	}, body, nil)
+}
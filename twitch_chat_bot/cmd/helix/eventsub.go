@@ -0,0 +1,45 @@
+package helix
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// EventSub subscriptions endpoints.
+
+// EventSub subscription request.
+type EventSubRequest struct {
+	Type      string            `json:"type"`
+	Version   string            `json:"version"`
+	Condition map[string]string `json:"condition"`
+	Transport EventSubTransport `json:"transport"`
+}
+
+// Transport used to deliver EventSub notifications.
+type EventSubTransport struct {
+	Method    string `json:"method"`               // "websocket" or "webhook"
+	SessionID string `json:"session_id,omitempty"` // ID of WebSocket session
+}
+
+// EventSub subscription.
+type EventSubSubscription struct {
+	ID        string            `json:"id"`
+	Status    string            `json:"status"`
+	Type      string            `json:"type"`
+	Version   string            `json:"version"`
+	Condition map[string]string `json:"condition"`
+	CreatedAt time.Time         `json:"created_at"`
+	Cost      int               `json:"cost"`
+}
+
+// Creates EventSub subscription. Scopes required by the access token depend on subscription type.
+func (c *Client) CreateEventSubSubscription(ctx context.Context, request EventSubRequest) (EventSubSubscription, error) {
+	return doOne[EventSubSubscription](ctx, c, http.MethodPost, "/eventsub/subscriptions", nil, request)
+}
+
+// Deletes EventSub subscription.
+func (c *Client) DeleteEventSubSubscription(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/eventsub/subscriptions", url.Values{"id": {id}}, nil, nil)
+}
@@ -0,0 +1,258 @@
+package helix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Twitch API (Helix) client.
+// Every request is sent with the client ID and access token provided by TokenSource.
+// When the API rejects the token (401), the token is refreshed and the request is sent again.
+// Rate limit headers (Ratelimit-Remaining, Ratelimit-Reset) are tracked, when the limit is exhausted
+// requests wait until the bucket is reset. Requests rejected with 429 are retried after the reset.
+// List endpoints are paginated, the client follows the cursors and returns all of the items.
+
+const DefaultBaseURL = "https://api.twitch.tv/helix" // Twitch API address
+const maxRetries = 3                                 // Maximum amount of retries after 401 and 429 responses
+const maxPageSize = 100                              // Maximum amount of items per page on most endpoints
+
+// Provides access token for the requests.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)   // Returns valid access token
+	Refresh(ctx context.Context) (string, error) // Refreshes the access token after it was rejected
+}
+
+// Static access token that can't be refreshed.
+type StaticToken string
+
+func (t StaticToken) Token(ctx context.Context) (string, error) {
+	return string(t), nil
+}
+
+func (t StaticToken) Refresh(ctx context.Context) (string, error) {
+	return "", errors.New("static token can't be refreshed")
+}
+
+// Twitch API client configuration.
+type Config struct {
+	ClientID   string       // Twitch API bots client ID
+	Token      TokenSource  // Access token provider, like *oauth.TokenSource
+	BaseURL    string       // API address, DefaultBaseURL if empty (can be changed for tests)
+	HTTPClient *http.Client // HTTP client, http.DefaultClient if nil
+}
+
+// Twitch API client.
+type Client struct {
+	config         Config
+	rateLimitMutex sync.Mutex
+	remaining      int       // Remaining requests in current rate limit bucket, -1 if unknown
+	reset          time.Time // Time when rate limit bucket is reset
+}
+
+// Error returned by the Twitch API.
+type Error struct {
+	Status  int    `json:"status"`
+	Name    string `json:"error"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("twitch api error %d %s: %s", e.Status, e.Name, e.Message)
+}
+
+// Response of the Twitch API.
+type response[T any] struct {
+	Data       []T `json:"data"`
+	Total      int `json:"total"`
+	Pagination struct {
+		Cursor string `json:"cursor"`
+	} `json:"pagination"`
+}
+
+// Creates new Twitch API client.
+func NewClient(config Config) *Client {
+	if len(config.BaseURL) == 0 {
+		config.BaseURL = DefaultBaseURL
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	return &Client{config: config, remaining: -1}
+}
+
+// Returns remaining requests in current rate limit bucket (-1 if unknown) and time when it's reset.
+func (c *Client) RateLimit() (remaining int, reset time.Time) {
+	c.rateLimitMutex.Lock()
+	defer c.rateLimitMutex.Unlock()
+	return c.remaining, c.reset
+}
+
+// Sends the request and decodes response into result (if not nil).
+// Body is encoded as JSON. The request is retried after token refresh and after hitting the rate limit.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body any, result any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	var refreshed = false
+	for attempt := 0; ; attempt++ {
+		if err := c.waitForRateLimit(ctx); err != nil {
+			return err
+		}
+
+		var token, err = c.config.Token.Token(ctx)
+		if err != nil {
+			return err
+		}
+		var u = c.config.BaseURL + path
+		if len(query) > 0 {
+			u += "?" + query.Encode()
+		}
+		req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Client-Id", c.config.ClientID)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := c.config.HTTPClient.Do(req)
+		if err != nil {
+			return err
+		}
+		c.updateRateLimit(resp.Header)
+		respData, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			if result == nil || len(respData) == 0 {
+				return nil
+			}
+			return json.Unmarshal(respData, result)
+		}
+
+		var apiErr = &Error{Status: resp.StatusCode}
+		json.Unmarshal(respData, apiErr)
+		if attempt >= maxRetries {
+			return apiErr
+		}
+		switch resp.StatusCode {
+		case http.StatusUnauthorized:
+			if refreshed {
+				return apiErr // Refreshed token was also rejected
+			}
+			slog.Info("Twitch API rejected access token, refreshing it.")
+			if _, err = c.config.Token.Refresh(ctx); err != nil {
+				return errors.Join(apiErr, err)
+			}
+			refreshed = true
+		case http.StatusTooManyRequests:
+			slog.Warn("Twitch API rate limit exceeded, waiting for reset.")
+			c.rateLimitMutex.Lock()
+			c.remaining = 0
+			c.rateLimitMutex.Unlock()
+		default:
+			return apiErr
+		}
+	}
+}
+
+// Waits until the rate limit bucket is reset, if there are no remaining requests.
+func (c *Client) waitForRateLimit(ctx context.Context) error {
+	c.rateLimitMutex.Lock()
+	var wait time.Duration
+	if c.remaining == 0 {
+		wait = time.Until(c.reset)
+		if c.reset.IsZero() {
+			// Reset time unknown, wait a moment for the bucket to refill
+			wait = time.Second
+			c.remaining = -1
+		}
+	}
+	c.rateLimitMutex.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+// Updates rate limit state from response headers.
+func (c *Client) updateRateLimit(header http.Header) {
+	var remaining, err = strconv.Atoi(header.Get("Ratelimit-Remaining"))
+	if err != nil {
+		return
+	}
+	var reset time.Time
+	if r, err := strconv.ParseInt(header.Get("Ratelimit-Reset"), 10, 64); err == nil {
+		reset = time.Unix(r, 0)
+	}
+	c.rateLimitMutex.Lock()
+	c.remaining = remaining
+	c.reset = reset
+	c.rateLimitMutex.Unlock()
+}
+
+// Sends GET request to paginated endpoint and returns items from all of the pages.
+func getAll[T any](ctx context.Context, c *Client, path string, query url.Values, pageSize int) ([]T, error) {
+	var items []T
+	var cursor = ""
+	for {
+		var q = url.Values{}
+		for key, values := range query {
+			q[key] = values
+		}
+		q.Set("first", strconv.Itoa(pageSize))
+		if len(cursor) > 0 {
+			q.Set("after", cursor)
+		}
+
+		var resp response[T]
+		if err := c.do(ctx, http.MethodGet, path, q, nil, &resp); err != nil {
+			return items, err
+		}
+		items = append(items, resp.Data...)
+		cursor = resp.Pagination.Cursor
+		if len(cursor) == 0 || len(resp.Data) == 0 {
+			return items, nil
+		}
+	}
+}
+
+// Sends the request and returns the first item of response data.
+func doOne[T any](ctx context.Context, c *Client, method, path string, query url.Values, body any) (T, error) {
+	var resp response[T]
+	var item T
+	if err := c.do(ctx, method, path, query, body, &resp); err != nil {
+		return item, err
+	}
+	if len(resp.Data) == 0 {
+		return item, errors.New("twitch api returned empty response")
+	}
+	return resp.Data[0], nil
+}
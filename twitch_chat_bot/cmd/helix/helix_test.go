@@ -0,0 +1,217 @@
+package helix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Token source that issues "token-N" after every refresh.
+type fakeTokens struct {
+	mutex     sync.Mutex
+	refreshes int
+	err       error // Error returned by Refresh
+}
+
+func (f *fakeTokens) Token(ctx context.Context) (string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return fmt.Sprintf("token-%d", f.refreshes), nil
+}
+
+func (f *fakeTokens) Refresh(ctx context.Context) (string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.err != nil {
+		return "", f.err
+	}
+	f.refreshes++
+	return fmt.Sprintf("token-%d", f.refreshes), nil
+}
+
+// Starts Twitch API stand-in and returns client connected to it.
+func newTestClient(t *testing.T, tokens TokenSource, handler http.HandlerFunc) *Client {
+	t.Helper()
+	var server = httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return NewClient(Config{ClientID: "client", Token: tokens, BaseURL: server.URL})
+}
+
+func TestClientHeaders(t *testing.T) {
+	var c = newTestClient(t, StaticToken("token"), func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Client-Id") != "client" || r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, `{"status":401,"error":"Unauthorized","message":"missing headers"}`, http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/users" || r.URL.Query().Get("login") != "bot" {
+			http.Error(w, `{"status":404,"error":"Not Found","message":"unexpected request"}`, http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"data":[{"id":"42","login":"bot","display_name":"Bot"}]}`)
+	})
+	var user, err = c.GetUserByLogin(context.Background(), "bot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != "42" || user.DisplayName != "Bot" {
+		t.Errorf("unexpected user %+v", user)
+	}
+}
+
+func TestClientRefreshesRejectedToken(t *testing.T) {
+	var tokens = &fakeTokens{}
+	var requests []string
+	var c = newTestClient(t, tokens, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Header.Get("Authorization"))
+		if r.Header.Get("Authorization") != "Bearer token-1" {
+			http.Error(w, `{"status":401,"error":"Unauthorized","message":"Invalid OAuth token"}`, http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"data":[{"id":"42","login":"bot"}]}`)
+	})
+
+	var users, err = c.GetUsers(context.Background(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || tokens.refreshes != 1 {
+		t.Errorf("users %+v after %d refreshes", users, tokens.refreshes)
+	}
+	if len(requests) != 2 || requests[0] != "Bearer token-0" || requests[1] != "Bearer token-1" {
+		t.Errorf("requests sent with tokens %q", requests)
+	}
+}
+
+func TestClientRejectedRefreshedToken(t *testing.T) {
+	var tokens = &fakeTokens{}
+	var requests = 0
+	var c = newTestClient(t, tokens, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, `{"status":401,"error":"Unauthorized","message":"Invalid OAuth token"}`, http.StatusUnauthorized)
+	})
+
+	// Token is refreshed only once
+	var _, err = c.GetUsers(context.Background(), nil, nil)
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized || apiErr.Message != "Invalid OAuth token" {
+		t.Errorf("error %v, expected API error 401", err)
+	}
+	if tokens.refreshes != 1 || requests != 2 {
+		t.Errorf("%d refreshes and %d requests, expected 1 and 2", tokens.refreshes, requests)
+	}
+
+	// Failed refresh is returned together with the API error
+	var refreshErr = errors.New("refresh failed")
+	tokens.err = refreshErr
+	_, err = c.GetUsers(context.Background(), nil, nil)
+	if !errors.Is(err, refreshErr) || !errors.As(err, &apiErr) {
+		t.Errorf("error %v, expected API error and refresh error", err)
+	}
+
+	// Static token can't be refreshed
+	c = newTestClient(t, StaticToken("token"), func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"status":401,"error":"Unauthorized","message":"Invalid OAuth token"}`, http.StatusUnauthorized)
+	})
+	if _, err = c.GetUsers(context.Background(), nil, nil); err == nil {
+		t.Error("request with rejected static token didn't fail")
+	}
+}
+
+func TestClientRateLimit(t *testing.T) {
+	var requests = 0
+	var c = newTestClient(t, StaticToken("token"), func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var reset = time.Now().Add(time.Second)
+		if requests == 1 {
+			// Rate limit exceeded, bucket is reset in the past so the test doesn't wait
+			reset = time.Now().Add(-time.Second)
+			w.Header().Set("Ratelimit-Remaining", "0")
+			w.Header().Set("Ratelimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+			http.Error(w, `{"status":429,"error":"Too Many Requests","message":""}`, http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Ratelimit-Remaining", "799")
+		w.Header().Set("Ratelimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		fmt.Fprint(w, `{"data":[{"id":"42"}]}`)
+	})
+
+	var users, err = c.GetUsers(context.Background(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || requests != 2 {
+		t.Errorf("users %+v after %d requests, expected retry after 429", users, requests)
+	}
+	if remaining, reset := c.RateLimit(); remaining != 799 || reset.IsZero() {
+		t.Errorf("rate limit %d, reset %s", remaining, reset)
+	}
+}
+
+func TestClientRateLimitExhausted(t *testing.T) {
+	var requests = 0
+	var c = newTestClient(t, StaticToken("token"), func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Ratelimit-Remaining", "0")
+		w.Header().Set("Ratelimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+		http.Error(w, `{"status":429,"error":"Too Many Requests","message":""}`, http.StatusTooManyRequests)
+	})
+
+	// Requests wait for the reset of exhausted bucket, until the context is canceled
+	var ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	var _, err = c.GetUsers(ctx, nil, nil)
+	if !errors.Is(err, context.DeadlineExceeded) || requests != 1 {
+		t.Errorf("error %v after %d requests, expected waiting for the reset", err, requests)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	var c = newTestClient(t, StaticToken("token"), func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"status":400,"error":"Bad Request","message":"Missing required parameter \"broadcaster_id\""}`, http.StatusBadRequest)
+	})
+	var _, err = c.GetUsers(context.Background(), nil, nil)
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadRequest || apiErr.Name != "Bad Request" {
+		t.Errorf("error %v, expected API error 400", err)
+	}
+
+	c = newTestClient(t, StaticToken("token"), func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":[]}`)
+	})
+	if _, err = c.GetUserByLogin(context.Background(), "missing"); err == nil {
+		t.Error("missing user didn't return an error")
+	}
+}
+
+func TestClientPagination(t *testing.T) {
+	var pages = map[string]string{
+		"":   `{"data":[{"user_id":"1"},{"user_id":"2"}],"pagination":{"cursor":"c1"}}`,
+		"c1": `{"data":[{"user_id":"3"}],"pagination":{"cursor":"c2"}}`,
+		"c2": `{"data":[{"user_id":"4"}],"pagination":{}}`,
+	}
+	var c = newTestClient(t, StaticToken("token"), func(w http.ResponseWriter, r *http.Request) {
+		var query = r.URL.Query()
+		if query.Get("broadcaster_id") != "1" || query.Get("moderator_id") != "2" || query.Get("first") != "1000" {
+			http.Error(w, `{"status":400,"error":"Bad Request","message":"invalid query"}`, http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, pages[query.Get("after")])
+	})
+	var chatters, err = c.GetChatters(context.Background(), "1", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, chatter := range chatters {
+		ids = append(ids, chatter.UserID)
+	}
+	if fmt.Sprint(ids) != "[1 2 3 4]" {
+		t.Errorf("chatters %v, expected all of the pages", ids)
+	}
+}
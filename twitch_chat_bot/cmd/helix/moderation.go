@@ -0,0 +1,47 @@
+package helix
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Moderation endpoints. Moderator ID has to match the user that owns the access token.
+
+// Bans the user, or times out the user if duration is not 0. Requires moderator:manage:banned_users scope.
+func (c *Client) BanUser(ctx context.Context, broadcasterID, moderatorID, userID string, duration time.Duration, reason string) error {
+	type ban struct {
+		UserID   string `json:"user_id"`
+		Duration int    `json:"duration,omitempty"`
+		Reason   string `json:"reason,omitempty"`
+	}
+	var body = struct {
+		Data ban `json:"data"`
+	}{ban{UserID: userID, Duration: int(duration.Seconds()), Reason: reason}}
+	if duration > 0 && body.Data.Duration == 0 {
+		body.Data.Duration = 1 // Shortest timeout is 1 second
+	}
+	return c.do(ctx, http.MethodPost, "/moderation/bans", url.Values{
+		"broadcaster_id": {broadcasterID},
+		"moderator_id":   {moderatorID},
+	}, body, nil)
+}
+
+// Removes ban or timeout of the user. Requires moderator:manage:banned_users scope.
+func (c *Client) UnbanUser(ctx context.Context, broadcasterID, moderatorID, userID string) error {
+	return c.do(ctx, http.MethodDelete, "/moderation/bans", url.Values{
+		"broadcaster_id": {broadcasterID},
+		"moderator_id":   {moderatorID},
+		"user_id":        {userID},
+	}, nil, nil)
+}
+
+// Deletes the chat message. Requires moderator:manage:chat_messages scope.
+func (c *Client) DeleteChatMessage(ctx context.Context, broadcasterID, moderatorID, messageID string) error {
+	return c.do(ctx, http.MethodDelete, "/moderation/chat", url.Values{
+		"broadcaster_id": {broadcasterID},
+		"moderator_id":   {moderatorID},
+		"message_id":     {messageID},
+	}, nil, nil)
+}
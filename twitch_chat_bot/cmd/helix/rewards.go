@@ -0,0 +1,108 @@
+package helix
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Channel points custom rewards and redemptions endpoints.
+// Only rewards created by the app (with the same client ID) can be managed by it.
+
+// Redemption statuses.
+const (
+	RedemptionUnfulfilled = "UNFULFILLED"
+	RedemptionFulfilled   = "FULFILLED"
+	RedemptionCanceled    = "CANCELED"
+)
+
+// Channel points custom reward.
+type CustomReward struct {
+	ID                  string `json:"id"`
+	BroadcasterID       string `json:"broadcaster_id"`
+	Title               string `json:"title"`
+	Prompt              string `json:"prompt"`
+	Cost                int    `json:"cost"`
+	BackgroundColor     string `json:"background_color"`
+	IsEnabled           bool   `json:"is_enabled"`
+	IsUserInputRequired bool   `json:"is_user_input_required"`
+	IsPaused            bool   `json:"is_paused"`
+	IsInStock           bool   `json:"is_in_stock"`
+	SkipRequestQueue    bool   `json:"should_redemptions_skip_request_queue"`
+}
+
+// Data of new custom reward.
+type CreateCustomReward struct {
+	Title               string `json:"title"`
+	Cost                int    `json:"cost"`
+	Prompt              string `json:"prompt,omitempty"`
+	IsEnabled           *bool  `json:"is_enabled,omitempty"`
+	BackgroundColor     string `json:"background_color,omitempty"`
+	IsUserInputRequired bool   `json:"is_user_input_required,omitempty"`
+	SkipRequestQueue    bool   `json:"should_redemptions_skip_request_queue,omitempty"`
+}
+
+// Redemption of custom reward.
+type Redemption struct {
+	ID            string    `json:"id"`
+	BroadcasterID string    `json:"broadcaster_id"`
+	UserID        string    `json:"user_id"`
+	UserLogin     string    `json:"user_login"`
+	UserName      string    `json:"user_name"`
+	UserInput     string    `json:"user_input"`
+	Status        string    `json:"status"`
+	RedeemedAt    time.Time `json:"redeemed_at"`
+	Reward        struct {
+		ID     string `json:"id"`
+		Title  string `json:"title"`
+		Prompt string `json:"prompt"`
+		Cost   int    `json:"cost"`
+	} `json:"reward"`
+}
+
+// Returns custom rewards of the broadcaster. Only manageable returns only rewards created by this app.
+// Requires channel:read:redemptions or channel:manage:redemptions scope.
+func (c *Client) GetCustomRewards(ctx context.Context, broadcasterID string, onlyManageable bool) ([]CustomReward, error) {
+	var resp response[CustomReward]
+	var err = c.do(ctx, http.MethodGet, "/channel_points/custom_rewards", url.Values{
+		"broadcaster_id":          {broadcasterID},
+		"only_manageable_rewards": {strconv.FormatBool(onlyManageable)},
+	}, nil, &resp)
+	return resp.Data, err
+}
+
+// Creates custom reward. Requires channel:manage:redemptions scope.
+func (c *Client) CreateCustomReward(ctx context.Context, broadcasterID string, reward CreateCustomReward) (CustomReward, error) {
+	return doOne[CustomReward](ctx, c, http.MethodPost, "/channel_points/custom_rewards", url.Values{
+		"broadcaster_id": {broadcasterID},
+	}, reward)
+}
+
+// Returns redemptions of the reward with provided status. Requires channel:read:redemptions scope.
+func (c *Client) GetRedemptions(ctx context.Context, broadcasterID, rewardID, status string) ([]Redemption, error) {
+	return getAll[Redemption](ctx, c, "/channel_points/custom_rewards/redemptions", url.Values{
+		"broadcaster_id": {broadcasterID},
+		"reward_id":      {rewardID},
+		"status":         {status},
+	}, 50)
+}
+
+// Changes status of the redemptions (at most 50) to RedemptionFulfilled or RedemptionCanceled.
+// Canceled redemptions are refunded. Requires channel:manage:redemptions scope.
+func (c *Client) UpdateRedemptionStatus(ctx context.Context, broadcasterID, rewardID string, redemptionIDs []string, status string) ([]Redemption, error) {
+	var query = url.Values{
+		"broadcaster_id": {broadcasterID},
+		"reward_id":      {rewardID},
+	}
+	for _, id := range redemptionIDs {
+		query.Add("id", id)
+	}
+	var body = struct {
+		Status string `json:"status"`
+	}{status}
+	var resp response[Redemption]
+	var err = c.do(ctx, http.MethodPatch, "/channel_points/custom_rewards/redemptions", query, body, &resp)
+	return resp.Data, err
+}
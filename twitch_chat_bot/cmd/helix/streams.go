@@ -0,0 +1,35 @@
+package helix
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Streams endpoint.
+
+// Live stream.
+type Stream struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	UserLogin   string    `json:"user_login"`
+	UserName    string    `json:"user_name"`
+	GameName    string    `json:"game_name"`
+	Type        string    `json:"type"` // "live", empty on error
+	Title       string    `json:"title"`
+	ViewerCount int       `json:"viewer_count"`
+	StartedAt   time.Time `json:"started_at"`
+}
+
+// Returns live streams of the users with provided IDs (at most 100), offline users are not included.
+func (c *Client) GetStreams(ctx context.Context, userIDs []string) ([]Stream, error) {
+	if len(userIDs) > maxPageSize {
+		return nil, errors.New("too many users requested")
+	}
+	var query = url.Values{"user_id": userIDs}
+	var resp response[Stream]
+	var err = c.do(ctx, http.MethodGet, "/streams", query, nil, &resp)
+	return resp.Data, err
+}
@@ -0,0 +1,69 @@
+package helix
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Users and chatters endpoints.
+
+// Twitch user.
+type User struct {
+	ID              string    `json:"id"`
+	Login           string    `json:"login"`
+	DisplayName     string    `json:"display_name"`
+	Type            string    `json:"type"`
+	BroadcasterType string    `json:"broadcaster_type"`
+	Description     string    `json:"description"`
+	ProfileImageURL string    `json:"profile_image_url"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// User connected to the chat.
+type Chatter struct {
+	UserID    string `json:"user_id"`
+	UserLogin string `json:"user_login"`
+	UserName  string `json:"user_name"`
+}
+
+// Returns users with provided IDs or logins (at most 100 in total).
+// Without IDs and logins returns the user that owns the access token.
+func (c *Client) GetUsers(ctx context.Context, ids []string, logins []string) ([]User, error) {
+	if len(ids)+len(logins) > maxPageSize {
+		return nil, errors.New("too many users requested")
+	}
+	var query = url.Values{}
+	for _, id := range ids {
+		query.Add("id", id)
+	}
+	for _, login := range logins {
+		query.Add("login", login)
+	}
+	var resp response[User]
+	var err = c.do(ctx, http.MethodGet, "/users", query, nil, &resp)
+	return resp.Data, err
+}
+
+// Returns the user with provided login.
+func (c *Client) GetUserByLogin(ctx context.Context, login string) (User, error) {
+	var users, err = c.GetUsers(ctx, nil, []string{login})
+	if err != nil {
+		return User{}, err
+	}
+	if len(users) == 0 {
+		return User{}, errors.New("user not found")
+	}
+	return users[0], nil
+}
+
+// Returns all users connected to broadcaster's chat. Moderator ID has to match the user that owns the access token.
+// Requires moderator:read:chatters scope.
+func (c *Client) GetChatters(ctx context.Context, broadcasterID, moderatorID string) ([]Chatter, error) {
+	return getAll[Chatter](ctx, c, "/chat/chatters", url.Values{
+		"broadcaster_id": {broadcasterID},
+		"moderator_id":   {moderatorID},
+	}, 1000)
+}
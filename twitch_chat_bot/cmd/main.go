@@ -1,8 +1,28 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 	"twitch_chat_bot/cmd/chat"
+	"twitch_chat_bot/cmd/chatlog"
+	"twitch_chat_bot/cmd/eventsub"
+	"twitch_chat_bot/cmd/games"
+	"twitch_chat_bot/cmd/helix"
+	"twitch_chat_bot/cmd/metrics"
+	"twitch_chat_bot/cmd/moderation"
+	"twitch_chat_bot/cmd/oauth"
+	"twitch_chat_bot/cmd/overlay"
+	"twitch_chat_bot/cmd/rewards"
+	"twitch_chat_bot/cmd/tts"
+	"twitch_chat_bot/cmd/users"
 )
 
 // Twitch chat bot.
@@ -14,13 +34,342 @@ import (
 // - detect an event (subscription, raid, announcement, etc.),
 // - send chat messages and responses to chat messages,
 // The bot keeps queue of messages that should be sent, to not send them too often and exhaust the connection.
-// Periodic messages can be easly implemented.
+// Periodic messages are posted on an interval when chat is active.
+// Commands can also be used in whispers, they are answered with whispers sent through Twitch API.
+// Chat messages are checked by moderation rules (links, caps, emote spam, repeated messages, banned phrases)
+// configured in config.json, by default the actions are only logged (dry-run).
+// Received messages are stored in SQLite chat log, that can be replayed to test command handlers:
+//   go run ./cmd replay -speed 10 chat.db
+// Twitch API is used for moderation actions and EventSub (channel points, follows, hype trains, stream status)
+// when Twitch app and access token are configured.
+// Chatters earn loyalty points for chatting, that can be checked with !points and given with !give.
+// Moderators can run chat mini-games: polls (!poll), giveaways (!giveaway) and trivia (!trivia).
+// Channel points rewards are handled by reward handlers, redemptions are fulfilled or refunded through Twitch API.
+// Text to speech messages requested with !tts or channel points reward are played on the speaker
+// (requires building with -tags speaker).
+// Chat messages and events are pushed to chat overlay (OBS browser source), also when replaying chat log.
+// Health and metrics are served over HTTP: /health, /status (JSON) and /metrics (Prometheus).
+// The bot is controlled with subcommands (see usage), configuration is read from config.json.
+// While running, the bot can be controlled from interactive console, SIGINT / SIGTERM stop it gracefully.
+
+const shutdownTimeout = time.Second * 5 // Time given to HTTP servers to finish requests when stopping
 
 func main() {
-	chat.Start()
+	var name, args = "run", os.Args[1:]
+	if len(args) > 0 && len(args[0]) > 0 && args[0][0] != '-' {
+		name, args = args[0], args[1:]
+	}
+
+	var err error
+	switch name {
+	case "run":
+		err = run(args)
+	case "auth":
+		err = auth(args)
+	case "say":
+		err = say(args)
+	case "replay":
+		err = replay(args)
+	case "config":
+		err = configCommand(args)
+	case "help":
+		usage()
+	default:
+		usage()
+		err = fmt.Errorf("unknown subcommand %q", name)
+	}
+	if errors.Is(err, errConfigCreated) {
+		os.Exit(1) // The instructions are already printed
+	}
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		slog.Error("Chat bot error", "Err", err)
+		os.Exit(1)
+	}
+}
+
+// Prints available subcommands.
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: %s <subcommand> [flags] [arguments]
+
+Subcommands:
+  run                       Runs the chat bot with interactive console (default)
+  auth                      Requests Twitch access token in the browser and saves it in the configuration file
+  say <channel> <text>      Sends chat message to the channel and exits
+  replay <log>              Replays messages stored in the chat log database file instead of connecting to Twitch
+  config validate           Checks the configuration file
+  help                      Shows this help
+
+Use "<subcommand> -h" to list subcommand flags.
+`, os.Args[0])
+}
+
+// Runs the chat bot until SIGINT / SIGTERM is received or "quit" is typed into the console.
+func run(args []string) error {
+	var flags = flag.NewFlagSet("run", flag.ContinueOnError)
+	var configPath = flags.String("config", defaultConfigPath, "Configuration file")
+	var noConsole = flags.Bool("no-console", false, "Disable interactive console, when running headless")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	var config, err = loadConfig(*configPath, true)
+	if err != nil {
+		return err
+	}
+	if err = config.validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	if len(config.Token.AccessToken) == 0 {
+		return errors.New("access token is missing, use \"auth\" subcommand first")
+	}
+
+	var ctx, stop = signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	var sleepDur = time.Second
-	for {
-		time.Sleep(sleepDur)
+	var api, botUserID = newHelixClient(config)
+	var client = newClient(chat.Config{
+		Pass:     config.accessToken,
+		Nick:     config.Nick,
+		Channels: config.Channels,
+	}, api, botUserID)
+
+	if len(config.ChatLog) > 0 {
+		var log, err = chatlog.Open(config.ChatLog)
+		if err != nil {
+			return fmt.Errorf("opening the chat log failed: %w", err)
+		}
+		defer log.Close()
+		log.Attach(client)
+	}
+
+	userStore, err := users.Open(config.Users, users.Config{PointsPerMessage: 1, PointsPerMinute: 10})
+	if err != nil {
+		return fmt.Errorf("opening the user store failed: %w", err)
+	}
+	defer userStore.Close()
+	userStore.Attach(client)
+	userStore.RegisterCommands(client)
+
+	gameManager, err := games.Open(config.Games, games.Config{
+		Bots:      append([]string{config.Nick}, config.Bots...),
+		Questions: config.Trivia,
+	})
+	if err != nil {
+		return fmt.Errorf("opening the games database failed: %w", err)
+	}
+	defer gameManager.Close()
+	gameManager.Attach(client)
+	gameManager.RegisterCommands(client)
+	if err = startModeration(client, config.Moderation, api, botUserID, gameManager); err != nil {
+		return fmt.Errorf("moderation: %w", err)
+	}
+
+	var rewardManager = newRewardManager(api)
+	defer rewardManager.Close()
+	if speech := newTTS(client, rewardManager); speech != nil {
+		defer speech.Close()
+	}
+	if api != nil {
+		if events := startEventSub(api, botUserID, config.mainChannel(), client, rewardManager); events != nil {
+			defer events.Stop()
+		}
+	} else if len(config.Rewards) > 0 {
+		// Without EventSub redemptions are received from chat, they contain only reward ID
+		rewardManager.SetRewardIDs(config.Rewards)
+		rewardManager.AttachChat(client)
+	} else {
+		slog.Warn("Channel points rewards are disabled, without Twitch API reward IDs have to be set in \"rewards\" configuration")
 	}
+	var servers []*http.Server
+	if len(config.Metrics) > 0 {
+		servers = append(servers, metrics.New(client).ListenAndServe(config.Metrics))
+	}
+	if len(config.Overlay) > 0 {
+		servers = append(servers, startOverlay(config.Overlay, client))
+	}
+
+	client.Start()
+	if !*noConsole {
+		fmt.Println(`Chat bot console, type "help" to list available commands.`)
+		go runConsole(client, os.Stdin, os.Stdout, stop)
+	}
+
+	<-ctx.Done()
+	slog.Info("Chat bot shutting down...")
+	var shutdownCtx, cancel = context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		server.Shutdown(shutdownCtx)
+	}
+	client.Stop()
+	return nil
+}
+
+// Creates Twitch API client if Twitch app and access token are configured, returns nil otherwise.
+// Also returns ID of the user that owns the access token (the chat bot).
+func newHelixClient(config *botConfig) (*helix.Client, string) {
+	if len(config.ClientID) == 0 || len(config.Token.AccessToken) == 0 {
+		slog.Warn("Twitch API is not configured, moderation actions are only logged.")
+		return nil, ""
+	}
+
+	var app = config.app()
+	var tokens = oauth.NewTokenSource(app, config.Token)
+	tokens.OnRefresh = func(token oauth.Token) {
+		if err := config.setToken(token); err != nil {
+			slog.Error("Error saving refreshed access token", "Err", err)
+		}
+	}
+	var ctx, cancel = context.WithTimeout(context.Background(), tokenRefreshTimeout)
+	defer cancel()
+	var token, err = tokens.Token(ctx)
+	if err != nil {
+		slog.Error("Twitch API access token error", "Err", err)
+		return nil, ""
+	}
+	validation, err := app.Validate(ctx, token)
+	if err != nil {
+		slog.Error("Twitch API access token validation error", "Err", err)
+		return nil, ""
+	}
+
+	// Chat connection uses the same token, so it's refreshed also when reconnecting to chat
+	config.mutex.Lock()
+	config.tokens = tokens
+	config.mutex.Unlock()
+	return helix.NewClient(helix.Config{ClientID: app.ClientID, Token: tokens}), validation.UserID
+}
+
+// Creates channel points reward manager, reward handlers are registered by the features using them (like TTS).
+func newRewardManager(api *helix.Client) *rewards.Manager {
+	if api == nil {
+		// Nil *helix.Client would be a non-nil StatusAPI interface, the manager would call it
+		return rewards.NewManager(nil)
+	}
+	return rewards.NewManager(api)
+}
+
+// Creates text to speech queue with chat commands and channel points reward. Returns nil if TTS isn't available.
+func newTTS(client *chat.Client, rewardManager *rewards.Manager) *tts.TTS {
+	var output, err = tts.NewSpeakerOutput()
+	if err != nil {
+		slog.Warn("TTS is disabled", "Err", err)
+		return nil
+	}
+	speech, err := tts.New(tts.Config{
+		Provider: &tts.StreamElements{},
+		Output:   output,
+		Voices:   []string{"Brian", "Amy", "Emma", "Joey", "Justin", "Matthew"},
+	})
+	if err != nil {
+		slog.Error("TTS error", "Err", err)
+		return nil
+	}
+	speech.RegisterCommands(client)
+	rewardManager.Register(rewards.Reward{Title: "TTS", Handler: speech.RewardHandler()})
+	return speech
+}
+
+// Starts EventSub client receiving channel points redemptions, follows and hype trains of the channel.
+// Returns nil if the client couldn't be started.
+// Live status of the channel is updated from stream online / offline events, for periodic messages posted only when live.
+func startEventSub(api *helix.Client, botUserID string, channel string, chatClient *chat.Client, rewardManager *rewards.Manager) *eventsub.Client {
+	var ctx, cancel = context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	var broadcaster, err = api.GetUserByLogin(ctx, channel)
+	if err != nil {
+		slog.Error("EventSub error, when getting broadcaster ID.", "Channel", channel, "Err", err)
+		return nil
+	}
+	// Stream could be already live, events are received only when it changes
+	if streams, err := api.GetStreams(ctx, []string{broadcaster.ID}); err != nil {
+		slog.Warn("Getting stream status failed, the channel is considered offline until it goes live", "Channel", channel, "Err", err)
+	} else {
+		chatClient.SetChannelLive(channel, len(streams) > 0)
+	}
+
+	var subscriptions = append(eventsub.HypeTrainSubscriptions(broadcaster.ID), eventsub.StreamSubscriptions(broadcaster.ID)...)
+	var client = eventsub.NewClient(eventsub.Config{
+		API: api,
+		Subscriptions: append(subscriptions,
+			eventsub.RedemptionSubscription(broadcaster.ID),
+			eventsub.FollowSubscription(broadcaster.ID, botUserID)),
+	})
+	rewardManager.AttachEventSub(client)
+	client.Subscribe(func(event eventsub.Event) {
+		switch e := event.(type) {
+		case *eventsub.StreamEvent:
+			slog.Info("Stream status", "Channel", e.BroadcasterUserLogin, "Online", e.Online)
+			chatClient.SetChannelLive(e.BroadcasterUserLogin, e.Online)
+		case *eventsub.RedemptionEvent:
+			slog.Info("Channel points redemption", "User", e.UserName, "Reward", e.Reward.Title, "Input", e.UserInput)
+		case *eventsub.FollowEvent:
+			slog.Info("New follower", "User", e.UserName)
+		case *eventsub.HypeTrainEvent:
+			slog.Info("Hype train", "Phase", e.Phase.ToString(), "Level", e.Level, "Progress", e.Progress, "Goal", e.Goal)
+		}
+	})
+	client.Start()
+	return client
+}
+
+// Creates the chat bot with registered commands and periodic messages.
+// Twitch API client is optional, without it commands can't be answered with whispers.
+func newClient(config chat.Config, api *helix.Client, botUserID string) *chat.Client {
+	if api != nil {
+		config.WhisperAPI = api
+		config.UserID = botUserID
+	}
+	var client = chat.NewClient(config)
+
+	client.RegisterCommand(chat.Command{
+		Name:     "time",
+		Aliases:  []string{"clock"},
+		Cooldown: time.Second * 10,
+		Whisper:  true,
+		Handler: func(ctx *chat.CommandContext) {
+			ctx.Reply(time.Now().Format(time.TimeOnly))
+		},
+	})
+
+	if len(config.Channels) > 0 {
+		client.AddPeriodicMessages(chat.PeriodicMessages{
+			Channel:         config.Channels[0],
+			Messages:        []string{"Use !time to check the time", "Thanks for watching!"},
+			Interval:        time.Minute * 15,
+			MinChatMessages: 10,
+		})
+	}
+
+	return client
+}
+
+// Starts moderating chat messages with configured rules. Moderation actions require Twitch API,
+// without it they are only logged. Giveaway keyword isn't moderated, many chatters send the same message.
+func startModeration(client *chat.Client, config moderationConfig, api *helix.Client, botUserID string, gameManager *games.Manager) error {
+	var rules, err = config.rules()
+	if err != nil {
+		return err
+	}
+	var moderatorConfig = moderation.Config{
+		DryRun: config.DryRun || api == nil,
+		Ignore: func(e *chat.MessageEvent) bool {
+			return gameManager.IsGiveawayKeyword(e.Channel, e.Message.Trailing)
+		},
+	}
+	if api != nil {
+		moderatorConfig.Actions = &moderation.HelixActions{Client: api, ModeratorID: botUserID}
+	}
+	var moderator = moderation.NewModerator(moderatorConfig)
+	for _, rule := range rules {
+		moderator.AddRule(rule)
+	}
+	moderator.Attach(client)
+	return nil
+}
+
+// Starts chat overlay HTTP server showing messages of the client.
+func startOverlay(address string, client *chat.Client) *http.Server {
+	var server = overlay.New(overlay.Config{})
+	server.Attach(client)
+	return server.ListenAndServe(address)
 }
@@ -0,0 +1,237 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"twitch_chat_bot/cmd/chat"
+)
+
+// Chat bot metrics and health HTTP endpoint.
+// Metrics are collected from chat bot events and client state:
+// - /metrics - metrics in Prometheus text format,
+// - /status - JSON status page,
+// - /health - returns 200 when the bot is connected, 503 otherwise.
+
+const rateWindow = time.Minute // Time window of message rates in the status page
+
+// Metrics of the chat bot.
+type Metrics struct {
+	client   *chat.Client
+	started  time.Time
+	mutex    sync.Mutex
+	messages map[string]uint64      // Received chat messages, key is channel name
+	events   map[string]uint64      // Received events, key is msg-id tag
+	commands map[string]uint64      // Command uses, key is command name
+	recent   map[string][]time.Time // Times of chat messages received within rate window, key is channel name
+}
+
+// JSON status of the chat bot.
+type Status struct {
+	Connected           bool              `json:"connected"`
+	LastMessageReceived time.Time         `json:"last_message_received"`
+	Uptime              string            `json:"uptime"`
+	Reconnects          int64             `json:"reconnects"`
+	Queue               chat.QueueStats   `json:"queue"`
+	Channels            []ChannelStatus   `json:"channels"`
+	Events              map[string]uint64 `json:"events"`
+	Commands            map[string]uint64 `json:"commands"`
+}
+
+// JSON status of a channel.
+type ChannelStatus struct {
+	Name              string `json:"name"`
+	Messages          uint64 `json:"messages"`
+	MessagesPerMinute int    `json:"messages_per_minute"`
+}
+
+// Starts collecting metrics of the client.
+func New(client *chat.Client) *Metrics {
+	var m = &Metrics{
+		client:   client,
+		started:  time.Now(),
+		messages: make(map[string]uint64),
+		events:   make(map[string]uint64),
+		commands: make(map[string]uint64),
+		recent:   make(map[string][]time.Time),
+	}
+	client.Subscribe(m.handleEvent)
+	return m
+}
+
+// Counts received messages, events and commands.
+func (m *Metrics) handleEvent(event chat.Event) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	switch e := event.(type) {
+	case *chat.MessageEvent:
+		if len(e.Metadata.MsgID) > 0 {
+			m.events[e.Metadata.MsgID]++
+		}
+		if e.Message.Command == "PRIVMSG" && len(e.Channel) > 0 {
+			m.messages[e.Channel]++
+			m.recent[e.Channel] = append(trimBefore(m.recent[e.Channel], e.Time.Add(-rateWindow)), e.Time)
+		}
+	case *chat.CommandEvent:
+		m.commands[e.Command]++
+	}
+}
+
+// Removes times before provided time from sorted slice.
+func trimBefore(times []time.Time, t time.Time) []time.Time {
+	var i = 0
+	for i < len(times) && times[i].Before(t) {
+		i++
+	}
+	return times[i:]
+}
+
+// Returns current status of the chat bot.
+func (m *Metrics) Status() Status {
+	var status = Status{
+		Connected:           m.client.IsConnected(),
+		LastMessageReceived: m.client.LastMessageReceived(),
+		Uptime:              time.Since(m.started).Round(time.Second).String(),
+		Reconnects:          m.client.Reconnects(),
+		Queue:               m.client.QueueStats(),
+		Events:              make(map[string]uint64),
+		Commands:            make(map[string]uint64),
+	}
+
+	var since = time.Now().Add(-rateWindow)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, channel := range m.channels() {
+		m.recent[channel] = trimBefore(m.recent[channel], since)
+		status.Channels = append(status.Channels, ChannelStatus{
+			Name:              channel,
+			Messages:          m.messages[channel],
+			MessagesPerMinute: len(m.recent[channel]),
+		})
+	}
+	for k, v := range m.events {
+		status.Events[k] = v
+	}
+	for k, v := range m.commands {
+		status.Commands[k] = v
+	}
+	return status
+}
+
+// Returns sorted names of joined channels and channels with received messages. Should be called with locked mutex.
+func (m *Metrics) channels() []string {
+	var channels = m.client.Channels()
+	for channel := range m.messages {
+		if !slices.Contains(channels, channel) {
+			channels = append(channels, channel)
+		}
+	}
+	slices.Sort(channels)
+	return channels
+}
+
+// Returns HTTP handler serving /metrics, /status and /health endpoints.
+func (m *Metrics) Handler() http.Handler {
+	var mux = http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.WritePrometheus(w)
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var encoder = json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(m.Status())
+	})
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		if m.client.IsConnected() {
+			fmt.Fprintln(w, "OK")
+		} else {
+			http.Error(w, "Disconnected", http.StatusServiceUnavailable)
+		}
+	})
+	return mux
+}
+
+// Starts HTTP server with metrics endpoints in the background.
+func (m *Metrics) ListenAndServe(address string) *http.Server {
+	var server = &http.Server{Addr: address, Handler: m.Handler()}
+	go func() {
+		slog.Info("Metrics server listening", "Address", address)
+		var err = server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			slog.Error("Metrics server error", "Err", err)
+		}
+	}()
+	return server
+}
+
+// Writes metrics in Prometheus text format.
+func (m *Metrics) WritePrometheus(w io.Writer) {
+	var status = m.Status()
+	var connected = 0
+	if status.Connected {
+		connected = 1
+	}
+	var lastMessage float64
+	if !status.LastMessageReceived.IsZero() {
+		lastMessage = float64(status.LastMessageReceived.UnixMilli()) / 1000
+	}
+
+	writeMetric(w, "chatbot_connected", "gauge", "Whether the chat bot is connected.", connected)
+	writeMetric(w, "chatbot_last_message_received_timestamp_seconds", "gauge", "Time when the last message was received.", lastMessage)
+	writeMetric(w, "chatbot_uptime_seconds", "gauge", "Time since the chat bot started.", time.Since(m.started).Seconds())
+	writeMetric(w, "chatbot_reconnects_total", "counter", "Amount of reconnects.", status.Reconnects)
+	writeMetric(w, "chatbot_queue_pending", "gauge", "Chat messages waiting in the send queue.", status.Queue.Pending)
+	writeMetric(w, "chatbot_queue_high_priority", "gauge", "Messages waiting in the high priority lane.", status.Queue.HighPriority)
+	writeMetric(w, "chatbot_messages_sent_total", "counter", "Amount of sent messages.", status.Queue.Sent)
+	writeMetric(w, "chatbot_messages_duplicate_total", "counter", "Chat messages dropped as duplicates.", status.Queue.Duplicates)
+
+	writeHeader(w, "chatbot_chat_messages_total", "counter", "Received chat messages per channel.")
+	for _, channel := range status.Channels {
+		fmt.Fprintf(w, "chatbot_chat_messages_total{channel=\"%s\"} %d\n", escapeLabel(channel.Name), channel.Messages)
+	}
+	writeHeader(w, "chatbot_events_total", "counter", "Received events per msg-id tag.")
+	for _, key := range sortedKeys(status.Events) {
+		fmt.Fprintf(w, "chatbot_events_total{msg_id=\"%s\"} %d\n", escapeLabel(key), status.Events[key])
+	}
+	writeHeader(w, "chatbot_commands_total", "counter", "Chat command uses per command.")
+	for _, key := range sortedKeys(status.Commands) {
+		fmt.Fprintf(w, "chatbot_commands_total{command=\"%s\"} %d\n", escapeLabel(key), status.Commands[key])
+	}
+}
+
+// Writes HELP and TYPE lines of the metric.
+func writeHeader(w io.Writer, name, metricType, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// Writes metric without labels.
+func writeMetric(w io.Writer, name, metricType, help string, value any) {
+	writeHeader(w, name, metricType, help)
+	fmt.Fprintf(w, "%s %v\n", name, value)
+}
+
+// Escapes label value in Prometheus text format.
+func escapeLabel(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
+
+// Returns sorted keys of the map.
+func sortedKeys(m map[string]uint64) []string {
+	var keys = make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"twitch_chat_bot/cmd/chat"
+)
+
+// Chat bot connected to in-memory connection, lines written by the test are received by the bot.
+type testClient struct {
+	client *chat.Client
+	server net.Conn     // Server side of the connection
+	offset atomic.Int64 // Added to the time of received messages
+	http   *httptest.Server
+}
+
+// Creates chat bot with collected metrics served by test HTTP server. The bot is started by the test.
+func newTestClient(t *testing.T) (*testClient, *Metrics) {
+	t.Helper()
+	var tc = &testClient{}
+	var server, conn = net.Pipe()
+	tc.server = server
+	go io.Copy(io.Discard, server) // Lines sent by the bot
+	var dialed atomic.Bool
+	tc.client = chat.NewClient(chat.Config{
+		Nick:     "bot",
+		Channels: []string{"channel"},
+		Clock:    func() time.Time { return time.Now().Add(time.Duration(tc.offset.Load())) },
+		Dial: func(ctx context.Context) (chat.Transport, error) {
+			if dialed.Swap(true) {
+				return nil, errors.New("server is down")
+			}
+			return conn, nil
+		},
+	})
+	tc.client.RegisterCommand(chat.Command{Name: "hello", Handler: func(ctx *chat.CommandContext) {}})
+	var m = New(tc.client)
+	tc.http = httptest.NewServer(m.Handler())
+	t.Cleanup(func() {
+		tc.client.Stop()
+		server.Close()
+		tc.http.Close()
+	})
+	return tc, m
+}
+
+// Sends IRC message to the bot.
+func (tc *testClient) send(t *testing.T, line string) {
+	t.Helper()
+	if _, err := tc.server.Write([]byte(line + "\r\n")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Requests the endpoint, returns status code and body.
+func (tc *testClient) get(t *testing.T, path string) (int, string) {
+	t.Helper()
+	var resp, err = http.Get(tc.http.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+// Waits until the condition is true.
+func waitUntil(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	var timeout = time.After(time.Second * 5)
+	for !condition() {
+		select {
+		case <-timeout:
+			t.Fatalf("%s timed out", what)
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+}
+
+func TestEndpoints(t *testing.T) {
+	var tc, m = newTestClient(t)
+	if code, _ := tc.get(t, "/health"); code != http.StatusServiceUnavailable {
+		t.Errorf("health of stopped bot returned %d", code)
+	}
+
+	var print = chat.PrintChatMessages()
+	chat.SetPrintChatMessages(false)
+	defer chat.SetPrintChatMessages(print)
+	tc.client.Start()
+	tc.send(t, ":tmi.twitch.tv 001 bot :Welcome, GLHF!")
+	waitUntil(t, "connecting", tc.client.IsConnected)
+	if code, body := tc.get(t, "/health"); code != http.StatusOK || body != "OK\n" {
+		t.Errorf("health of connected bot returned %d %q", code, body)
+	}
+
+	// Message older than the rate window is counted only in the total
+	tc.offset.Store(int64(-rateWindow * 2))
+	tc.send(t, "@user-id=1 :viewer!viewer@viewer.tmi.twitch.tv PRIVMSG #channel :old message")
+	waitUntil(t, "old message", func() bool { return m.Status().Channels[0].Messages == 1 })
+	tc.offset.Store(0)
+	tc.send(t, "@user-id=1 :viewer!viewer@viewer.tmi.twitch.tv PRIVMSG #channel :hello")
+	tc.send(t, "@user-id=2 :other!other@other.tmi.twitch.tv PRIVMSG #channel :!hello")
+	tc.send(t, "@user-id=2 :other!other@other.tmi.twitch.tv PRIVMSG #other :hi")
+	tc.send(t, "@msg-id=sub;user-id=3 :tmi.twitch.tv USERNOTICE #channel :new sub")
+	tc.send(t, "@msg-id=sub;user-id=4 :tmi.twitch.tv USERNOTICE #channel")
+	waitUntil(t, "events", func() bool { return m.Status().Events["sub"] == 2 })
+
+	var code, body = tc.get(t, "/status")
+	var status Status
+	if err := json.Unmarshal([]byte(body), &status); code != http.StatusOK || err != nil {
+		t.Fatalf("status returned %d %q, %v", code, body, err)
+	}
+	var channels = fmt.Sprint(status.Channels)
+	if !status.Connected || channels != "[{channel 3 2} {other 1 1}]" || status.Commands["hello"] != 1 || len(status.Events) != 1 {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	code, body = tc.get(t, "/metrics")
+	for _, line := range []string{
+		"# TYPE chatbot_connected gauge\nchatbot_connected 1\n",
+		"chatbot_reconnects_total 0\n",
+		"chatbot_chat_messages_total{channel=\"channel\"} 3\nchatbot_chat_messages_total{channel=\"other\"} 1\n",
+		"chatbot_events_total{msg_id=\"sub\"} 2\n",
+		"chatbot_commands_total{command=\"hello\"} 1\n",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("metrics don't contain %q:\n%s", line, body)
+		}
+	}
+
+	// Lost connection fails the health check
+	tc.server.Close()
+	waitUntil(t, "disconnecting", func() bool { return !tc.client.IsConnected() })
+	if code, body := tc.get(t, "/health"); code != http.StatusServiceUnavailable || body != "Disconnected\n" {
+		t.Errorf("health of disconnected bot returned %d %q", code, body)
+	}
+	if _, body := tc.get(t, "/metrics"); !strings.Contains(body, "chatbot_connected 0\n") {
+		t.Errorf("metrics of disconnected bot:\n%s", body)
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	if label := escapeLabel("a\\b\"c\nd"); label != `a\\b\"c\nd` {
+		t.Errorf("escaped label %q", label)
+	}
+}
@@ -0,0 +1,211 @@
+package moderation
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"twitch_chat_bot/cmd/chat"
+	"unicode"
+)
+
+// Chat message filters used by moderation rules.
+
+// Checks the chat message. Returns reason and true if the message matches the filter.
+type Filter interface {
+	Check(e *chat.MessageEvent) (reason string, matched bool)
+}
+
+// Function used as a filter.
+type FilterFunc func(e *chat.MessageEvent) (string, bool)
+
+func (f FilterFunc) Check(e *chat.MessageEvent) (string, bool) {
+	return f(e)
+}
+
+// Matches messages containing banned phrases (case insensitive) or matching regular expressions.
+type PhraseFilter struct {
+	Phrases  []string
+	Patterns []*regexp.Regexp
+}
+
+func (f *PhraseFilter) Check(e *chat.MessageEvent) (string, bool) {
+	var text = strings.ToLower(e.Message.Trailing)
+	for _, phrase := range f.Phrases {
+		if strings.Contains(text, strings.ToLower(phrase)) {
+			return fmt.Sprintf("banned phrase %q", phrase), true
+		}
+	}
+	for _, pattern := range f.Patterns {
+		if pattern.MatchString(e.Message.Trailing) {
+			return fmt.Sprintf("banned pattern %q", pattern.String()), true
+		}
+	}
+	return "", false
+}
+
+// Regular expression detecting links. Groups are the scheme or "www." prefix, the host and it's top-level domain.
+var linkRegexp = regexp.MustCompile(`(?i)\b(https?://|www\.)?((?:[a-z0-9-]+\.)+([a-z]{2,}))(?::\d+)?(?:/\S*)?`)
+
+// Top-level domains of links written without the scheme or "www." prefix, like "example.com".
+// Other words with dots (file names like "main.go", "e.g.", sentences missing a space) are not links.
+// Domains that look like file extensions (.md, .py, .sh, .rs, etc.) are left out on purpose.
+var linkTopLevelDomains = []string{
+	"com", "net", "org", "info", "biz", "io", "co", "me", "tv", "gg", "xyz", "app", "dev", "ly", "cc", "to",
+	"live", "shop", "store", "site", "online", "top", "club", "link", "click", "fun", "pro", "vip", "win",
+	"us", "uk", "eu", "de", "fr", "pl", "ru", "ua", "nl", "es", "it", "br", "ca", "au", "jp", "cn",
+}
+
+// Matches messages containing links to domains that are not allowed.
+type LinkFilter struct {
+	Allowed []string // Allowed domains, their subdomains are also allowed (like "twitch.tv" or "youtube.com")
+}
+
+func (f *LinkFilter) Check(e *chat.MessageEvent) (string, bool) {
+	for _, match := range linkRegexp.FindAllStringSubmatch(e.Message.Trailing, -1) {
+		var prefix, host, tld = match[1], strings.ToLower(match[2]), strings.ToLower(match[3])
+		if len(prefix) == 0 && !slices.Contains(linkTopLevelDomains, tld) {
+			continue
+		}
+		if !f.allowed(host) {
+			return fmt.Sprintf("link to %s", host), true
+		}
+	}
+	return "", false
+}
+
+// Returns true if the domain or it's parent domain is allowed.
+func (f *LinkFilter) allowed(host string) bool {
+	for _, domain := range f.Allowed {
+		domain = strings.ToLower(domain)
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches messages with too many capital letters. Emotes are not counted.
+type CapsFilter struct {
+	MinLength int     // Minimum amount of letters in the message to be checked
+	MaxRatio  float64 // Maximum ratio of capital letters to all letters, like 0.7
+}
+
+func (f *CapsFilter) Check(e *chat.MessageEvent) (string, bool) {
+	var emotes = e.Metadata.Tags.Emotes()
+	var letters, upper int
+	var i = 0
+	for _, r := range e.Message.Trailing {
+		var isEmote = false
+		for _, emote := range emotes {
+			if i >= emote.Start && i <= emote.End {
+				isEmote = true
+				break
+			}
+		}
+		i++
+		if isEmote || !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if unicode.IsUpper(r) {
+			upper++
+		}
+	}
+
+	if letters == 0 || letters < f.MinLength {
+		return "", false
+	}
+	var ratio = float64(upper) / float64(letters)
+	if ratio > f.MaxRatio {
+		return fmt.Sprintf("%.0f%% capital letters", ratio*100), true
+	}
+	return "", false
+}
+
+// Matches messages with too many emotes.
+type EmoteSpamFilter struct {
+	MaxEmotes int // Maximum amount of emotes in the message
+}
+
+func (f *EmoteSpamFilter) Check(e *chat.MessageEvent) (string, bool) {
+	var count = len(e.Metadata.Tags.Emotes())
+	if count > f.MaxEmotes {
+		return fmt.Sprintf("%d emotes", count), true
+	}
+	return "", false
+}
+
+// Matches chatters that send the same message repeatedly.
+type RepeatFilter struct {
+	maxRepeats int
+	period     time.Duration
+	history    map[string][]time.Time // Times of the message, key is channel, chatter ID and normalized message text
+	cleaned    time.Time              // Last time old messages of all chatters were removed
+	mutex      sync.Mutex
+}
+
+// Creates new filter that matches a message sent more than maxRepeats times by the same chatter within the period.
+func NewRepeatFilter(maxRepeats int, period time.Duration) *RepeatFilter {
+	return &RepeatFilter{
+		maxRepeats: maxRepeats,
+		period:     period,
+		history:    make(map[string][]time.Time),
+	}
+}
+
+func (f *RepeatFilter) Check(e *chat.MessageEvent) (string, bool) {
+	var text = strings.Join(strings.Fields(strings.ToLower(e.Message.Trailing)), " ")
+	var key = fmt.Sprintf("%s %d %s", e.Channel, e.Metadata.UserID, text)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	// Messages older than the period are removed before counting the repeats
+	var times = append(f.removeOld(f.history[key], e.Time), e.Time)
+	f.history[key] = times
+
+	// History of other chatters is cleaned up once per period, so it doesn't grow forever
+	if e.Time.Sub(f.cleaned) >= f.period {
+		for k, times := range f.history {
+			if times = f.removeOld(times, e.Time); len(times) == 0 {
+				delete(f.history, k)
+			} else {
+				f.history[k] = times
+			}
+		}
+		f.cleaned = e.Time
+	}
+
+	var count = len(times)
+	if count > f.maxRepeats {
+		return fmt.Sprintf("message repeated %d times", count), true
+	}
+	return "", false
+}
+
+// Returns times of the message that are within the period before now.
+func (f *RepeatFilter) removeOld(times []time.Time, now time.Time) []time.Time {
+	for len(times) > 0 && now.Sub(times[0]) > f.period {
+		times = times[1:]
+	}
+	return times
+}
+
+// Applies the filter only to messages of first-time chatters (like blocking links in first messages).
+type FirstMessageFilter struct {
+	Filter Filter
+}
+
+func (f *FirstMessageFilter) Check(e *chat.MessageEvent) (string, bool) {
+	if !e.Metadata.Tags.FirstMessage() {
+		return "", false
+	}
+	var reason, ok = f.Filter.Check(e)
+	if !ok {
+		return "", false
+	}
+	return "first message, " + reason, true
+}
@@ -0,0 +1,166 @@
+package moderation
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+	"twitch_chat_bot/cmd/chat"
+)
+
+// Creates chat message event of the chatter with provided badge (like "MOD") and additional tags.
+func messageEvent(t *testing.T, userID int64, badge, tags, text string) *chat.MessageEvent {
+	t.Helper()
+	var line = fmt.Sprintf("@id=msg-%d;room-id=1;user-id=%d%s :user%d!user%d@user%d.tmi.twitch.tv PRIVMSG #channel :%s",
+		userID, userID, tags, userID, userID, userID, text)
+	var msg, err = chat.ParseMessage(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &chat.MessageEvent{
+		Channel: "channel",
+		Time:    time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		Message: msg,
+		Metadata: chat.MessageMetadata{
+			UserID:    userID,
+			UserName:  fmt.Sprintf("User%d", userID),
+			Badge:     badge,
+			MessageID: msg.Tags["id"],
+			Channel:   "channel",
+			Tags:      msg.Tags,
+		},
+	}
+}
+
+func TestLinkFilter(t *testing.T) {
+	var filter = &LinkFilter{Allowed: []string{"twitch.tv", "YouTube.com"}}
+	var tests = []struct {
+		text   string
+		reason string // Expected reason, empty if the message shouldn't match
+	}{
+		{"check out https://example.com/path?a=b", "link to example.com"},
+		{"http://Sub.Example.org:8080 now", "link to sub.example.org"},
+		{"www.example.info", "link to example.info"},
+		{"www.example.unknown", "link to example.unknown"},
+		{"buy followers at bigfollows.com", "link to bigfollows.com"},
+		{"BIGFOLLOWS.XYZ cheap", "link to bigfollows.xyz"},
+		{"https://twitch.tv@evil.com", "link to evil.com"},
+		{"https://twitch.tv/streamer and https://www.youtube.com/watch?v=1", ""},
+		{"clips.twitch.tv/clip", ""},
+		{"youtube.com", ""},
+		{"https://example.dev", "link to example.dev"},
+		{"https://readme.md", "link to readme.md"},
+
+		// False positives of words with dots
+		{"the bug is in main.go", ""},
+		{"see README.md and build.sh", ""},
+		{"fix script.py or lib.rs", ""},
+		{"it's done.Next time I'll win", ""},
+		{"use a tool, e.g. a hammer", ""},
+		{"i.e. nothing", ""},
+		{"version 1.2.3 is out", ""},
+		{"wait...what", ""},
+		{"node.js and vue.js are fine", ""},
+		{"ok.thanks", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		var reason, matched = filter.Check(messageEvent(t, 1, "", "", test.text))
+		if matched != (len(test.reason) > 0) || reason != test.reason {
+			t.Errorf("%q: reason %q (matched %v), expected %q", test.text, reason, matched, test.reason)
+		}
+	}
+}
+
+func TestPhraseFilter(t *testing.T) {
+	var filter = &PhraseFilter{Phrases: []string{"Bad Word"}, Patterns: []*regexp.Regexp{regexp.MustCompile(`\d{4,}`)}}
+	var tests = map[string]bool{
+		"this is a BAD WORD": true,
+		"call 12345":         true,
+		"bad, word":          false,
+		"123":                false,
+	}
+	for text, expected := range tests {
+		if _, matched := filter.Check(messageEvent(t, 1, "", "", text)); matched != expected {
+			t.Errorf("%q: matched %v, expected %v", text, matched, expected)
+		}
+	}
+}
+
+func TestCapsFilter(t *testing.T) {
+	var filter = &CapsFilter{MinLength: 10, MaxRatio: 0.7}
+	var tests = []struct {
+		text    string
+		emotes  string
+		matched bool
+	}{
+		{"THIS IS VERY LOUD", "", true},
+		{"This Is Not Loud At All", "", false},
+		{"SHORT", "", false},
+		{"ŻÓŁĆ GĘŚLĄ JAŹŃ", "", true},
+		{"LUL LUL LUL LUL hello there", ";emotes=425618:0-2,4-6,8-10,12-14", false},
+		{"12345!!! 67890???", "", false},
+	}
+	for _, test := range tests {
+		if _, matched := filter.Check(messageEvent(t, 1, "", test.emotes, test.text)); matched != test.matched {
+			t.Errorf("%q: matched %v, expected %v", test.text, matched, test.matched)
+		}
+	}
+}
+
+func TestEmoteSpamFilter(t *testing.T) {
+	var filter = &EmoteSpamFilter{MaxEmotes: 2}
+	if _, matched := filter.Check(messageEvent(t, 1, "", ";emotes=25:0-4,6-10", "Kappa Kappa")); matched {
+		t.Error("2 emotes matched")
+	}
+	if reason, matched := filter.Check(messageEvent(t, 1, "", ";emotes=25:0-4,6-10/1902:12-16", "Kappa Kappa Keepo")); !matched || reason != "3 emotes" {
+		t.Errorf("3 emotes: reason %q, matched %v", reason, matched)
+	}
+}
+
+func TestRepeatFilter(t *testing.T) {
+	var filter = NewRepeatFilter(2, time.Minute)
+	var check = func(userID int64, text string, at time.Duration) bool {
+		var e = messageEvent(t, userID, "", "", text)
+		e.Time = e.Time.Add(at)
+		var _, matched = filter.Check(e)
+		return matched
+	}
+
+	if check(1, "spam", 0) || check(1, "SPAM ", time.Second) {
+		t.Error("matched before the limit")
+	}
+	if check(2, "spam", time.Second*2) {
+		t.Error("other chatter's message was counted")
+	}
+	if !check(1, "spam", time.Second*3) {
+		t.Error("third repeat didn't match")
+	}
+	if check(1, "spam", time.Minute*2) {
+		t.Error("old messages weren't forgotten")
+	}
+	if len(filter.history) != 1 {
+		t.Errorf("history of %d messages kept, expected only the last one", len(filter.history))
+	}
+
+	// Only repeats within the period before the message are counted
+	if check(1, "spam", time.Minute*2+time.Second*30) || !check(1, "spam", time.Minute*2+time.Second*40) {
+		t.Error("third repeat within the period didn't match")
+	}
+	if check(1, "spam", time.Minute*3+time.Second*35) {
+		t.Error("repeats older than the period were counted")
+	}
+}
+
+func TestFirstMessageFilter(t *testing.T) {
+	var filter = &FirstMessageFilter{Filter: &LinkFilter{}}
+	if reason, matched := filter.Check(messageEvent(t, 1, "", ";first-msg=1", "example.com")); !matched || reason != "first message, link to example.com" {
+		t.Errorf("first message: reason %q, matched %v", reason, matched)
+	}
+	if _, matched := filter.Check(messageEvent(t, 1, "", ";first-msg=0", "example.com")); matched {
+		t.Error("not first message matched")
+	}
+	if _, matched := filter.Check(messageEvent(t, 1, "", ";first-msg=1", "hello")); matched {
+		t.Error("first message without a link matched")
+	}
+}
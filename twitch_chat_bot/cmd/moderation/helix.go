@@ -0,0 +1,36 @@
+package moderation
+
+import (
+	"context"
+	"strconv"
+	"time"
+	"twitch_chat_bot/cmd/helix"
+)
+
+const helixActionTimeout = time.Second * 10 // Timeout of Twitch API request performing the action
+
+// Moderation actions performed through Twitch API.
+type HelixActions struct {
+	Client      *helix.Client
+	ModeratorID string // ID of the user that owns the access token (the chat bot)
+}
+
+func (a *HelixActions) DeleteMessage(target Target) error {
+	var ctx, cancel = context.WithTimeout(context.Background(), helixActionTimeout)
+	defer cancel()
+	return a.Client.DeleteChatMessage(ctx, strconv.FormatInt(target.ChannelID, 10), a.ModeratorID, target.MessageID)
+}
+
+func (a *HelixActions) Timeout(target Target, duration time.Duration, reason string) error {
+	var ctx, cancel = context.WithTimeout(context.Background(), helixActionTimeout)
+	defer cancel()
+	return a.Client.BanUser(ctx, strconv.FormatInt(target.ChannelID, 10), a.ModeratorID,
+		strconv.FormatInt(target.UserID, 10), duration, reason)
+}
+
+func (a *HelixActions) Ban(target Target, reason string) error {
+	var ctx, cancel = context.WithTimeout(context.Background(), helixActionTimeout)
+	defer cancel()
+	return a.Client.BanUser(ctx, strconv.FormatInt(target.ChannelID, 10), a.ModeratorID,
+		strconv.FormatInt(target.UserID, 10), 0, reason)
+}
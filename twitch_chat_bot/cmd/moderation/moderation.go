@@ -0,0 +1,242 @@
+package moderation
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+	"twitch_chat_bot/cmd/chat"
+)
+
+// Chat moderation.
+// Every chat message is checked against configured rules. Each rule has a filter (banned phrases, links,
+// caps, emote spam, repeated messages, etc.) and an action that is taken when the filter matches.
+// If multiple rules match, only the most severe action is taken (ban > timeout > delete).
+// Actions are performed through Actions interface (Twitch API), so they can be replaced with a fake one.
+// In dry-run mode actions are only logged, nothing is done in chat.
+// Messages can be excluded from moderation with Config.Ignore (like giveaway keyword sent by many chatters).
+// Every taken action is written to the audit log.
+
+const defaultAuditLogSize = 1000 // Default amount of kept audit log entries
+
+var errNoActions = errors.New("moderation actions are not configured")
+
+// Type of moderation action.
+type ActionType uint8
+
+const (
+	ActionNone ActionType = iota
+	ActionDelete
+	ActionTimeout
+	ActionBan
+)
+
+// Converts action type to it's string representation.
+func (a ActionType) ToString() string {
+	switch a {
+	case ActionNone:
+		return "None"
+	case ActionDelete:
+		return "Delete"
+	case ActionTimeout:
+		return "Timeout"
+	case ActionBan:
+		return "Ban"
+	default:
+		return ""
+	}
+}
+
+// Moderation action taken when a filter matches.
+type Action struct {
+	Type     ActionType
+	Duration time.Duration // Timeout duration
+}
+
+// Returns true if the action is more severe than the other one.
+func (a Action) moreSevere(other Action) bool {
+	if a.Type != other.Type {
+		return a.Type > other.Type
+	}
+	return a.Type == ActionTimeout && a.Duration > other.Duration
+}
+
+// Chatter and chat message that the action is taken on.
+type Target struct {
+	Channel   string // Channel name
+	ChannelID int64  // Broadcaster ID
+	UserID    int64  // Chatter ID
+	UserName  string // Name of the chatter
+	MessageID string // ID of the chat message
+}
+
+// Performs moderation actions in chat.
+type Actions interface {
+	DeleteMessage(target Target) error                                  // Deletes the chat message
+	Timeout(target Target, duration time.Duration, reason string) error // Times out the chatter
+	Ban(target Target, reason string) error                             // Permanently bans the chatter
+}
+
+// Moderation rule.
+type Rule struct {
+	Name   string // Rule name, used in logs
+	Filter Filter // Filter checking chat messages
+	Action Action // Action taken when the filter matches
+}
+
+// Moderator configuration.
+type Config struct {
+	Actions      Actions                         // Performs the actions, can be nil in dry-run mode
+	DryRun       bool                            // Only log the actions, don't perform them?
+	Exempt       chat.Permission                 // Chatters with this or higher permission are not moderated, Everyone (zero value) means moderators
+	Ignore       func(e *chat.MessageEvent) bool // Returns true for messages that are not moderated, can be nil
+	AuditLogSize int                             // Amount of kept audit log entries, 0 means 1000
+}
+
+// Entry of the audit log.
+type AuditEntry struct {
+	Time   time.Time
+	Target Target
+	Text   string // Chat message text
+	Rule   string // Name of matched rule
+	Reason string // Why the filter matched
+	Action Action // Taken action
+	DryRun bool   // Was the action only logged?
+	Err    error  // Error returned when performing the action
+}
+
+// Chat moderator.
+type Moderator struct {
+	config     Config
+	rules      []Rule
+	rulesMutex sync.Mutex
+	audit      []AuditEntry
+	auditMutex sync.Mutex
+}
+
+// Creates new moderator. Rules are added with AddRule.
+func NewModerator(config Config) *Moderator {
+	if config.Exempt == chat.PermissionEveryone {
+		config.Exempt = chat.PermissionModerator
+	}
+	if config.AuditLogSize <= 0 {
+		config.AuditLogSize = defaultAuditLogSize
+	}
+	return &Moderator{config: config}
+}
+
+// Adds moderation rule.
+func (m *Moderator) AddRule(rule Rule) {
+	m.rulesMutex.Lock()
+	m.rules = append(m.rules, rule)
+	m.rulesMutex.Unlock()
+}
+
+// Sets dry-run mode, in which the actions are only logged.
+func (m *Moderator) SetDryRun(dryRun bool) {
+	m.rulesMutex.Lock()
+	m.config.DryRun = dryRun
+	m.rulesMutex.Unlock()
+}
+
+// Starts moderating chat messages received by the client. Returns subscription ID that can be used to unsubscribe.
+func (m *Moderator) Attach(client *chat.Client) int {
+	return client.Subscribe(func(event chat.Event) {
+		var e, ok = event.(*chat.MessageEvent)
+		if !ok || e.Message.Command != "PRIVMSG" {
+			return
+		}
+		if entry, ok := m.Check(e); ok {
+			// Actions are API requests, don't block receiving chat messages
+			go m.Perform(entry)
+		}
+	})
+}
+
+// Checks the chat message against the rules. Returns audit entry with the most severe action and true
+// if any rule matched. The action isn't performed, use Perform (Attach performs it automatically).
+func (m *Moderator) Check(e *chat.MessageEvent) (AuditEntry, bool) {
+	if chat.PermissionFromBadge(e.Metadata.Badge) >= m.config.Exempt {
+		return AuditEntry{}, false
+	}
+	if m.config.Ignore != nil && m.config.Ignore(e) {
+		return AuditEntry{}, false
+	}
+
+	var entry AuditEntry
+	var matched = false
+	m.rulesMutex.Lock()
+	for _, rule := range m.rules {
+		var reason, ok = rule.Filter.Check(e)
+		if !ok {
+			continue
+		}
+		if !matched || rule.Action.moreSevere(entry.Action) {
+			entry.Rule = rule.Name
+			entry.Reason = reason
+			entry.Action = rule.Action
+		}
+		matched = true
+	}
+	entry.DryRun = m.config.DryRun
+	m.rulesMutex.Unlock()
+
+	if !matched || entry.Action.Type == ActionNone {
+		return AuditEntry{}, false
+	}
+	entry.Time = e.Time
+	entry.Text = e.Message.Trailing
+	entry.Target = Target{
+		Channel:   e.Channel,
+		ChannelID: int64(e.Metadata.Tags.Int("room-id")),
+		UserID:    e.Metadata.UserID,
+		UserName:  e.Metadata.UserName,
+		MessageID: e.Metadata.MessageID,
+	}
+	return entry, true
+}
+
+// Performs the action returned by Check (unless in dry-run mode) and writes it to the audit log.
+func (m *Moderator) Perform(entry AuditEntry) {
+	if !entry.DryRun {
+		if m.config.Actions == nil {
+			entry.Err = errNoActions
+		} else {
+			switch entry.Action.Type {
+			case ActionDelete:
+				entry.Err = m.config.Actions.DeleteMessage(entry.Target)
+			case ActionTimeout:
+				entry.Err = m.config.Actions.Timeout(entry.Target, entry.Action.Duration, entry.Reason)
+			case ActionBan:
+				entry.Err = m.config.Actions.Ban(entry.Target, entry.Reason)
+			}
+		}
+	}
+
+	var args = []any{"Channel", entry.Target.Channel, "User", entry.Target.UserName, "Action", entry.Action.Type.ToString(),
+		"Rule", entry.Rule, "Reason", entry.Reason, "DryRun", entry.DryRun}
+	if entry.Action.Type == ActionTimeout {
+		args = append(args, "Duration", entry.Action.Duration)
+	}
+	if entry.Err != nil {
+		slog.Error("Moderation action failed", append(args, "Err", entry.Err)...)
+	} else {
+		slog.Info("Moderation action", args...)
+	}
+
+	m.auditMutex.Lock()
+	m.audit = append(m.audit, entry)
+	if len(m.audit) > m.config.AuditLogSize {
+		m.audit = m.audit[len(m.audit)-m.config.AuditLogSize:]
+	}
+	m.auditMutex.Unlock()
+}
+
+// Returns copy of the audit log, oldest entries first.
+func (m *Moderator) AuditLog() []AuditEntry {
+	m.auditMutex.Lock()
+	defer m.auditMutex.Unlock()
+	var log = make([]AuditEntry, len(m.audit))
+	copy(log, m.audit)
+	return log
+}
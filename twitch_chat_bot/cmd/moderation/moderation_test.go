@@ -0,0 +1,189 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+	"twitch_chat_bot/cmd/chat"
+	"twitch_chat_bot/cmd/chat/chattest"
+)
+
+// Fake moderation actions recording performed actions.
+type fakeActions struct {
+	mutex   sync.Mutex
+	actions []string
+	err     error // Error returned by every action
+}
+
+func (a *fakeActions) record(action string) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.actions = append(a.actions, action)
+	return a.err
+}
+
+func (a *fakeActions) DeleteMessage(target Target) error {
+	return a.record(fmt.Sprintf("delete %s %s", target.Channel, target.MessageID))
+}
+
+func (a *fakeActions) Timeout(target Target, duration time.Duration, reason string) error {
+	return a.record(fmt.Sprintf("timeout %s %s %s: %s", target.Channel, target.UserName, duration, reason))
+}
+
+func (a *fakeActions) Ban(target Target, reason string) error {
+	return a.record(fmt.Sprintf("ban %s %s: %s", target.Channel, target.UserName, reason))
+}
+
+// Creates moderator with delete rule for links, timeout rule for "spam" and ban rule for "scam".
+func newTestModerator(config Config) *Moderator {
+	var m = NewModerator(config)
+	m.AddRule(Rule{Name: "Links", Filter: &LinkFilter{}, Action: Action{Type: ActionDelete}})
+	m.AddRule(Rule{Name: "Spam", Filter: &PhraseFilter{Phrases: []string{"spam"}}, Action: Action{Type: ActionTimeout, Duration: time.Minute}})
+	m.AddRule(Rule{Name: "Long spam", Filter: &PhraseFilter{Phrases: []string{"spam spam"}}, Action: Action{Type: ActionTimeout, Duration: time.Hour}})
+	m.AddRule(Rule{Name: "Scam", Filter: &PhraseFilter{Phrases: []string{"scam"}}, Action: Action{Type: ActionBan}})
+	return m
+}
+
+func TestModerator(t *testing.T) {
+	var actions = &fakeActions{}
+	var m = newTestModerator(Config{Actions: actions})
+
+	var tests = []struct {
+		badge  string
+		text   string
+		action string // Expected performed action, empty if nothing should be done
+	}{
+		{"", "hello chat", ""},
+		{"", "visit example.com", "delete channel msg-1"},
+		{"SUB", "spam", "timeout channel User1 1m0s: banned phrase \"spam\""},
+		{"", "spam spam at example.com", "timeout channel User1 1h0m0s: banned phrase \"spam spam\""},
+		{"VIP", "scam spam example.com", "ban channel User1: banned phrase \"scam\""},
+		{"MOD", "scam example.com", ""},
+		{"STR", "spam", ""},
+	}
+	for _, test := range tests {
+		actions.actions = nil
+		var entry, ok = m.Check(messageEvent(t, 1, test.badge, "", test.text))
+		if ok != (len(test.action) > 0) {
+			t.Errorf("%s %q: matched %v", test.badge, test.text, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		m.Perform(entry)
+		if !slices.Equal(actions.actions, []string{test.action}) {
+			t.Errorf("%s %q: performed %q, expected %q", test.badge, test.text, actions.actions, test.action)
+		}
+	}
+
+	var log = m.AuditLog()
+	if len(log) != 4 {
+		t.Fatalf("audit log has %d entries, expected 4", len(log))
+	}
+	var last = log[3]
+	if last.Rule != "Scam" || last.Action.Type != ActionBan || last.Text != "scam spam example.com" ||
+		last.Target.UserID != 1 || last.Target.ChannelID != 1 || last.DryRun || last.Err != nil {
+		t.Errorf("unexpected audit entry %+v", last)
+	}
+}
+
+func TestModeratorExempt(t *testing.T) {
+	var m = newTestModerator(Config{Actions: &fakeActions{}, Exempt: chat.PermissionSubscriber})
+	if _, ok := m.Check(messageEvent(t, 1, "SUB", "", "spam")); ok {
+		t.Error("exempt subscriber was moderated")
+	}
+	if _, ok := m.Check(messageEvent(t, 1, "", "", "spam")); !ok {
+		t.Error("chatter wasn't moderated")
+	}
+
+	m = newTestModerator(Config{Actions: &fakeActions{}, Ignore: func(e *chat.MessageEvent) bool { return e.Message.Trailing == "!spam" }})
+	if _, ok := m.Check(messageEvent(t, 1, "", "", "!spam")); ok {
+		t.Error("ignored message was moderated")
+	}
+	if _, ok := m.Check(messageEvent(t, 1, "", "", "!spam now")); !ok {
+		t.Error("chatter wasn't moderated")
+	}
+}
+
+func TestModeratorDryRun(t *testing.T) {
+	var actions = &fakeActions{}
+	var m = newTestModerator(Config{Actions: actions, DryRun: true})
+
+	var entry, ok = m.Check(messageEvent(t, 1, "", "", "scam"))
+	if !ok || !entry.DryRun {
+		t.Fatalf("dry-run entry %+v, matched %v", entry, ok)
+	}
+	m.Perform(entry)
+	if len(actions.actions) != 0 {
+		t.Errorf("actions performed in dry-run mode: %q", actions.actions)
+	}
+
+	m.SetDryRun(false)
+	entry, _ = m.Check(messageEvent(t, 1, "", "", "scam"))
+	m.Perform(entry)
+	if len(actions.actions) != 1 {
+		t.Errorf("performed %q after disabling dry-run mode", actions.actions)
+	}
+	var log = m.AuditLog()
+	if len(log) != 2 || !log[0].DryRun || log[1].DryRun {
+		t.Errorf("unexpected audit log %+v", log)
+	}
+}
+
+func TestModeratorErrors(t *testing.T) {
+	var failed = errors.New("request failed")
+	var m = newTestModerator(Config{Actions: &fakeActions{err: failed}, AuditLogSize: 2})
+	for i := 0; i < 3; i++ {
+		var entry, _ = m.Check(messageEvent(t, int64(i), "", "", "spam"))
+		m.Perform(entry)
+	}
+	var log = m.AuditLog()
+	if len(log) != 2 || log[0].Target.UserID != 1 || log[1].Target.UserID != 2 {
+		t.Fatalf("audit log wasn't trimmed to the newest entries: %+v", log)
+	}
+	if !errors.Is(log[1].Err, failed) {
+		t.Errorf("audit entry error %v", log[1].Err)
+	}
+
+	// Without actions nothing can be done
+	m = newTestModerator(Config{})
+	var entry, _ = m.Check(messageEvent(t, 1, "", "", "spam"))
+	m.Perform(entry)
+	if log := m.AuditLog(); len(log) != 1 || !errors.Is(log[0].Err, errNoActions) {
+		t.Errorf("unexpected audit log %+v", log)
+	}
+}
+
+func TestModeratorAttach(t *testing.T) {
+	var server = chattest.NewServer(chattest.Config{})
+	defer server.Close()
+	var client = chat.NewClient(server.ClientConfig("bot", "channel"))
+	var actions = &fakeActions{}
+	var m = newTestModerator(Config{Actions: actions})
+	m.Attach(client)
+	client.Start()
+	defer client.Stop()
+
+	var ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := server.WaitJoined(ctx, "channel"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Messages received by the client are checked and actions are performed in the background
+	server.PrivMsg("channel", "Viewer", "hello", chat.Tags{"id": "ok"})
+	server.PrivMsg("channel", "Viewer", "free followers at bigfollows.com", chat.Tags{"id": "link"})
+	for len(m.AuditLog()) == 0 && ctx.Err() == nil {
+		time.Sleep(time.Millisecond * 10)
+	}
+	actions.mutex.Lock()
+	defer actions.mutex.Unlock()
+	if !slices.Equal(actions.actions, []string{"delete channel link"}) {
+		t.Errorf("performed %q", actions.actions)
+	}
+}
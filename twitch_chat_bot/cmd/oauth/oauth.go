@@ -0,0 +1,327 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OAuth tokens based on Twitch API (authorization code flow), shared by the chat bot and Twitch API client.
+// New token is requested by opening browser window where the user authorizes the app,
+// Twitch then redirects to local server with authorization code that is exchanged for the token.
+// Expired tokens are refreshed with the refresh token, without user interference.
+// Tokens should be saved to file / database after every refresh (see TokenSource.OnRefresh).
+
+var AuthURL = "https://id.twitch.tv/oauth2" // Twitch OAuth server, can be changed for tests
+
+const refreshBeforeExpiration = time.Minute // Token is refreshed when it expires in less than this time
+
+// Default scopes requested by the chat bot.
+var DefaultScopes = []string{
+	"bits:read",                      // View Bits information for a channel
+	"channel:manage:redemptions",     // Manage Channel Points custom rewards and their redemptions on a channel
+	"channel:moderate",               // Perform moderation actions in a channel. The user requesting the scope must be a moderator in the channel
+	"channel:read:hype_train",        // View Hype Train information for a channel
+	"channel:read:redemptions",       // View Channel Points custom rewards and their redemptions on a channel
+	"channel:read:subscriptions",     // View a list of all subscribers to a channel and check if a user is subscribed to a channel
+	"chat:edit",                      // Send live stream chat messages
+	"chat:read",                      // View live stream chat messages
+	"moderator:manage:announcements", // Send announcements in channels where you have the moderator role
+	"moderator:manage:banned_users",  // Ban and unban users
+	"moderator:manage:chat_messages", // Delete chat messages in channels where you have the moderator role
+	"moderator:manage:shoutouts",     // Manage a broadcaster’s shoutouts
+	"moderator:read:chatters",        // View the chatters in a broadcaster’s chat room
+	"moderator:read:followers",       // Read the followers of a broadcaster
+	"user:manage:whispers",           // Send and receive whisper messages
+	"whispers:edit",                  // Send whisper messages
+	"whispers:read",                  // View your whisper messages
+}
+
+// Twitch app configuration.
+type Config struct {
+	ClientID     string   // Twitch API bots client ID
+	ClientSecret string   // Twitch API bots client password
+	RedirectURI  string   // Twitch API bots redirect Uri, like "http://localhost:3000"
+	Scopes       []string // Requested scopes, DefaultScopes if empty
+}
+
+// OAuth token.
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	Expires      time.Time `json:"expires"`
+	Scopes       []string  `json:"scopes"`
+}
+
+// Returns true if the token is expired or will expire soon.
+func (t Token) Expired(now time.Time) bool {
+	return len(t.AccessToken) == 0 || (!t.Expires.IsZero() && t.Expires.Sub(now) < refreshBeforeExpiration)
+}
+
+// Response to token validation.
+type Validation struct {
+	ClientID  string   `json:"client_id"`
+	Login     string   `json:"login"`
+	UserID    string   `json:"user_id"`
+	Scopes    []string `json:"scopes"`
+	ExpiresIn int      `json:"expires_in"`
+}
+
+// Token response of Twitch OAuth server.
+type tokenResponse struct {
+	AccessToken  string   `json:"access_token"`
+	RefreshToken string   `json:"refresh_token"`
+	ExpiresIn    int      `json:"expires_in"`
+	Scope        []string `json:"scope"`
+}
+
+// Returns requested scopes.
+func (c Config) scopes() []string {
+	if len(c.Scopes) == 0 {
+		return DefaultScopes
+	}
+	return c.Scopes
+}
+
+// Requests new token. Opens browser window where the user authorizes the app and waits for the redirect
+// to local server listening on RedirectURI.
+func (c Config) Authorize(ctx context.Context) (Token, error) {
+	slog.Info("Twitch access token, requesting new one.")
+	var redirect, err = url.Parse(c.RedirectURI)
+	if err != nil {
+		return Token{}, err
+	}
+	state, err := newState()
+	if err != nil {
+		return Token{}, err
+	}
+	var authURL = fmt.Sprintf(
+		"%s/authorize?client_id=%s&redirect_uri=%s&response_type=code&state=%s&scope=%s",
+		AuthURL,
+		url.QueryEscape(c.ClientID),
+		url.QueryEscape(c.RedirectURI),
+		state,
+		// url.QueryEscape(strings.Join(scopes, "+")), // Query escape also escapes "+" which Twitch doesn't like
+		strings.ReplaceAll(strings.Join(c.scopes(), "+"), ":", "%3A"),
+	)
+
+	// Local server is needed to get response to user authorizing the app (to grab the authorization code)
+	listener, err := net.Listen("tcp", redirect.Host)
+	if err != nil {
+		return Token{}, fmt.Errorf("couldn't start local server: %w", err)
+	}
+	var codes = make(chan string, 1)
+	var server = http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var query = r.URL.Query()
+		if query.Get("state") != state || len(query.Get("code")) == 0 {
+			slog.Warn("Twitch access token request. Received request doesn't contain code part - waiting for another connection")
+			http.Error(w, "Missing authorization code", http.StatusBadRequest)
+			return
+		}
+		// Redirect to www.twitch.tv to hide code part in the url
+		http.Redirect(w, r, "https://www.twitch.tv", http.StatusFound)
+		select {
+		case codes <- query.Get("code"):
+		default:
+		}
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	// Open the url for the user to complete authorization
+	if err = OpenURL(authURL); err != nil {
+		slog.Warn("Twitch access token request. Couldn't open the browser, open the url manually", "Url", authURL, "Err", err)
+	}
+
+	var code string
+	select {
+	case <-ctx.Done():
+		return Token{}, ctx.Err()
+	case code = <-codes:
+	}
+
+	// Next step - request user token with received authorization code
+	return c.requestToken(ctx, url.Values{
+		"client_id":     {c.ClientID},
+		"client_secret": {c.ClientSecret},
+		"code":          {code},
+		"grant_type":    {"authorization_code"},
+		"redirect_uri":  {c.RedirectURI},
+	})
+}
+
+// Returns random state parameter of the authorization request, protecting the redirect from forged requests.
+func newState() (string, error) {
+	var b = make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating state failed: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Refreshes the token using refresh token.
+func (c Config) Refresh(ctx context.Context, refreshToken string) (Token, error) {
+	if len(c.ClientID) == 0 || len(c.ClientSecret) == 0 || len(refreshToken) == 0 {
+		return Token{}, errors.New("missing client ID, client password or refresh token")
+	}
+	return c.requestToken(ctx, url.Values{
+		"client_id":     {c.ClientID},
+		"client_secret": {c.ClientSecret},
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+}
+
+// Sends token request to OAuth server.
+func (c Config) requestToken(ctx context.Context, form url.Values) (Token, error) {
+	var req, err = http.NewRequestWithContext(ctx, http.MethodPost, AuthURL+"/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Token{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Token{}, fmt.Errorf("token request didn't succeed: %s", resp.Status)
+	}
+
+	var data tokenResponse
+	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return Token{}, err
+	}
+	if !c.checkScopes(data.Scope) {
+		slog.Warn("Twitch access token. Received scopes are different from requested ones")
+	}
+	var expiresIn = time.Second * time.Duration(data.ExpiresIn)
+	slog.Info("Twitch access token received.", "ExpiresIn", expiresIn.String())
+	return Token{
+		AccessToken:  data.AccessToken,
+		RefreshToken: data.RefreshToken,
+		Expires:      time.Now().Add(expiresIn),
+		Scopes:       data.Scope,
+	}, nil
+}
+
+// Validates the access token.
+func (c Config) Validate(ctx context.Context, accessToken string) (Validation, error) {
+	var req, err = http.NewRequestWithContext(ctx, http.MethodGet, AuthURL+"/validate", nil)
+	if err != nil {
+		return Validation{}, err
+	}
+	req.Header.Set("Authorization", "OAuth "+accessToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Validation{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Validation{}, fmt.Errorf("token validation didn't succeed: %s", resp.Status)
+	}
+
+	var data Validation
+	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return Validation{}, err
+	}
+	if data.ClientID != c.ClientID || data.ExpiresIn <= 0 {
+		return data, errors.New("token has expired or belongs to different app")
+	}
+	return data, nil
+}
+
+// Compares provided list of scopes with requested scopes returning true if they are the same, otherwise false.
+func (c Config) checkScopes(scopes []string) bool {
+	var requested = c.scopes()
+	if len(scopes) != len(requested) {
+		return false
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(requested, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// Provides valid access token, refreshing it when it expires.
+type TokenSource struct {
+	config    Config
+	token     Token
+	mutex     sync.Mutex
+	OnRefresh func(token Token) // Called after the token is refreshed, should save the token
+}
+
+// Creates new token source starting with provided token.
+func NewTokenSource(config Config, token Token) *TokenSource {
+	return &TokenSource{config: config, token: token}
+}
+
+// Returns access token, refreshing it if it's expired.
+func (s *TokenSource) Token(ctx context.Context) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.token.Expired(time.Now()) {
+		return s.token.AccessToken, nil
+	}
+	return s.refresh(ctx)
+}
+
+// Refreshes the token, even if it isn't expired (like after the API rejected it).
+func (s *TokenSource) Refresh(ctx context.Context) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.refresh(ctx)
+}
+
+// Refreshes the token. Should be called with locked mutex.
+func (s *TokenSource) refresh(ctx context.Context) (string, error) {
+	var token, err = s.config.Refresh(ctx, s.token.RefreshToken)
+	if err != nil {
+		return "", fmt.Errorf("token refresh failed: %w", err)
+	}
+	s.token = token
+	if s.OnRefresh != nil {
+		s.OnRefresh(token)
+	}
+	return token.AccessToken, nil
+}
+
+// Returns current token.
+func (s *TokenSource) Current() Token {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.token
+}
+
+// Opens the url in the browser.
+func OpenURL(url string) error {
+	var err error = nil
+
+	switch runtime.GOOS {
+	case "linux":
+		err = exec.Command("xdg-open", url).Start()
+	case "windows":
+		err = exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+	case "darwin":
+		err = exec.Command("open", url).Start()
+	default:
+		err = fmt.Errorf("unsupported platform")
+	}
+
+	return err
+}
@@ -0,0 +1,222 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Fake Twitch OAuth server. Issues tokens "access-N" / "refresh-N" for the authorization code "code"
+// and for the latest refresh token.
+type fakeAuthServer struct {
+	server   *httptest.Server
+	mutex    sync.Mutex
+	issued   int          // Amount of issued tokens
+	forms    []url.Values // Received token requests
+	scopes   []string     // Scopes of issued tokens
+	rejected bool         // Reject all token requests?
+}
+
+func newFakeAuthServer(t *testing.T) *fakeAuthServer {
+	t.Helper()
+	var s = &fakeAuthServer{scopes: []string{"chat:read", "chat:edit"}}
+	var mux = http.NewServeMux()
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if err := r.ParseForm(); err != nil || r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+			http.Error(w, "invalid form", http.StatusBadRequest)
+			return
+		}
+		s.forms = append(s.forms, r.PostForm)
+		var valid = false
+		switch r.PostForm.Get("grant_type") {
+		case "authorization_code":
+			valid = r.PostForm.Get("code") == "code"
+		case "refresh_token":
+			valid = r.PostForm.Get("refresh_token") == fmt.Sprintf("refresh-%d", s.issued)
+		}
+		if s.rejected || !valid || r.PostForm.Get("client_secret") != "secret" {
+			http.Error(w, `{"status":400,"message":"Invalid refresh token"}`, http.StatusBadRequest)
+			return
+		}
+		s.issued++
+		json.NewEncoder(w).Encode(tokenResponse{
+			AccessToken:  fmt.Sprintf("access-%d", s.issued),
+			RefreshToken: fmt.Sprintf("refresh-%d", s.issued),
+			ExpiresIn:    3600,
+			Scope:        s.scopes,
+		})
+	})
+	mux.HandleFunc("GET /validate", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case "OAuth valid":
+			json.NewEncoder(w).Encode(Validation{ClientID: "client", Login: "bot", UserID: "42", ExpiresIn: 3600})
+		case "OAuth other-app":
+			json.NewEncoder(w).Encode(Validation{ClientID: "other", Login: "bot", UserID: "42", ExpiresIn: 3600})
+		default:
+			http.Error(w, `{"status":401,"message":"invalid access token"}`, http.StatusUnauthorized)
+		}
+	})
+	s.server = httptest.NewServer(mux)
+	t.Cleanup(s.server.Close)
+
+	var authURL = AuthURL
+	AuthURL = s.server.URL
+	t.Cleanup(func() { AuthURL = authURL })
+	return s
+}
+
+var testApp = Config{ClientID: "client", ClientSecret: "secret", RedirectURI: "http://localhost:3000", Scopes: []string{"chat:read", "chat:edit"}}
+
+func TestTokenExchange(t *testing.T) {
+	var s = newFakeAuthServer(t)
+	var ctx = context.Background()
+
+	var token, err = testApp.requestToken(ctx, url.Values{
+		"client_id":     {testApp.ClientID},
+		"client_secret": {testApp.ClientSecret},
+		"code":          {"code"},
+		"grant_type":    {"authorization_code"},
+		"redirect_uri":  {testApp.RedirectURI},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "access-1" || token.RefreshToken != "refresh-1" || !slices.Equal(token.Scopes, s.scopes) {
+		t.Errorf("unexpected token %+v", token)
+	}
+	if d := time.Until(token.Expires); d < time.Minute*59 || d > time.Hour {
+		t.Errorf("token expires in %s, expected an hour", d)
+	}
+	if s.forms[0].Get("redirect_uri") != testApp.RedirectURI || s.forms[0].Get("client_id") != "client" {
+		t.Errorf("unexpected token request %v", s.forms[0])
+	}
+
+	if _, err = testApp.requestToken(ctx, url.Values{"client_secret": {"secret"}, "code": {"wrong"}, "grant_type": {"authorization_code"}}); err == nil {
+		t.Error("exchange of invalid code didn't fail")
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	var s = newFakeAuthServer(t)
+	var ctx = context.Background()
+	s.issued = 1
+
+	var token, err = testApp.Refresh(ctx, "refresh-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "access-2" || token.RefreshToken != "refresh-2" {
+		t.Errorf("unexpected token %+v", token)
+	}
+	if _, err = testApp.Refresh(ctx, "refresh-1"); err == nil {
+		t.Error("refresh with used refresh token didn't fail")
+	}
+	if _, err = testApp.Refresh(ctx, ""); err == nil {
+		t.Error("refresh without refresh token didn't fail")
+	}
+	if _, err = (Config{ClientID: "client"}).Refresh(ctx, "refresh-2"); err == nil {
+		t.Error("refresh without client secret didn't fail")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	newFakeAuthServer(t)
+	var ctx = context.Background()
+
+	var validation, err = testApp.Validate(ctx, "valid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if validation.Login != "bot" || validation.UserID != "42" {
+		t.Errorf("unexpected validation %+v", validation)
+	}
+	if _, err = testApp.Validate(ctx, "expired"); err == nil {
+		t.Error("validation of expired token didn't fail")
+	}
+	if _, err = testApp.Validate(ctx, "other-app"); err == nil {
+		t.Error("validation of token of other app didn't fail")
+	}
+}
+
+func TestTokenSource(t *testing.T) {
+	var s = newFakeAuthServer(t)
+	var ctx = context.Background()
+	s.issued = 1
+
+	var refreshed []Token
+	var tokens = NewTokenSource(testApp, Token{AccessToken: "access-1", RefreshToken: "refresh-1", Expires: time.Now().Add(time.Hour)})
+	tokens.OnRefresh = func(token Token) {
+		refreshed = append(refreshed, token)
+	}
+
+	// Valid token is returned without refreshing
+	if token, err := tokens.Token(ctx); err != nil || token != "access-1" || len(s.forms) != 0 {
+		t.Fatalf("Token returned %q, %v after %d requests", token, err, len(s.forms))
+	}
+
+	// Rejected token is refreshed on request
+	if token, err := tokens.Refresh(ctx); err != nil || token != "access-2" {
+		t.Fatalf("Refresh returned %q, %v", token, err)
+	}
+	if len(refreshed) != 1 || refreshed[0].RefreshToken != "refresh-2" || tokens.Current().AccessToken != "access-2" {
+		t.Errorf("OnRefresh got %+v, current token %+v", refreshed, tokens.Current())
+	}
+
+	// Token expiring soon is refreshed
+	tokens.token.Expires = time.Now().Add(refreshBeforeExpiration / 2)
+	if token, err := tokens.Token(ctx); err != nil || token != "access-3" || len(refreshed) != 2 {
+		t.Errorf("Token returned %q, %v after %d refreshes", token, err, len(refreshed))
+	}
+
+	// Failed refresh keeps the current token
+	s.rejected = true
+	tokens.token.Expires = time.Now()
+	if _, err := tokens.Token(ctx); err == nil {
+		t.Error("failed refresh didn't return an error")
+	}
+	if tokens.Current().AccessToken != "access-3" || len(refreshed) != 2 {
+		t.Errorf("failed refresh changed the token to %+v", tokens.Current())
+	}
+}
+
+func TestTokenExpired(t *testing.T) {
+	var now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var tests = []struct {
+		token   Token
+		expired bool
+	}{
+		{Token{}, true},
+		{Token{AccessToken: "a"}, false},
+		{Token{AccessToken: "a", Expires: now.Add(time.Hour)}, false},
+		{Token{AccessToken: "a", Expires: now.Add(refreshBeforeExpiration - time.Second)}, true},
+		{Token{AccessToken: "a", Expires: now.Add(-time.Hour)}, true},
+	}
+	for _, test := range tests {
+		if expired := test.token.Expired(now); expired != test.expired {
+			t.Errorf("%+v: expired %v, expected %v", test.token, expired, test.expired)
+		}
+	}
+}
+
+func TestNewState(t *testing.T) {
+	var seen = make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		var state, err = newState()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(state) != 32 || seen[state] {
+			t.Fatalf("state %q is too short or repeated", state)
+		}
+		seen[state] = true
+	}
+}
@@ -0,0 +1,334 @@
+package overlay
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"twitch_chat_bot/cmd/chat"
+
+	"github.com/gorilla/websocket"
+)
+
+// Chat overlay server for OBS browser sources.
+// The server serves static HTML/JS client (add "http://localhost:8080/" as browser source)
+// and pushes chat messages and events (subs, raids, cheers) as JSON over WebSocket ("/ws").
+// Messages are removed from the overlay when they are deleted (CLEARMSG) or the chatter gets banned / chat gets cleared (CLEARCHAT).
+// Recent messages are kept in history and sent to newly connected clients, so reloading the browser source doesn't lose chat.
+// The client is themed with query parameters, like "/?theme=light&font=24&fade=30&max=20&channel=name".
+// POST request to "/test" from the local machine pushes sample messages and events (curl -X POST localhost:8080/test),
+// overlay also works with chat log replay ("replay" subcommand).
+
+//go:embed www
+var files embed.FS
+
+const defaultHistorySize = 50         // Default amount of messages sent to newly connected clients
+const sendBufferSize = 64             // Amount of payloads waiting for a slow client before it's disconnected
+const writeTimeout = time.Second * 5  // Timeout of writing to WebSocket connection
+const pingInterval = time.Second * 30 // How often WebSocket pings are sent to the clients
+const readTimeout = pingInterval * 2  // Client is disconnected when nothing was received for that long
+
+// Overlay server configuration.
+type Config struct {
+	Channels    []string // Channels shown in the overlay, all of the channels if empty
+	HistorySize int      // Amount of recent messages sent to newly connected clients, 0 means 50
+}
+
+// Part of chat message, plain text or an emote.
+type Fragment struct {
+	Type string `json:"type"`          // "text" or "emote"
+	Text string `json:"text"`          // Text or emote name
+	URL  string `json:"url,omitempty"` // Emote image URL
+}
+
+// JSON payload sent to the clients.
+type Payload struct {
+	Type      string     `json:"type"`                // "message", "event", "delete" or "clear"
+	ID        string     `json:"id,omitempty"`        // Chat message ID (message, delete)
+	Channel   string     `json:"channel"`             // Channel name
+	UserID    int64      `json:"user_id,omitempty"`   // Chatter ID (message, event, clear of chatter messages)
+	UserName  string     `json:"user_name,omitempty"` // Name of the chatter (message, event)
+	Color     string     `json:"color,omitempty"`     // Chatter name color (message)
+	Badge     string     `json:"badge,omitempty"`     // Badge of the chatter: STR, MOD, VIP or SUB (message)
+	Fragments []Fragment `json:"fragments,omitempty"` // Chat message text and emotes (message)
+	Event     string     `json:"event,omitempty"`     // Event name: sub, resub, subgift, raid, cheer, etc. (event)
+	Amount    int        `json:"amount,omitempty"`    // Months, gift count, raid viewers or bits (event)
+	Text      string     `json:"text,omitempty"`      // Message attached to the event (event)
+	Time      time.Time  `json:"time"`                // Time when the message was received
+}
+
+// Chat overlay server.
+type Server struct {
+	config   Config
+	upgrader websocket.Upgrader
+	mutex    sync.Mutex
+	clients  map[*client]struct{}
+	history  []Payload // Recent messages, oldest first
+}
+
+// Connected overlay client.
+type client struct {
+	ws   *websocket.Conn
+	send chan []byte
+}
+
+// Creates new overlay server.
+func New(config Config) *Server {
+	if config.HistorySize <= 0 {
+		config.HistorySize = defaultHistorySize
+	}
+	config.Channels = slices.Clone(config.Channels)
+	for i := range config.Channels {
+		config.Channels[i] = strings.ToLower(strings.TrimPrefix(config.Channels[i], "#"))
+	}
+	return &Server{
+		config:  config,
+		clients: make(map[*client]struct{}),
+	}
+}
+
+// Subscribes to chat bot events and pushes them to the overlay. Returns subscription ID.
+func (s *Server) Attach(c *chat.Client) int {
+	return c.Subscribe(s.handleEvent)
+}
+
+// Converts chat event into overlay payload.
+func (s *Server) handleEvent(event chat.Event) {
+	var p = Payload{Type: "event", Event: event.EventName(), Time: time.Now()}
+	switch e := event.(type) {
+	case *chat.MessageEvent:
+		if e.Message.Command != "PRIVMSG" {
+			return
+		}
+		p = Payload{
+			Type:      "message",
+			ID:        e.Metadata.MessageID,
+			Channel:   e.Channel,
+			UserID:    e.Metadata.UserID,
+			UserName:  e.Metadata.UserName,
+			Color:     e.Metadata.Tags.Color(),
+			Badge:     e.Metadata.Badge,
+			Fragments: convertFragments(e.Metadata.Fragments),
+			Time:      e.Time,
+		}
+		if len(p.UserName) == 0 {
+			p.UserName = e.Message.Prefix.Nick
+		}
+	case *chat.SubEvent:
+		p.Channel, p.UserID, p.UserName, p.Amount, p.Text = e.Channel, e.UserID, e.UserName, e.Months, e.Message
+	case *chat.GiftSubEvent:
+		p.Channel, p.UserID, p.UserName, p.Amount, p.Text = e.Channel, e.UserID, e.UserName, e.Count, e.Message
+	case *chat.RaidEvent:
+		p.Channel, p.UserID, p.UserName, p.Amount = e.Channel, e.UserID, e.UserName, e.Viewers
+	case *chat.CheerEvent:
+		p.Channel, p.UserID, p.UserName, p.Amount, p.Text = e.Channel, e.UserID, e.UserName, e.Bits, e.Message
+	case *chat.MessageDeletedEvent:
+		p = Payload{Type: "delete", ID: e.MessageID, Channel: e.Channel, Time: p.Time}
+	case *chat.BanEvent:
+		p = Payload{Type: "clear", Channel: e.Channel, UserID: e.UserID, Time: p.Time}
+	case *chat.ClearChatEvent:
+		p = Payload{Type: "clear", Channel: e.Channel, Time: p.Time}
+	default:
+		return
+	}
+	s.Broadcast(p)
+}
+
+// Converts chat message fragments into overlay fragments.
+func convertFragments(fragments []chat.Fragment) []Fragment {
+	var result = make([]Fragment, 0, len(fragments))
+	for _, f := range fragments {
+		if f.Type == chat.FragmentEmote && f.Emote != nil {
+			result = append(result, Fragment{Type: "emote", Text: f.Text, URL: f.Emote.URL})
+		} else {
+			result = append(result, Fragment{Type: "text", Text: f.Text})
+		}
+	}
+	return result
+}
+
+// Sends the payload to all of the connected clients and updates message history.
+func (s *Server) Broadcast(p Payload) {
+	if len(s.config.Channels) > 0 && !slices.Contains(s.config.Channels, p.Channel) {
+		return
+	}
+	var data, err = json.Marshal(p)
+	if err != nil {
+		slog.Error("Overlay, error encoding payload", "Type", p.Type, "Err", err)
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	switch p.Type {
+	case "message":
+		s.history = append(s.history, p)
+		if len(s.history) > s.config.HistorySize {
+			s.history = slices.Delete(s.history, 0, len(s.history)-s.config.HistorySize)
+		}
+	case "delete":
+		s.history = slices.DeleteFunc(s.history, func(h Payload) bool { return h.ID == p.ID })
+	case "clear":
+		s.history = slices.DeleteFunc(s.history, func(h Payload) bool {
+			return h.Channel == p.Channel && (p.UserID == 0 || h.UserID == p.UserID)
+		})
+	}
+	for c := range s.clients {
+		select {
+		case c.send <- data:
+		default:
+			slog.Warn("Overlay client is too slow, disconnecting", "Address", c.ws.RemoteAddr())
+			s.removeClient(c)
+		}
+	}
+}
+
+// Removes the client and stops its writer. Should be called with locked mutex.
+func (s *Server) removeClient(c *client) {
+	if _, ok := s.clients[c]; ok {
+		delete(s.clients, c)
+		close(c.send)
+	}
+}
+
+// Returns amount of connected clients.
+func (s *Server) Clients() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.clients)
+}
+
+// Returns HTTP handler serving the overlay client ("/"), WebSocket connection ("/ws") and test messages (POST "/test").
+func (s *Server) Handler() http.Handler {
+	var www, _ = fs.Sub(files, "www")
+	var mux = http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.FS(www)))
+	mux.HandleFunc("/ws", s.handleWebSocket)
+	mux.HandleFunc("/test", s.handleTest)
+	return mux
+}
+
+// Pushes test messages. Only POST requests from the local machine are accepted, overlay viewers can't push messages.
+func (s *Server) handleTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var host, _, err = net.SplitHostPort(r.RemoteAddr)
+	if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	s.SendTestMessages()
+	w.Write([]byte("Test messages sent\n"))
+}
+
+// Starts HTTP server with the overlay in the background.
+func (s *Server) ListenAndServe(address string) *http.Server {
+	var server = &http.Server{Addr: address, Handler: s.Handler()}
+	go func() {
+		slog.Info("Overlay server listening", "Address", "http://"+address)
+		var err = server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			slog.Error("Overlay server error", "Err", err)
+		}
+	}()
+	return server
+}
+
+// Upgrades the request to WebSocket connection, sends message history and then live payloads.
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	var ws, err = s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	slog.Info("Overlay client connected", "Address", ws.RemoteAddr())
+
+	var c = &client{ws: ws, send: make(chan []byte, sendBufferSize+s.config.HistorySize)}
+	s.mutex.Lock()
+	for _, p := range s.history {
+		if data, err := json.Marshal(p); err == nil {
+			c.send <- data
+		}
+	}
+	s.clients[c] = struct{}{}
+	s.mutex.Unlock()
+
+	go s.writeMessages(c)
+	s.readMessages(c)
+
+	s.mutex.Lock()
+	s.removeClient(c)
+	s.mutex.Unlock()
+	slog.Info("Overlay client disconnected", "Address", ws.RemoteAddr())
+}
+
+// Reads messages from the client until the connection is closed. Clients don't send anything except pongs.
+func (s *Server) readMessages(c *client) {
+	c.ws.SetReadDeadline(time.Now().Add(readTimeout))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(readTimeout))
+	})
+	for {
+		if _, _, err := c.ws.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// Writes queued payloads and pings to the client until the send channel is closed.
+func (s *Server) writeMessages(c *client) {
+	var ticker = time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	defer c.ws.Close()
+
+	for {
+		select {
+		case data, ok := <-c.send:
+			if !ok {
+				return
+			}
+			c.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := c.ws.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := c.ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Pushes sample chat messages and events, for testing the overlay without live chat.
+func (s *Server) SendTestMessages() {
+	var channel = "test"
+	if len(s.config.Channels) > 0 {
+		channel = s.config.Channels[0]
+	}
+	var now = time.Now()
+	var messages = []Payload{
+		{Type: "message", ID: "test-1", UserID: 1, UserName: "Viewer", Color: "#1E90FF", Fragments: []Fragment{
+			{Type: "text", Text: "Hello chat! "},
+			{Type: "emote", Text: "Kappa", URL: chat.EmoteSourceTwitch.URL("25")},
+		}},
+		{Type: "message", ID: "test-2", UserID: 2, UserName: "Moderator", Color: "#00FF7F", Badge: "MOD", Fragments: []Fragment{
+			{Type: "text", Text: "Welcome to the stream <b>not bold</b>"},
+		}},
+		{Type: "event", Event: "sub", UserID: 3, UserName: "Subscriber", Amount: 12, Text: "A year already!"},
+		{Type: "event", Event: "raid", UserID: 4, UserName: "Raider", Amount: 42},
+		{Type: "event", Event: "cheer", UserID: 5, UserName: "Cheerer", Amount: 100, Text: "Cheer100 nice"},
+	}
+	for _, p := range messages {
+		p.Channel, p.Time = channel, now
+		s.Broadcast(p)
+	}
+}
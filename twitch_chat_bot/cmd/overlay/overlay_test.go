@@ -0,0 +1,136 @@
+package overlay
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"twitch_chat_bot/cmd/chat"
+
+	"github.com/gorilla/websocket"
+)
+
+// Starts HTTP server with the overlay and returns its address.
+func startServer(t *testing.T, s *Server) string {
+	t.Helper()
+	var server = httptest.NewServer(s.Handler())
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// Connects overlay client to the server.
+func connect(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	var ws, _, err = websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+// Reads next payload sent to the client, fails if nothing is received for a while.
+func read(t *testing.T, ws *websocket.Conn) Payload {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(time.Second * 5))
+	var p Payload
+	if err := ws.ReadJSON(&p); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// Returns chat message payload.
+func message(id, channel string, userID int64) Payload {
+	return Payload{Type: "message", ID: id, Channel: channel, UserID: userID, Fragments: []Fragment{{Type: "text", Text: id}}}
+}
+
+func TestHistory(t *testing.T) {
+	var s = New(Config{HistorySize: 4})
+	s.Broadcast(message("m1", "channel", 1))
+	s.Broadcast(message("m2", "channel", 2))
+	s.Broadcast(message("m3", "other", 1))
+	s.Broadcast(message("m4", "channel", 1))
+	s.Broadcast(message("m5", "channel", 3))
+
+	// Deleted messages and messages of banned chatters or cleared chat are removed from the history
+	s.handleEvent(&chat.MessageDeletedEvent{Channel: "channel", MessageID: "m4"})
+	s.handleEvent(&chat.BanEvent{Channel: "channel", UserID: 2})
+	s.handleEvent(&chat.BanEvent{Channel: "channel", UserID: 1}) // Message of the chatter in other channel is kept
+	var ws = connect(t, startServer(t, s))
+	for _, id := range []string{"m3", "m5"} {
+		if p := read(t, ws); p.ID != id {
+			t.Fatalf("history sent %+v, expected %s", p, id)
+		}
+	}
+
+	// Connected client receives live payloads
+	s.handleEvent(&chat.ClearChatEvent{Channel: "other"})
+	if p := read(t, ws); p.Type != "clear" || p.Channel != "other" || p.UserID != 0 {
+		t.Errorf("unexpected clear payload %+v", p)
+	}
+	s.Broadcast(message("m6", "channel", 1))
+	if p := read(t, ws); p.ID != "m6" || p.Fragments[0].Text != "m6" {
+		t.Errorf("unexpected message payload %+v", p)
+	}
+
+	var reconnected = connect(t, startServer(t, s))
+	for _, id := range []string{"m5", "m6"} {
+		if p := read(t, reconnected); p.ID != id {
+			t.Fatalf("history sent %+v after clear, expected %s", p, id)
+		}
+	}
+}
+
+func TestChannels(t *testing.T) {
+	var channels = []string{"#Channel"}
+	var s = New(Config{Channels: channels})
+	if channels[0] != "#Channel" {
+		t.Errorf("configured channels were changed to %q", channels)
+	}
+	var ws = connect(t, startServer(t, s))
+	for s.Clients() == 0 {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// Payloads of other channels are not sent
+	s.Broadcast(message("other", "other", 1))
+	s.handleEvent(&chat.ClearChatEvent{Channel: "other"})
+	s.handleEvent(&chat.RaidEvent{Channel: "channel", UserID: 5, UserName: "Raider", Viewers: 42})
+	var p = read(t, ws)
+	if p.Type != "event" || p.Event != "raid" || p.UserName != "Raider" || p.Amount != 42 {
+		t.Errorf("unexpected payload %+v", p)
+	}
+}
+
+func TestTestMessages(t *testing.T) {
+	var s = New(Config{Channels: []string{"channel"}})
+	var url = startServer(t, s)
+	if resp, err := http.Get(url + "/test"); err != nil || resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET /test returned %v, %v", resp.Status, err)
+	}
+
+	// Test messages can't be pushed from other machines
+	var request = httptest.NewRequest(http.MethodPost, "/test", nil)
+	request.RemoteAddr = "192.0.2.1:1234"
+	var recorder = httptest.NewRecorder()
+	s.Handler().ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusForbidden || len(s.history) != 0 {
+		t.Errorf("POST /test from other machine returned %d", recorder.Code)
+	}
+
+	var resp, err = http.Post(url+"/test", "", nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /test returned %v, %v", resp.Status, err)
+	}
+	var ws = connect(t, url)
+	if p := read(t, ws); p.ID != "test-1" || p.Channel != "channel" {
+		t.Errorf("unexpected test message %+v", p)
+	}
+	var data, _ = json.Marshal(s.history)
+	if len(s.history) != 2 || !strings.Contains(string(data), "Welcome to the stream") {
+		t.Errorf("unexpected history after test messages %s", data)
+	}
+}
@@ -0,0 +1,185 @@
+// Chat overlay client.
+// Query parameters:
+// - theme - "dark" (default), "light" or "transparent",
+// - font - font size in pixels,
+// - fade - seconds after which messages disappear, 0 (default) keeps them,
+// - max - maximum amount of displayed messages (default 30),
+// - channel - show only messages of the channel,
+// - events - "0" hides events (subs, raids, cheers),
+// - errors - "0" hides connection error message.
+
+let ws; // WebSocket connection
+let conn_err; // Div containing elements that should be displayed on WebSocket connection error
+let content; // Div with chat messages
+let options; // Options read from query parameters
+
+function loaded() {
+  conn_err = document.getElementById("conn_err");
+  content = document.getElementById("content");
+
+  let params = new URLSearchParams(window.location.search);
+  options = {
+    theme: params.get("theme") || "dark",
+    font: parseInt(params.get("font")) || 0,
+    fade: parseFloat(params.get("fade")) || 0,
+    max: parseInt(params.get("max")) || 30,
+    channel: (params.get("channel") || "").toLowerCase().replace(/^#/, ""),
+    events: params.get("events") != "0",
+    errors: params.get("errors") != "0",
+  };
+  document.body.classList.add(options.theme);
+  if (options.font > 0) {
+    document.documentElement.style.setProperty("--font-size", options.font + "px");
+  }
+
+  connect();
+}
+
+function connect() {
+  let protocol = window.location.protocol == "https:" ? "wss://" : "ws://";
+  ws = new WebSocket(protocol + window.location.host + "/ws");
+
+  ws.addEventListener("open", () => {
+    console.log("WebSocket connection established!");
+    conn_err.hidden = true;
+    // Server sends recent messages after connecting
+    content.innerHTML = "";
+  });
+
+  ws.addEventListener("close", () => {
+    console.log("WebSocket connection closed! Reconnecting...");
+    conn_err.hidden = !options.errors;
+    setTimeout(connect, 2000);
+  });
+
+  ws.addEventListener("error", (err) => {
+    console.error("Socket encountered error: ", err.message);
+    ws.close();
+  });
+
+  ws.addEventListener("message", (e) => {
+    parse_message(e.data);
+  });
+}
+
+window.addEventListener("load", loaded);
+
+function parse_message(data) {
+  let msg = JSON.parse(data);
+  if (options.channel.length > 0 && msg.channel != options.channel) {
+    return;
+  }
+
+  switch (msg.type) {
+    case "message":
+      add_element(create_message(msg));
+      break;
+    case "event":
+      if (options.events) {
+        add_element(create_event(msg));
+      }
+      break;
+    case "delete":
+      remove_elements((el) => el.dataset.id == msg.id);
+      break;
+    case "clear":
+      remove_elements((el) => el.dataset.channel == msg.channel &&
+        (!msg.user_id || el.dataset.userId == String(msg.user_id)));
+      break;
+  }
+}
+
+function create_message(msg) {
+  let el = document.createElement("div");
+  el.className = "message";
+  el.dataset.id = msg.id || "";
+  el.dataset.channel = msg.channel;
+  el.dataset.userId = String(msg.user_id || "");
+
+  if (msg.badge) {
+    let badge = document.createElement("span");
+    badge.className = "badge " + msg.badge;
+    badge.textContent = msg.badge;
+    el.appendChild(badge);
+  }
+
+  let name = document.createElement("span");
+  name.className = "name";
+  name.textContent = msg.user_name;
+  if (msg.color) {
+    name.style.color = msg.color;
+  }
+  el.appendChild(name);
+  el.appendChild(document.createTextNode(": "));
+
+  for (let fragment of msg.fragments || []) {
+    if (fragment.type == "emote" && fragment.url) {
+      let img = document.createElement("img");
+      img.className = "emote";
+      img.src = fragment.url;
+      img.alt = fragment.text;
+      img.title = fragment.text;
+      el.appendChild(img);
+    } else {
+      el.appendChild(document.createTextNode(fragment.text));
+    }
+  }
+  return el;
+}
+
+function create_event(msg) {
+  let el = document.createElement("div");
+  el.className = "event";
+  el.dataset.channel = msg.channel;
+  el.dataset.userId = String(msg.user_id || "");
+
+  let text;
+  switch (msg.event) {
+    case "sub":
+      text = msg.user_name + " subscribed!";
+      break;
+    case "resub":
+      text = msg.user_name + " resubscribed for " + msg.amount + " months!";
+      break;
+    case "subgift":
+      text = msg.user_name + " gifted a subscription!";
+      break;
+    case "submysterygift":
+      text = msg.user_name + " gifted " + msg.amount + " subscriptions!";
+      break;
+    case "raid":
+      text = msg.user_name + " raided with " + msg.amount + " viewers!";
+      break;
+    case "cheer":
+      text = msg.user_name + " cheered " + msg.amount + " bits!";
+      break;
+    default:
+      text = msg.user_name + ": " + msg.event;
+  }
+  if (msg.text) {
+    text += " " + msg.text;
+  }
+  el.textContent = text;
+  return el;
+}
+
+function add_element(el) {
+  content.appendChild(el);
+  while (content.childElementCount > options.max) {
+    content.firstElementChild.remove();
+  }
+  if (options.fade > 0) {
+    setTimeout(() => {
+      el.classList.add("hidden");
+      setTimeout(() => el.remove(), 1000);
+    }, options.fade * 1000);
+  }
+}
+
+function remove_elements(predicate) {
+  for (let el of Array.from(content.children)) {
+    if (predicate(el)) {
+      el.remove();
+    }
+  }
+}
@@ -0,0 +1,267 @@
+package rewards
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"twitch_chat_bot/cmd/chat"
+	"twitch_chat_bot/cmd/eventsub"
+	"twitch_chat_bot/cmd/helix"
+)
+
+// Channel points custom reward handlers.
+// Handlers are bound to rewards by reward ID or title. Every reward has it's own queue,
+// so redemptions of the same reward are handled one by one (like TTS messages that shouldn't overlap),
+// while different rewards are handled at the same time.
+// After the handler finishes, the redemption is marked as FULFILLED, or CANCELED when the handler
+// returns an error (channel points are refunded).
+// Redemptions are received from EventSub (preferred) or from chat messages with custom-reward-id tag.
+// Chat messages don't contain redemption ID, so status of redemptions received from chat can't be updated.
+// They don't contain reward title either, rewards registered by title need their IDs set with SetRewardIDs.
+// Only one of the sources should be attached, otherwise redemptions with user input are handled twice.
+// Twitch allows updating status only of rewards created by the same app (client ID).
+
+const defaultQueueSize = 100           // Default maximum amount of redemptions waiting in reward queue
+const defaultTimeout = time.Minute * 5 // Default maximum time of running the handler
+const statusTimeout = time.Second * 10 // Timeout of redemption status update request
+
+var errQueueFull = errors.New("reward queue is full")
+
+// Updates redemption status, implemented by *helix.Client.
+type StatusAPI interface {
+	UpdateRedemptionStatus(ctx context.Context, broadcasterID, rewardID string, redemptionIDs []string, status string) ([]helix.Redemption, error)
+}
+
+// Redemption of custom reward.
+type Redemption struct {
+	ID            string // Redemption ID, empty when received from chat
+	BroadcasterID string // Broadcaster ID
+	Channel       string // Channel name
+	RewardID      string
+	RewardTitle   string // Reward title, empty when received from chat
+	UserID        string // Chatter ID
+	UserName      string // Name of the chatter
+	Input         string // Text provided by the chatter
+	Time          time.Time
+}
+
+// Function handling the redemption. Returning an error cancels the redemption and refunds the points.
+type Handler func(ctx context.Context, r Redemption) error
+
+// Custom reward handler configuration.
+type Reward struct {
+	ID        string        // Reward ID, if empty the reward is matched by title
+	Title     string        // Reward title (case insensitive), used when ID is empty
+	Handler   Handler       // Function called for every redemption
+	Timeout   time.Duration // Maximum time of running the handler, 0 means 5 minutes
+	QueueSize int           // Maximum amount of waiting redemptions, 0 means 100. Redemptions over the limit are canceled
+}
+
+// Registered reward with it's queue.
+type rewardQueue struct {
+	config Reward
+	queue  chan Redemption
+}
+
+// Runs reward handlers and updates redemption status.
+type Manager struct {
+	api     StatusAPI
+	rewards []*rewardQueue
+	ids     map[string]string // Reward IDs, key is lowercase reward title
+	mutex   sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// Creates new reward manager. Twitch API is optional, without it redemption status isn't updated.
+func NewManager(api StatusAPI) *Manager {
+	var ctx, cancel = context.WithCancel(context.Background())
+	return &Manager{api: api, ids: make(map[string]string), ctx: ctx, cancel: cancel}
+}
+
+// Sets IDs of rewards registered by title, key is reward title (case insensitive).
+// Needed for redemptions received from chat, they contain only reward ID.
+func (m *Manager) SetRewardIDs(ids map[string]string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for title, id := range ids {
+		m.ids[strings.ToLower(title)] = id
+	}
+}
+
+// Returns titles of registered rewards without known ID.
+func (m *Manager) unresolved() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var titles []string
+	for _, reward := range m.rewards {
+		if len(reward.config.ID) == 0 && len(m.ids[strings.ToLower(reward.config.Title)]) == 0 {
+			titles = append(titles, reward.config.Title)
+		}
+	}
+	return titles
+}
+
+// Registers reward handler and starts it's queue.
+func (m *Manager) Register(reward Reward) error {
+	if len(reward.ID) == 0 && len(reward.Title) == 0 {
+		return errors.New("reward ID and title are empty")
+	}
+	if reward.Handler == nil {
+		return errors.New("reward handler is nil")
+	}
+	if reward.Timeout <= 0 {
+		reward.Timeout = defaultTimeout
+	}
+	if reward.QueueSize <= 0 {
+		reward.QueueSize = defaultQueueSize
+	}
+
+	var r = &rewardQueue{config: reward, queue: make(chan Redemption, reward.QueueSize)}
+	m.mutex.Lock()
+	m.rewards = append(m.rewards, r)
+	m.mutex.Unlock()
+
+	m.wg.Add(1)
+	go m.runQueue(r)
+	return nil
+}
+
+// Stops reward queues, waiting for running handlers to finish. Redemptions left in the queues are not handled.
+func (m *Manager) Close() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// Starts handling redemptions received from EventSub. Returns subscription ID that can be used to unsubscribe.
+func (m *Manager) AttachEventSub(client *eventsub.Client) int {
+	return client.Subscribe(func(event eventsub.Event) {
+		var e, ok = event.(*eventsub.RedemptionEvent)
+		if !ok {
+			return
+		}
+		m.Redeem(Redemption{
+			ID:            e.ID,
+			BroadcasterID: e.BroadcasterUserID,
+			Channel:       e.BroadcasterUserLogin,
+			RewardID:      e.Reward.ID,
+			RewardTitle:   e.Reward.Title,
+			UserID:        e.UserID,
+			UserName:      e.UserName,
+			Input:         e.UserInput,
+			Time:          e.RedeemedAt,
+		})
+	})
+}
+
+// Starts handling redemptions received from chat messages. Only rewards requiring user input
+// are visible in chat. Returns subscription ID that can be used to unsubscribe.
+// Rewards have to be registered before. Rewards registered by title without ID set with SetRewardIDs
+// are logged and skipped, chat redemptions contain only reward ID.
+func (m *Manager) AttachChat(client *chat.Client) int {
+	if titles := m.unresolved(); len(titles) > 0 {
+		slog.Warn("Rewards are skipped, their IDs are unknown and chat redemptions contain only reward ID", "Rewards", titles)
+	}
+	return client.Subscribe(func(event chat.Event) {
+		var e, ok = event.(*chat.MessageEvent)
+		if !ok || e.Message.Command != "PRIVMSG" || len(e.Metadata.CustomRewardID) == 0 {
+			return
+		}
+		m.Redeem(Redemption{
+			BroadcasterID: e.Metadata.Tags["room-id"],
+			Channel:       e.Channel,
+			RewardID:      e.Metadata.CustomRewardID,
+			UserID:        strconv.FormatInt(e.Metadata.UserID, 10),
+			UserName:      e.Metadata.UserName,
+			Input:         e.Message.Trailing,
+			Time:          e.Time,
+		})
+	})
+}
+
+// Adds the redemption to queue of matching reward. Returns false if no reward matches.
+func (m *Manager) Redeem(r Redemption) bool {
+	var reward = m.find(r)
+	if reward == nil {
+		return false
+	}
+	select {
+	case reward.queue <- r:
+	default:
+		slog.Warn("Reward queue is full, canceling redemption", "Reward", r.RewardTitle, "User", r.UserName)
+		go m.updateStatus(r, errQueueFull)
+	}
+	return true
+}
+
+// Returns reward matching the redemption by ID or title. Rewards registered by title are also matched
+// by ID set with SetRewardIDs.
+func (m *Manager) find(r Redemption) *rewardQueue {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, reward := range m.rewards {
+		var id = reward.config.ID
+		if len(id) == 0 {
+			if len(r.RewardTitle) > 0 && strings.EqualFold(reward.config.Title, r.RewardTitle) {
+				return reward
+			}
+			id = m.ids[strings.ToLower(reward.config.Title)]
+		}
+		if len(id) > 0 && id == r.RewardID {
+			return reward
+		}
+	}
+	return nil
+}
+
+// Handles redemptions of the reward one by one until the manager is closed.
+func (m *Manager) runQueue(reward *rewardQueue) {
+	defer m.wg.Done()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case r := <-reward.queue:
+			var err = m.runHandler(reward.config, r)
+			if err != nil {
+				slog.Error("Reward handler error", "Reward", r.RewardTitle, "User", r.UserName, "Err", err)
+			}
+			m.updateStatus(r, err)
+		}
+	}
+}
+
+// Runs the handler with timeout, recovering from panic.
+func (m *Manager) runHandler(reward Reward, r Redemption) (err error) {
+	var ctx, cancel = context.WithTimeout(m.ctx, reward.Timeout)
+	defer cancel()
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("reward handler panicked: %v", p)
+		}
+	}()
+	return reward.Handler(ctx, r)
+}
+
+// Marks the redemption as fulfilled, or canceled if the handler failed.
+func (m *Manager) updateStatus(r Redemption, handlerErr error) {
+	if m.api == nil || len(r.ID) == 0 {
+		return // Status can't be updated
+	}
+	var status = helix.RedemptionFulfilled
+	if handlerErr != nil {
+		status = helix.RedemptionCanceled
+	}
+	var ctx, cancel = context.WithTimeout(context.Background(), statusTimeout)
+	defer cancel()
+	var _, err = m.api.UpdateRedemptionStatus(ctx, r.BroadcasterID, r.RewardID, []string{r.ID}, status)
+	if err != nil {
+		slog.Error("Reward redemption status update error", "Reward", r.RewardTitle, "Status", status, "Err", err)
+	}
+}
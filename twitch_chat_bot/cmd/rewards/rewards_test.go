@@ -0,0 +1,204 @@
+package rewards
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+	"twitch_chat_bot/cmd/chat"
+	"twitch_chat_bot/cmd/chat/chattest"
+	"twitch_chat_bot/cmd/helix"
+)
+
+// Status API recording status updates.
+type fakeStatusAPI struct {
+	mutex   sync.Mutex
+	updates []string
+	updated chan struct{} // Signaled with every update
+}
+
+func newFakeStatusAPI() *fakeStatusAPI {
+	return &fakeStatusAPI{updated: make(chan struct{}, 100)}
+}
+
+func (a *fakeStatusAPI) UpdateRedemptionStatus(ctx context.Context, broadcasterID, rewardID string, redemptionIDs []string, status string) ([]helix.Redemption, error) {
+	a.mutex.Lock()
+	a.updates = append(a.updates, fmt.Sprintf("%s %s %v %s", broadcasterID, rewardID, redemptionIDs, status))
+	a.mutex.Unlock()
+	a.updated <- struct{}{}
+	return nil, nil
+}
+
+// Waits for status updates and returns all of them.
+func (a *fakeStatusAPI) wait(t *testing.T, count int) []string {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		select {
+		case <-a.updated:
+		case <-time.After(time.Second * 5):
+			t.Fatalf("received %d status updates, expected %d", i, count)
+		}
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return slices.Clone(a.updates)
+}
+
+// Registers reward sending handled redemptions to the channel.
+func registerRecorder(t *testing.T, m *Manager, reward Reward, err error) chan Redemption {
+	t.Helper()
+	var handled = make(chan Redemption, 10)
+	reward.Handler = func(ctx context.Context, r Redemption) error {
+		handled <- r
+		return err
+	}
+	if err := m.Register(reward); err != nil {
+		t.Fatal(err)
+	}
+	return handled
+}
+
+// Waits for redemption handled by the reward.
+func waitHandled(t *testing.T, handled chan Redemption) Redemption {
+	t.Helper()
+	select {
+	case r := <-handled:
+		return r
+	case <-time.After(time.Second * 5):
+		t.Fatal("redemption wasn't handled")
+		return Redemption{}
+	}
+}
+
+func TestManagerStatus(t *testing.T) {
+	var api = newFakeStatusAPI()
+	var m = NewManager(api)
+	defer m.Close()
+	var hydrate = registerRecorder(t, m, Reward{Title: "Hydrate"}, nil)
+	var failing = registerRecorder(t, m, Reward{ID: "failing-id"}, errors.New("handler failed"))
+
+	// Matched by title (case insensitive) and fulfilled
+	if !m.Redeem(Redemption{ID: "r1", BroadcasterID: "1", RewardID: "hydrate-id", RewardTitle: "HYDRATE"}) {
+		t.Fatal("reward wasn't matched by title")
+	}
+	waitHandled(t, hydrate)
+	if updates := api.wait(t, 1); updates[0] != "1 hydrate-id [r1] FULFILLED" {
+		t.Errorf("status update %q", updates[0])
+	}
+
+	// Failed handler cancels the redemption
+	if !m.Redeem(Redemption{ID: "r2", BroadcasterID: "1", RewardID: "failing-id", RewardTitle: "Failing"}) {
+		t.Fatal("reward wasn't matched by ID")
+	}
+	waitHandled(t, failing)
+	if updates := api.wait(t, 1); updates[1] != "1 failing-id [r2] CANCELED" {
+		t.Errorf("status update %q", updates[1])
+	}
+
+	if m.Redeem(Redemption{ID: "r3", RewardID: "other-id", RewardTitle: "Other"}) {
+		t.Error("unknown reward was matched")
+	}
+}
+
+func TestManagerPanicAndTimeout(t *testing.T) {
+	var api = newFakeStatusAPI()
+	var m = NewManager(api)
+	defer m.Close()
+	m.Register(Reward{ID: "panic", Handler: func(ctx context.Context, r Redemption) error { panic("oops") }})
+	m.Register(Reward{ID: "slow", Timeout: time.Millisecond * 10, Handler: func(ctx context.Context, r Redemption) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+
+	m.Redeem(Redemption{ID: "r1", RewardID: "panic"})
+	m.Redeem(Redemption{ID: "r2", RewardID: "slow"})
+	var updates = api.wait(t, 2)
+	slices.Sort(updates)
+	if !slices.Equal(updates, []string{" panic [r1] CANCELED", " slow [r2] CANCELED"}) {
+		t.Errorf("status updates %q", updates)
+	}
+}
+
+func TestManagerQueueFull(t *testing.T) {
+	var api = newFakeStatusAPI()
+	var m = NewManager(api)
+	defer m.Close()
+	var release = make(chan struct{})
+	var started = make(chan struct{}, 1)
+	m.Register(Reward{ID: "tts", QueueSize: 1, Handler: func(ctx context.Context, r Redemption) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}})
+
+	// First redemption is running, second one waits in the queue, third one doesn't fit
+	m.Redeem(Redemption{ID: "r1", RewardID: "tts"})
+	<-started
+	m.Redeem(Redemption{ID: "r2", RewardID: "tts"})
+	m.Redeem(Redemption{ID: "r3", RewardID: "tts"})
+	if updates := api.wait(t, 1); updates[0] != " tts [r3] CANCELED" {
+		t.Errorf("status update %q, expected canceled redemption over the limit", updates[0])
+	}
+	close(release)
+	var updates = api.wait(t, 2)
+	if !slices.Equal(updates[1:], []string{" tts [r1] FULFILLED", " tts [r2] FULFILLED"}) {
+		t.Errorf("status updates %q", updates)
+	}
+}
+
+func TestManagerRegisterErrors(t *testing.T) {
+	var m = NewManager(nil)
+	defer m.Close()
+	if err := m.Register(Reward{Handler: func(ctx context.Context, r Redemption) error { return nil }}); err == nil {
+		t.Error("reward without ID and title was registered")
+	}
+	if err := m.Register(Reward{ID: "id"}); err == nil {
+		t.Error("reward without handler was registered")
+	}
+}
+
+func TestManagerAttachChat(t *testing.T) {
+	var server = chattest.NewServer(chattest.Config{})
+	defer server.Close()
+	var client = chat.NewClient(server.ClientConfig("bot", "channel"))
+
+	var m = NewManager(nil)
+	defer m.Close()
+	var tts = registerRecorder(t, m, Reward{Title: "TTS"}, nil)
+	var hydrate = registerRecorder(t, m, Reward{ID: "hydrate-id"}, nil)
+
+	// Chat redemptions don't contain reward title, rewards registered by title need their IDs
+	m.AttachChat(client)
+	if titles := m.unresolved(); len(titles) != 1 || titles[0] != "TTS" {
+		t.Fatalf("unresolved rewards %q", titles)
+	}
+	m.SetRewardIDs(map[string]string{"tts": "tts-id"})
+	if titles := m.unresolved(); len(titles) != 0 {
+		t.Errorf("unresolved rewards %q after setting IDs", titles)
+	}
+
+	client.Start()
+	defer client.Stop()
+	var ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := server.WaitJoined(ctx, "channel"); err != nil {
+		t.Fatal(err)
+	}
+	server.PrivMsg("channel", "Viewer", "read this please", chat.Tags{"custom-reward-id": "tts-id"})
+	server.PrivMsg("channel", "Viewer", "not a redemption", nil)
+	server.PrivMsg("channel", "Other", "water", chat.Tags{"custom-reward-id": "hydrate-id"})
+
+	var r = waitHandled(t, tts)
+	if r.RewardID != "tts-id" || r.UserName != "Viewer" || r.Input != "read this please" || r.Channel != "channel" || len(r.BroadcasterID) == 0 {
+		t.Errorf("unexpected redemption %+v", r)
+	}
+	if r = waitHandled(t, hydrate); r.UserName != "Other" {
+		t.Errorf("unexpected redemption %+v", r)
+	}
+	if len(tts) != 0 {
+		t.Error("chat message without reward ID was handled")
+	}
+}
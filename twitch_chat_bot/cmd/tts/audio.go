@@ -0,0 +1,73 @@
+package tts
+
+import (
+	"sync"
+
+	"github.com/gopxl/beep"
+)
+
+// Audio playback.
+// Output plays one Queue streamer for the whole time, TTS messages are added to the queue.
+// When the queue is empty, silence is streamed.
+
+// Output audio format, every TTS message is resampled to that format.
+var Format = beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+
+// Audio output, like the speaker.
+type Output interface {
+	Play(s beep.Streamer) // Starts playing the streamer, shouldn't block
+}
+
+// Queue of streamers played one after another.
+type Queue struct {
+	q     []beep.Streamer
+	mutex sync.Mutex
+}
+
+// Adds the streamer at the end of the queue.
+func (q *Queue) Add(s beep.Streamer) {
+	q.mutex.Lock()
+	q.q = append(q.q, s)
+	q.mutex.Unlock()
+}
+
+// Removes all of the streamers, stopping currently played one.
+func (q *Queue) Clear() {
+	q.mutex.Lock()
+	q.q = q.q[:0]
+	q.mutex.Unlock()
+}
+
+func (q *Queue) Err() error {
+	return nil
+}
+
+func (q *Queue) Stream(samples [][2]float64) (n int, ok bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	// We use the filled variable to track how many samples we've
+	// successfully filled already. We loop until all samples are filled.
+	filled := 0
+	for filled < len(samples) {
+		// There are no streamers in the queue, so we stream silence.
+		if len(q.q) == 0 {
+			for i := range samples[filled:] {
+				samples[filled+i][0] = 0
+				samples[filled+i][1] = 0
+			}
+			break
+		}
+
+		// We stream from the first streamer in the queue.
+		n, ok := q.q[0].Stream(samples[filled:])
+		// If it's drained, we pop it from the queue, thus continuing with
+		// the next streamer.
+		if !ok {
+			q.q = q.q[1:]
+		}
+		// We update the number of filled samples.
+		filled += n
+	}
+	return len(samples), true
+}
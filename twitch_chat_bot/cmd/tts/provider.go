@@ -0,0 +1,51 @@
+package tts
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Text to speech providers.
+
+// Converts text to speech audio.
+type Provider interface {
+	Speak(ctx context.Context, text, voice string) (data []byte, err error) // Returns MP3 audio data
+}
+
+// Text to speech provider using StreamElements API.
+type StreamElements struct {
+	BaseURL    string       // API address, "https://api.streamelements.com/kappa/v2/speech" if empty (can be changed for tests)
+	HTTPClient *http.Client // HTTP client, http.DefaultClient if nil
+}
+
+func (p *StreamElements) Speak(ctx context.Context, text, voice string) ([]byte, error) {
+	var baseURL = p.BaseURL
+	if len(baseURL) == 0 {
+		baseURL = "https://api.streamelements.com/kappa/v2/speech"
+	}
+	var client = p.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var req, err = http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s?voice=%s&text=%s", baseURL, url.QueryEscape(voice), url.QueryEscape(text)), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tts request didn't succeed: %s", resp.Status)
+	}
+	if resp.Header.Get("Content-Type") != "audio/mp3" && resp.Header.Get("Content-Type") != "audio/mpeg" {
+		return nil, fmt.Errorf("tts response didn't contain mp3 data")
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,27 @@
+//go:build speaker
+
+package tts
+
+import (
+	"time"
+
+	"github.com/gopxl/beep"
+	"github.com/gopxl/beep/speaker"
+)
+
+// Speaker output, on Linux it requires ALSA development files (libasound2-dev) to build.
+
+type speakerOutput struct{}
+
+// Initializes the speaker and returns it as audio output.
+func NewSpeakerOutput() (Output, error) {
+	var err = speaker.Init(Format.SampleRate, Format.SampleRate.N(time.Second/10))
+	if err != nil {
+		return nil, err
+	}
+	return speakerOutput{}, nil
+}
+
+func (speakerOutput) Play(s beep.Streamer) {
+	speaker.Play(s)
+}
@@ -0,0 +1,13 @@
+//go:build !speaker
+
+package tts
+
+import "errors"
+
+// Speaker output is built only with "speaker" build tag (go build -tags speaker ./...),
+// because on Linux it requires ALSA development files (libasound2-dev).
+
+// Returns an error, the chat bot was built without speaker support.
+func NewSpeakerOutput() (Output, error) {
+	return nil, errors.New("built without speaker support, build with -tags speaker")
+}
@@ -0,0 +1,393 @@
+package tts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"twitch_chat_bot/cmd/chat"
+	"twitch_chat_bot/cmd/rewards"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gopxl/beep"
+	"github.com/gopxl/beep/mp3"
+)
+
+// Text to speech queue.
+// TTS messages are requested with chat command (!tts hello or !tts Brian: hello to use different voice)
+// or with channel points reward. Messages are checked (maximum length, banned words) and queued,
+// then they are converted to speech by the provider and played one after another.
+// Moderators can skip currently played message (!ttsskip) or clear the whole queue (!ttsclear).
+
+const defaultMaxLength = 300          // Default maximum length of TTS message in characters
+const defaultQueueSize = 50           // Default maximum amount of waiting TTS messages
+const speakTimeout = time.Second * 15 // Timeout of TTS provider request
+const resampleQuality = 4             // Quality of resampling TTS audio to output format
+
+var ErrEmpty = errors.New("tts message is empty")
+var ErrTooLong = errors.New("tts message is too long")
+var ErrBannedWord = errors.New("tts message contains banned word")
+var ErrQueueFull = errors.New("tts queue is full")
+var ErrSkipped = errors.New("tts message was skipped")
+var ErrClosed = errors.New("tts queue was closed")
+
+// TTS configuration.
+type Config struct {
+	Provider    Provider // Converts text to speech
+	Output      Output   // Plays the speech
+	Voices      []string // Available voices, the first one is the default voice
+	MaxLength   int      // Maximum length of TTS message in characters, 0 means 300
+	BannedWords []string // Messages containing any of the words are rejected (case insensitive)
+	QueueSize   int      // Maximum amount of waiting messages, 0 means 50
+}
+
+// TTS message request.
+type Request struct {
+	Text     string // Message to read
+	Voice    string // Voice name, default voice if empty
+	UserName string // Chatter that requested the message
+
+	// Called once with the result of the message: nil when it was played, ErrSkipped when it was
+	// skipped or cleared, ErrClosed when the queue was closed, or the error of the provider. Optional.
+	Done func(err error)
+
+	id uint64 // Request ID assigned when it's queued
+}
+
+// Reports the result of the request.
+func (r Request) finish(err error) {
+	if r.Done != nil {
+		r.Done(err)
+	}
+}
+
+// Text to speech queue.
+type TTS struct {
+	config   Config
+	requests []Request
+	nextID   uint64
+	playing  uint64 // ID of currently played request, 0 if nothing is played
+	mutex    sync.Mutex
+	notify   chan struct{} // Signaled when new request is added
+	skip     chan uint64   // Signaled with request ID to skip it if it's played, 0 skips any message
+	player   *Queue
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// Creates new TTS queue and starts playing queued messages.
+func New(config Config) (*TTS, error) {
+	if config.Provider == nil || config.Output == nil {
+		return nil, errors.New("tts provider or output is nil")
+	}
+	if len(config.Voices) == 0 {
+		return nil, errors.New("no tts voices configured")
+	}
+	if config.MaxLength <= 0 {
+		config.MaxLength = defaultMaxLength
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaultQueueSize
+	}
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	var t = &TTS{
+		config: config,
+		notify: make(chan struct{}, 1),
+		skip:   make(chan uint64, 1),
+		player: &Queue{},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	config.Output.Play(t.player)
+	go t.run(ctx)
+	return t, nil
+}
+
+// Stops playing TTS messages, waiting messages fail with ErrClosed.
+func (t *TTS) Close() {
+	t.cancel()
+	<-t.done
+	t.player.Clear()
+
+	t.mutex.Lock()
+	var dropped = t.requests
+	t.requests = nil
+	t.mutex.Unlock()
+	for _, r := range dropped {
+		r.finish(ErrClosed)
+	}
+}
+
+// Checks the request and adds it to the queue.
+func (t *TTS) Add(r Request) error {
+	var _, err = t.add(r)
+	return err
+}
+
+// Checks the request and adds it to the queue. Returns ID of the queued request.
+func (t *TTS) add(r Request) (uint64, error) {
+	r.Text = chat.SanitizeMessage(r.Text)
+	if len(r.Text) == 0 {
+		return 0, ErrEmpty
+	}
+	if utf8.RuneCountInString(r.Text) > t.config.MaxLength {
+		return 0, ErrTooLong
+	}
+	if t.containsBannedWord(r.Text) {
+		return 0, ErrBannedWord
+	}
+	if len(r.Voice) == 0 {
+		r.Voice = t.config.Voices[0]
+	}
+
+	t.mutex.Lock()
+	if len(t.requests) >= t.config.QueueSize {
+		t.mutex.Unlock()
+		return 0, ErrQueueFull
+	}
+	t.nextID++
+	r.id = t.nextID
+	t.requests = append(t.requests, r)
+	t.mutex.Unlock()
+
+	select {
+	case t.notify <- struct{}{}:
+	default:
+	}
+	return r.id, nil
+}
+
+// Removes the request from the queue, or skips it if it's played. Removed request fails with ErrSkipped.
+func (t *TTS) remove(id uint64) {
+	t.mutex.Lock()
+	var i = slices.IndexFunc(t.requests, func(r Request) bool { return r.id == id })
+	if i < 0 {
+		var playing = t.playing == id
+		t.mutex.Unlock()
+		if playing {
+			t.skipRequest(id)
+		}
+		return
+	}
+	var r = t.requests[i]
+	t.requests = slices.Delete(t.requests, i, i+1)
+	t.mutex.Unlock()
+	r.finish(ErrSkipped)
+}
+
+// Splits "Voice: text" into the voice and the text. If the text doesn't start with available voice name,
+// returns empty voice and whole text.
+func (t *TTS) ParseVoice(text string) (voice string, msg string) {
+	var name, rest, found = strings.Cut(text, ":")
+	if !found {
+		return "", text
+	}
+	name = strings.TrimSpace(name)
+	for _, v := range t.config.Voices {
+		if strings.EqualFold(v, name) {
+			return v, strings.TrimSpace(rest)
+		}
+	}
+	return "", text
+}
+
+// Skips currently played message.
+func (t *TTS) Skip() {
+	t.skipRequest(0)
+}
+
+// Skips the request if it's played, 0 skips any message.
+func (t *TTS) skipRequest(id uint64) {
+	select {
+	case t.skip <- id:
+	default:
+		// Waiting skip of another request is replaced, that request could be already played.
+		// Skip of any message is kept, it skips this request too.
+		select {
+		case old := <-t.skip:
+			if old == 0 {
+				id = 0
+			}
+		default:
+		}
+		select {
+		case t.skip <- id:
+		default:
+		}
+	}
+}
+
+// Removes all waiting messages and skips currently played one. Removed messages fail with ErrSkipped.
+func (t *TTS) Clear() {
+	t.mutex.Lock()
+	var dropped = t.requests
+	t.requests = nil
+	t.mutex.Unlock()
+	t.Skip()
+	for _, r := range dropped {
+		r.finish(ErrSkipped)
+	}
+}
+
+// Returns amount of waiting messages.
+func (t *TTS) Pending() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return len(t.requests)
+}
+
+// Returns true if the text contains any of banned words.
+func (t *TTS) containsBannedWord(text string) bool {
+	if len(t.config.BannedWords) == 0 {
+		return false
+	}
+	var words = strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, banned := range t.config.BannedWords {
+		if slices.Contains(words, strings.ToLower(banned)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Plays queued messages one by one until the context is canceled.
+func (t *TTS) run(ctx context.Context) {
+	defer close(t.done)
+	for {
+		t.mutex.Lock()
+		var r Request
+		var ok = len(t.requests) > 0
+		if ok {
+			r = t.requests[0]
+			t.requests = t.requests[1:]
+			t.playing = r.id
+		}
+		t.mutex.Unlock()
+
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.notify:
+			}
+			continue
+		}
+
+		// Skip requested before this message started doesn't apply to it
+		select {
+		case <-t.skip:
+		default:
+		}
+		var err = t.play(ctx, r)
+		t.mutex.Lock()
+		t.playing = 0
+		t.mutex.Unlock()
+		if ctx.Err() != nil {
+			err = ErrClosed
+		}
+		if err != nil && !errors.Is(err, ErrSkipped) && !errors.Is(err, ErrClosed) {
+			slog.Error("TTS error", "User", r.UserName, "Voice", r.Voice, "Err", err)
+		}
+		r.finish(err)
+		if errors.Is(err, ErrClosed) {
+			return
+		}
+	}
+}
+
+// Converts the request to speech and plays it, waiting until it's finished or skipped.
+// Returns ErrSkipped if the message was skipped.
+func (t *TTS) play(ctx context.Context, r Request) error {
+	var speakCtx, cancel = context.WithTimeout(ctx, speakTimeout)
+	var data, err = t.config.Provider.Speak(speakCtx, r.Text, r.Voice)
+	cancel()
+	if err != nil {
+		return err
+	}
+	stream, format, err := mp3.Decode(io.NopCloser(bytes.NewReader(data)))
+	if err != nil {
+		return fmt.Errorf("decoding tts data failed: %w", err)
+	}
+	defer stream.Close()
+
+	slog.Info("TTS playing", "User", r.UserName, "Voice", r.Voice, "Text", r.Text)
+	var finished = make(chan struct{})
+	t.player.Add(beep.Seq(
+		beep.Resample(resampleQuality, format.SampleRate, Format.SampleRate, stream),
+		beep.Callback(func() { close(finished) }),
+	))
+	for {
+		select {
+		case <-finished:
+			return nil
+		case id := <-t.skip:
+			if id != 0 && id != r.id {
+				continue // Skip of another request
+			}
+			slog.Info("TTS message skipped", "User", r.UserName)
+			t.player.Clear()
+			return ErrSkipped
+		case <-ctx.Done():
+			t.player.Clear()
+			return ErrClosed
+		}
+	}
+}
+
+// Registers TTS chat commands: !tts [voice:] <text>, !ttsskip and !ttsclear (moderators only).
+func (t *TTS) RegisterCommands(client *chat.Client) error {
+	return errors.Join(
+		client.RegisterCommand(chat.Command{
+			Name:         "tts",
+			UserCooldown: time.Second * 30,
+			Handler: func(ctx *chat.CommandContext) {
+				var voice, text = t.ParseVoice(strings.Join(ctx.Args, " "))
+				var err = t.Add(Request{Text: text, Voice: voice, UserName: ctx.Metadata.UserName})
+				if err != nil {
+					ctx.Reply(fmt.Sprintf("Can't read that: %s.", err.Error()))
+				}
+			},
+		}),
+		client.RegisterCommand(chat.Command{
+			Name:       "ttsskip",
+			Permission: chat.PermissionModerator,
+			Handler:    func(ctx *chat.CommandContext) { t.Skip() },
+		}),
+		client.RegisterCommand(chat.Command{
+			Name:       "ttsclear",
+			Permission: chat.PermissionModerator,
+			Handler:    func(ctx *chat.CommandContext) { t.Clear() },
+		}),
+	)
+}
+
+// Returns reward handler that reads user input of the redemption and waits until it's played.
+// Messages that are rejected, skipped or fail to play are refunded. If the handler context ends first,
+// the message is removed from the queue (or skipped), so a refunded message isn't read.
+func (t *TTS) RewardHandler() rewards.Handler {
+	return func(ctx context.Context, r rewards.Redemption) error {
+		var voice, text = t.ParseVoice(r.Input)
+		var done = make(chan error, 1)
+		var id, err = t.add(Request{Text: text, Voice: voice, UserName: r.UserName, Done: func(err error) { done <- err }})
+		if err != nil {
+			return err
+		}
+		select {
+		case err = <-done:
+			return err
+		case <-ctx.Done():
+			t.remove(id)
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package tts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"twitch_chat_bot/cmd/rewards"
+
+	"github.com/gopxl/beep"
+)
+
+// Returns MP3 data of silent frames (MPEG-1 Layer III, 128 kbps, 44.1 kHz, mono), every frame is 26 ms long.
+func silence(frames int) []byte {
+	var frame = make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0xC4})
+	return bytes.Repeat(frame, frames)
+}
+
+// Provider returning audio or errors by the text of the message.
+type fakeProvider struct {
+	speaking chan string   // Receives texts of requests
+	release  chan struct{} // Closed to finish requests of "wait" text
+}
+
+func newFakeProvider() *fakeProvider {
+	return &fakeProvider{speaking: make(chan string, 100), release: make(chan struct{})}
+}
+
+func (p *fakeProvider) Speak(ctx context.Context, text, voice string) ([]byte, error) {
+	p.speaking <- text
+	switch text {
+	case "wait":
+		select {
+		case <-p.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	case "fail":
+		return nil, errors.New("provider failed")
+	case "invalid":
+		return []byte("not mp3"), nil
+	case "long":
+		return silence(10000), nil // Played for about 10 seconds by fakeOutput
+	}
+	return silence(10), nil
+}
+
+// Returns true if the provider received a request that wasn't waited for.
+func (p *fakeProvider) received() bool {
+	return len(p.speaking) > 0
+}
+
+// Waits until the provider receives the request.
+func (p *fakeProvider) wait(t *testing.T, text string) {
+	t.Helper()
+	select {
+	case received := <-p.speaking:
+		if received != text {
+			t.Fatalf("provider received %q, expected %q", received, text)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("provider didn't receive %q", text)
+	}
+}
+
+// Output streaming played audio faster than real time.
+type fakeOutput struct {
+	stop chan struct{}
+}
+
+func (o *fakeOutput) Play(s beep.Streamer) {
+	go func() {
+		var samples = make([][2]float64, 1024)
+		for {
+			select {
+			case <-o.stop:
+				return
+			case <-time.After(time.Millisecond):
+				s.Stream(samples)
+			}
+		}
+	}()
+}
+
+func newTestTTS(t *testing.T, config Config) (*TTS, *fakeProvider) {
+	t.Helper()
+	var provider = newFakeProvider()
+	var output = &fakeOutput{stop: make(chan struct{})}
+	config.Provider = provider
+	config.Output = output
+	config.Voices = []string{"Brian", "Amy"}
+	var tts, err = New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		tts.Close()
+		close(output.stop)
+	})
+	return tts, provider
+}
+
+// Adds the request and returns channel receiving its result.
+func add(t *testing.T, tts *TTS, text string) chan error {
+	t.Helper()
+	var done = make(chan error, 1)
+	if err := tts.Add(Request{Text: text, Done: func(err error) { done <- err }}); err != nil {
+		t.Fatalf("adding %q failed: %v", text, err)
+	}
+	return done
+}
+
+// Waits for the result of the request.
+func result(t *testing.T, done chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(time.Second * 5):
+		t.Fatal("request didn't finish")
+		return nil
+	}
+}
+
+func TestAdd(t *testing.T) {
+	var tts, provider = newTestTTS(t, Config{MaxLength: 10, QueueSize: 1, BannedWords: []string{"Bad"}})
+	var tests = []struct {
+		text string
+		err  error
+	}{
+		{"  \x01 ", ErrEmpty},
+		{"very long message", ErrTooLong},
+		{"it's BAD!", ErrBannedWord},
+		{"badge", nil},
+	}
+	for _, test := range tests {
+		if err := tts.Add(Request{Text: test.text}); !errors.Is(err, test.err) {
+			t.Errorf("Add(%q) returned %v, expected %v", test.text, err, test.err)
+		}
+	}
+	provider.wait(t, "badge")
+
+	// First message is being converted, second one waits, third one doesn't fit
+	add(t, tts, "wait")
+	provider.wait(t, "wait")
+	add(t, tts, "queued")
+	if err := tts.Add(Request{Text: "full"}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Add over the queue size returned %v", err)
+	}
+}
+
+func TestRequestResult(t *testing.T) {
+	var tts, provider = newTestTTS(t, Config{})
+	close(provider.release)
+	var tests = []struct {
+		text string
+		err  bool
+	}{
+		{"hello", false},
+		{"fail", true},
+		{"invalid", true},
+	}
+	for _, test := range tests {
+		if err := result(t, add(t, tts, test.text)); (err != nil) != test.err {
+			t.Errorf("%q finished with %v", test.text, err)
+		}
+	}
+
+	// Skipped message and messages removed from the queue fail with ErrSkipped
+	var long = add(t, tts, "long")
+	var queued = add(t, tts, "queued")
+	provider.wait(t, "hello")
+	provider.wait(t, "fail")
+	provider.wait(t, "invalid")
+	provider.wait(t, "long")
+	tts.Clear()
+	if err := result(t, queued); !errors.Is(err, ErrSkipped) {
+		t.Errorf("cleared message finished with %v", err)
+	}
+	if err := result(t, long); !errors.Is(err, ErrSkipped) {
+		t.Errorf("skipped message finished with %v", err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	var tts, provider = newTestTTS(t, Config{})
+	var waiting = add(t, tts, "wait")
+	provider.wait(t, "wait")
+	var queued = add(t, tts, "queued")
+
+	tts.Close()
+	if err := result(t, waiting); !errors.Is(err, ErrClosed) {
+		t.Errorf("played message finished with %v", err)
+	}
+	if err := result(t, queued); !errors.Is(err, ErrClosed) {
+		t.Errorf("waiting message finished with %v", err)
+	}
+}
+
+func TestRewardHandler(t *testing.T) {
+	var tts, provider = newTestTTS(t, Config{})
+	close(provider.release)
+	var handler = tts.RewardHandler()
+	var ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	// Redemption is fulfilled after the message is played, failures are refunded
+	if err := handler(ctx, rewards.Redemption{Input: "amy: hello", UserName: "Viewer"}); err != nil {
+		t.Errorf("played message returned %v", err)
+	}
+	if err := handler(ctx, rewards.Redemption{Input: "fail"}); err == nil {
+		t.Error("failed message didn't return an error")
+	}
+	if err := handler(ctx, rewards.Redemption{Input: strings.Repeat("a", 301)}); !errors.Is(err, ErrTooLong) {
+		t.Errorf("too long message returned %v", err)
+	}
+
+	var skipped = make(chan error, 1)
+	go func() { skipped <- handler(ctx, rewards.Redemption{Input: "long"}) }()
+	provider.wait(t, "hello")
+	provider.wait(t, "fail")
+	provider.wait(t, "long")
+	tts.Skip()
+	if err := result(t, skipped); !errors.Is(err, ErrSkipped) {
+		t.Errorf("skipped message returned %v", err)
+	}
+}
+
+func TestRewardHandlerCanceled(t *testing.T) {
+	var tts, provider = newTestTTS(t, Config{})
+	var handler = tts.RewardHandler()
+
+	// Message still in the queue when the handler times out is removed, it won't be read after the refund
+	var playing = add(t, tts, "wait")
+	provider.wait(t, "wait")
+	var ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	if err := handler(ctx, rewards.Redemption{Input: "queued"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("timed out handler returned %v", err)
+	}
+	if tts.Pending() != 0 {
+		t.Errorf("%d messages are waiting after the handler timed out", tts.Pending())
+	}
+	close(provider.release)
+	if err := result(t, playing); err != nil {
+		t.Fatal(err)
+	}
+
+	// Played message is skipped
+	ctx, cancel = context.WithCancel(context.Background())
+	var canceled = make(chan error, 1)
+	go func() { canceled <- handler(ctx, rewards.Redemption{Input: "long"}) }()
+	provider.wait(t, "long")
+	cancel()
+	if err := result(t, canceled); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled handler returned %v", err)
+	}
+	var next = add(t, tts, "next")
+	provider.wait(t, "next")
+	if err := result(t, next); err != nil {
+		t.Errorf("next message finished with %v", err)
+	}
+	if provider.received() {
+		t.Error("removed message was read")
+	}
+}
+
+func TestParseVoice(t *testing.T) {
+	var tts, _ = newTestTTS(t, Config{})
+	var tests = []struct {
+		text, voice, msg string
+	}{
+		{"hello", "", "hello"},
+		{"amy: hello", "Amy", "hello"},
+		{" Brian :hi: there", "Brian", "hi: there"},
+		{"note: hello", "", "note: hello"},
+	}
+	for _, test := range tests {
+		if voice, msg := tts.ParseVoice(test.text); voice != test.voice || msg != test.msg {
+			t.Errorf("ParseVoice(%q) returned %q, %q", test.text, voice, msg)
+		}
+	}
+}
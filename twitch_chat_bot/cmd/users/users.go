@@ -0,0 +1,356 @@
+package users
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"twitch_chat_bot/cmd/chat"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Viewer state stored in SQLite database.
+// Chatters are identified by user ID (display name can change), separately in every channel.
+// Every chat message updates last seen time, message count and display name of the chatter.
+// Watch time is accrued while chatting: time between two messages is added to the watch time
+// if the chatter was active (the gap is shorter than ActiveWindow).
+// Watch time points are awarded for every whole minute of the total watch time, so the seconds left over
+// from one message carry over to the next one.
+// Chatters earn points for messages and watch time, points can be checked and given with chat commands.
+// On Windows SQLite requires GCC to build: https://github.com/mattn/go-sqlite3?tab=readme-ov-file#windows
+
+const leaderboardSize = 5 // Amount of chatters shown by the leaderboard command
+
+var ErrUserNotFound = errors.New("user not found")
+var ErrNotEnoughPoints = errors.New("not enough points")
+
+// User store configuration.
+type Config struct {
+	PointsPerMessage int              // Points for every chat message
+	PointsPerMinute  int              // Points for every minute of watch time
+	ActiveWindow     time.Duration    // Maximum time between messages that counts as watch time, 0 means 10 minutes
+	Clock            func() time.Time // Time source, time.Now if nil
+}
+
+// Chatter state in a channel.
+type User struct {
+	ID        int64  // Chatter ID
+	Channel   string // Channel name
+	Name      string // Last known display name
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Messages  int           // Amount of chat messages
+	WatchTime time.Duration // Accrued watch time
+	Points    int64
+}
+
+// Store of chatters state.
+type Store struct {
+	db     *sql.DB
+	config Config
+	mutex  sync.Mutex
+}
+
+// Opens user store database. If the database file is not found, new file is created.
+func Open(path string, config Config) (*Store, error) {
+	if config.ActiveWindow <= 0 {
+		config.ActiveWindow = time.Minute * 10
+	}
+	if config.Clock == nil {
+		config.Clock = time.Now
+	}
+
+	var db, err = sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec(`
+CREATE TABLE IF NOT EXISTS users (
+	channel TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	user_name TEXT NOT NULL,
+	first_seen INTEGER NOT NULL,
+	last_seen INTEGER NOT NULL,
+	messages INTEGER NOT NULL DEFAULT 0,
+	watch_time INTEGER NOT NULL DEFAULT 0,
+	points INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (channel, user_id));
+CREATE INDEX IF NOT EXISTS users_name ON users (channel, user_name COLLATE NOCASE);
+CREATE INDEX IF NOT EXISTS users_points ON users (channel, points);`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db, config: config}, nil
+}
+
+// Closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Starts tracking chatters of the client. Returns subscription ID that can be used to unsubscribe.
+func (s *Store) Attach(client *chat.Client) int {
+	return client.Subscribe(func(event chat.Event) {
+		var e, ok = event.(*chat.MessageEvent)
+		if !ok || e.Message.Command != "PRIVMSG" || e.Metadata.UserID == 0 {
+			return
+		}
+		var err = s.Seen(e.Channel, e.Metadata.UserID, e.Metadata.UserName)
+		if err != nil {
+			slog.Error("User store error, when updating the chatter.", "Err", err)
+		}
+	})
+}
+
+// Records chat message of the chatter, updating it's state and awarding points.
+func (s *Store) Seen(channel string, userID int64, name string) error {
+	var now = s.config.Clock()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var tx, err = s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldName string
+	var lastSeen, watchTime int64
+	err = tx.QueryRow("SELECT user_name, last_seen, watch_time FROM users WHERE channel = ? AND user_id = ?;",
+		channel, userID).Scan(&oldName, &lastSeen, &watchTime)
+	if errors.Is(err, sql.ErrNoRows) {
+		_, err = tx.Exec("INSERT INTO users (channel, user_id, user_name, first_seen, last_seen, messages, points) VALUES (?, ?, ?, ?, ?, 1, ?);",
+			channel, userID, name, now.UnixMilli(), now.UnixMilli(), s.config.PointsPerMessage)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	} else if err != nil {
+		return err
+	}
+
+	if len(name) > 0 && oldName != name {
+		slog.Info("Chatter changed name", "Channel", channel, "UserID", userID, "OldName", oldName, "Name", name)
+	} else {
+		name = oldName
+	}
+	var watched time.Duration
+	if gap := now.Sub(time.UnixMilli(lastSeen)); gap > 0 && gap <= s.config.ActiveWindow {
+		watched = gap
+	}
+	// Points for minutes completed by this message, the leftover counts towards the next minute
+	var minutes = (watchTime+watched.Milliseconds())/time.Minute.Milliseconds() - watchTime/time.Minute.Milliseconds()
+	var points = int64(s.config.PointsPerMessage) + minutes*int64(s.config.PointsPerMinute)
+	_, err = tx.Exec(`UPDATE users SET user_name = ?, last_seen = ?, messages = messages + 1,
+watch_time = watch_time + ?, points = points + ? WHERE channel = ? AND user_id = ?;`,
+		name, now.UnixMilli(), watched.Milliseconds(), points, channel, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Returns the chatter with provided ID.
+func (s *Store) User(channel string, userID int64) (User, error) {
+	return s.queryUser("channel = ? AND user_id = ?", channel, userID)
+}
+
+// Returns the chatter with provided display name (case insensitive, "@" prefix is ignored).
+func (s *Store) UserByName(channel string, name string) (User, error) {
+	return s.queryUser("channel = ? AND user_name = ? COLLATE NOCASE ORDER BY last_seen DESC", channel, strings.TrimPrefix(name, "@"))
+}
+
+// Adds points to the chatter (or removes them if amount is negative). Returns new amount of points.
+func (s *Store) AddPoints(channel string, userID int64, amount int64) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var points int64
+	var err = s.db.QueryRow("UPDATE users SET points = points + ? WHERE channel = ? AND user_id = ? RETURNING points;",
+		amount, channel, userID).Scan(&points)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrUserNotFound
+	}
+	return points, err
+}
+
+// Moves points from one chatter to another.
+func (s *Store) Transfer(channel string, fromID, toID int64, amount int64) error {
+	if amount <= 0 {
+		return errors.New("amount has to be greater than 0")
+	}
+	if fromID == toID {
+		return errors.New("can't give points to yourself")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var tx, err = s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var points int64
+	err = tx.QueryRow("SELECT points FROM users WHERE channel = ? AND user_id = ?;", channel, fromID).Scan(&points)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUserNotFound
+	} else if err != nil {
+		return err
+	}
+	if points < amount {
+		return ErrNotEnoughPoints
+	}
+
+	result, err := tx.Exec("UPDATE users SET points = points + ? WHERE channel = ? AND user_id = ?;", amount, channel, toID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	_, err = tx.Exec("UPDATE users SET points = points - ? WHERE channel = ? AND user_id = ?;", amount, channel, fromID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Returns chatters with the most points in the channel.
+func (s *Store) Leaderboard(channel string, limit int) ([]User, error) {
+	var rows, err = s.db.Query(`SELECT user_id, channel, user_name, first_seen, last_seen, messages, watch_time, points
+FROM users WHERE channel = ? ORDER BY points DESC, user_id LIMIT ?;`, channel, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u, err = scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// Returns the first chatter matching the condition.
+func (s *Store) queryUser(condition string, args ...any) (User, error) {
+	var row = s.db.QueryRow(`SELECT user_id, channel, user_name, first_seen, last_seen, messages, watch_time, points
+FROM users WHERE `+condition+" LIMIT 1;", args...)
+	var u, err = scanUser(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return u, ErrUserNotFound
+	}
+	return u, err
+}
+
+// Reads the chatter from the row.
+func scanUser(row interface{ Scan(dest ...any) error }) (User, error) {
+	var u User
+	var firstSeen, lastSeen, watchTime int64
+	var err = row.Scan(&u.ID, &u.Channel, &u.Name, &firstSeen, &lastSeen, &u.Messages, &watchTime, &u.Points)
+	u.FirstSeen = time.UnixMilli(firstSeen)
+	u.LastSeen = time.UnixMilli(lastSeen)
+	u.WatchTime = time.Duration(watchTime) * time.Millisecond
+	return u, err
+}
+
+// Registers points chat commands: !points [name], !give <name> <amount> and !leaderboard.
+func (s *Store) RegisterCommands(client *chat.Client) error {
+	return errors.Join(
+		client.RegisterCommand(chat.Command{
+			Name:         "points",
+			UserCooldown: time.Second * 10,
+			Handler:      s.pointsCommand,
+		}),
+		client.RegisterCommand(chat.Command{
+			Name:         "give",
+			UserCooldown: time.Second * 5,
+			Handler:      s.giveCommand,
+		}),
+		client.RegisterCommand(chat.Command{
+			Name:     "leaderboard",
+			Aliases:  []string{"top"},
+			Cooldown: time.Second * 30,
+			Handler:  s.leaderboardCommand,
+		}),
+	)
+}
+
+// Responds with points of the chatter or of provided chatter.
+func (s *Store) pointsCommand(ctx *chat.CommandContext) {
+	var user User
+	var err error
+	if len(ctx.Args) > 0 {
+		user, err = s.UserByName(ctx.Metadata.Channel, ctx.Args[0])
+	} else {
+		user, err = s.User(ctx.Metadata.Channel, ctx.Metadata.UserID)
+	}
+	if errors.Is(err, ErrUserNotFound) {
+		ctx.Reply("I don't know that chatter yet.")
+		return
+	} else if err != nil {
+		slog.Error("User store error, when reading points.", "Err", err)
+		return
+	}
+	ctx.Reply(fmt.Sprintf("%s has %d points.", user.Name, user.Points))
+}
+
+// Gives points of the chatter to another chatter.
+func (s *Store) giveCommand(ctx *chat.CommandContext) {
+	if len(ctx.Args) < 2 {
+		ctx.Reply(fmt.Sprintf("Usage: %sgive <name> <amount>", chat.CommandPrefix))
+		return
+	}
+	var amount, err = strconv.ParseInt(ctx.Args[1], 10, 64)
+	if err != nil || amount <= 0 {
+		ctx.Reply("Amount has to be a positive number.")
+		return
+	}
+	target, err := s.UserByName(ctx.Metadata.Channel, ctx.Args[0])
+	if errors.Is(err, ErrUserNotFound) {
+		ctx.Reply("I don't know that chatter yet.")
+		return
+	} else if err != nil {
+		slog.Error("User store error, when giving points.", "Err", err)
+		return
+	}
+
+	err = s.Transfer(ctx.Metadata.Channel, ctx.Metadata.UserID, target.ID, amount)
+	switch {
+	case err == nil:
+		ctx.Reply(fmt.Sprintf("Gave %d points to %s.", amount, target.Name))
+	case errors.Is(err, ErrNotEnoughPoints):
+		ctx.Reply("You don't have enough points.")
+	case errors.Is(err, ErrUserNotFound):
+		ctx.Reply("I don't know that chatter yet.")
+	default:
+		ctx.Reply(err.Error())
+	}
+}
+
+// Responds with chatters with the most points.
+func (s *Store) leaderboardCommand(ctx *chat.CommandContext) {
+	var users, err = s.Leaderboard(ctx.Metadata.Channel, leaderboardSize)
+	if err != nil {
+		slog.Error("User store error, when reading leaderboard.", "Err", err)
+		return
+	}
+	if len(users) == 0 {
+		ctx.Reply("Nobody has any points yet.")
+		return
+	}
+	var parts = make([]string, len(users))
+	for i, u := range users {
+		parts[i] = fmt.Sprintf("%d. %s (%d)", i+1, u.Name, u.Points)
+	}
+	ctx.Reply(strings.Join(parts, ", "))
+}
@@ -0,0 +1,151 @@
+package users
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Fake clock that only moves when advanced.
+type fakeClock struct {
+	t time.Time
+}
+
+func (f *fakeClock) Now() time.Time          { return f.t }
+func (f *fakeClock) Advance(d time.Duration) { f.t = f.t.Add(d) }
+
+// Opens user store in temporary directory, driven by returned fake clock.
+func openTestStore(t *testing.T, config Config) (*Store, *fakeClock) {
+	t.Helper()
+	var clock = &fakeClock{t: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	config.Clock = clock.Now
+	var s, err = Open(filepath.Join(t.TempDir(), "users.db"), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, clock
+}
+
+// Records message of the chatter, failing the test on error.
+func seen(t *testing.T, s *Store, channel string, userID int64, name string) {
+	t.Helper()
+	if err := s.Seen(channel, userID, name); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Returns the chatter, failing the test on error.
+func user(t *testing.T, s *Store, channel string, userID int64) User {
+	t.Helper()
+	var u, err = s.User(channel, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestWatchTimePoints(t *testing.T) {
+	var s, clock = openTestStore(t, Config{PointsPerMessage: 1, PointsPerMinute: 10})
+
+	// Messages every 40 seconds, none of the gaps is a whole minute, but together they are
+	seen(t, s, "channel", 1, "Viewer")
+	for i := 0; i < 5; i++ {
+		clock.Advance(time.Second * 40)
+		seen(t, s, "channel", 1, "Viewer")
+	}
+	var u = user(t, s, "channel", 1)
+	if u.WatchTime != time.Second*200 || u.Messages != 6 {
+		t.Errorf("watch time %s and %d messages, expected 3m20s and 6", u.WatchTime, u.Messages)
+	}
+	if u.Points != 6+3*10 {
+		t.Errorf("%d points, expected 36 (6 messages, 3 whole minutes)", u.Points)
+	}
+
+	// Leftover 20 seconds complete next minute
+	clock.Advance(time.Second * 40)
+	seen(t, s, "channel", 1, "Viewer")
+	if u = user(t, s, "channel", 1); u.Points != 7+4*10 {
+		t.Errorf("%d points, expected 47", u.Points)
+	}
+
+	// Gap longer than the active window isn't watch time
+	clock.Advance(time.Hour)
+	seen(t, s, "channel", 1, "Viewer")
+	if u = user(t, s, "channel", 1); u.WatchTime != time.Second*240 || u.Points != 8+4*10 {
+		t.Errorf("watch time %s and %d points after inactivity", u.WatchTime, u.Points)
+	}
+	if !u.LastSeen.Equal(clock.Now()) {
+		t.Errorf("last seen %s, expected %s", u.LastSeen, clock.Now())
+	}
+}
+
+func TestSeen(t *testing.T) {
+	var s, clock = openTestStore(t, Config{PointsPerMessage: 2})
+	var start = clock.Now()
+	seen(t, s, "channel", 1, "Viewer")
+	seen(t, s, "other", 1, "Viewer")
+	clock.Advance(time.Minute)
+	seen(t, s, "channel", 1, "NewName")
+	seen(t, s, "channel", 1, "")
+
+	var u = user(t, s, "channel", 1)
+	if u.Name != "NewName" || u.Messages != 3 || u.Points != 6 || !u.FirstSeen.Equal(start) {
+		t.Errorf("unexpected user %+v", u)
+	}
+	if u = user(t, s, "other", 1); u.Messages != 1 || u.Name != "Viewer" {
+		t.Errorf("chatter in other channel %+v", u)
+	}
+	if u, err := s.UserByName("channel", "@newname"); err != nil || u.ID != 1 {
+		t.Errorf("UserByName returned %+v, %v", u, err)
+	}
+	if _, err := s.UserByName("channel", "Viewer"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("old name found, error %v", err)
+	}
+}
+
+func TestPoints(t *testing.T) {
+	var s, _ = openTestStore(t, Config{PointsPerMessage: 10})
+	seen(t, s, "channel", 1, "A")
+	seen(t, s, "channel", 2, "B")
+	seen(t, s, "channel", 3, "C")
+
+	if points, err := s.AddPoints("channel", 3, 100); err != nil || points != 110 {
+		t.Errorf("AddPoints returned %d, %v", points, err)
+	}
+	if _, err := s.AddPoints("channel", 4, 100); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("AddPoints to unknown chatter returned %v", err)
+	}
+
+	if err := s.Transfer("channel", 1, 2, 5); err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		from, to, amount int64
+		err              error
+	}{
+		{1, 2, 6, ErrNotEnoughPoints},
+		{1, 4, 1, ErrUserNotFound},
+		{4, 1, 1, ErrUserNotFound},
+		{1, 1, 1, nil}, // Any error
+		{1, 2, 0, nil},
+	}
+	for _, test := range tests {
+		var err = s.Transfer("channel", test.from, test.to, test.amount)
+		if err == nil || (test.err != nil && !errors.Is(err, test.err)) {
+			t.Errorf("Transfer(%d, %d, %d) returned %v, expected %v", test.from, test.to, test.amount, err, test.err)
+		}
+	}
+	if a, b := user(t, s, "channel", 1), user(t, s, "channel", 2); a.Points != 5 || b.Points != 15 {
+		t.Errorf("points after transfers %d and %d, expected 5 and 15", a.Points, b.Points)
+	}
+
+	var leaderboard, err = s.Leaderboard("channel", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaderboard) != 2 || leaderboard[0].Name != "C" || leaderboard[1].Name != "B" {
+		t.Errorf("unexpected leaderboard %+v", leaderboard)
+	}
+}
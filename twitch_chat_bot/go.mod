@@ -1,3 +1,18 @@
 module twitch_chat_bot
 
 go 1.22.5
+
+require github.com/gorilla/websocket v1.5.3
+
+require (
+	github.com/gopxl/beep v1.4.1
+	github.com/mattn/go-sqlite3 v1.14.22
+)
+
+require (
+	github.com/ebitengine/oto/v3 v3.1.0 // indirect
+	github.com/ebitengine/purego v0.7.1 // indirect
+	github.com/hajimehoshi/go-mp3 v0.3.4 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	golang.org/x/sys v0.12.0 // indirect
+)